@@ -0,0 +1,135 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"slices"
+	"strings"
+)
+
+// A Duplicate is a taxon name
+// found in more than one tree
+// of a collection.
+type Duplicate struct {
+	// Taxon is the name of the taxon
+	Taxon string
+
+	// Trees are the names of the trees
+	// that contain the taxon
+	Trees []string
+
+	// MinAge and MaxAge are the youngest and oldest ages
+	// (in years)
+	// of the node of the taxon
+	// in the trees.
+	MinAge int64
+	MaxAge int64
+
+	// Placements is the number of different placements
+	// of the taxon in the trees.
+	// The placement of a taxon is defined
+	// by the terminals of its sister group
+	// that are shared by all the trees with the taxon.
+	Placements int
+}
+
+// Duplicates returns the taxon names
+// that are found in more than one tree
+// of the collection,
+// sorted by taxon name.
+func (c *Collection) Duplicates() []Duplicate {
+	trees := make(map[string][]*Tree)
+	for _, nm := range c.Names() {
+		t := c.trees[nm]
+		for tx := range t.taxa {
+			trees[tx] = append(trees[tx], t)
+		}
+	}
+
+	var dups []Duplicate
+	for tx, ts := range trees {
+		if len(ts) < 2 {
+			continue
+		}
+
+		d := Duplicate{
+			Taxon:  tx,
+			MinAge: ts[0].taxa[tx].age,
+			MaxAge: ts[0].taxa[tx].age,
+		}
+		for _, t := range ts {
+			d.Trees = append(d.Trees, t.name)
+			a := t.taxa[tx].age
+			if a < d.MinAge {
+				d.MinAge = a
+			}
+			if a > d.MaxAge {
+				d.MaxAge = a
+			}
+		}
+		d.Placements = placements(tx, ts)
+		dups = append(dups, d)
+	}
+
+	slices.SortFunc(dups, func(a, b Duplicate) int {
+		return strings.Compare(a.Taxon, b.Taxon)
+	})
+	return dups
+}
+
+// Placements returns the number of different placements
+// of a taxon in a set of trees.
+func placements(tx string, ts []*Tree) int {
+	// terminals shared by all trees
+	shared := make(map[string]int)
+	for _, t := range ts {
+		for _, n := range t.taxa {
+			if n.isTerm() {
+				shared[n.taxon]++
+			}
+		}
+	}
+
+	keys := make(map[string]bool)
+	for _, t := range ts {
+		n := t.taxa[tx]
+		if n.parent == nil {
+			continue
+		}
+		in := make(map[string]bool)
+		for _, term := range n.terms(nil) {
+			in[term] = true
+		}
+
+		var sister []string
+		for _, term := range n.parent.terms(nil) {
+			if in[term] || shared[term] != len(ts) {
+				continue
+			}
+			sister = append(sister, term)
+		}
+		if len(sister) == 0 {
+			continue
+		}
+		slices.Sort(sister)
+		keys[strings.Join(sister, "\n")] = true
+	}
+	if len(keys) == 0 {
+		return 1
+	}
+	return len(keys)
+}
+
+// Terms returns the names of the terminals
+// descendant from a node.
+func (n *node) terms(ts []string) []string {
+	if n.isTerm() {
+		return append(ts, n.taxon)
+	}
+	for _, c := range n.children {
+		ts = c.terms(ts)
+	}
+	return ts
+}
@@ -0,0 +1,55 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/timetree"
+)
+
+func TestDuplicates(t *testing.T) {
+	data := dinoTree + `other	0	-1	200000000	
+other	1	0	150000000	
+other	2	1	66000000	Tyrannosaurus rex
+other	3	1	140000000	Ceratosaurus nasicornis
+other	4	0	0	Passer domesticus
+other	5	0	100000000	Velociraptor mongoliensis
+`
+	c, err := timetree.ReadTSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("duplicates: unexpected error: %v", err)
+	}
+
+	want := []timetree.Duplicate{
+		{
+			Taxon:      "Ceratosaurus nasicornis",
+			Trees:      []string{"dinos", "other"},
+			MinAge:     140_000_000,
+			MaxAge:     145_000_000,
+			Placements: 1,
+		},
+		{
+			Taxon:      "Passer domesticus",
+			Trees:      []string{"dinos", "other"},
+			MinAge:     0,
+			MaxAge:     0,
+			Placements: 1,
+		},
+		{
+			Taxon:      "Tyrannosaurus rex",
+			Trees:      []string{"dinos", "other"},
+			MinAge:     66_000_000,
+			MaxAge:     68_000_000,
+			Placements: 2,
+		},
+	}
+	got := c.Duplicates()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("duplicates: got %v, want %v", got, want)
+	}
+}
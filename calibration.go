@@ -0,0 +1,307 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Calibration is an age constraint
+// of a clade.
+//
+// A calibration is defined by the name of the clade,
+// or by a list of taxa,
+// instead of a node ID,
+// so the same calibration can be used
+// in different versions of a tree
+// (for example,
+// after the tree was formatted,
+// or imported again).
+type Calibration struct {
+	// Tree is the name of the tree
+	// in which the calibration is used.
+	// If empty,
+	// the calibration is used in any tree.
+	Tree string
+
+	// Clade is the name of the clade.
+	Clade string
+
+	// Taxa are the names of the taxa
+	// (terminals or named internal nodes)
+	// that define the clade.
+	// The clade is the most recent common ancestor
+	// of the taxa.
+	// If empty,
+	// the clade is the node with the name of the clade.
+	Taxa []string
+
+	// Min and Max are the minimum and maximum ages
+	// (in years)
+	// of the clade.
+	// If there is no maximum age,
+	// Max is math.MaxInt64.
+	Min int64
+	Max int64
+}
+
+var calibrationFields = []string{
+	"clade",
+	"taxa",
+	"min",
+	"max",
+}
+
+// Node returns the ID of the node
+// of the calibration in a tree.
+// It returns -1 if the calibration is defined
+// for a different tree,
+// or the clade is not in the tree.
+// If the clade is defined by taxa,
+// all the taxa must be in the tree.
+func (c Calibration) Node(t *Tree) int {
+	if c.Tree != "" && c.Tree != t.name {
+		return -1
+	}
+	if len(c.Taxa) == 0 {
+		id, ok := t.TaxNode(c.Clade)
+		if !ok {
+			return -1
+		}
+		return id
+	}
+
+	taxa := make([]string, 0, len(c.Taxa))
+	for _, tax := range c.Taxa {
+		n, ok := t.taxa[canon(tax)]
+		if !ok {
+			return -1
+		}
+		taxa = append(taxa, n.taxon)
+	}
+	return t.MRCA(taxa...)
+}
+
+// Calibration returns a calibration
+// for the indicated node,
+// with the indicated age range
+// (in years).
+// The clade of the calibration
+// is defined by the name of the node
+// (if the node is named),
+// and by two taxa whose most recent common ancestor
+// is the node
+// (or the name of the node, if it is a terminal).
+// It returns an error if the node is not in the tree.
+func (t *Tree) Calibration(id int, min, max int64) (Calibration, error) {
+	n, ok := t.nodes[id]
+	if !ok {
+		return Calibration{}, fmt.Errorf("node ID %d not in tree %q", id, t.name)
+	}
+
+	c := Calibration{
+		Clade: n.taxon,
+		Min:   min,
+		Max:   max,
+	}
+	if n.isTerm() {
+		c.Taxa = []string{n.taxon}
+		return c, nil
+	}
+
+	// the first terminal of each child
+	// in alphabetical order
+	k := t.stats().keys
+	var firsts []string
+	for _, d := range n.children {
+		firsts = append(firsts, k.first[d])
+	}
+	slices.Sort(firsts)
+	c.Taxa = firsts[:2]
+	return c, nil
+}
+
+// ReadCalibrations reads a list of calibrations
+// from a TSV file.
+//
+// The TSV must contain the following fields:
+//
+//	-clade, the name of the clade
+//	-taxa, the names of the taxa that define the clade,
+//	    separated by commas
+//	-min, the minimum age of the clade (in million years)
+//	-max, the maximum age of the clade (in million years)
+//
+// Optionally,
+// the field "tree" can be used
+// to restrict a calibration to a tree.
+// Empty fields at the end of a row
+// can be omitted.
+// If the taxa field is empty,
+// the clade is the node with the name of the clade.
+// An empty minimum or maximum age
+// is not constrained.
+//
+// Here is an example file:
+//
+//	# calibrations
+//	clade	taxa	min	max
+//	Avialae	Archaeopteryx lithographica,Passer domesticus	150	170
+//	Theropoda		200
+//
+// Any returned error wraps ErrSyntax,
+// or ErrIO.
+func ReadCalibrations(r io.Reader) ([]Calibration, error) {
+	cals, err := readCalibrations(r)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return cals, nil
+}
+
+func readCalibrations(r io.Reader) ([]Calibration, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("while reading header: %w", err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(strings.TrimSpace(h))
+		fields[h] = i
+	}
+	for _, h := range calibrationFields {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("%w: expecting field %q", ErrSyntax, h)
+		}
+	}
+
+	var cals []Calibration
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on row %d: %w", ln, err)
+		}
+
+		// empty trailing fields can be omitted
+		get := func(f string) string {
+			i, ok := fields[f]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return row[i]
+		}
+
+		c := Calibration{
+			Clade: strings.Join(strings.Fields(get("clade")), " "),
+			Tree:  strings.ToLower(strings.Join(strings.Fields(get("tree")), " ")),
+			Max:   math.MaxInt64,
+		}
+		for _, tax := range strings.Split(get("taxa"), ",") {
+			tax = strings.Join(strings.Fields(tax), " ")
+			if tax == "" {
+				continue
+			}
+			c.Taxa = append(c.Taxa, tax)
+		}
+		if c.Clade == "" && len(c.Taxa) == 0 {
+			return nil, fmt.Errorf("%w: on row %d: undefined clade", ErrSyntax, ln)
+		}
+
+		f := "min"
+		if v := strings.TrimSpace(get(f)); v != "" {
+			a, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("on row %d: field %q: %w", ln, f, err)
+			}
+			c.Min = int64(a * millionYears)
+		}
+		f = "max"
+		if v := strings.TrimSpace(get(f)); v != "" {
+			a, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("on row %d: field %q: %w", ln, f, err)
+			}
+			c.Max = int64(a * millionYears)
+		}
+		if c.Min < 0 || c.Max < c.Min {
+			return nil, fmt.Errorf("%w: on row %d: invalid age range", ErrSyntax, ln)
+		}
+		cals = append(cals, c)
+	}
+	return cals, nil
+}
+
+// WriteCalibrations writes a list of calibrations
+// as a TSV file,
+// using the format of ReadCalibrations.
+// The field "tree" is only written
+// if a calibration is restricted to a tree.
+func WriteCalibrations(w io.Writer, cals []Calibration) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# calibrations\n")
+	tab := csv.NewWriter(bw)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	withTree := slices.ContainsFunc(cals, func(c Calibration) bool {
+		return c.Tree != ""
+	})
+	header := slices.Clip(calibrationFields)
+	if withTree {
+		header = append([]string{"tree"}, header...)
+	}
+	if err := tab.Write(header); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+
+	for _, c := range cals {
+		maxAge := ""
+		if c.Max < math.MaxInt64 {
+			maxAge = strconv.FormatFloat(float64(c.Max)/millionYears, 'f', -1, 64)
+		}
+		row := []string{
+			c.Clade,
+			strings.Join(c.Taxa, ","),
+			strconv.FormatFloat(float64(c.Min)/millionYears, 'f', -1, 64),
+			maxAge,
+		}
+		if withTree {
+			row = append([]string{c.Tree}, row...)
+		}
+		if err := tab.Write(row); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/timetree"
+)
+
+func TestReadCalibrations(t *testing.T) {
+	data := `# calibrations
+clade	taxa	min	max	tree
+Avialae	Archaeopteryx lithographica, Passer domesticus	150	170
+Theropoda	Tyrannosaurus rex,Passer domesticus	200		dinos
+Passer	Passer domesticus		1
+Neornithes	Passer domesticus,Struthio camelus	66	100
+Ceratosauria	Carnotaurus sastrei,Ceratosaurus nasicornis	100	200	other
+`
+	cals, err := timetree.ReadCalibrations(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("calibrations: unexpected error: %v", err)
+	}
+
+	want := []timetree.Calibration{
+		{Clade: "Avialae", Taxa: []string{"Archaeopteryx lithographica", "Passer domesticus"}, Min: 150_000_000, Max: 170_000_000},
+		{Tree: "dinos", Clade: "Theropoda", Taxa: []string{"Tyrannosaurus rex", "Passer domesticus"}, Min: 200_000_000, Max: math.MaxInt64},
+		{Clade: "Passer", Taxa: []string{"Passer domesticus"}, Max: 1_000_000},
+		{Clade: "Neornithes", Taxa: []string{"Passer domesticus", "Struthio camelus"}, Min: 66_000_000, Max: 100_000_000},
+		{Tree: "other", Clade: "Ceratosauria", Taxa: []string{"Carnotaurus sastrei", "Ceratosaurus nasicornis"}, Min: 100_000_000, Max: 200_000_000},
+	}
+	if !reflect.DeepEqual(cals, want) {
+		t.Errorf("calibrations: got %v, want %v", cals, want)
+	}
+
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("calibrations: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	nodes := []int{8, 6, 10, -1, -1}
+	for i, cal := range cals {
+		if got := cal.Node(d); got != nodes[i] {
+			t.Errorf("calibrations: node of %q: got %d, want %d", cal.Clade, got, nodes[i])
+		}
+	}
+
+	// a clade defined by name
+	if err := d.SetName(6, "Theropoda"); err != nil {
+		t.Fatalf("calibrations: unexpected error: %v", err)
+	}
+	named := timetree.Calibration{Clade: "theropoda", Max: math.MaxInt64}
+	if got := named.Node(d); got != 6 {
+		t.Errorf("calibrations: named clade: got %d, want %d", got, 6)
+	}
+
+	// node IDs changed after format
+	d.Format()
+	for i, cal := range cals[:3] {
+		id := cal.Node(d)
+		if id < 0 {
+			t.Errorf("calibrations: after format: clade %q not found", cal.Clade)
+			continue
+		}
+		if got, want := d.Age(id), c.Tree("dinos").Age(nodes[i]); got != want {
+			t.Errorf("calibrations: after format: clade %q: age %d, want %d", cal.Clade, got, want)
+		}
+	}
+
+	bad := map[string]string{
+		"no header":   "Avialae\tPasser domesticus\t150\t170\n",
+		"no clade":    "clade\ttaxa\tmin\tmax\n\t\t150\t170\n",
+		"bad range":   "clade\ttaxa\tmin\tmax\nAvialae\tPasser domesticus\t170\t150\n",
+		"bad number":  "clade\ttaxa\tmin\tmax\nAvialae\tPasser domesticus\tx\t150\n",
+		"missing max": "clade\ttaxa\tmin\nAvialae\tPasser domesticus\t150\n",
+	}
+	for name, in := range bad {
+		_, err := timetree.ReadCalibrations(strings.NewReader(in))
+		if !errors.Is(err, timetree.ErrSyntax) {
+			t.Errorf("calibrations: %s: got error %v, want %v", name, err, timetree.ErrSyntax)
+		}
+	}
+}
+
+func TestWriteCalibrations(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("write calibrations: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+	if err := d.SetName(3, "Ceratosauria"); err != nil {
+		t.Fatalf("write calibrations: unexpected error: %v", err)
+	}
+
+	var cals []timetree.Calibration
+	for _, id := range []int{3, 6, 9} {
+		cal, err := d.Calibration(id, d.Age(id)-1_000_000, d.Age(id)+1_000_000)
+		if err != nil {
+			t.Fatalf("write calibrations: unexpected error: %v", err)
+		}
+		if got := cal.Node(d); got != id {
+			t.Errorf("write calibrations: node %d: got %d", id, got)
+		}
+		cals = append(cals, cal)
+	}
+	cals[1].Tree = "dinos"
+	cals[1].Max = math.MaxInt64
+
+	wantTaxa := [][]string{
+		{"Carnotaurus sastrei", "Ceratosaurus nasicornis"},
+		{"Archaeopteryx lithographica", "Tyrannosaurus rex"},
+		{"Archaeopteryx lithographica"},
+	}
+	for i, cal := range cals {
+		if !reflect.DeepEqual(cal.Taxa, wantTaxa[i]) {
+			t.Errorf("write calibrations: taxa of %d: got %v, want %v", i, cal.Taxa, wantTaxa[i])
+		}
+	}
+	if cals[0].Clade != "Ceratosauria" {
+		t.Errorf("write calibrations: clade: got %q, want %q", cals[0].Clade, "Ceratosauria")
+	}
+
+	if _, err := d.Calibration(20, 0, 0); err == nil {
+		t.Errorf("write calibrations: node 20: expecting error")
+	}
+
+	var buf bytes.Buffer
+	if err := timetree.WriteCalibrations(&buf, cals); err != nil {
+		t.Fatalf("write calibrations: unexpected error: %v", err)
+	}
+	got, err := timetree.ReadCalibrations(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("write calibrations: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, cals) {
+		t.Errorf("write calibrations: got %v, want %v", got, cals)
+	}
+}
@@ -9,11 +9,13 @@ package add
 import (
 	"fmt"
 	"io"
-	"os"
 	"strconv"
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 )
 
 var Command = &command.Command{
@@ -46,7 +48,7 @@ the flag --output, or -o, to define an output file. As this command modifies
 the tree, it is possible that node IDs will be modified in the process.
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      outfile.Locked(&output, run),
 }
 
 var output string
@@ -90,59 +92,51 @@ func run(c *command.Command, args []string) error {
 	if len(args) > 2 {
 		in = args[2]
 	}
-	tc, err := readCollection(c.Stdin(), in)
+	tc, err := infile.Collection(c.Stdin(), in)
 	if err != nil {
 		return err
 	}
+	orig := dryrun.Copy(tc)
 
 	t := tc.Tree(treeName)
 	if t == nil {
 		return fmt.Errorf("tree %q not found", treeName)
 	}
+	if err := infile.CheckUnits(t); err != nil {
+		return err
+	}
 
 	if _, err := t.AddSister(sister, age, int64(brLen*millionYears), toAdd); err != nil {
 		return err
 	}
 	t.Format()
 
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, tc)
+		return nil
+	}
+
 	if err := writeTrees(c.Stdout(), tc); err != nil {
 		return err
 	}
 	return nil
 }
 
-func readCollection(r io.Reader, name string) (*timetree.Collection, error) {
-	if name != "-" {
-		f, err := os.Open(name)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		r = f
-	} else {
-		name = "stdin"
-	}
-
-	c, err := timetree.ReadTSV(r)
-	if err != nil {
-		return nil, fmt.Errorf("while reading file %q: %v", name, err)
-	}
-	return c, nil
-}
-
 func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
 	outName := "stdout"
 	if output != "" {
 		outName = output
-		f, err := os.Create(output)
+		var f *outfile.File
+		f, err = outfile.Create(output)
 		if err != nil {
 			return err
 		}
 		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
+			if err != nil {
+				f.Discard()
+				return
 			}
+			err = f.Close()
 		}()
 		w = f
 	}
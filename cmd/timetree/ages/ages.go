@@ -0,0 +1,118 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package ages implements a command to print
+// the ages of the nodes of the trees in a tree file.
+package ages
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `ages [--internal] [--tree <tree>]
+	[-o|--output <file>] [<tree-file>...]`,
+	Short: "print the ages of the nodes of a tree",
+	Long: `
+Command ages reads one or more tree files in TSV format and prints the age of
+each node of the trees. It is useful to produce calibration tables or
+summaries of divergence times.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+By default, the ages of all the nodes of all the trees will be printed. Use
+the flag --internal to print only the internal nodes. Use the flag --tree to
+print the nodes of a single tree.
+
+The output is a TSV table with the following columns:
+
+	-tree   the name of the tree
+	-node   the ID of the node
+	-taxon  the name of the node
+	-age    the age of the node, in million years
+
+By default, the table will be printed in the standard output. Use the flag
+--output, or -o, to define an output file.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var internal bool
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().BoolVar(&internal, "internal", false, "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	names := coll.Names()
+	if treeName != "" {
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "tree\tnode\ttaxon\tage\n")
+	for _, tn := range names {
+		t := coll.Tree(tn)
+		for _, id := range t.Nodes() {
+			if internal && t.IsTerm(id) {
+				continue
+			}
+			fmt.Fprintf(bw, "%s\t%d\t%s\t%.6f\n", t.Name(), id, t.Taxon(id), float64(t.Age(id))/millionYears)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
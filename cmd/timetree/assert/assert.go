@@ -0,0 +1,327 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package assert implements a command to verify
+// a list of expected facts
+// in a tree collection.
+package assert
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+)
+
+var Command = &command.Command{
+	Usage: `assert [--tree <tree>] [--calibration <file>] [-v|--verbose]
+	<assert-file> <treefile>...`,
+	Short: "verify expected facts of a tree",
+	Long: `
+Command assert reads a file with a list of expected facts (assertions) and one
+or more trees in TSV format, and verifies that the assertions are true in each
+tree. It is useful as a regression test of a curated tree maintained in a
+repository.
+
+The first argument of the command is the assertion file. The following
+arguments are the tree files.
+
+The assertion file is a TSV file without header. Empty lines and lines
+starting with '#' are ignored. The first column of each row is the kind of
+assertion, and the other columns are the arguments of the assertion. The
+following assertions are recognized:
+
+	taxon <taxon>...
+		all the taxa are present in the tree.
+	mono <taxon>...
+		the taxa are present in the tree, and they form a monophyletic
+		group.
+	age <min> <max> <taxon>...
+		the taxa are present in the tree, and the age of their most
+		recent common ancestor, in million years, is between min and
+		max (inclusive).
+
+For example:
+
+	taxon	Homo sapiens
+	mono	Homo sapiens	Pan troglodytes	Gorilla gorilla
+	age	5	8	Homo sapiens	Pan troglodytes
+
+Use the flag --calibration to verify the age constraints of a calibration
+file, in which the calibrations are defined by clade names (see the
+documentation of the command set for the format of the file). Each
+calibration is verified as an age assertion: the clade must be in the tree,
+and its age must be inside the calibration range. Calibrations restricted to
+a tree are only verified in that tree. If the flag is defined, the assertion
+file can be omitted (use "-" as its name).
+
+By default, the assertions are verified in all the trees. Use the flag --tree
+to verify a single tree.
+
+Each failed assertion will be printed in the standard output. Use the flag
+--verbose, or -v, to print the assertions that passed too. If any assertion
+fails, the command ends with an error.
+	`,
+	SetFlags: setFlags,
+	Run:      run,
+}
+
+var treeName string
+var calFile string
+var verbose bool
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&calFile, "calibration", "", "")
+	c.Flags().BoolVar(&verbose, "verbose", false, "")
+	c.Flags().BoolVar(&verbose, "v", false, "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) < 2 {
+		return c.UsageError("expecting an assertion file and one or more tree files")
+	}
+
+	var asserts []assertion
+	if args[0] != "-" || calFile == "" {
+		var err error
+		asserts, err = readAssertions(args[0])
+		if err != nil {
+			return err
+		}
+	}
+	args = args[1:]
+	if calFile != "" {
+		cals, err := readCalibrations(calFile)
+		if err != nil {
+			return err
+		}
+		asserts = append(asserts, cals...)
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	names := coll.Names()
+	if treeName != "" {
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
+	}
+
+	var failed, total int
+	for _, tn := range names {
+		t := coll.Tree(tn)
+		for _, a := range asserts {
+			if a.cal.Tree != "" && a.cal.Tree != t.Name() {
+				continue
+			}
+			total++
+			if err := a.check(t); err != nil {
+				failed++
+				fmt.Fprintf(c.Stdout(), "FAIL\ttree %q: %s: %v\n", t.Name(), a.label(), err)
+				continue
+			}
+			if verbose {
+				fmt.Fprintf(c.Stdout(), "ok\ttree %q: %s\n", t.Name(), a.label())
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d assertions failed", failed, total)
+	}
+	return nil
+}
+
+// millionYears is used to transform ages
+// from million years to years.
+const millionYears = 1_000_000
+
+// An Assertion is an expected fact of a tree.
+type assertion struct {
+	line int
+	kind string
+	taxa []string
+
+	// age range, in years
+	min, max int64
+
+	// calibration assertions
+	cal timetree.Calibration
+}
+
+// Label returns the position of the assertion
+// in its source file.
+func (a assertion) label() string {
+	if a.kind == "calibration" {
+		name := a.cal.Clade
+		if name == "" {
+			name = strings.Join(a.cal.Taxa, ",")
+		}
+		return fmt.Sprintf("calibration %q", name)
+	}
+	return fmt.Sprintf("line %d: %s", a.line, a.kind)
+}
+
+// Check returns an error
+// if the assertion is false in a tree.
+func (a assertion) check(t *timetree.Tree) error {
+	if a.kind == "calibration" {
+		id := a.cal.Node(t)
+		if id < 0 {
+			return fmt.Errorf("clade not found")
+		}
+		age := t.Age(id)
+		if age < a.cal.Min {
+			return fmt.Errorf("node %d: age %.6f, want at least %.6f", id, float64(age)/millionYears, float64(a.cal.Min)/millionYears)
+		}
+		if age > a.cal.Max {
+			return fmt.Errorf("node %d: age %.6f, want at most %.6f", id, float64(age)/millionYears, float64(a.cal.Max)/millionYears)
+		}
+		return nil
+	}
+
+	var missing []string
+	for _, tax := range a.taxa {
+		if _, ok := t.TaxNode(tax); !ok {
+			missing = append(missing, tax)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("taxa not found: %s", strings.Join(missing, ", "))
+	}
+
+	switch a.kind {
+	case "mono":
+		for _, tax := range a.taxa {
+			if id, _ := t.TaxNode(tax); !t.IsTerm(id) {
+				return fmt.Errorf("taxon %q is not a terminal", tax)
+			}
+		}
+		mrca := t.MRCA(a.taxa...)
+		if n := t.CladeSize(mrca); n != len(a.taxa) {
+			return fmt.Errorf("not monophyletic: most recent common ancestor (node %d) has %d terminals, want %d", mrca, n, len(a.taxa))
+		}
+	case "age":
+		mrca := t.MRCA(a.taxa...)
+		age := t.Age(mrca)
+		if age < a.min || age > a.max {
+			return fmt.Errorf("node %d: age %.6f, want between %.6f and %.6f", mrca, float64(age)/millionYears, float64(a.min)/millionYears, float64(a.max)/millionYears)
+		}
+	}
+	return nil
+}
+
+func readAssertions(name string) ([]assertion, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	var asserts []assertion
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", name, ln, err)
+		}
+
+		kind := strings.ToLower(strings.TrimSpace(row[0]))
+		if kind == "" {
+			continue
+		}
+		a := assertion{
+			line: ln,
+			kind: kind,
+		}
+		fields := row[1:]
+		switch kind {
+		case "taxon", "mono":
+		case "age":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%q: on row %d: assertion %q: expecting minimum and maximum ages", name, ln, kind)
+			}
+			minAge, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q: on row %d: assertion %q: minimum age: %v", name, ln, kind, err)
+			}
+			maxAge, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q: on row %d: assertion %q: maximum age: %v", name, ln, kind, err)
+			}
+			if minAge > maxAge {
+				return nil, fmt.Errorf("%q: on row %d: assertion %q: minimum age %.6f greater than maximum age %.6f", name, ln, kind, minAge, maxAge)
+			}
+			a.min = int64(minAge * millionYears)
+			a.max = int64(maxAge * millionYears)
+			fields = fields[2:]
+		default:
+			return nil, fmt.Errorf("%q: on row %d: unknown assertion %q", name, ln, kind)
+		}
+
+		for _, f := range fields {
+			tax := strings.Join(strings.Fields(f), " ")
+			if tax == "" {
+				continue
+			}
+			a.taxa = append(a.taxa, tax)
+		}
+		if len(a.taxa) == 0 {
+			return nil, fmt.Errorf("%q: on row %d: assertion %q: expecting taxon names", name, ln, kind)
+		}
+		if kind == "mono" && len(a.taxa) < 2 {
+			return nil, fmt.Errorf("%q: on row %d: assertion %q: expecting at least two taxa", name, ln, kind)
+		}
+		asserts = append(asserts, a)
+	}
+	if len(asserts) == 0 {
+		return nil, fmt.Errorf("%q: no assertions defined", name)
+	}
+	return asserts, nil
+}
+
+// ReadCalibrations reads a calibration file
+// as a list of assertions.
+func readCalibrations(name string) ([]assertion, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cals, err := timetree.ReadCalibrations(f)
+	if err != nil {
+		return nil, fmt.Errorf("while reading file %q: %v", name, err)
+	}
+
+	asserts := make([]assertion, 0, len(cals))
+	for _, cal := range cals {
+		asserts = append(asserts, assertion{
+			kind: "calibration",
+			cal:  cal,
+		})
+	}
+	return asserts, nil
+}
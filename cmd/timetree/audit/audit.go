@@ -0,0 +1,117 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package audit implements a command to report
+// taxon names repeated in different trees.
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `audit [--age <value>] [--all]
+	[-o|--output <file>] [<tree-file>...]`,
+	Short: "report taxa repeated in different trees",
+	Long: `
+Command audit reads one or more tree files in TSV format, and reports the taxon
+names that are found in more than one tree, and that have different ages, or
+different placements, in those trees. It is intended as an early warning of
+copy and paste errors in curated tree files.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+The placement of a taxon is defined by the terminals of its sister group, that
+are shared by all the trees that contain the taxon.
+
+By default, a taxon will be reported if the difference between its oldest and
+youngest age is larger than 1 million years, or if it has more than one
+placement. Use the flag --age to define a different age difference (in
+million years). If the flag --all is defined, all repeated taxa will be
+reported.
+
+The output is a TSV file with the following columns:
+
+	-taxon       the taxon name
+	-trees       the number of trees with the taxon
+	-min         the youngest age of the taxon (in million years)
+	-max         the oldest age of the taxon (in million years)
+	-placements  the number of different placements of the taxon
+	-names       the names of the trees with the taxon
+
+By default the output will be printed in the standard output. To define an
+output file use the flag --output, or -o.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var ageFlag float64
+var allFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().Float64Var(&ageFlag, "age", 1, "")
+	c.Flags().BoolVar(&allFlag, "all", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+func run(c *command.Command, args []string) (err error) {
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	maxDiff := int64(ageFlag * millionYears)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "taxon\ttrees\tmin\tmax\tplacements\tnames\n")
+	for _, d := range coll.Duplicates() {
+		if !allFlag && d.MaxAge-d.MinAge <= maxDiff && d.Placements < 2 {
+			continue
+		}
+		minAge := float64(d.MinAge) / millionYears
+		maxAge := float64(d.MaxAge) / millionYears
+		fmt.Fprintf(bw, "%s\t%d\t%.6f\t%.6f\t%d\t%s\n", d.Taxon, len(d.Trees), minAge, maxAge, d.Placements, strings.Join(d.Trees, ","))
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
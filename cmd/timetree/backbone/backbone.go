@@ -0,0 +1,288 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package backbone implements a command to reduce a tree
+// to a single exemplar terminal per clade.
+package backbone
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `backbone [--clades <file>] [--rule <rule>]
+	[--tree <tree>] [-o|--output <file>] <treefile>...`,
+	Short: "reduce a tree to an exemplar terminal per clade",
+	Long: `
+Command backbone reads one or more trees in TSV format, and reduces each tree
+to a single exemplar terminal per clade (for example, a genus, or a family).
+The exemplar is renamed with the name of the clade. The ages of the remaining
+internal nodes are not changed. It is useful to produce backbone trees for
+figures or coarse analyses.
+
+One or more tree files must be given as arguments.
+
+By default, the clades are the genera, defined by the first word of the
+terminal names. Use the flag --clades to define the clades from a file. The
+file is a TSV file without header, and the following columns:
+
+	-clade  the name of the clade
+	-taxon  the name of a terminal in the clade
+
+A clade is defined by all the rows that share the same clade name. Terminals
+absent in a tree are ignored, and terminals without a clade are kept without
+changes. The clades are not required to be monophyletic, but in that case,
+the exemplar will only represent a part of the clade.
+
+The flag --rule defines how the exemplar of a clade is selected. Valid values
+are:
+
+	first     the first terminal, in alphabetical order (the default)
+	youngest  the youngest terminal (for example, an extant species)
+	oldest    the oldest terminal
+	random    a terminal selected at random
+
+By default, all the trees in the files will be reduced. Use the flag --tree to
+reduce a single tree.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var cladesFile string
+var rule string
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&cladesFile, "clades", "", "")
+	c.Flags().StringVar(&rule, "rule", "first", "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	switch rule {
+	case "first", "youngest", "oldest", "random":
+	default:
+		return c.UsageError(fmt.Sprintf("flag --rule: unknown rule %q", rule))
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	var sets map[string]string
+	if cladesFile != "" {
+		var err error
+		sets, err = readClades()
+		if err != nil {
+			return err
+		}
+	}
+
+	names := coll.Names()
+	if treeName != "" {
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
+	}
+
+	for _, tn := range names {
+		if err := backbone(coll.Tree(tn), sets); err != nil {
+			return fmt.Errorf("tree %q: %v", tn, err)
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Backbone reduces a tree
+// to an exemplar terminal per clade.
+// If sets is nil,
+// the genus of each terminal is used as its clade.
+func backbone(t *timetree.Tree, sets map[string]string) error {
+	clades := make(map[string][]string)
+	var keep []string
+	for _, tax := range t.Terms() {
+		cl := genus(tax)
+		if sets != nil {
+			cl = sets[strings.ToLower(tax)]
+		}
+		if cl == "" {
+			keep = append(keep, tax)
+			continue
+		}
+		clades[cl] = append(clades[cl], tax)
+	}
+
+	exemplars := make(map[string]string, len(clades))
+	for cl, terms := range clades {
+		ex := exemplar(t, terms)
+		exemplars[cl] = ex
+		keep = append(keep, ex)
+	}
+	if err := t.Keep(keep...); err != nil {
+		return err
+	}
+
+	cls := make([]string, 0, len(exemplars))
+	for cl := range exemplars {
+		cls = append(cls, cl)
+	}
+	slices.Sort(cls)
+	for _, cl := range cls {
+		ex := exemplars[cl]
+		if strings.EqualFold(ex, cl) {
+			continue
+		}
+		id, _ := t.TaxNode(ex)
+		if err := t.SetName(id, cl); err != nil {
+			return fmt.Errorf("clade %q: %v", cl, err)
+		}
+		if dryrun.Enabled {
+			dryrun.Rename(t.Name(), ex, t.Taxon(id))
+		}
+	}
+	t.Format()
+	return nil
+}
+
+// Genus returns the genus of a taxon name,
+// i.e., its first word.
+func genus(name string) string {
+	g, _, _ := strings.Cut(name, " ")
+	return g
+}
+
+// Exemplar returns the exemplar terminal
+// of a list of terminals
+// sorted in alphabetical order.
+func exemplar(t *timetree.Tree, terms []string) string {
+	switch rule {
+	case "random":
+		return terms[rand.IntN(len(terms))]
+	case "youngest", "oldest":
+		ex := terms[0]
+		exID, _ := t.TaxNode(ex)
+		for _, tax := range terms[1:] {
+			id, _ := t.TaxNode(tax)
+			if rule == "youngest" && t.Age(id) < t.Age(exID) {
+				ex, exID = tax, id
+			}
+			if rule == "oldest" && t.Age(id) > t.Age(exID) {
+				ex, exID = tax, id
+			}
+		}
+		return ex
+	}
+	return terms[0]
+}
+
+// ReadClades reads the clade of each terminal
+// from the clades file.
+func readClades() (map[string]string, error) {
+	f, err := os.Open(cladesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	sets := make(map[string]string)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", cladesFile, ln, err)
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", cladesFile, ln, len(row), 2)
+		}
+
+		name := strings.Join(strings.Fields(row[0]), " ")
+		if name == "" {
+			continue
+		}
+		tax := strings.ToLower(strings.Join(strings.Fields(row[1]), " "))
+		if tax == "" {
+			continue
+		}
+		if cl, ok := sets[tax]; ok && cl != name {
+			return nil, fmt.Errorf("%q: on row %d: taxon %q in clades %q and %q", cladesFile, ln, row[1], cl, name)
+		}
+		sets[tax] = name
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("%q: no clades defined", cladesFile)
+	}
+	return sets, nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
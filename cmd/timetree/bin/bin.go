@@ -0,0 +1,188 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package bin implements a command to split a tree collection
+// into bins of trees with similar ages.
+package bin
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `bin [--bins <number>] [--clade <taxon>[,<taxon>...]]
+	[-o|--output <prefix>] [<tree-file>...]`,
+	Short: "split trees into bins by age",
+	Long: `
+Command bin reads one or more trees in TSV format, and partitions the trees
+into bins of equal frequency (i.e., each bin has the same number of trees),
+using the age of the root of each tree. This is useful for stratified
+analyses of large collections, for example, the trees of a posterior sample.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+By default, four bins will be made. Use the flag --bins to define a different
+number of bins.
+
+By default, the age of the root is used to sort the trees. Use the flag
+--clade to use the age of a clade. If a single taxon name is given, it will
+use the node with that name. If two or more names are given, separated by
+commas, the most recent common ancestor of the indicated taxa will be used.
+Trees without the indicated clade will be ignored.
+
+Each bin will be written in a file with the name "bin-<number>.tab". Use the
+flag --output, or -o, to define a different prefix for the output files.
+
+A summary with the file name, the number of trees, and the minimum and maximum
+age (in million years) of each bin will be printed in the standard output.
+	`,
+	SetFlags: setFlags,
+	Run:      run,
+}
+
+var numBins int
+var cladeFlag string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().IntVar(&numBins, "bins", 4, "")
+	c.Flags().StringVar(&cladeFlag, "clade", "", "")
+	c.Flags().StringVar(&output, "output", "bin", "")
+	c.Flags().StringVar(&output, "o", "bin", "")
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+func run(c *command.Command, args []string) error {
+	if numBins <= 0 {
+		return c.UsageError("flag --bins must be greater than 0")
+	}
+	var clade []string
+	if cladeFlag != "" {
+		for _, tx := range strings.Split(cladeFlag, ",") {
+			tx = strings.Join(strings.Fields(tx), " ")
+			if tx == "" {
+				continue
+			}
+			clade = append(clade, tx)
+		}
+	}
+
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.TimeTrees(c, args)
+	if err != nil {
+		return err
+	}
+
+	type treeAge struct {
+		name string
+		age  int64
+	}
+	var trees []treeAge
+	for _, tn := range coll.Names() {
+		t := coll.Tree(tn)
+		id := cladeNode(t, clade)
+		if id < 0 {
+			fmt.Fprintf(c.Stderr(), "tree %q: clade %q not found\n", tn, cladeFlag)
+			continue
+		}
+		trees = append(trees, treeAge{name: tn, age: t.Age(id)})
+	}
+	if len(trees) == 0 {
+		return fmt.Errorf("no trees to bin")
+	}
+	slices.SortStableFunc(trees, func(a, b treeAge) int {
+		return cmp.Compare(a.age, b.age)
+	})
+
+	bins := numBins
+	if bins > len(trees) {
+		bins = len(trees)
+	}
+
+	bw := bufio.NewWriter(c.Stdout())
+	fmt.Fprintf(bw, "bin\tfile\ttrees\tmin\tmax\n")
+	size := len(trees) / bins
+	extra := len(trees) % bins
+	start := 0
+	for i := 0; i < bins; i++ {
+		end := start + size
+		if i < extra {
+			end++
+		}
+
+		bc := timetree.NewCollection()
+		for _, ta := range trees[start:end] {
+			if err := bc.Add(coll.Tree(ta.name)); err != nil {
+				return fmt.Errorf("bin %d: %v", i+1, err)
+			}
+		}
+		name := fmt.Sprintf("%s-%d.tab", output, i+1)
+		if err := writeTrees(name, bc); err != nil {
+			return err
+		}
+
+		min := float64(trees[start].age) / millionYears
+		max := float64(trees[end-1].age) / millionYears
+		fmt.Fprintf(bw, "%d\t%s\t%d\t%.6f\t%.6f\n", i+1, name, end-start, min, max)
+		start = end
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing summary: %v", err)
+	}
+	return nil
+}
+
+// CladeNode returns the ID of the node
+// that defines the clade
+// or -1 if the clade is not in the tree.
+func cladeNode(t *timetree.Tree, clade []string) int {
+	if len(clade) == 0 {
+		return t.Root()
+	}
+	names := make([]string, 0, len(clade))
+	for _, tx := range clade {
+		id, ok := t.TaxNode(tx)
+		if !ok {
+			return -1
+		}
+		names = append(names, t.Taxon(id))
+	}
+	return t.MRCA(names...)
+}
+
+func writeTrees(name string, c *timetree.Collection) (err error) {
+	f, err := outfile.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Discard()
+			return
+		}
+		err = f.Close()
+	}()
+
+	if err := c.TSV(f); err != nil {
+		return fmt.Errorf("while writing to %q: %v", name, err)
+	}
+	return nil
+}
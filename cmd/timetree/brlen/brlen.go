@@ -0,0 +1,283 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package brlen implements a command to check,
+// and repair,
+// the consistency between node ages
+// and a branch length field.
+package brlen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `brlen [--field <name>] [--tolerance <value>]
+	[--repair <mode>] [-o|--output <file>] [<treefile>]`,
+	Short: "check the branch lengths of the trees",
+	Long: `
+Command brlen reads a tree file in TSV format, and compares the branch
+lengths stored in a metadata field of the nodes (for example, after editing
+the tree file in a spreadsheet, or when the tree was built from a table with
+branch lengths) with the branch lengths derived from the node ages (i.e.,
+the age of the parent minus the age of the node).
+
+The name of a tree file can be given as an argument. If no file is given, the
+trees will be read from the standard input.
+
+By default, the branch lengths are read from the field "length". Use the flag
+--field to define a different field. Branch lengths must be in million years.
+Nodes without the field, as well as the root, are ignored.
+
+By default, any difference between the branch lengths is reported. Use the
+flag --tolerance to define the maximum difference, in million years, that is
+accepted.
+
+The report is a TSV table with the following columns:
+
+	-tree    the name of the tree
+	-node    the ID of the node
+	-taxon   the taxon name of the node
+	-age     the branch length from the node ages
+	-field   the branch length from the field
+	-diff    the difference between the field and the age branch lengths
+
+Use the flag --repair to make the ages and the branch lengths consistent. The
+value of the flag defines which values are used to repair the tree. Valid
+values are:
+
+	-ages     the node ages are kept, and the field is set to the branch
+	          lengths derived from the ages, for all the nodes of the tree
+	-lengths  the branch lengths of the field are kept, and the ages are
+	          updated, keeping the age of the root (nodes without the field
+	          keep its current branch length)
+
+If the flag --repair is used, the resulting trees will be printed in the
+standard output, and the report (with the inconsistencies found before the
+repair) will be printed in the standard error. Otherwise, the report will be
+printed in the standard output. Use the flag --output, or -o, to define an
+output file for the trees, or the report. If the output file name ends with
+".gz", the trees will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var field string
+var tolerance float64
+var repair string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&field, "field", "length", "")
+	c.Flags().Float64Var(&tolerance, "tolerance", 0, "")
+	c.Flags().StringVar(&repair, "repair", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+func run(c *command.Command, args []string) error {
+	field = strings.ToLower(strings.TrimSpace(field))
+	if field == "" {
+		return c.UsageError("flag --field: undefined field")
+	}
+	if tolerance < 0 {
+		return fmt.Errorf("flag --tolerance: invalid value %.6f", tolerance)
+	}
+	repair = strings.ToLower(strings.TrimSpace(repair))
+	switch repair {
+	case "", "ages", "lengths":
+	default:
+		return fmt.Errorf("flag --repair: unknown mode %q", repair)
+	}
+
+	in := "-"
+	if len(args) > 0 {
+		in = args[0]
+	}
+	tc, err := infile.Collection(c.Stdin(), in)
+	if err != nil {
+		return err
+	}
+	orig := dryrun.Copy(tc)
+
+	var rows []inconsistency
+	for _, tn := range tc.Names() {
+		t := tc.Tree(tn)
+		lens, err := readLengths(t)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, check(t, lens)...)
+
+		switch repair {
+		case "ages":
+			for _, id := range t.Nodes() {
+				if t.IsRoot(id) {
+					continue
+				}
+				v := strconv.FormatFloat(float64(t.BranchLen(id))/millionYears, 'f', -1, 64)
+				if err := t.SetMeta(id, field, v); err != nil {
+					return fmt.Errorf("tree %q: node %d: %v", tn, id, err)
+				}
+			}
+		case "lengths":
+			if err := t.SetBranchLens(lens); err != nil {
+				return fmt.Errorf("tree %q: %v", tn, err)
+			}
+		}
+	}
+
+	if repair == "" {
+		return writeReport(c.Stdout(), rows)
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, tc)
+		return nil
+	}
+	if err := writeReport(c.Stderr(), rows); err != nil {
+		return err
+	}
+	if err := writeTrees(c.Stdout(), tc); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadLengths returns the branch lengths
+// (in years)
+// stored in the field of the nodes of a tree.
+func readLengths(t *timetree.Tree) (map[int]int64, error) {
+	lens := make(map[int]int64)
+	for _, id := range t.Nodes() {
+		if t.IsRoot(id) {
+			continue
+		}
+		v := t.Meta(id, field)
+		if v == "" {
+			continue
+		}
+		l, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("tree %q: node %d: field %q: %v", t.Name(), id, field, err)
+		}
+		if l < 0 {
+			return nil, fmt.Errorf("tree %q: node %d: field %q: invalid length %q", t.Name(), id, field, v)
+		}
+		lens[id] = int64(math.Round(l * millionYears))
+	}
+	return lens, nil
+}
+
+// An inconsistency is a node
+// with a branch length in the field
+// different from the branch length
+// derived from the ages.
+type inconsistency struct {
+	tree  string
+	node  int
+	taxon string
+	age   int64
+	field int64
+}
+
+func check(t *timetree.Tree, lens map[int]int64) []inconsistency {
+	tol := int64(math.Round(tolerance * millionYears))
+
+	var rows []inconsistency
+	for _, id := range t.Nodes() {
+		l, ok := lens[id]
+		if !ok {
+			continue
+		}
+		a := t.BranchLen(id)
+		d := l - a
+		if d < 0 {
+			d = -d
+		}
+		if d <= tol {
+			continue
+		}
+		rows = append(rows, inconsistency{
+			tree:  t.Name(),
+			node:  id,
+			taxon: t.Taxon(id),
+			age:   a,
+			field: l,
+		})
+	}
+	return rows
+}
+
+func writeReport(w io.Writer, rows []inconsistency) (err error) {
+	outName := "stdout"
+	if output != "" && repair == "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "tree\tnode\ttaxon\tage\tfield\tdiff\n")
+	for _, r := range rows {
+		fmt.Fprintf(bw, "%s\t%d\t%s\t%.6f\t%.6f\t%.6f\n", r.tree, r.node, r.taxon, float64(r.age)/millionYears, float64(r.field)/millionYears, float64(r.field-r.age)/millionYears)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
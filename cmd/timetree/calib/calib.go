@@ -0,0 +1,261 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package calib implements a command to export
+// a calibration file
+// with the calibrations defined by clade names.
+package calib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `calib [-o|--output <file>]
+	<calibration-file> <treefile>...`,
+	Short: "export calibrations defined by clade names",
+	Long: `
+Command calib reads a calibration file, and one or more trees in TSV format,
+and writes the calibrations as a calibration file in which each calibration
+is defined by clade names and taxa, instead of node IDs, so the calibration
+file keeps working after the tree is edited, formatted, or imported again.
+
+The first argument of the command is the calibration file. The following
+arguments are the tree files.
+
+The calibration file can be a TSV file without header, as used by the flag
+--calibrate of the command set, with the following columns:
+
+	-tree  the name of the tree
+	-node  the constrained node
+	-min   the minimum age (in million years) of the node
+	-max   the maximum age (in million years) of the node
+
+in which the node can be defined by its ID, by the name of a taxon, or by two
+or more taxon names separated by commas. It can be also a calibration file
+with clade names (see the documentation of the command set), in which case
+the taxa of each clade will be normalized using the first tree in which the
+clade is found.
+
+In the exported file, each clade is defined by the name of the node (if the
+node is named), and by two terminals whose most recent common ancestor is the
+node. Calibrations read from a file without header are restricted to their
+tree. Calibrations of clades not found in the trees are printed as warnings in
+the standard error and exported without changes.
+
+The calibration file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) < 2 {
+		return c.UsageError("expecting a calibration file and one or more tree files")
+	}
+	calFile := args[0]
+	args = args[1:]
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(calFile)
+	if err != nil {
+		return err
+	}
+	var cals []timetree.Calibration
+	if isCladeFile(data) {
+		cals, err = normalize(c.Stderr(), coll, calFile, data)
+	} else {
+		cals, err = readNodes(coll, calFile, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeCalibrations(c.Stdout(), cals); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsCladeFile returns true
+// if the calibration file has a header
+// with a "clade" field.
+func isCladeFile(data []byte) bool {
+	for _, ln := range strings.Split(string(data), "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		for _, f := range strings.Split(ln, "\t") {
+			if strings.ToLower(strings.TrimSpace(f)) == "clade" {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// Normalize sets the taxa of the calibrations
+// of a calibration file
+// using the first tree in which the clade is found.
+func normalize(w io.Writer, coll *timetree.Collection, name string, data []byte) ([]timetree.Calibration, error) {
+	cals, err := timetree.ReadCalibrations(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("while reading file %q: %v", name, err)
+	}
+
+	for i, cal := range cals {
+		found := false
+		for _, tn := range coll.Names() {
+			t := coll.Tree(tn)
+			id := cal.Node(t)
+			if id < 0 {
+				continue
+			}
+			nc, err := t.Calibration(id, cal.Min, cal.Max)
+			if err != nil {
+				return nil, err
+			}
+			if cal.Clade != "" {
+				nc.Clade = cal.Clade
+			}
+			nc.Tree = cal.Tree
+			cals[i] = nc
+			found = true
+			break
+		}
+		if !found {
+			clade := cal.Clade
+			if clade == "" {
+				clade = strings.Join(cal.Taxa, ",")
+			}
+			fmt.Fprintf(w, "warning: %q: clade %q not found\n", name, clade)
+		}
+	}
+	return cals, nil
+}
+
+// ReadNodes reads a calibration file
+// with calibrations defined by tree nodes.
+func readNodes(coll *timetree.Collection, name string, data []byte) ([]timetree.Calibration, error) {
+	tab := csv.NewReader(bytes.NewReader(data))
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	var cals []timetree.Calibration
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", name, ln, err)
+		}
+		if len(row) < 4 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", name, ln, len(row), 4)
+		}
+
+		tn := strings.ToLower(strings.Join(strings.Fields(row[0]), " "))
+		if tn == "" {
+			continue
+		}
+		t := coll.Tree(tn)
+		if t == nil {
+			return nil, fmt.Errorf("%q: on row %d: tree %q not found", name, ln, tn)
+		}
+		id, err := t.FindNode(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", name, ln, "node", err)
+		}
+
+		var minAge int64
+		maxAge := int64(math.MaxInt64)
+		if v := strings.TrimSpace(row[2]); v != "" {
+			a, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q: on row %d: field %q: %v", name, ln, "min", err)
+			}
+			minAge = int64(a * millionYears)
+		}
+		if v := strings.TrimSpace(row[3]); v != "" {
+			a, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q: on row %d: field %q: %v", name, ln, "max", err)
+			}
+			maxAge = int64(a * millionYears)
+		}
+		if maxAge < minAge {
+			return nil, fmt.Errorf("%q: on row %d: invalid age range", name, ln)
+		}
+
+		cal, err := t.Calibration(id, minAge, maxAge)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", name, ln, "node", err)
+		}
+		cal.Tree = tn
+		cals = append(cals, cal)
+	}
+	return cals, nil
+}
+
+// millionYears is used to transform ages
+// from million years to years.
+const millionYears = 1_000_000
+
+func writeCalibrations(w io.Writer, cals []timetree.Calibration) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := timetree.WriteCalibrations(bw, cals); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package clades implements a command to print
+// the age and size of the clades of the trees in a tree file.
+package clades
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `clades [--min <number>] [--tree <tree>]
+	[-o|--output <file>] [<tree-file>...]`,
+	Short: "print the age and size of the clades of a tree",
+	Long: `
+Command clades reads one or more tree files in TSV format and prints the age
+and the number of terminals of each clade (i.e., internal node) of the trees.
+It is the raw material for clade age versus clade size plots, for example, to
+explore diversification slowdowns.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+By default, the clades of all the trees will be printed. Use the flag --tree
+to print the clades of a single tree. Use the flag --min to print only the
+clades with at least the indicated number of terminals (by default, 2, i.e.,
+all the clades).
+
+The output is a TSV table with the following columns:
+
+	-tree   the name of the tree
+	-node   the ID of the node
+	-taxon  the name of the node
+	-crown  the age of the node, in million years
+	-stem   the age of the parent of the node, in million years (empty for
+	        the root)
+	-tips   the number of terminals of the clade
+
+By default, the table will be printed in the standard output. Use the flag
+--output, or -o, to define an output file.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var minSize int
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().IntVar(&minSize, "min", 2, "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	names := coll.Names()
+	if treeName != "" {
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "tree\tnode\ttaxon\tcrown\tstem\ttips\n")
+	for _, tn := range names {
+		t := coll.Tree(tn)
+		for _, id := range t.Nodes() {
+			if t.IsTerm(id) {
+				continue
+			}
+			size := t.CladeSize(id)
+			if size < minSize {
+				continue
+			}
+			stem := ""
+			if p := t.Parent(id); p >= 0 {
+				stem = fmt.Sprintf("%.6f", float64(t.Age(p))/millionYears)
+			}
+			fmt.Fprintf(bw, "%s\t%d\t%s\t%.6f\t%s\t%d\n", t.Name(), id, t.Taxon(id), float64(t.Age(id))/millionYears, stem, size)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
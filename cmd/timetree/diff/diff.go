@@ -0,0 +1,296 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package diff implements a command to report
+// the differences between two trees.
+package diff
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `diff [--trees <tree>,<tree>] [--threshold <age>]
+	[-o|--output <file>] <treefile>...`,
+	Short: "report the differences between two trees",
+	Long: `
+Command diff reads one or more tree files in TSV format, and reports the
+differences between two trees: the terminals found in only one of the trees,
+the clades found in only one of the trees, and the clades found in both trees
+with different ages.
+
+One or more tree files must be given as arguments.
+
+Use the flag --trees to define the names of the trees to be compared,
+separated by a comma. If the flag is not defined, the tree files must contain
+exactly two trees. The ages of both trees must be in the same unit (as stored
+in the "unit" metadata field of the root node).
+
+Clades are compared using the terminals shared by both trees, so a clade that
+only differs by the presence of a terminal absent in the other tree is
+considered the same clade. If several nodes define the same set of shared
+terminals, the youngest node is used.
+
+Trees are compared using its canonical representation, so two trees with the
+same topology, taxon names, and ages, are identical regardless of their node
+IDs or the order of the children of the nodes. For identical trees, only the
+header of the table is printed.
+
+By default, any difference in the age of a clade will be reported. Use the
+flag --threshold to define the minimum difference, in million years, to report
+an age difference.
+
+The output is a TSV table with the following columns:
+
+	-type       the kind of difference: "terminal" for a terminal found
+	            only in one tree, "clade" for a clade found only in one
+	            tree, and "age" for a clade with different ages
+	-tree       the name of the tree with the terminal or clade (for age
+	            differences, the first tree)
+	-node       the ID of the node in the tree
+	-age        the age of the node, in million years
+	-other      the ID of the node in the other tree (only for age
+	            differences)
+	-other-age  the age of the node in the other tree
+	-name       the name of the node
+	-terms      the shared terminals of the clade, separated by commas
+
+By default, the table will be printed in the standard output. Use the flag
+--output, or -o, to define an output file.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var treesFlag string
+var threshold float64
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&treesFlag, "trees", "", "")
+	c.Flags().Float64Var(&threshold, "threshold", 0, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+	if threshold < 0 {
+		return c.UsageError("flag --threshold must be a positive value")
+	}
+
+	coll, order, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	a, b, err := pickTrees(coll, order)
+	if err != nil {
+		return err
+	}
+	if ua, ub := a.AgeUnit(), b.AgeUnit(); ua != ub {
+		return fmt.Errorf("trees %q and %q have ages in different units: %s and %s", a.Name(), b.Name(), ua, ub)
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "type\ttree\tnode\tage\tother\tother-age\tname\tterms\n")
+	if a.Equal(b) {
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("while writing to %q: %v", output, err)
+		}
+		return nil
+	}
+
+	shared := make(map[string]bool)
+	for _, tax := range a.Terms() {
+		if id, ok := b.TaxNode(tax); ok && b.IsTerm(id) {
+			shared[tax] = true
+		}
+	}
+
+	// terminals
+	for _, t := range []*timetree.Tree{a, b} {
+		for _, tax := range t.Terms() {
+			if shared[tax] {
+				continue
+			}
+			id, _ := t.TaxNode(tax)
+			fmt.Fprintf(bw, "terminal\t%s\t%d\t%.6f\t\t\t%s\t\n", t.Name(), id, float64(t.Age(id))/millionYears, tax)
+		}
+	}
+
+	// clades
+	ca := clades(a, shared)
+	cb := clades(b, shared)
+	writeClades(bw, a, ca, cb)
+	writeClades(bw, b, cb, ca)
+
+	// ages
+	minDiff := int64(threshold * millionYears)
+	for _, k := range ca.order {
+		cl := ca.clades[k]
+		o, ok := cb.clades[k]
+		if !ok {
+			continue
+		}
+		ageA := a.Age(cl.id)
+		ageB := b.Age(o.id)
+		d := ageA - ageB
+		if d < 0 {
+			d = -d
+		}
+		if d == 0 || d < minDiff {
+			continue
+		}
+		fmt.Fprintf(bw, "age\t%s\t%d\t%.6f\t%d\t%.6f\t%s\t%s\n", a.Name(), cl.id, float64(ageA)/millionYears, o.id, float64(ageB)/millionYears, a.Taxon(cl.id), strings.Join(cl.terms, ","))
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+// PickTrees returns the trees to be compared.
+func pickTrees(c *timetree.Collection, order []string) (*timetree.Tree, *timetree.Tree, error) {
+	if treesFlag == "" {
+		if len(order) != 2 {
+			return nil, nil, fmt.Errorf("expecting two trees, got %d: flag --trees must be defined", len(order))
+		}
+		return c.Tree(order[0]), c.Tree(order[1]), nil
+	}
+
+	na, nb, ok := strings.Cut(treesFlag, ",")
+	if !ok {
+		return nil, nil, fmt.Errorf("flag --trees: expecting <tree>,<tree>, got %q", treesFlag)
+	}
+	a := c.Tree(na)
+	if a == nil {
+		return nil, nil, fmt.Errorf("flag --trees: tree %q not found", na)
+	}
+	b := c.Tree(nb)
+	if b == nil {
+		return nil, nil, fmt.Errorf("flag --trees: tree %q not found", nb)
+	}
+	if a == b {
+		return nil, nil, fmt.Errorf("flag --trees: expecting two different trees, got %q", treesFlag)
+	}
+	return a, b, nil
+}
+
+// A Clade is a set of shared terminals
+// defined by a node.
+type clade struct {
+	id    int
+	terms []string
+}
+
+// CladeSet is the set of clades of a tree.
+type cladeSet struct {
+	clades map[string]clade
+
+	// clade keys in node order
+	order []string
+}
+
+// Clades returns the clades of a tree
+// defined by the shared terminals,
+// using the youngest node
+// for each set of shared terminals.
+func clades(t *timetree.Tree, shared map[string]bool) cladeSet {
+	terms := make(map[int][]string)
+	var post []int
+	stack := []int{t.Root()}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		post = append(post, id)
+		stack = append(stack, t.Children(id)...)
+	}
+	slices.Reverse(post)
+
+	cs := cladeSet{
+		clades: make(map[string]clade, len(post)),
+	}
+	for _, id := range post {
+		if t.IsTerm(id) {
+			if tax := t.Taxon(id); shared[tax] {
+				terms[id] = []string{tax}
+			}
+			continue
+		}
+		var ts []string
+		youngest := true
+		for _, c := range t.Children(id) {
+			ts = append(ts, terms[c]...)
+		}
+		for _, c := range t.Children(id) {
+			if len(terms[c]) == len(ts) {
+				youngest = false
+			}
+		}
+		terms[id] = ts
+		if len(ts) < 2 || !youngest {
+			continue
+		}
+
+		ts = slices.Clone(ts)
+		slices.Sort(ts)
+		k := strings.Join(ts, "\x00")
+		cs.clades[k] = clade{id: id, terms: ts}
+		cs.order = append(cs.order, k)
+	}
+
+	slices.SortFunc(cs.order, func(a, b string) int {
+		return cmp.Compare(cs.clades[a].id, cs.clades[b].id)
+	})
+	return cs
+}
+
+// WriteClades writes the clades of a tree
+// not found in the other tree.
+func writeClades(w *bufio.Writer, t *timetree.Tree, cs, other cladeSet) {
+	for _, k := range cs.order {
+		if _, ok := other.clades[k]; ok {
+			continue
+		}
+		cl := cs.clades[k]
+		fmt.Fprintf(w, "clade\t%s\t%d\t%.6f\t\t\t%s\t%s\n", t.Name(), cl.id, float64(t.Age(cl.id))/millionYears, t.Taxon(cl.id), strings.Join(cl.terms, ","))
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package dist implements a command to output
+// the patristic distances between the terminals of a tree.
+package dist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `dist [--tree <tree>] [--format <format>]
+	[-o|--output <file>] [<tree-file>...]`,
+	Short: "print a distance matrix of tree terminals",
+	Long: `
+Command dist reads a tree in TSV format and prints the patristic distance
+(i.e., the sum of the length of the branches that connect two terminals)
+between each pair of terminals of the tree, in million years.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+If the files contain a single tree, that tree will be used. Otherwise, use the
+flag --tree to select the tree.
+
+By default, the output is a TSV square matrix, with a header with the name of
+each terminal. Use the flag --format to define a different format. Valid
+formats are:
+
+	tsv     a TSV square matrix (the default)
+	phylip  a square matrix in relaxed PHYLIP format, in which the spaces
+	        of the terminal names are replaced by underscores
+
+By default the output will be printed in the standard output. To define an
+output file use the flag --output, or -o.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var treeName string
+var format string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&format, "format", "tsv", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	format = strings.ToLower(format)
+	if format != "tsv" && format != "phylip" {
+		return c.UsageError(fmt.Sprintf("unknown format %q", format))
+	}
+
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	if treeName == "" {
+		names := coll.Names()
+		if len(names) != 1 {
+			return c.UsageError("expecting flag --tree")
+		}
+		treeName = names[0]
+	}
+	t := coll.Tree(treeName)
+	if t == nil {
+		return fmt.Errorf("tree %q not found", treeName)
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+	bw := bufio.NewWriter(w)
+
+	terms := t.Terms()
+	m := distances(t, terms)
+	if format == "phylip" {
+		writePhylip(bw, terms, m)
+	} else {
+		writeTSV(bw, terms, m)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
+
+// millionYears is used to transform distances
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+// Distances returns the patristic distances
+// between each pair of terminals.
+func distances(t *timetree.Tree, terms []string) [][]float64 {
+	m := make([][]float64, len(terms))
+	for i := range m {
+		m[i] = make([]float64, len(terms))
+	}
+
+	for i, a := range terms {
+		idA, _ := t.TaxNode(a)
+		for j := i + 1; j < len(terms); j++ {
+			b := terms[j]
+			idB, _ := t.TaxNode(b)
+			mrca := t.Age(t.MRCA(a, b))
+			d := float64(2*mrca-t.Age(idA)-t.Age(idB)) / millionYears
+			m[i][j] = d
+			m[j][i] = d
+		}
+	}
+	return m
+}
+
+func writeTSV(w io.Writer, terms []string, m [][]float64) {
+	fmt.Fprintf(w, "taxon")
+	for _, tax := range terms {
+		fmt.Fprintf(w, "\t%s", tax)
+	}
+	fmt.Fprintf(w, "\n")
+
+	for i, tax := range terms {
+		fmt.Fprintf(w, "%s", tax)
+		for _, d := range m[i] {
+			fmt.Fprintf(w, "\t%.6f", d)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func writePhylip(w io.Writer, terms []string, m [][]float64) {
+	fmt.Fprintf(w, "%d\n", len(terms))
+	for i, tax := range terms {
+		name := strings.Join(strings.Fields(tax), "_")
+		fmt.Fprintf(w, "%s", name)
+		for _, d := range m[i] {
+			fmt.Fprintf(w, " %.6f", d)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
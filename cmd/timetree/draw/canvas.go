@@ -0,0 +1,355 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/timetree/layout"
+)
+
+// A Canvas is a drawing surface
+// used by the PNG and PDF backends.
+// Coordinates are in pixels,
+// with the origin at the top-left corner.
+type canvas interface {
+	// Rect fills a rectangle.
+	rect(x, y, w, h float64, fill color.RGBA)
+
+	// Line draws a line with round caps.
+	line(x1, y1, x2, y2, width float64, stroke color.RGBA)
+
+	// Polygon draws the outline of a closed polygon.
+	polygon(pts []point, width float64, stroke color.RGBA)
+
+	// Circle draws a filled circle with an outline.
+	circle(x, y, r, width float64, fill, stroke color.RGBA)
+
+	// Text draws a text,
+	// with its baseline at the y coordinate.
+	text(x, y float64, text string, size float64, style fontStyle, fill color.RGBA)
+}
+
+// A Point is a point in a canvas.
+type point struct {
+	x, y float64
+}
+
+// FontStyle is the style of a text.
+type fontStyle int
+
+// Valid font styles.
+const (
+	regular fontStyle = iota
+	italic
+	bold
+)
+
+var (
+	black = color.RGBA{A: 255}
+	white = color.RGBA{255, 255, 255, 255}
+)
+
+// A ShiftCanvas is a canvas
+// that moves down all the elements
+// drawn into another canvas.
+type shiftCanvas struct {
+	cv canvas
+	dy float64
+}
+
+func (s shiftCanvas) rect(x, y, w, h float64, fill color.RGBA) {
+	s.cv.rect(x, y+s.dy, w, h, fill)
+}
+
+func (s shiftCanvas) line(x1, y1, x2, y2, width float64, stroke color.RGBA) {
+	s.cv.line(x1, y1+s.dy, x2, y2+s.dy, width, stroke)
+}
+
+func (s shiftCanvas) polygon(pts []point, width float64, stroke color.RGBA) {
+	moved := make([]point, len(pts))
+	for i, p := range pts {
+		moved[i] = point{p.x, p.y + s.dy}
+	}
+	s.cv.polygon(moved, width, stroke)
+}
+
+func (s shiftCanvas) circle(x, y, r, width float64, fill, stroke color.RGBA) {
+	s.cv.circle(x, y+s.dy, r, width, fill, stroke)
+}
+
+func (s shiftCanvas) text(x, y float64, text string, size float64, style fontStyle, fill color.RGBA) {
+	s.cv.text(x, y+s.dy, text, size, style, fill)
+}
+
+// PaintTrees draws one or more trees into a canvas.
+// The trees are stacked vertically.
+func paintTrees(cv canvas, trees []svgTree) {
+	var y float64
+	for _, t := range trees {
+		t.paint(shiftCanvas{cv: cv, dy: y})
+		y += t.height
+	}
+}
+
+// Paint draws the tree into a canvas,
+// using the same geometry of the SVG drawing.
+func (s svgTree) paint(cv canvas) {
+	s.paintTimeRecs(cv)
+	s.paintTimeScale(cv)
+	if s.title != "" {
+		cv.text(s.m.left, s.titleY(), s.title, style.FontSize, bold, black)
+	}
+
+	for _, n := range s.nodes {
+		s.paintBar(cv, n)
+	}
+	for _, n := range s.nodes {
+		s.paintNode(cv, n)
+	}
+	for _, n := range s.nodes {
+		s.paintLabel(cv, n)
+	}
+	s.legend.paint(cv)
+}
+
+// Color returns the color of a node.
+func (s svgTree) color(id int) color.RGBA {
+	c, ok := s.colors[id]
+	if !ok {
+		return black
+	}
+	return styleColor(c)
+}
+
+// LineColor returns the color of the branches of a node.
+func (s svgTree) lineColor(id int) color.RGBA {
+	c, ok := s.colors[id]
+	if !ok {
+		c = style.LineColor
+	}
+	return styleColor(c)
+}
+
+// StyleColor returns the RGB value of a color,
+// or black if the color is invalid.
+func styleColor(c string) color.RGBA {
+	rgb, err := parseColor(c)
+	if err != nil {
+		return black
+	}
+	return rgb
+}
+
+func (s svgTree) paintTimeRecs(cv canvas) {
+	if timeBox == 0 {
+		return
+	}
+
+	height := s.scaleY()
+	for a := 0.0; ; a += timeBox * 2 {
+		if a+timeBox < s.minAge {
+			continue
+		}
+		maxX := s.xAge(a)
+		if maxX > s.x {
+			maxX = s.x
+		}
+		minX := s.xAge(a + timeBox)
+
+		if maxX < s.m.left {
+			break
+		}
+		cv.rect(minX, 0, maxX-minX, height, styleColor(style.TimeColor))
+	}
+}
+
+func (s svgTree) paintTimeScale(cv canvas) {
+	y := s.scaleY()
+	tc := styleColor(style.TickColor)
+	cv.line(s.m.left, y, s.x, y, style.TickWidth, tc)
+
+	for a := 0.0; a < s.rootAge; a += float64(s.min) {
+		if a < s.minAge {
+			continue
+		}
+
+		x := s.xAge(a)
+		maxY := y + style.TickLength/2
+		if int(a)%s.max == 0 {
+			maxY = y + style.TickLength
+		}
+		cv.line(x, y, x, maxY, style.TickWidth, tc)
+	}
+
+	for _, tl := range s.tickLabels() {
+		cv.text(tl.x, y+style.RowHeight+5, tl.text, style.FontSize, regular, black)
+	}
+}
+
+func (s svgTree) paintBar(cv canvas, n layout.Node) {
+	y := n.Y + s.m.top
+	if b, ok := s.cals[n.ID]; ok {
+		c, _ := parseColor(calColor)
+		cv.rect(s.xAge(b[1]), y+calOffset, s.xAge(b[0])-s.xAge(b[1]), calHeight, c)
+	}
+
+	b, ok := s.bars[n.ID]
+	if !ok {
+		return
+	}
+	x1 := s.xAge(b[1])
+	x2 := s.xAge(b[0])
+	c, _ := parseColor(barColor)
+	cv.rect(x1, y-barHeight/2, x2-x1, barHeight, c)
+}
+
+func (s svgTree) paintNode(cv canvas, n layout.Node) {
+	x := n.X + s.m.left
+	y := n.Y + s.m.top
+	c := s.lineColor(n.ID)
+	if s.outliers[n.ID] {
+		c = styleColor(outlierColor)
+	}
+
+	x1 := x - 5
+	if n.Parent >= 0 {
+		anc := s.nodes[s.ids[n.Parent]]
+		x1 = anc.X + s.m.left
+	}
+	cv.line(x1, y, x, y, style.LineWidth, c)
+
+	if n.Triangle {
+		x2 := s.xAge(float64(n.MinAge) / scale)
+		h := style.RowHeight/2 - 1
+		cv.polygon([]point{{x, y}, {x2, y - h}, {x2, y + h}}, 1, c)
+		return
+	}
+	if len(n.Children) == 0 {
+		return
+	}
+	cv.line(x, n.Top+s.m.top, x, n.Bottom+s.m.top, style.LineWidth, c)
+}
+
+func (s svgTree) paintLabel(cv canvas, n layout.Node) {
+	x := n.X + s.m.left
+	y := n.Y + s.m.top
+
+	if n.Triangle {
+		cv.text(s.xAge(float64(n.MinAge)/scale)+10, y+5, s.badges[n.ID], style.FontSize, regular, s.color(n.ID))
+	} else if len(n.Children) == 0 {
+		cv.text(x+10, y+5, n.Taxon, style.FontSize, style.fontStyle(), s.color(n.ID))
+	}
+
+	if showIDs() {
+		cv.circle(x, y, 7, 1, white, black)
+		cv.text(x-5, y+2, strconv.Itoa(n.ID), 6, regular, black)
+	}
+	if showAges() && len(n.Children) > 0 && !n.Triangle {
+		cv.text(x+ageOffset(), y+3, ageLabel(n.Age), ageSize, regular, black)
+	}
+}
+
+func (l legend) paint(cv canvas) {
+	if len(l.entries) == 0 || legendPos == "none" {
+		return
+	}
+
+	y := l.y
+	if l.title != "" {
+		cv.text(l.x, y+swatchSize, l.title, style.FontSize, bold, black)
+		y += style.RowHeight
+	}
+
+	for _, c := range l.entries {
+		rgb, err := parseColor(c.color)
+		if err != nil {
+			rgb = black
+		}
+		cv.rect(l.x, y+1, swatchSize, swatchSize, rgb)
+		cv.text(l.x+swatchSize+5, y+swatchSize, c.name, style.FontSize, regular, black)
+		y += style.RowHeight
+	}
+}
+
+// ColorNames are the color names
+// accepted by the PNG and PDF backends.
+var colorNames = map[string]color.RGBA{
+	"aqua":      {0, 255, 255, 255},
+	"black":     {0, 0, 0, 255},
+	"blue":      {0, 0, 255, 255},
+	"brown":     {165, 42, 42, 255},
+	"cyan":      {0, 255, 255, 255},
+	"darkblue":  {0, 0, 139, 255},
+	"darkgreen": {0, 100, 0, 255},
+	"darkred":   {139, 0, 0, 255},
+	"fuchsia":   {255, 0, 255, 255},
+	"gold":      {255, 215, 0, 255},
+	"gray":      {128, 128, 128, 255},
+	"green":     {0, 128, 0, 255},
+	"grey":      {128, 128, 128, 255},
+	"lightblue": {173, 216, 230, 255},
+	"lime":      {0, 255, 0, 255},
+	"magenta":   {255, 0, 255, 255},
+	"maroon":    {128, 0, 0, 255},
+	"navy":      {0, 0, 128, 255},
+	"olive":     {128, 128, 0, 255},
+	"orange":    {255, 165, 0, 255},
+	"pink":      {255, 192, 203, 255},
+	"purple":    {128, 0, 128, 255},
+	"red":       {255, 0, 0, 255},
+	"silver":    {192, 192, 192, 255},
+	"teal":      {0, 128, 128, 255},
+	"violet":    {238, 130, 238, 255},
+	"white":     {255, 255, 255, 255},
+	"yellow":    {255, 255, 0, 255},
+}
+
+// ParseColor returns the color
+// of an SVG color value
+// (a color name,
+// a hexadecimal value, such as "#ff0000" or "#f00",
+// or an RGB function, such as "rgb(255,0,0)").
+func parseColor(v string) (color.RGBA, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if c, ok := colorNames[v]; ok {
+		return c, nil
+	}
+
+	if h, ok := strings.CutPrefix(v, "#"); ok {
+		if len(h) == 3 {
+			h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+		}
+		if len(h) != 6 {
+			return color.RGBA{}, fmt.Errorf("invalid color %q", v)
+		}
+		x, err := strconv.ParseUint(h, 16, 32)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("invalid color %q", v)
+		}
+		return color.RGBA{uint8(x >> 16), uint8(x >> 8), uint8(x), 255}, nil
+	}
+
+	if args, ok := strings.CutPrefix(v, "rgb("); ok {
+		args, ok = strings.CutSuffix(args, ")")
+		vals := strings.Split(args, ",")
+		if !ok || len(vals) != 3 {
+			return color.RGBA{}, fmt.Errorf("invalid color %q", v)
+		}
+		var rgb [3]uint8
+		for i, x := range vals {
+			c, err := strconv.ParseUint(strings.TrimSpace(x), 10, 8)
+			if err != nil {
+				return color.RGBA{}, fmt.Errorf("invalid color %q", v)
+			}
+			rgb[i] = uint8(c)
+		}
+		return color.RGBA{rgb[0], rgb[1], rgb[2], 255}, nil
+	}
+	return color.RGBA{}, fmt.Errorf("unknown color %q", v)
+}
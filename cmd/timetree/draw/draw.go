@@ -3,11 +3,13 @@
 // Distributed under BSD2 license that can be found in the LICENSE file.
 
 // Package draw implements a command to output a phylogenetic tree
-// from a TSV file into an SVG file.
+// from a TSV file into an SVG, PNG, or PDF file.
 package draw
 
 import (
 	"bufio"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -16,14 +18,23 @@ import (
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 )
 
 var Command = &command.Command{
 	Usage: `draw [--tree <tree>]
 	[--scale <value>]
 	[--step <value>] [--time <number>] [--tick <tick-value>]
+	[--order <file>] [--margin <value>[,<value>,<value>,<value>]]
+	[--color <file>] [--legend <position>] [--legend-title <title>]
+	[--min-support <value>] [--support <field>] [--triangle <file>]
+	[--plain] [--node-labels <mode>] [--precision <value>]
+	[--interval <field>[,<field>]] [--calibration <file>]
+	[--flag-outliers] [--outlier-sd <value>]
+	[--style <file>] [--stack] [--format <format>]
 	[-o|--output <out-file>] [<tree-file>...]`,
-	Short: "draw a tree into an SVG file",
+	Short: "draw a tree into an image file",
 	Long: `
 Command draw reads a tree in TSV format and draw the tree into an SVG encoded
 file.
@@ -48,11 +59,210 @@ ticks that will be labeled; for example, the default is "1,5,5" which means
 that small ticks will be added time scale unit, major ticks will be added
 every 5 time scale units, and labels will be added every 5 time scale units.
 
+The timescale ends at the youngest node of the tree, or, if the tree has an
+offset (i.e., the tree ends before the present), at the age of the offset.
+
 By default, 10 pixels units will be used per time scale unit, use the flag
 --step to define a different value (it can have decimal points).
 
-The output file will be the name of each tree. If the flag --output, or -o, is
+By default, the terminals are drawn in the order of the node IDs. Use the flag
+--order with a file that define an external order for the terminals (for
+example, latitude, or stratigraphic position), and the nodes of the tree will
+be rotated so the order of the terminals in the drawing is as close as
+possible to the external order (rotations do not change the topology of the
+tree). The order file is a TSV file without header, and the following
+columns:
+
+	-taxon  the name of a terminal
+	-value  a number that defines the position of the terminal
+
+Terminals with smaller values will be drawn at the top of the drawing.
+Terminals without a value will be placed after terminals with values.
+
+By default, all nodes of the tree are drawn. If the flag --min-support is
+defined, internal nodes with a support value below the indicated value will
+be collapsed into a polytomy (the tree file is not modified). Support values
+are read from the metadata fields of the nodes. By default, the first field
+defined from "bootstrap", "confidence", "posterior", "probability", and
+"support" will be used. Use the flag --support to define a different field.
+Nodes without a support value are never collapsed.
+
+Large clades can be summarized as triangles. Use the flag --triangle with a
+file that define the clades to be drawn as triangles. The file is a TSV file
+without header, and the following columns:
+
+	-clade  the name of the clade
+	-taxon  the name of a taxon in the clade
+
+As with colors, a clade is the most recent common ancestor of the taxa in the
+clade, or, if the taxon field is empty, the node with the name of the clade.
+Next to each triangle, the name of the clade, the number of terminals in the
+clade, and the age range of the clade (from the age of the clade to the age of
+its youngest descendant, in time scale units), will be printed. If a triangle
+is inside another triangle, only the outer triangle is drawn.
+
+By default the tree is drawn in black. Use the flag --color with a file that
+define the color of one or more clades. The file is a TSV file without
+header, and the following columns:
+
+	-clade  the name of the clade
+	-taxon  the name of a taxon in the clade
+	-color  an SVG color (for example "red", or "#ff0000")
+
+A clade is defined by all the rows that share the same clade name, and it is
+the most recent common ancestor of the taxa in the clade that are present in
+the tree (taxa absent in the tree are ignored). A taxon can be a terminal, or
+a named internal node. If the taxon field of a clade is empty, the clade is
+the internal node with the name of the clade (for example, the row
+"Theropoda<tab><tab>red" colors the node named "Theropoda"). The color of a clade is the
+first color defined in the rows of the clade. The branches, and terminal
+names, of a clade will be drawn with the color of the clade. If a clade is
+nested inside another colored clade, the color of the nested clade is used.
+
+When colors are used, a legend with the name and color of each clade present
+in the tree is added to the drawing. By default, the legend is placed at the
+right of the tree. Use the flag --legend to define the position of the
+legend. Valid values are:
+
+	-right   at the right of the tree (the default)
+	-bottom  below the time scale
+	-none    the legend is not drawn
+
+Use the flag --legend-title to add a title to the legend.
+
+By default, each node is drawn as a circle with the node ID. Use the flag
+--node-labels to define the labels of the nodes. Valid values are:
+
+	-id    a circle with the node ID (the default)
+	-age   the age of each internal node, in time scale units
+	-both  the circle with the node ID, and the age of internal nodes
+	-none  no node labels
+
+The ages are printed at the right of the node, with two decimal digits. Use
+the flag --precision to define a different number of decimal digits.
+
+The node IDs are useful while editing a tree, but not in a figure for
+publication. Use the flag --plain to draw only the branches and the names of
+the terminals (and the summarized clades, legend, and bars, if defined). With
+this flag, the flag --node-labels is ignored.
+
+Use the flag --interval to draw the uncertainty of the node ages (for
+example, the 95% HPD interval of the ages of a Bayesian analysis) as
+horizontal light blue bars across the nodes. The value of the flag is the
+metadata field with the interval, in the form "{min,max}" (for example,
+"height_95%_hpd", as imported from a BEAST tree), or two fields separated by a
+comma, the first with the minimum age, and the second with the maximum age.
+The ages of the intervals must be in million years. Nodes without an interval
+are drawn without a bar. If an interval is older than the root, the left
+margin is increased so the whole bar is drawn.
+
+Use the flag --calibration to draw the age constraints of a calibration file,
+in which the calibrations are defined by clade names (see the documentation
+of the command set for the format of the file). The age range of each
+calibrated node is drawn as a thin orange bar below the node. Calibrations
+without a maximum age are drawn up to the age of the root.
+
+Use the flag --flag-outliers to draw in red the terminal branches with an
+extreme length (for example, to review a tree just imported). A terminal
+branch is an outlier if its length differs from the mean length of the
+terminal branches of the tree by more than three standard deviations. Use the
+flag --outlier-sd to define a different number of standard deviations.
+
+The size of the drawing is calculated using the width of the terminal names
+and time scale labels in the font of the drawing (in SVG files, as the actual
+font depends on the fonts available in the viewer, the widths of Verdana are
+used for any font other than Arial or Helvetica). Time scale labels that
+overlap with other labels are not drawn. By default, a margin of 5 pixels is
+added at the top and bottom of the drawing, and a margin of 10 pixels is
+added at the left and right of the drawing. Use the flag --margin to define a
+different margin, either as a single value, that will be used for all sides,
+or as four values separated by commas, in the following order:
+"<top>,<right>,<bottom>,<left>".
+
+Use the flag --style with a JSON file to change the appearance of the
+drawing. The file is a JSON object with one or more of the following fields
+(fields not in the file keep its default value):
+
+	-font         the font family of the text (only in SVG files), by
+	              default "Verdana"
+	-font-size    the size of the text, in pixels, by default 10
+	-row-height   the vertical space between terminals, in pixels, by
+	              default 12
+	-line-width   the width of the branches, in pixels, by default 2
+	-line-color   the color of the branches outside a colored clade, by
+	              default "black"
+	-italic       if true (the default), the terminal names are in italics
+	-margin       the margin of the drawing, in the format of the flag
+	              --margin (the flag takes precedence)
+	-tick-width   the width of the time scale and ticks, by default 2
+	-tick-length  the length of the major ticks (minor ticks are half of
+	              it), by default 6
+	-tick-color   the color of the time scale, by default "black"
+	-time-color   the color of the time boxes, by default
+	              "rgb(200,200,200)"
+
+For example, the following style draws a tree with larger text, thinner
+branches, and terminal names in a regular font:
+
+	{
+		"font": "Arial",
+		"font-size": 14,
+		"row-height": 16,
+		"line-width": 1,
+		"italic": false
+	}
+
+The elements of the drawing have "id" and "class" attributes, so the
+drawing can be styled, or animated, with CSS or JavaScript. Each element of a
+node has an ID with the kind of the element, and the ID of the node, for
+example "branch-7". The kinds of elements are:
+
+	-branch       the horizontal line of the node
+	-connector    the vertical line that joins the children of a node
+	-label        the name of a terminal
+	-node         the circle at the node
+	-node-id      the node ID
+	-node-age     the age of the node
+	-bar          the age interval of the node
+	-calibration  the calibrated age range of the node
+	-triangle     the triangle of a summarized clade
+	-badge        the label of a summarized clade
+
+The elements of a node also have the class of its kind, the class "terminal"
+if the node is a terminal, the class "triangle" if the node is drawn as a
+triangle, the class "taxon-<name>" if the node has a taxon name (in lowercase
+and with spaces replaced by dashes, for example "taxon-homo-sapiens"), and a
+class "clade-<id>" for the node and each of its ancestors, so for example, the
+selector ".clade-7" will select all the elements of the clade defined by the
+node 7. The branches with an outlier length have the class "outlier". The
+elements of the time scale have the classes "time-scale", "tick", "minor" or
+"major", "tick-label", and "time-box".
+
+By default, the drawing is an SVG file. Use the flag --format to define a
+different output format. Valid formats are:
+
+	-svg  an SVG file (the default)
+	-png  a PNG image, drawn at twice the size of the SVG drawing
+	-pdf  a single page PDF document (a pixel of the drawing is a point)
+
+In PNG and PDF files, the Go and Helvetica fonts are used instead of Verdana,
+the elements of the drawing do not have IDs or classes, and colors must be
+defined as a name of a basic color (for example "red" or "navy"), a
+hexadecimal value (for example "#ff0000"), or an RGB value (for example
+"rgb(255,0,0)").
+
+The output file will be the name of each tree, with the extension of the
+format. If the flag --output, or -o, is
 defined, the indicated name will be used as the prefix for the output files.
+
+By default, each tree is drawn in its own file. Use the flag --stack to draw
+all the trees in a single file (for example, to compare the trees in a
+figure). The trees are stacked vertically, in the order of the tree names,
+with the name of each tree as its title, and aligned on the same time axis
+(i.e., a given age is at the same horizontal position in all the trees). The
+output file will be "trees", with the extension of the format, or, if the
+flag --output, or -o, is defined, the indicated name, with the extension of
+the format.
 	`,
 	SetFlags: setFlags,
 	Run:      run,
@@ -63,6 +273,24 @@ var timeBox float64
 var scale float64
 var treeName string
 var tickFlag string
+var orderFile string
+var marginFlag string
+var colorFile string
+var legendPos string
+var legendTitle string
+var minSupport float64
+var supportField string
+var triangleFile string
+var formatFlag string
+var nodeLabels string
+var plain bool
+var intervalField string
+var calFile string
+var styleFile string
+var stack bool
+var flagOutliers bool
+var outlierSD float64
+var agePrecision int
 var output string
 
 func setFlags(c *command.Command) {
@@ -73,6 +301,24 @@ func setFlags(c *command.Command) {
 	c.Flags().StringVar(&output, "o", "", "")
 	c.Flags().StringVar(&treeName, "tree", "", "")
 	c.Flags().StringVar(&tickFlag, "tick", "", "")
+	c.Flags().StringVar(&orderFile, "order", "", "")
+	c.Flags().StringVar(&marginFlag, "margin", "", "")
+	c.Flags().StringVar(&colorFile, "color", "", "")
+	c.Flags().StringVar(&legendPos, "legend", "right", "")
+	c.Flags().StringVar(&legendTitle, "legend-title", "", "")
+	c.Flags().Float64Var(&minSupport, "min-support", 0, "")
+	c.Flags().StringVar(&supportField, "support", "", "")
+	c.Flags().StringVar(&triangleFile, "triangle", "", "")
+	c.Flags().StringVar(&formatFlag, "format", "svg", "")
+	c.Flags().StringVar(&nodeLabels, "node-labels", "id", "")
+	c.Flags().BoolVar(&plain, "plain", false, "")
+	c.Flags().IntVar(&agePrecision, "precision", 2, "")
+	c.Flags().StringVar(&intervalField, "interval", "", "")
+	c.Flags().StringVar(&calFile, "calibration", "", "")
+	c.Flags().StringVar(&styleFile, "style", "", "")
+	c.Flags().BoolVar(&stack, "stack", false, "")
+	c.Flags().BoolVar(&flagOutliers, "flag-outliers", false, "")
+	c.Flags().Float64Var(&outlierSD, "outlier-sd", 3, "")
 }
 
 // millionYears is used to transform ages
@@ -86,25 +332,101 @@ func run(c *command.Command, args []string) error {
 		return err
 	}
 
-	coll := timetree.NewCollection()
+	formatFlag = strings.ToLower(strings.TrimSpace(formatFlag))
+	switch formatFlag {
+	case "svg", "png", "pdf":
+	default:
+		return c.UsageError(fmt.Sprintf("unknown format %q", formatFlag))
+	}
 
-	if len(args) == 0 {
-		args = append(args, "-")
+	if styleFile != "" {
+		if err := readStyle(styleFile); err != nil {
+			return err
+		}
+	}
+	if err := setMetrics(); err != nil {
+		return err
+	}
+	if marginFlag == "" {
+		marginFlag = style.Margin
+	}
+	m, err := parseMargin()
+	if err != nil {
+		return err
+	}
+
+	nodeLabels = strings.ToLower(strings.TrimSpace(nodeLabels))
+	if plain {
+		nodeLabels = "none"
+	}
+	switch nodeLabels {
+	case "id", "age", "both", "none":
+	default:
+		return fmt.Errorf("invalid node labels: %q", nodeLabels)
 	}
-	for _, a := range args {
-		nc, err := readCollection(c.Stdin(), a)
+	intervalField = strings.ToLower(strings.Join(strings.Fields(intervalField), ""))
+	if outlierSD <= 0 {
+		return fmt.Errorf("flag --outlier-sd: invalid value %.2f", outlierSD)
+	}
+	if agePrecision < 0 {
+		return fmt.Errorf("invalid precision: %d", agePrecision)
+	}
+
+	legendPos = strings.ToLower(strings.TrimSpace(legendPos))
+	switch legendPos {
+	case "right", "bottom", "none":
+	default:
+		return fmt.Errorf("invalid legend position: %q", legendPos)
+	}
+
+	var colored []clade
+	if colorFile != "" {
+		colored, err = readColors(colorFile)
 		if err != nil {
 			return err
 		}
-
-		for _, tn := range nc.Names() {
-			t := nc.Tree(tn)
-			if err := coll.Add(t); err != nil {
-				return fmt.Errorf("when adding trees from %q: %v", a, err)
+		if formatFlag != "svg" {
+			for _, cl := range colored {
+				if _, err := parseColor(cl.color); err != nil {
+					return fmt.Errorf("%q: clade %q: %v", colorFile, cl.name, err)
+				}
 			}
 		}
 	}
 
+	var triangles []clade
+	if triangleFile != "" {
+		triangles, err = readClades(triangleFile, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	var cals []timetree.Calibration
+	if calFile != "" {
+		cals, err = readCalibrations(calFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var order map[string]float64
+	if orderFile != "" {
+		order, err = readOrder(orderFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
 	var names []string
 	if treeName != "" {
 		names = []string{treeName}
@@ -112,54 +434,108 @@ func run(c *command.Command, args []string) error {
 		names = coll.Names()
 	}
 
+	if stack {
+		return writeStack(coll, names, tv, order, m, colored, triangles, cals)
+	}
+
 	for _, tn := range names {
 		t := coll.Tree(tn)
-		if err := writeSVG(tn, copyTree(t, stepX, tv.min, tv.max, tv.label)); err != nil {
+		name := tn + "." + formatFlag
+		if output != "" {
+			name = fmt.Sprintf("%s-%s", output, name)
+		}
+		if err := writeDrawing(name, []svgTree{copyTree(t, stepX, tv.min, tv.max, tv.label, order, m, colored, lowSupport(t), triangles, cals)}); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func readCollection(r io.Reader, name string) (*timetree.Collection, error) {
-	if name != "-" {
-		f, err := os.Open(name)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		r = f
-	} else {
-		name = "stdin"
+// WriteStack writes all the trees
+// into a single file,
+// with the trees stacked vertically,
+// and aligned on the same time axis.
+func writeStack(coll *timetree.Collection, names []string, tv tickValues, order map[string]float64, m margins, colored, triangles []clade, cals []timetree.Calibration) error {
+	m.top += titleHeight()
+
+	trees := make([]svgTree, 0, len(names))
+	var x0 float64
+	for _, tn := range names {
+		t := coll.Tree(tn)
+		s := copyTree(t, stepX, tv.min, tv.max, tv.label, order, m, colored, lowSupport(t), triangles, cals)
+		x0 = max(x0, s.xAge(0))
+		trees = append(trees, s)
 	}
 
-	c, err := timetree.ReadTSV(r)
+	// the time axis is aligned
+	// by increasing the left margin
+	// of the trees with a younger root
+	for i, tn := range names {
+		t := coll.Tree(tn)
+		tm := trees[i].m
+		tm.left += x0 - trees[i].xAge(0)
+		trees[i] = copyTree(t, stepX, tv.min, tv.max, tv.label, order, tm, colored, lowSupport(t), triangles, cals)
+		trees[i].setTitle(tn)
+	}
+
+	name := "trees." + formatFlag
+	if output != "" {
+		name = output + "." + formatFlag
+	}
+	return writeDrawing(name, trees)
+}
+
+func readCalibrations(name string) ([]timetree.Calibration, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cals, err := timetree.ReadCalibrations(f)
 	if err != nil {
 		return nil, fmt.Errorf("while reading file %q: %v", name, err)
 	}
-	return c, nil
+	return cals, nil
 }
 
-func writeSVG(name string, t svgTree) (err error) {
-	if output != "" {
-		name = fmt.Sprintf("%s-%s.svg", output, name)
-	} else {
-		name += ".svg"
+func writeDrawing(name string, trees []svgTree) (err error) {
+	var width, height float64
+	for _, t := range trees {
+		width = max(width, t.width)
+		height += t.height
 	}
 
-	f, err := os.Create(name)
+	f, err := outfile.Create(name)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		e := f.Close()
-		if e != nil && err == nil {
-			err = e
+		if err != nil {
+			f.Discard()
+			return
 		}
+		err = f.Close()
 	}()
 
 	bw := bufio.NewWriter(f)
-	if err := t.draw(bw); err != nil {
+	switch formatFlag {
+	case "png":
+		var cv *pngCanvas
+		cv, err = newPNGCanvas(width, height)
+		if err != nil {
+			return err
+		}
+		paintTrees(cv, trees)
+		err = cv.encode(bw)
+	case "pdf":
+		cv := newPDFCanvas(width, height)
+		paintTrees(cv, trees)
+		err = cv.encode(bw)
+	default:
+		err = drawSVG(bw, trees)
+	}
+	if err != nil {
 		return fmt.Errorf("while writing file %q: %v", name, err)
 	}
 	if err := bw.Flush(); err != nil {
@@ -168,6 +544,166 @@ func writeSVG(name string, t svgTree) (err error) {
 	return nil
 }
 
+func readOrder(name string) (map[string]float64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	order := make(map[string]float64)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", name, ln, err)
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", name, ln, len(row), 2)
+		}
+
+		tax := strings.Join(strings.Fields(row[0]), " ")
+		if tax == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", name, ln, "value", err)
+		}
+		order[tax] = v
+	}
+	return order, nil
+}
+
+// supportFields are the metadata fields
+// used by default
+// to store support values.
+var supportFields = []string{
+	"bootstrap",
+	"confidence",
+	"posterior",
+	"probability",
+	"support",
+}
+
+// LowSupport returns the internal nodes
+// with a support value below the minimum support.
+func lowSupport(t *timetree.Tree) map[int]bool {
+	if minSupport <= 0 {
+		return nil
+	}
+
+	fields := supportFields
+	if supportField != "" {
+		fields = []string{supportField}
+	}
+
+	low := make(map[int]bool)
+	for _, id := range t.Nodes() {
+		if t.IsTerm(id) || t.IsRoot(id) {
+			continue
+		}
+		for _, f := range fields {
+			v := t.Meta(id, f)
+			if v == "" {
+				continue
+			}
+			s, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				break
+			}
+			if s < minSupport {
+				low[id] = true
+			}
+			break
+		}
+	}
+	return low
+}
+
+// A clade is a named set of taxa.
+type clade struct {
+	name  string
+	color string
+	taxa  []string
+}
+
+func readColors(name string) ([]clade, error) {
+	clades, err := readClades(name, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clades {
+		if c.color == "" {
+			return nil, fmt.Errorf("%q: clade %q: undefined color", name, c.name)
+		}
+	}
+	return clades, nil
+}
+
+// ReadClades reads a TSV file with clade names
+// and taxa,
+// and optionally,
+// a color.
+func readClades(name string, withColor bool) ([]clade, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	var clades []clade
+	idx := make(map[string]int)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", name, ln, err)
+		}
+		want := 2
+		if withColor {
+			want = 3
+		}
+		if len(row) < want {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", name, ln, len(row), want)
+		}
+
+		nm := strings.Join(strings.Fields(row[0]), " ")
+		if nm == "" {
+			continue
+		}
+		i, ok := idx[nm]
+		if !ok {
+			i = len(clades)
+			idx[nm] = i
+			clades = append(clades, clade{name: nm})
+		}
+		if withColor && clades[i].color == "" {
+			clades[i].color = strings.TrimSpace(row[2])
+		}
+		if tax := strings.Join(strings.Fields(row[1]), " "); tax != "" {
+			clades[i].taxa = append(clades[i].taxa, tax)
+		}
+	}
+	return clades, nil
+}
+
 type tickValues struct {
 	min   int
 	max   int
@@ -209,3 +745,46 @@ func parseTick() (tickValues, error) {
 		label: label,
 	}, nil
 }
+
+func parseMargin() (margins, error) {
+	if marginFlag == "" {
+		return margins{
+			top:    5,
+			right:  10,
+			bottom: 5,
+			left:   10,
+		}, nil
+	}
+
+	vals := strings.Split(marginFlag, ",")
+	if len(vals) != 1 && len(vals) != 4 {
+		return margins{}, fmt.Errorf("invalid margin values: %q", marginFlag)
+	}
+
+	var v []float64
+	for _, f := range vals {
+		x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return margins{}, fmt.Errorf("invalid margin value: %q: %v", marginFlag, err)
+		}
+		if x < 0 {
+			return margins{}, fmt.Errorf("invalid margin value: %q: negative value", marginFlag)
+		}
+		v = append(v, x)
+	}
+	if len(v) == 1 {
+		return margins{
+			top:    v[0],
+			right:  v[0],
+			bottom: v[0],
+			left:   v[0],
+		}, nil
+	}
+
+	return margins{
+		top:    v[0],
+		right:  v[1],
+		bottom: v[2],
+		left:   v[3],
+	}, nil
+}
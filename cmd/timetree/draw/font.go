@@ -0,0 +1,147 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"strings"
+
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// A fontMetrics is a table with the advance widths
+// of the printable ASCII characters
+// (from space to tilde)
+// of a font,
+// in units of 1/1000 of the font size.
+// The italic style has nearly the same widths
+// than the regular style,
+// so the same values are used for both styles.
+type fontMetrics struct {
+	widths [95]int
+
+	// width used for characters
+	// outside the printable ASCII range
+	// (the width of "n").
+	def int
+}
+
+// Verdana are the metrics of the Verdana font.
+var verdana = fontMetrics{
+	widths: [...]int{
+		352, 394, 459, 818, 636, 1076, 727, 269, // space to '
+		454, 454, 636, 818, 364, 454, 364, 454, // ( to /
+		636, 636, 636, 636, 636, 636, 636, 636, // 0 to 7
+		636, 636, 454, 454, 818, 818, 818, 545, // 8 to ?
+		1000, 684, 686, 698, 771, 632, 575, 775, // @ to G
+		751, 421, 455, 693, 557, 843, 748, 787, // H to O
+		603, 787, 695, 684, 616, 732, 684, 989, // P to W
+		685, 615, 685, 454, 454, 454, 818, 636, // X to _
+		636, 601, 623, 521, 623, 596, 352, 623, // ` to g
+		633, 274, 344, 592, 274, 973, 633, 607, // h to o
+		623, 623, 427, 521, 394, 633, 592, 818, // p to w
+		592, 592, 525, 635, 454, 635, 818, // x to ~
+	},
+	def: 633,
+}
+
+// Helvetica are the metrics of the Helvetica font
+// (Arial has the same metrics).
+var helvetica = fontMetrics{
+	widths: [...]int{
+		278, 278, 355, 556, 556, 889, 667, 222, // space to '
+		333, 333, 389, 584, 278, 333, 278, 278, // ( to /
+		556, 556, 556, 556, 556, 556, 556, 556, // 0 to 7
+		556, 556, 278, 278, 584, 584, 584, 556, // 8 to ?
+		1015, 667, 667, 722, 722, 667, 611, 778, // @ to G
+		722, 278, 500, 667, 556, 833, 722, 778, // H to O
+		667, 778, 722, 667, 611, 722, 667, 944, // P to W
+		667, 667, 611, 278, 278, 278, 469, 556, // X to _
+		222, 556, 556, 500, 556, 556, 278, 556, // ` to g
+		556, 222, 222, 500, 222, 833, 556, 556, // h to o
+		556, 556, 333, 500, 278, 556, 500, 722, // p to w
+		500, 500, 500, 334, 260, 334, 584, // x to ~
+	},
+	def: 556,
+}
+
+// Metrics are the font metrics
+// used to measure the text of the drawing.
+var metrics = &verdana
+
+// SetMetrics sets the font metrics
+// of the font used in the output format:
+// the Go font in PNG images,
+// Helvetica in PDF documents,
+// and the font of the style in SVG files.
+// As the actual font of an SVG file
+// depends on the fonts available in the viewer,
+// Verdana
+// (a wide font)
+// is used for any font without metrics.
+func setMetrics() error {
+	switch formatFlag {
+	case "png":
+		m, err := goMetrics()
+		if err != nil {
+			return err
+		}
+		metrics = m
+		return nil
+	case "pdf":
+		metrics = &helvetica
+		return nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(style.Font)) {
+	case "arial", "helvetica", "liberation sans":
+		metrics = &helvetica
+	default:
+		metrics = &verdana
+	}
+	return nil
+}
+
+// GoMetrics returns the metrics
+// of the regular Go font.
+func goMetrics() (*fontMetrics, error) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size: 1000,
+		DPI:  72,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	m := &fontMetrics{}
+	for i := range m.widths {
+		adv, _ := face.GlyphAdvance(rune(' ' + i))
+		m.widths[i] = adv.Ceil()
+	}
+	adv, _ := face.GlyphAdvance('n')
+	m.def = adv.Ceil()
+	return m, nil
+}
+
+// TextWidth returns the width
+// (in pixels)
+// of a text
+// for a given font size.
+func textWidth(text string, size float64) float64 {
+	var w int
+	for _, r := range text {
+		if r < ' ' || r > '~' {
+			w += metrics.def
+			continue
+		}
+		w += metrics.widths[r-' ']
+	}
+	return float64(w) * size / 1000
+}
@@ -0,0 +1,113 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+// SwatchSize is the size
+// (in pixels)
+// of the color box of a legend entry.
+const swatchSize = 10
+
+// BoldScale is the increase in width
+// of a text in bold style.
+const boldScale = 1.15
+
+// A legend is a list of the colors used in a drawing.
+type legend struct {
+	title   string
+	entries []clade
+
+	// position of the top-left corner
+	x float64
+	y float64
+}
+
+// Width returns the width of the legend.
+func (l legend) width() float64 {
+	w := textWidth(l.title, style.FontSize) * boldScale
+	for _, c := range l.entries {
+		if x := swatchSize + 5 + textWidth(c.name, style.FontSize); x > w {
+			w = x
+		}
+	}
+	return w
+}
+
+// Height returns the height of the legend.
+func (l legend) height() float64 {
+	rows := len(l.entries)
+	if l.title != "" {
+		rows++
+	}
+	return float64(rows) * style.RowHeight
+}
+
+func (l legend) draw(e *xml.Encoder) {
+	if len(l.entries) == 0 || legendPos == "none" {
+		return
+	}
+
+	g := xml.StartElement{
+		Name: xml.Name{Local: "g"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "id"}, Value: "legend"},
+			{Name: xml.Name{Local: "class"}, Value: "legend"},
+			{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
+		},
+	}
+	e.EncodeToken(g)
+
+	y := l.y
+	if l.title != "" {
+		tx := xml.StartElement{
+			Name: xml.Name{Local: "text"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(l.x))},
+				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + swatchSize))},
+				{Name: xml.Name{Local: "font-weight"}, Value: "bold"},
+				{Name: xml.Name{Local: "class"}, Value: "legend-title"},
+			},
+		}
+		e.EncodeToken(tx)
+		e.EncodeToken(xml.CharData(l.title))
+		e.EncodeToken(tx.End())
+		y += style.RowHeight
+	}
+
+	for _, c := range l.entries {
+		rect := xml.StartElement{
+			Name: xml.Name{Local: "rect"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(l.x))},
+				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + 1))},
+				{Name: xml.Name{Local: "width"}, Value: strconv.Itoa(swatchSize)},
+				{Name: xml.Name{Local: "height"}, Value: strconv.Itoa(swatchSize)},
+				{Name: xml.Name{Local: "fill"}, Value: c.color},
+				{Name: xml.Name{Local: "class"}, Value: "legend-swatch"},
+			},
+		}
+		e.EncodeToken(rect)
+		e.EncodeToken(rect.End())
+
+		tx := xml.StartElement{
+			Name: xml.Name{Local: "text"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(l.x + swatchSize + 5))},
+				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + swatchSize))},
+				{Name: xml.Name{Local: "class"}, Value: "legend-label"},
+			},
+		}
+		e.EncodeToken(tx)
+		e.EncodeToken(xml.CharData(c.name))
+		e.EncodeToken(tx.End())
+		y += style.RowHeight
+	}
+
+	e.EncodeToken(g.End())
+}
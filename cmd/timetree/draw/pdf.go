@@ -0,0 +1,182 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+// A PdfCanvas is a canvas
+// that draws into a single page PDF document.
+// A pixel of the drawing is a point in the page.
+type pdfCanvas struct {
+	width  float64
+	height float64
+	buf    bytes.Buffer
+}
+
+// PdfFonts are the names of the PDF standard fonts
+// used for each font style.
+var pdfFonts = [...]string{
+	regular: "Helvetica",
+	italic:  "Helvetica-Oblique",
+	bold:    "Helvetica-Bold",
+}
+
+func newPDFCanvas(width, height float64) *pdfCanvas {
+	p := &pdfCanvas{
+		width:  math.Ceil(width),
+		height: math.Ceil(height),
+	}
+
+	// flip the vertical axis,
+	// so the origin is at the top-left corner
+	fmt.Fprintf(&p.buf, "1 0 0 -1 0 %s cm\n", pdfNum(p.height))
+	fmt.Fprintf(&p.buf, "1 J 1 j\n")
+	return p
+}
+
+func (p *pdfCanvas) rect(x, y, w, h float64, fill color.RGBA) {
+	fmt.Fprintf(&p.buf, "%s rg\n", pdfColor(fill))
+	fmt.Fprintf(&p.buf, "%s %s %s %s re f\n", pdfNum(x), pdfNum(y), pdfNum(w), pdfNum(h))
+}
+
+func (p *pdfCanvas) line(x1, y1, x2, y2, width float64, stroke color.RGBA) {
+	fmt.Fprintf(&p.buf, "%s w %s RG\n", pdfNum(width), pdfColor(stroke))
+	fmt.Fprintf(&p.buf, "%s %s m %s %s l S\n", pdfNum(x1), pdfNum(y1), pdfNum(x2), pdfNum(y2))
+}
+
+func (p *pdfCanvas) polygon(pts []point, width float64, stroke color.RGBA) {
+	fmt.Fprintf(&p.buf, "%s w %s RG\n", pdfNum(width), pdfColor(stroke))
+	for i, pt := range pts {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&p.buf, "%s %s %s\n", pdfNum(pt.x), pdfNum(pt.y), op)
+	}
+	fmt.Fprintf(&p.buf, "s\n")
+}
+
+func (p *pdfCanvas) circle(x, y, r, width float64, fill, stroke color.RGBA) {
+	fmt.Fprintf(&p.buf, "%s w %s RG %s rg\n", pdfNum(width), pdfColor(stroke), pdfColor(fill))
+
+	k := r * kappa
+	fmt.Fprintf(&p.buf, "%s %s m\n", pdfNum(x+r), pdfNum(y))
+	curve := [][6]float64{
+		{x + r, y + k, x + k, y + r, x, y + r},
+		{x - k, y + r, x - r, y + k, x - r, y},
+		{x - r, y - k, x - k, y - r, x, y - r},
+		{x + k, y - r, x + r, y - k, x + r, y},
+	}
+	for _, c := range curve {
+		fmt.Fprintf(&p.buf, "%s %s %s %s %s %s c\n", pdfNum(c[0]), pdfNum(c[1]), pdfNum(c[2]), pdfNum(c[3]), pdfNum(c[4]), pdfNum(c[5]))
+	}
+	fmt.Fprintf(&p.buf, "b\n")
+}
+
+func (p *pdfCanvas) text(x, y float64, text string, size float64, style fontStyle, fill color.RGBA) {
+	fmt.Fprintf(&p.buf, "%s rg\n", pdfColor(fill))
+
+	// the text matrix flips the text,
+	// so it is not drawn upside down
+	fmt.Fprintf(&p.buf, "BT /F%d %s Tf 1 0 0 -1 %s %s Tm (%s) Tj ET\n", style+1, pdfNum(size), pdfNum(x), pdfNum(y), pdfString(text))
+}
+
+// PdfNum formats a number
+// for a PDF content stream.
+func pdfNum(v float64) string {
+	s := fmt.Sprintf("%.3f", v)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// PdfColor formats a color
+// as RGB components
+// for a PDF content stream.
+func pdfColor(c color.RGBA) string {
+	return fmt.Sprintf("%s %s %s", pdfNum(float64(c.R)/255), pdfNum(float64(c.G)/255), pdfNum(float64(c.B)/255))
+}
+
+// PdfString returns a text
+// as the content of a PDF literal string
+// using the WinAnsi encoding.
+// Characters outside the Latin-1 range
+// are replaced by a question mark.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ':
+			b.WriteByte(' ')
+		case r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func (p *pdfCanvas) encode(w io.Writer) error {
+	var content bytes.Buffer
+	z := zlib.NewWriter(&content)
+	if _, err := z.Write(p.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := z.Close(); err != nil {
+		return err
+	}
+
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 5 0 R /F2 6 0 R /F3 7 0 R >> >> /Contents 4 0 R >>", pdfNum(p.width), pdfNum(p.height)),
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.String()),
+	}
+	for _, f := range pdfFonts {
+		objs = append(objs, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f))
+	}
+
+	bw := bufio.NewWriter(w)
+	var n int
+	write := func(format string, a ...any) {
+		c, _ := fmt.Fprintf(bw, format, a...)
+		n += c
+	}
+
+	write("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = n
+		write("%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+
+	xref := n
+	write("xref\n0 %d\n", len(objs)+1)
+	write("0000000000 65535 f \n")
+	for _, off := range offsets {
+		write("%010d 00000 n \n", off)
+	}
+	write("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+
+	return bw.Flush()
+}
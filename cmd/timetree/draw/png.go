@@ -0,0 +1,212 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// PNGScale is the number of pixels
+// of the PNG image
+// for each pixel of the drawing.
+const pngScale = 2
+
+// A PngCanvas is a canvas
+// that draws into a raster image.
+type pngCanvas struct {
+	img   *image.RGBA
+	fonts map[fontStyle]*opentype.Font
+	faces map[faceKey]font.Face
+}
+
+type faceKey struct {
+	style fontStyle
+	size  float64
+}
+
+func newPNGCanvas(width, height float64) (*pngCanvas, error) {
+	w := int(math.Ceil(width * pngScale))
+	h := int(math.Ceil(height * pngScale))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+
+	fonts := make(map[fontStyle]*opentype.Font, 3)
+	for st, ttf := range map[fontStyle][]byte{
+		regular: goregular.TTF,
+		italic:  goitalic.TTF,
+		bold:    gobold.TTF,
+	} {
+		f, err := opentype.Parse(ttf)
+		if err != nil {
+			return nil, err
+		}
+		fonts[st] = f
+	}
+
+	return &pngCanvas{
+		img:   img,
+		fonts: fonts,
+		faces: make(map[faceKey]font.Face),
+	}, nil
+}
+
+func (p *pngCanvas) rect(x, y, w, h float64, fill color.RGBA) {
+	r := image.Rect(
+		int(math.Round(x*pngScale)),
+		int(math.Round(y*pngScale)),
+		int(math.Round((x+w)*pngScale)),
+		int(math.Round((y+h)*pngScale)),
+	)
+	draw.Draw(p.img, r.Intersect(p.img.Bounds()), image.NewUniform(fill), image.Point{}, draw.Over)
+}
+
+func (p *pngCanvas) line(x1, y1, x2, y2, width float64, stroke color.RGBA) {
+	x1, y1, x2, y2 = x1*pngScale, y1*pngScale, x2*pngScale, y2*pngScale
+	hw := width * pngScale / 2
+
+	minX, maxX := math.Min(x1, x2)-hw, math.Max(x1, x2)+hw
+	minY, maxY := math.Min(y1, y2)-hw, math.Max(y1, y2)+hw
+	z, off := p.rasterizer(minX, minY, maxX, maxY)
+	if z == nil {
+		return
+	}
+
+	// the body of the line
+	dx, dy := x2-x1, y2-y1
+	if l := math.Hypot(dx, dy); l > 0 {
+		nx, ny := -dy/l*hw, dx/l*hw
+		z.MoveTo(float32(x1+nx-off.x), float32(y1+ny-off.y))
+		z.LineTo(float32(x2+nx-off.x), float32(y2+ny-off.y))
+		z.LineTo(float32(x2-nx-off.x), float32(y2-ny-off.y))
+		z.LineTo(float32(x1-nx-off.x), float32(y1-ny-off.y))
+		z.ClosePath()
+		p.fill(z, off, stroke)
+	}
+
+	// round caps
+	// (each shape is filled independently,
+	// so overlapping paths do not cancel)
+	size := z.Size()
+	for _, c := range []point{{x1, y1}, {x2, y2}} {
+		z.Reset(size.X, size.Y)
+		addCircle(z, c.x-off.x, c.y-off.y, hw)
+		p.fill(z, off, stroke)
+	}
+}
+
+func (p *pngCanvas) polygon(pts []point, width float64, stroke color.RGBA) {
+	for i, pt := range pts {
+		nx := pts[(i+1)%len(pts)]
+		p.line(pt.x, pt.y, nx.x, nx.y, width, stroke)
+	}
+}
+
+func (p *pngCanvas) circle(x, y, r, width float64, fill, stroke color.RGBA) {
+	x, y = x*pngScale, y*pngScale
+	outer := (r + width/2) * pngScale
+	inner := (r - width/2) * pngScale
+
+	z, off := p.rasterizer(x-outer, y-outer, x+outer, y+outer)
+	if z == nil {
+		return
+	}
+	addCircle(z, x-off.x, y-off.y, outer)
+	p.fill(z, off, stroke)
+
+	z, off = p.rasterizer(x-inner, y-inner, x+inner, y+inner)
+	if z == nil {
+		return
+	}
+	addCircle(z, x-off.x, y-off.y, inner)
+	p.fill(z, off, fill)
+}
+
+func (p *pngCanvas) text(x, y float64, text string, size float64, style fontStyle, fill color.RGBA) {
+	k := faceKey{style: style, size: size}
+	face, ok := p.faces[k]
+	if !ok {
+		var err error
+		face, err = opentype.NewFace(p.fonts[style], &opentype.FaceOptions{
+			Size:    size * pngScale,
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+		if err != nil {
+			return
+		}
+		p.faces[k] = face
+	}
+
+	d := font.Drawer{
+		Dst:  p.img,
+		Src:  image.NewUniform(fill),
+		Face: face,
+		Dot:  fixed.P(int(math.Round(x*pngScale)), int(math.Round(y*pngScale))),
+	}
+	d.DrawString(text)
+}
+
+// Rasterizer returns a rasterizer
+// for the indicated bounding box
+// (in image coordinates)
+// and the offset of the box.
+func (p *pngCanvas) rasterizer(minX, minY, maxX, maxY float64) (*vector.Rasterizer, point) {
+	r := image.Rect(
+		int(math.Floor(minX)),
+		int(math.Floor(minY)),
+		int(math.Ceil(maxX))+1,
+		int(math.Ceil(maxY))+1,
+	)
+	r = r.Intersect(p.img.Bounds())
+	if r.Empty() {
+		return nil, point{}
+	}
+	return vector.NewRasterizer(r.Dx(), r.Dy()), point{float64(r.Min.X), float64(r.Min.Y)}
+}
+
+// Fill draws the path of a rasterizer
+// with the indicated color.
+func (p *pngCanvas) fill(z *vector.Rasterizer, off point, c color.RGBA) {
+	min := image.Pt(int(off.x), int(off.y))
+	r := image.Rectangle{Min: min, Max: min.Add(z.Size())}
+	z.Draw(p.img, r, image.NewUniform(c), image.Point{})
+}
+
+// Kappa is the distance of the control points
+// of a cubic Bézier curve
+// that approximates a quarter of a circle
+// of radius 1.
+const kappa = 0.5522847498
+
+// AddCircle adds a circle to the path of a rasterizer.
+func addCircle(z *vector.Rasterizer, x, y, r float64) {
+	if r <= 0 {
+		return
+	}
+	k := r * kappa
+	z.MoveTo(float32(x+r), float32(y))
+	z.CubeTo(float32(x+r), float32(y+k), float32(x+k), float32(y+r), float32(x), float32(y+r))
+	z.CubeTo(float32(x-k), float32(y+r), float32(x-r), float32(y+k), float32(x-r), float32(y))
+	z.CubeTo(float32(x-r), float32(y-k), float32(x-k), float32(y-r), float32(x), float32(y-r))
+	z.CubeTo(float32(x+k), float32(y-r), float32(x+r), float32(y-k), float32(x+r), float32(y))
+	z.ClosePath()
+}
+
+func (p *pngCanvas) encode(w io.Writer) error {
+	return png.Encode(w, p.img)
+}
@@ -0,0 +1,122 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// A drawStyle is the set of visual attributes
+// of a drawing.
+type drawStyle struct {
+	// Font is the font family of the text
+	// (only used in SVG files).
+	Font string `json:"font"`
+
+	// FontSize is the size
+	// (in pixels)
+	// of the text of the drawing.
+	FontSize float64 `json:"font-size"`
+
+	// RowHeight is the vertical space
+	// (in pixels)
+	// between two terminals.
+	RowHeight float64 `json:"row-height"`
+
+	// LineWidth is the width
+	// (in pixels)
+	// of the branches.
+	LineWidth float64 `json:"line-width"`
+
+	// LineColor is the color of the branches
+	// and the names of the terminals
+	// outside a colored clade.
+	LineColor string `json:"line-color"`
+
+	// Italic sets the names of the terminals
+	// in italics.
+	Italic bool `json:"italic"`
+
+	// Margin is the margin of the drawing,
+	// using the format of the flag --margin.
+	Margin string `json:"margin"`
+
+	// TickWidth is the width
+	// (in pixels)
+	// of the time scale line and ticks.
+	TickWidth float64 `json:"tick-width"`
+
+	// TickLength is the length
+	// (in pixels)
+	// of the major ticks.
+	// Minor ticks are half the length.
+	TickLength float64 `json:"tick-length"`
+
+	// TickColor is the color of the time scale.
+	TickColor string `json:"tick-color"`
+
+	// TimeColor is the color of the time boxes.
+	TimeColor string `json:"time-color"`
+}
+
+// Style is the style of the drawing.
+var style = drawStyle{
+	Font:       "Verdana",
+	FontSize:   10,
+	RowHeight:  12,
+	LineWidth:  2,
+	LineColor:  "black",
+	Italic:     true,
+	TickWidth:  2,
+	TickLength: 6,
+	TickColor:  "black",
+	TimeColor:  "rgb(200,200,200)",
+}
+
+// ReadStyle reads a style file
+// in JSON format.
+// Fields not defined in the file
+// keep the default value.
+func readStyle(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&style); err != nil {
+		return fmt.Errorf("on file %q: %v", name, err)
+	}
+
+	if style.FontSize <= 0 {
+		return fmt.Errorf("on file %q: invalid font size: %.2f", name, style.FontSize)
+	}
+	if style.RowHeight <= 0 {
+		return fmt.Errorf("on file %q: invalid row height: %.2f", name, style.RowHeight)
+	}
+	if style.LineWidth < 0 || style.TickWidth < 0 || style.TickLength < 0 {
+		return fmt.Errorf("on file %q: invalid negative width or length", name)
+	}
+	if formatFlag != "svg" {
+		for _, c := range []string{style.LineColor, style.TickColor, style.TimeColor} {
+			if _, err := parseColor(c); err != nil {
+				return fmt.Errorf("on file %q: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FontStyle returns the style of the terminal names.
+func (ds drawStyle) fontStyle() fontStyle {
+	if ds.Italic {
+		return italic
+	}
+	return regular
+}
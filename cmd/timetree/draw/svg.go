@@ -10,156 +10,576 @@ import (
 	"io"
 	"math"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/layout"
 )
 
-const yStep = 12
-
-type node struct {
-	x    float64
-	y    int
-	topY int
-	botY int
-
-	id  int
-	tax string
-	age float64
-
-	anc  *node
-	desc []*node
+// Margins are the space
+// (in pixels)
+// around the drawing.
+type margins struct {
+	top    float64
+	right  float64
+	bottom float64
+	left   float64
 }
 
 type svgTree struct {
-	y      int
-	x      float64
-	minAge float64
-	xStep  float64
+	y       int
+	x       float64
+	rootAge float64
+	minAge  float64
+	xStep   float64
+	m       margins
+
+	// size of the drawing
+	width  float64
+	height float64
+
+	// title of the drawing
+	// (the name of the tree),
+	// used when several trees
+	// are drawn in the same file
+	title string
 
 	// timescale ticks
 	min   int // small ticks
 	max   int // large ticks
 	label int // label ticks
 
-	taxSz int
-	root  *node
+	nodes []layout.Node
+	ids   map[int]int
+
+	// class names of the clades
+	// that include a node
+	clades map[int]string
+
+	// colors of the nodes
+	colors map[int]string
+	legend legend
+
+	// labels of the triangles
+	badges map[int]string
+
+	// age intervals of the nodes
+	// (in time scale units)
+	bars map[int][2]float64
+
+	// calibrated age ranges of the nodes
+	// (in time scale units)
+	cals map[int][2]float64
+
+	// terminals with an outlier branch length
+	outliers map[int]bool
+}
+
+// A tickLabel is a label of the time scale.
+type tickLabel struct {
+	x    float64
+	text string
+}
+
+func copyTree(t *timetree.Tree, xStep float64, minTick, maxTick, labelTick int, order map[string]float64, m margins, colored []clade, collapse map[int]bool, triangles []clade, calibrations []timetree.Calibration) svgTree {
+	triNames := make(map[int]string, len(triangles))
+	triNodes := make(map[int]bool, len(triangles))
+	for _, c := range triangles {
+		if id := cladeNode(t, c); id >= 0 && !t.IsTerm(id) {
+			triNames[id] = c.name
+			triNodes[id] = true
+		}
+	}
+
+	bars := ageBars(t)
+	cals := calibrationBars(t, calibrations)
+	rootAge := float64(t.Age(t.Root())) / scale
+	for _, bs := range []map[int][2]float64{bars, cals} {
+		for _, b := range bs {
+			// make room for intervals older than the root
+			if d := (b[1] - rootAge) * xStep; d > 0 && m.left < d+10 {
+				m.left = d + 10
+			}
+		}
+	}
+
+	l := layout.Rectangular(t, layout.Options{
+		XStep:     xStep,
+		YStep:     style.RowHeight,
+		Scale:     scale,
+		Order:     order,
+		Collapse:  collapse,
+		Triangles: triNodes,
+	})
+
+	s := svgTree{
+		y:       int(l.Height),
+		x:       l.Width + m.left,
+		rootAge: float64(l.RootAge) / scale,
+		minAge:  float64(l.MinAge) / scale,
+		xStep:   xStep,
+		m:       m,
+		min:     minTick,
+		max:     maxTick,
+		label:   labelTick,
+		nodes:   l.Nodes,
+		ids:     make(map[int]int, len(l.Nodes)),
+		clades:  make(map[int]string, len(l.Nodes)),
+		colors:  make(map[int]string),
+		badges:  make(map[int]string),
+		bars:    bars,
+		cals:    cals,
+
+		outliers: outlierBranches(t),
+	}
+
+	own := make(map[int]string, len(colored))
+	for _, c := range colored {
+		id := cladeNode(t, c)
+		if id < 0 {
+			continue
+		}
+		own[id] = c.color
+		s.legend.entries = append(s.legend.entries, c)
+	}
+
+	// colors are assigned in the full tree,
+	// so the color of a collapsed node
+	// is passed to its descendants
+	stack := []int{t.Root()}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if c, ok := own[id]; ok {
+			s.colors[id] = c
+		} else if c, ok := s.colors[t.Parent(id)]; ok {
+			s.colors[id] = c
+		}
+		stack = append(stack, t.Children(id)...)
+	}
+
+	width := s.x
+	for i, n := range l.Nodes {
+		s.ids[n.ID] = i
+
+		// nodes are in pre-order
+		// so the ancestors are always defined
+		s.clades[n.ID] = fmt.Sprintf("clade-%d", n.ID)
+		if n.Parent >= 0 {
+			s.clades[n.ID] = s.clades[n.Parent] + " " + s.clades[n.ID]
+		}
+
+		if n.Triangle {
+			b := fmt.Sprintf("%s (%d terminals, %.1f-%.1f)", triNames[n.ID], n.Terms, float64(n.Age)/scale, float64(n.MinAge)/scale)
+			s.badges[n.ID] = strings.TrimSpace(b)
+			x := s.xAge(float64(n.MinAge)/scale) + 10 + textWidth(s.badges[n.ID], style.FontSize)
+			if x > width {
+				width = x
+			}
+			continue
+		}
+		if len(n.Children) > 0 {
+			continue
+		}
+		x := n.X + m.left + 10 + textWidth(n.Taxon, style.FontSize)
+		if x > width {
+			width = x
+		}
+	}
+	for _, tl := range s.tickLabels() {
+		x := tl.x + textWidth(tl.text, style.FontSize)
+		if x > width {
+			width = x
+		}
+	}
+	height := s.scaleY() + style.RowHeight + 5
+
+	if len(s.legend.entries) > 0 && legendPos != "none" {
+		s.legend.title = legendTitle
+		switch legendPos {
+		case "right":
+			s.legend.x = width + 10
+			s.legend.y = m.top
+		case "bottom":
+			s.legend.x = m.left
+			s.legend.y = height + 10
+		}
+		if x := s.legend.x + s.legend.width(); x > width {
+			width = x
+		}
+		if y := s.legend.y + s.legend.height(); y > height {
+			height = y
+		}
+	}
+
+	s.width = width + m.right
+	s.height = height + m.bottom
+
+	return s
+}
+
+// TitleHeight is the space
+// (in pixels)
+// added above a tree
+// for its title.
+func titleHeight() float64 {
+	return style.RowHeight + 5
+}
+
+// SetTitle sets the title of the drawing.
+// The title is printed at the top-left corner,
+// above the top margin,
+// so the top margin must include
+// the space for the title.
+func (s *svgTree) setTitle(title string) {
+	s.title = title
+	if w := s.m.left + textWidth(title, style.FontSize)*boldScale + s.m.right; w > s.width {
+		s.width = w
+	}
 }
 
-func copyTree(t *timetree.Tree, xStep float64, minTick, maxTick, labelTick int) svgTree {
-	maxSz := 0
-	var root *node
-	ids := make(map[int]*node)
+// TitleY returns the Y coordinate in the drawing
+// of the baseline of the title.
+func (s svgTree) titleY() float64 {
+	return s.m.top - titleHeight() + style.FontSize
+}
+
+// BarHeight is the height
+// of the age interval bars.
+const barHeight = 6
+
+// BarColor is the color
+// of the age interval bars.
+const barColor = "lightblue"
+
+// CalHeight is the height
+// of the calibration bars.
+const calHeight = 2
+
+// CalOffset is the vertical distance
+// between a node and its calibration bar.
+const calOffset = 3
+
+// CalColor is the color
+// of the calibration bars.
+const calColor = "orange"
+
+// OutlierColor is the color
+// of the branches with an outlier length.
+const outlierColor = "red"
+
+// OutlierBranches returns the terminals
+// with a branch length
+// that differs from the mean length
+// of the terminal branches of the tree
+// by more than the number of standard deviations
+// of the flag --outlier-sd.
+func outlierBranches(t *timetree.Tree) map[int]bool {
+	if !flagOutliers {
+		return nil
+	}
 
-	minAge := float64(t.Age(t.Root())) / scale
+	var terms []int
+	var sum float64
 	for _, id := range t.Nodes() {
-		var anc *node
-		p := t.Parent(id)
-		if p >= 0 {
-			anc = ids[p]
+		if !t.IsTerm(id) {
+			continue
 		}
+		terms = append(terms, id)
+		sum += float64(t.BranchLen(id))
+	}
+	if len(terms) < 3 {
+		return nil
+	}
+	mean := sum / float64(len(terms))
+
+	var ss float64
+	for _, id := range terms {
+		d := float64(t.BranchLen(id)) - mean
+		ss += d * d
+	}
+	sd := math.Sqrt(ss / float64(len(terms)-1))
+	if sd == 0 {
+		return nil
+	}
 
-		n := &node{
-			id:  id,
-			tax: t.Taxon(id),
-			anc: anc,
-			age: float64(t.Age(id)) / scale,
+	outliers := make(map[int]bool)
+	for _, id := range terms {
+		if math.Abs(float64(t.BranchLen(id))-mean) > outlierSD*sd {
+			outliers[id] = true
 		}
-		if anc == nil {
-			root = n
-		} else {
-			anc.desc = append(anc.desc, n)
+	}
+	return outliers
+}
+
+// CalibrationBars returns the calibrated age ranges
+// of the nodes of a tree,
+// in time scale units.
+// Calibrations without a maximum age
+// end at the age of the root.
+func calibrationBars(t *timetree.Tree, cals []timetree.Calibration) map[int][2]float64 {
+	bars := make(map[int][2]float64)
+	rootAge := t.Age(t.Root())
+	for _, c := range cals {
+		id := c.Node(t)
+		if id < 0 {
+			continue
 		}
-		ids[id] = n
-		if len(n.tax) > maxSz {
-			maxSz = len(n.tax)
+		maxAge := c.Max
+		if maxAge == math.MaxInt64 {
+			maxAge = max(rootAge, c.Min)
 		}
-		if n.age < minAge {
-			minAge = n.age
+		bars[id] = [2]float64{float64(c.Min) / scale, float64(maxAge) / scale}
+	}
+	return bars
+}
+
+// AgeBars returns the age intervals
+// of the nodes of a tree,
+// in time scale units,
+// as defined by the field (or fields)
+// of the flag --interval.
+// Nodes without a valid interval are ignored.
+func ageBars(t *timetree.Tree) map[int][2]float64 {
+	bars := make(map[int][2]float64)
+	if intervalField == "" {
+		return bars
+	}
+
+	minField, maxField, two := strings.Cut(intervalField, ",")
+	for _, id := range t.Nodes() {
+		v := t.Meta(id, minField)
+		if two {
+			v += "," + t.Meta(id, maxField)
+		}
+		b, ok := parseInterval(v)
+		if !ok {
+			continue
 		}
+		bars[id] = [2]float64{b[0] * millionYears / scale, b[1] * millionYears / scale}
 	}
+	return bars
+}
 
-	s := svgTree{
-		xStep:  xStep,
-		minAge: minAge,
-		min:    minTick,
-		max:    maxTick,
-		label:  labelTick,
-		root:   root,
-		taxSz:  maxSz,
+// ParseInterval parses an age interval,
+// in million years,
+// in the form "{min,max}",
+// or "min,max".
+func parseInterval(v string) ([2]float64, bool) {
+	v = strings.TrimSpace(v)
+	v = strings.TrimPrefix(v, "{")
+	v = strings.TrimSuffix(v, "}")
+	lo, hi, ok := strings.Cut(v, ",")
+	if !ok {
+		return [2]float64{}, false
+	}
+	min, err := strconv.ParseFloat(strings.TrimSpace(lo), 64)
+	if err != nil {
+		return [2]float64{}, false
+	}
+	max, err := strconv.ParseFloat(strings.TrimSpace(hi), 64)
+	if err != nil {
+		return [2]float64{}, false
 	}
+	if min > max {
+		min, max = max, min
+	}
+	return [2]float64{min, max}, true
+}
 
-	s.prepare(root)
-	s.y = s.y * yStep
+// CladeNode returns the ID of the most recent common ancestor
+// of the taxa of a clade
+// that are present in a tree.
+// If the clade does not have taxa,
+// it returns the node with the name of the clade.
+// It returns -1 if no taxon is in the tree.
+func cladeNode(t *timetree.Tree, c clade) int {
+	if len(c.taxa) == 0 {
+		id, ok := t.TaxNode(c.name)
+		if !ok {
+			return -1
+		}
+		return id
+	}
 
-	return s
+	var names []string
+	for _, tax := range c.taxa {
+		id, ok := t.TaxNode(tax)
+		if !ok {
+			continue
+		}
+		names = append(names, t.Taxon(id))
+	}
+	if len(names) == 0 {
+		return -1
+	}
+	return t.MRCA(names...)
 }
 
-func (s *svgTree) prepare(n *node) {
-	n.x = (s.root.age-n.age)*s.xStep + 10
-	if s.x < n.x {
-		s.x = n.x
+// Class returns the class attribute
+// of an element of a node.
+func (s svgTree) class(kind string, n layout.Node) xml.Attr {
+	c := kind
+	if n.Triangle {
+		if kind != "triangle" {
+			c += " triangle"
+		}
+	} else if len(n.Children) == 0 {
+		c += " terminal"
+	}
+	if n.Taxon != "" {
+		c += " taxon-" + cssName(n.Taxon)
 	}
+	c += " " + s.clades[n.ID]
+	return xml.Attr{Name: xml.Name{Local: "class"}, Value: c}
+}
 
-	if n.desc == nil {
-		n.y = s.y*yStep + 5
-		s.y += 1
-		return
+// CSSName returns a name
+// that can be used as an ID or class
+// in CSS selectors.
+func cssName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteRune('-')
 	}
+	return b.String()
+}
+
+// XAge returns the X coordinate in the drawing
+// of an age in time scale units.
+func (s svgTree) xAge(a float64) float64 {
+	return (s.rootAge-a)*s.xStep + s.m.left
+}
 
-	botY := 0
-	topY := math.MaxInt
-	for _, d := range n.desc {
-		s.prepare(d)
-		if d.y < topY {
-			topY = d.y
+// ScaleY returns the Y coordinate in the drawing
+// of the time scale.
+func (s svgTree) scaleY() float64 {
+	return float64(s.y) + s.m.top
+}
+
+// TickLabels returns the labels of the time scale.
+// Labels are centered at its tick,
+// and a label that overlaps
+// with a previous label
+// is skipped.
+func (s svgTree) tickLabels() []tickLabel {
+	gap := textWidth(" ", style.FontSize)
+
+	var labels []tickLabel
+	prev := math.Inf(1)
+	for a := 0.0; a < s.rootAge; a += float64(s.min) {
+		if a < s.minAge {
+			continue
 		}
-		if d.y > botY {
-			botY = d.y
+		if int(a)%s.label != 0 {
+			continue
 		}
+
+		text := strconv.Itoa(int(a))
+		w := textWidth(text, style.FontSize)
+		x := s.xAge(a) - w/2
+		if x+w+gap > prev {
+			continue
+		}
+		labels = append(labels, tickLabel{x: x, text: text})
+		prev = x
 	}
-	n.topY = topY
-	n.botY = botY
-	n.y = topY + (botY-topY)/2
+	return labels
 }
 
-func (s svgTree) draw(w io.Writer) error {
+// DrawSVG writes one or more trees
+// into an SVG file.
+// The trees are stacked vertically.
+func drawSVG(w io.Writer, trees []svgTree) error {
+	var width, height float64
+	for _, s := range trees {
+		width = max(width, s.width)
+		height += s.height
+	}
+
 	fmt.Fprintf(w, "%s", xml.Header)
 	e := xml.NewEncoder(w)
 	svg := xml.StartElement{
 		Name: xml.Name{Local: "svg"},
 		Attr: []xml.Attr{
-			{Name: xml.Name{Local: "height"}, Value: strconv.Itoa(s.y + 5 + 2*yStep)},
-			// assume that each character has 6 pixels wide
-			{Name: xml.Name{Local: "width"}, Value: strconv.Itoa(int(s.x) + s.taxSz*6)},
+			{Name: xml.Name{Local: "height"}, Value: strconv.Itoa(int(math.Ceil(height)))},
+			{Name: xml.Name{Local: "width"}, Value: strconv.Itoa(int(math.Ceil(width)))},
 			{Name: xml.Name{Local: "xmlns"}, Value: "http://www.w3.org/2000/svg"},
 		},
 	}
 	e.EncodeToken(svg)
 
+	var y float64
+	for _, s := range trees {
+		s.draw(e, y)
+		y += s.height
+	}
+
+	e.EncodeToken(svg.End())
+	if err := e.Flush(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Draw encodes the elements of a tree
+// moved down by the indicated number of pixels.
+func (s svgTree) draw(e *xml.Encoder, dy float64) {
 	g := xml.StartElement{
 		Name: xml.Name{Local: "g"},
 		Attr: []xml.Attr{
-			{Name: xml.Name{Local: "stroke-width"}, Value: "2"},
-			{Name: xml.Name{Local: "stroke"}, Value: "black"},
+			{Name: xml.Name{Local: "stroke-width"}, Value: formatFloat(style.LineWidth)},
+			{Name: xml.Name{Local: "stroke"}, Value: style.LineColor},
 			{Name: xml.Name{Local: "stroke-linecap"}, Value: "round"},
-			{Name: xml.Name{Local: "font-family"}, Value: "Verdana"},
-			{Name: xml.Name{Local: "font-size"}, Value: "10"},
+			{Name: xml.Name{Local: "font-family"}, Value: style.Font},
+			{Name: xml.Name{Local: "font-size"}, Value: formatFloat(style.FontSize)},
 		},
 	}
+	if dy > 0 {
+		g.Attr = append(g.Attr, xml.Attr{Name: xml.Name{Local: "transform"}, Value: fmt.Sprintf("translate(0,%s)", formatFloat(dy))})
+	}
 	e.EncodeToken(g)
 
 	s.drawTimeRecs(e)
 	s.drawTimeScale(e)
+	s.drawTitle(e)
 
-	s.root.draw(e)
-	s.root.label(e)
+	for _, n := range s.nodes {
+		s.drawBar(e, n)
+	}
+	for _, n := range s.nodes {
+		s.drawNode(e, n)
+	}
+	for _, n := range s.nodes {
+		s.labelNode(e, n)
+	}
+	s.legend.draw(e)
 
 	e.EncodeToken(g.End())
-	e.EncodeToken(svg.End())
-	if err := e.Flush(); err != nil {
-		return err
+}
+
+func (s svgTree) drawTitle(e *xml.Encoder) {
+	if s.title == "" {
+		return
 	}
-	return nil
+	tx := xml.StartElement{
+		Name: xml.Name{Local: "text"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(s.m.left))},
+			{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(s.titleY()))},
+			{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
+			{Name: xml.Name{Local: "font-weight"}, Value: "bold"},
+			{Name: xml.Name{Local: "class"}, Value: "tree-title"},
+		},
+	}
+	e.EncodeToken(tx)
+	e.EncodeToken(xml.CharData(s.title))
+	e.EncodeToken(tx.End())
 }
 
 func (s svgTree) drawTimeRecs(e *xml.Encoder) {
@@ -167,18 +587,18 @@ func (s svgTree) drawTimeRecs(e *xml.Encoder) {
 		return
 	}
 
-	height := s.y
+	height := s.scaleY()
 	for a := 0.0; ; a += timeBox * 2 {
 		if a+timeBox < s.minAge {
 			continue
 		}
-		maxX := (s.root.age-a)*s.xStep + 10
+		maxX := s.xAge(a)
 		if maxX > s.x {
 			maxX = s.x
 		}
-		minX := (s.root.age-(a+timeBox))*s.xStep + 10
+		minX := s.xAge(a + timeBox)
 
-		if maxX < s.root.x {
+		if maxX < s.m.left {
 			break
 		}
 
@@ -189,7 +609,8 @@ func (s svgTree) drawTimeRecs(e *xml.Encoder) {
 				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(minX))},
 				{Name: xml.Name{Local: "width"}, Value: strconv.Itoa(int(maxX - minX))},
 				{Name: xml.Name{Local: "height"}, Value: strconv.Itoa(int(height))},
-				{Name: xml.Name{Local: "style"}, Value: "fill:rgb(200,200,200); stroke-width:0"},
+				{Name: xml.Name{Local: "style"}, Value: "fill:" + style.TimeColor + "; stroke-width:0"},
+				{Name: xml.Name{Local: "class"}, Value: "time-box"},
 			},
 		}
 		e.EncodeToken(rect)
@@ -198,136 +619,324 @@ func (s svgTree) drawTimeRecs(e *xml.Encoder) {
 }
 
 func (s svgTree) drawTimeScale(e *xml.Encoder) {
-	y := s.y + yStep/2
+	y := s.scaleY()
 	ln := xml.StartElement{
 		Name: xml.Name{Local: "line"},
 		Attr: []xml.Attr{
-			{Name: xml.Name{Local: "x1"}, Value: strconv.Itoa(int(s.root.x))},
+			{Name: xml.Name{Local: "x1"}, Value: strconv.Itoa(int(s.m.left))},
 			{Name: xml.Name{Local: "y1"}, Value: strconv.Itoa(int(y))},
 			{Name: xml.Name{Local: "x2"}, Value: strconv.Itoa(int(s.x))},
 			{Name: xml.Name{Local: "y2"}, Value: strconv.Itoa(int(y))},
+			{Name: xml.Name{Local: "stroke"}, Value: style.TickColor},
+			{Name: xml.Name{Local: "stroke-width"}, Value: formatFloat(style.TickWidth)},
+			{Name: xml.Name{Local: "id"}, Value: "time-scale"},
+			{Name: xml.Name{Local: "class"}, Value: "time-scale"},
 		},
 	}
 	e.EncodeToken(ln)
 	e.EncodeToken(ln.End())
 
+	// ticks do not have ID
+	ln.Attr = append(ln.Attr[:6], xml.Attr{Name: xml.Name{Local: "class"}})
+
 	// Add tick marks
-	for a := 0.0; a < s.root.age; a += float64(s.min) {
+	for a := 0.0; a < s.rootAge; a += float64(s.min) {
 		if a < s.minAge {
 			continue
 		}
 
-		x := (s.root.age-a)*s.xStep + 10
+		x := s.xAge(a)
 		ln.Attr[0].Value = strconv.Itoa(int(x))
 		ln.Attr[2].Value = strconv.Itoa(int(x))
 
-		maxY := y + yStep/4
+		maxY := y + style.TickLength/2
+		ln.Attr[6].Value = "tick minor"
 		if int(a)%s.max == 0 {
-			maxY = y + yStep/2
+			maxY = y + style.TickLength
+			ln.Attr[6].Value = "tick major"
 		}
 		ln.Attr[3].Value = strconv.Itoa(int(maxY))
 		e.EncodeToken(ln)
 		e.EncodeToken(ln.End())
+	}
 
-		// tick label
-		if int(a)%s.label != 0 {
-			continue
-		}
+	// tick labels
+	for _, tl := range s.tickLabels() {
 		tx := xml.StartElement{
 			Name: xml.Name{Local: "text"},
 			Attr: []xml.Attr{
-				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(x - 5))},
-				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + yStep + 5))},
+				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(tl.x))},
+				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + style.RowHeight + 5))},
 				{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
+				{Name: xml.Name{Local: "class"}, Value: "tick-label"},
 			},
 		}
 		e.EncodeToken(tx)
-		e.EncodeToken(xml.CharData(strconv.Itoa(int(a))))
+		e.EncodeToken(xml.CharData(tl.text))
 		e.EncodeToken(tx.End())
-
 	}
 }
 
-func (n node) draw(e *xml.Encoder) {
+func (s svgTree) drawNode(e *xml.Encoder, n layout.Node) {
+	x := n.X + s.m.left
+	y := n.Y + s.m.top
+
 	// horizontal line
 	ln := xml.StartElement{
 		Name: xml.Name{Local: "line"},
 		Attr: []xml.Attr{
-			{Name: xml.Name{Local: "x1"}, Value: strconv.Itoa(int(n.x - 5))},
-			{Name: xml.Name{Local: "y1"}, Value: strconv.Itoa(int(n.y))},
-			{Name: xml.Name{Local: "x2"}, Value: strconv.Itoa(int(n.x))},
-			{Name: xml.Name{Local: "y2"}, Value: strconv.Itoa(int(n.y))},
+			{Name: xml.Name{Local: "x1"}, Value: strconv.Itoa(int(x - 5))},
+			{Name: xml.Name{Local: "y1"}, Value: strconv.Itoa(int(y))},
+			{Name: xml.Name{Local: "x2"}, Value: strconv.Itoa(int(x))},
+			{Name: xml.Name{Local: "y2"}, Value: strconv.Itoa(int(y))},
+			{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("branch-%d", n.ID)},
+			s.class("branch", n),
 		},
 	}
-	if n.anc != nil {
-		ln.Attr[0].Value = strconv.Itoa(int(n.anc.x))
+	if n.Parent >= 0 {
+		anc := s.nodes[s.ids[n.Parent]]
+		ln.Attr[0].Value = strconv.Itoa(int(anc.X + s.m.left))
+	}
+	c, ok := s.colors[n.ID]
+	if s.outliers[n.ID] {
+		ln.Attr[5].Value += " outlier"
+		c, ok = outlierColor, true
+	}
+	if ok {
+		ln.Attr = append(ln.Attr, xml.Attr{Name: xml.Name{Local: "stroke"}, Value: c})
 	}
 	e.EncodeToken(ln)
 	e.EncodeToken(ln.End())
 
+	if n.Triangle {
+		s.drawTriangle(e, n)
+		return
+	}
+
 	// terminal name
-	if n.desc == nil {
+	if len(n.Children) == 0 {
 		return
 	}
 
 	// draws vertical line
 	ln.Attr[0].Value = ln.Attr[2].Value
-	ln.Attr[1].Value = strconv.Itoa(int(n.topY))
-	ln.Attr[3].Value = strconv.Itoa(int(n.botY))
+	ln.Attr[1].Value = strconv.Itoa(int(n.Top + s.m.top))
+	ln.Attr[3].Value = strconv.Itoa(int(n.Bottom + s.m.top))
+	ln.Attr[4].Value = fmt.Sprintf("connector-%d", n.ID)
+	ln.Attr[5] = s.class("connector", n)
 	e.EncodeToken(ln)
 	e.EncodeToken(ln.End())
+}
+
+func (s svgTree) drawBar(e *xml.Encoder, n layout.Node) {
+	s.drawCalibration(e, n)
 
-	for _, d := range n.desc {
-		d.draw(e)
+	b, ok := s.bars[n.ID]
+	if !ok {
+		return
 	}
+	x1 := s.xAge(b[1])
+	x2 := s.xAge(b[0])
+	y := n.Y + s.m.top
+
+	rect := xml.StartElement{
+		Name: xml.Name{Local: "rect"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(x1))},
+			{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y - barHeight/2))},
+			{Name: xml.Name{Local: "width"}, Value: strconv.Itoa(int(math.Ceil(x2 - x1)))},
+			{Name: xml.Name{Local: "height"}, Value: strconv.Itoa(barHeight)},
+			{Name: xml.Name{Local: "fill"}, Value: barColor},
+			{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
+			{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("bar-%d", n.ID)},
+			s.class("bar", n),
+		},
+	}
+	e.EncodeToken(rect)
+	e.EncodeToken(rect.End())
+}
+
+func (s svgTree) drawCalibration(e *xml.Encoder, n layout.Node) {
+	b, ok := s.cals[n.ID]
+	if !ok {
+		return
+	}
+	x1 := s.xAge(b[1])
+	x2 := s.xAge(b[0])
+	y := n.Y + s.m.top
+
+	rect := xml.StartElement{
+		Name: xml.Name{Local: "rect"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(x1))},
+			{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + calOffset))},
+			{Name: xml.Name{Local: "width"}, Value: strconv.Itoa(int(math.Ceil(x2 - x1)))},
+			{Name: xml.Name{Local: "height"}, Value: strconv.Itoa(calHeight)},
+			{Name: xml.Name{Local: "fill"}, Value: calColor},
+			{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
+			{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("calibration-%d", n.ID)},
+			s.class("calibration", n),
+		},
+	}
+	e.EncodeToken(rect)
+	e.EncodeToken(rect.End())
 }
 
-func (n node) label(e *xml.Encoder) {
-	if n.desc == nil {
+func (s svgTree) drawTriangle(e *xml.Encoder, n layout.Node) {
+	x := n.X + s.m.left
+	y := n.Y + s.m.top
+	x2 := s.xAge(float64(n.MinAge) / scale)
+	h := style.RowHeight/2 - 1
+
+	pts := fmt.Sprintf("%d,%d %d,%d %d,%d", int(x), int(y), int(x2), int(y-h), int(x2), int(y+h))
+	poly := xml.StartElement{
+		Name: xml.Name{Local: "polygon"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "points"}, Value: pts},
+			{Name: xml.Name{Local: "fill"}, Value: "none"},
+			{Name: xml.Name{Local: "stroke-width"}, Value: "1"},
+			{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("triangle-%d", n.ID)},
+			s.class("triangle", n),
+		},
+	}
+	if c, ok := s.colors[n.ID]; ok {
+		poly.Attr = append(poly.Attr, xml.Attr{Name: xml.Name{Local: "stroke"}, Value: c})
+	}
+	e.EncodeToken(poly)
+	e.EncodeToken(poly.End())
+}
+
+func (s svgTree) labelNode(e *xml.Encoder, n layout.Node) {
+	x := n.X + s.m.left
+	y := n.Y + s.m.top
+
+	if n.Triangle {
 		tx := xml.StartElement{
 			Name: xml.Name{Local: "text"},
 			Attr: []xml.Attr{
-				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(n.x + 10))},
-				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(n.y + 5))},
+				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(s.xAge(float64(n.MinAge)/scale) + 10))},
+				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + 5))},
 				{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
-				{Name: xml.Name{Local: "font-style"}, Value: "italic"},
+				{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("badge-%d", n.ID)},
+				s.class("badge", n),
 			},
 		}
+		if c, ok := s.colors[n.ID]; ok {
+			tx.Attr = append(tx.Attr, xml.Attr{Name: xml.Name{Local: "fill"}, Value: c})
+		}
 		e.EncodeToken(tx)
-		e.EncodeToken(xml.CharData(n.tax))
+		e.EncodeToken(xml.CharData(s.badges[n.ID]))
+		e.EncodeToken(tx.End())
+	} else if len(n.Children) == 0 {
+		tx := xml.StartElement{
+			Name: xml.Name{Local: "text"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(x + 10))},
+				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + 5))},
+				{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
+				{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("label-%d", n.ID)},
+				s.class("label", n),
+			},
+		}
+		if style.Italic {
+			tx.Attr = append(tx.Attr, xml.Attr{Name: xml.Name{Local: "font-style"}, Value: "italic"})
+		}
+		if c, ok := s.colors[n.ID]; ok {
+			tx.Attr = append(tx.Attr, xml.Attr{Name: xml.Name{Local: "fill"}, Value: c})
+		}
+		e.EncodeToken(tx)
+		e.EncodeToken(xml.CharData(n.Taxon))
 		e.EncodeToken(tx.End())
 	}
 
-	// draws a circle at the node
-	circ := xml.StartElement{
-		Name: xml.Name{Local: "circle"},
-		Attr: []xml.Attr{
-			{Name: xml.Name{Local: "cx"}, Value: strconv.Itoa(int(n.x))},
-			{Name: xml.Name{Local: "cy"}, Value: strconv.Itoa(int(n.y))},
-			{Name: xml.Name{Local: "r"}, Value: "7"},
-			{Name: xml.Name{Local: "fill"}, Value: "white"},
-			{Name: xml.Name{Local: "stroke"}, Value: "black"},
-			{Name: xml.Name{Local: "stroke-width"}, Value: "1"},
-		},
+	if showIDs() {
+		// draws a circle at the node
+		circ := xml.StartElement{
+			Name: xml.Name{Local: "circle"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "cx"}, Value: strconv.Itoa(int(x))},
+				{Name: xml.Name{Local: "cy"}, Value: strconv.Itoa(int(y))},
+				{Name: xml.Name{Local: "r"}, Value: "7"},
+				{Name: xml.Name{Local: "fill"}, Value: "white"},
+				{Name: xml.Name{Local: "stroke"}, Value: "black"},
+				{Name: xml.Name{Local: "stroke-width"}, Value: "1"},
+				{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("node-%d", n.ID)},
+				s.class("node", n),
+			},
+		}
+		e.EncodeToken(circ)
+		e.EncodeToken(circ.End())
+
+		// put node ID
+		tx := xml.StartElement{
+			Name: xml.Name{Local: "text"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(x - 5))},
+				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + 2))},
+				{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
+				{Name: xml.Name{Local: "font-size"}, Value: "6"},
+				{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("node-id-%d", n.ID)},
+				s.class("node-id", n),
+			},
+		}
+		e.EncodeToken(tx)
+		e.EncodeToken(xml.CharData(strconv.Itoa(n.ID)))
+		e.EncodeToken(tx.End())
 	}
-	e.EncodeToken(circ)
-	e.EncodeToken(circ.End())
 
-	// put node ID
-	tx := xml.StartElement{
-		Name: xml.Name{Local: "text"},
-		Attr: []xml.Attr{
-			{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(n.x - 5))},
-			{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(n.y + 2))},
-			{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
-			{Name: xml.Name{Local: "font-size"}, Value: "6"},
-		},
+	// put node age
+	if showAges() && len(n.Children) > 0 && !n.Triangle {
+		tx := xml.StartElement{
+			Name: xml.Name{Local: "text"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(int(x + ageOffset()))},
+				{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(int(y + 3))},
+				{Name: xml.Name{Local: "stroke-width"}, Value: "0"},
+				{Name: xml.Name{Local: "font-size"}, Value: strconv.Itoa(ageSize)},
+				{Name: xml.Name{Local: "id"}, Value: fmt.Sprintf("node-age-%d", n.ID)},
+				s.class("node-age", n),
+			},
+		}
+		e.EncodeToken(tx)
+		e.EncodeToken(xml.CharData(ageLabel(n.Age)))
+		e.EncodeToken(tx.End())
 	}
-	e.EncodeToken(tx)
-	e.EncodeToken(xml.CharData(strconv.Itoa(n.id)))
-	e.EncodeToken(tx.End())
+}
+
+// AgeSize is the font size
+// of the node age labels.
+const ageSize = 8
+
+// ShowIDs returns true if the node IDs
+// should be drawn.
+func showIDs() bool {
+	return nodeLabels == "id" || nodeLabels == "both"
+}
+
+// ShowAges returns true if the ages
+// of the internal nodes
+// should be drawn.
+func showAges() bool {
+	return nodeLabels == "age" || nodeLabels == "both"
+}
 
-	for _, d := range n.desc {
-		d.label(e)
+// AgeOffset returns the horizontal distance
+// between a node and its age label.
+func ageOffset() float64 {
+	if showIDs() {
+		return 9
 	}
+	return 3
+}
+
+// AgeLabel returns the age of a node
+// in time scale units.
+func ageLabel(age int64) string {
+	return strconv.FormatFloat(float64(age)/scale, 'f', agePrecision, 64)
+}
+
+// FormatFloat returns a number
+// in the shortest representation.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
 }
@@ -0,0 +1,242 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package dryrun implements the global --dry-run flag
+// used by the commands that modify trees.
+//
+// When the flag is set,
+// a command performs all the parsing and validation,
+// and instead of writing the resulting trees,
+// it prints a report of the changes.
+package dryrun
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+)
+
+// Enabled is true if the --dry-run flag is set.
+var Enabled bool
+
+// SetFlags sets the --dry-run flag
+// in the root command.
+func SetFlags(c *command.Command) {
+	c.Flags().BoolVar(&Enabled, "dry-run", false, "")
+}
+
+// Copy returns a copy of a collection
+// that can be used to report the changes made
+// by a command.
+// If the --dry-run flag is not set,
+// it returns nil.
+func Copy(c *timetree.Collection) *timetree.Collection {
+	if !Enabled {
+		return nil
+	}
+
+	cp := timetree.NewCollection()
+	if c == nil {
+		return cp
+	}
+	for _, tn := range c.Names() {
+		cp.Add(c.Tree(tn).Clone())
+	}
+	return cp
+}
+
+// Renames are the terminal names
+// changed by a command,
+// for each tree.
+var renames = make(map[string]map[string]string)
+
+// Rename registers a change
+// in the name of a terminal of a tree,
+// so the terminal can be identified
+// in the original and the modified trees.
+func Rename(tree, old, name string) {
+	m, ok := renames[tree]
+	if !ok {
+		m = make(map[string]string)
+		renames[tree] = m
+	}
+	m[old] = name
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+// Report writes the changes
+// between the original collection
+// and the modified collection.
+// A node is identified by its descendant terminals,
+// so a change in the topology of a tree
+// is reported as removed and added nodes.
+func Report(w io.Writer, orig, mod *timetree.Collection) {
+	var changes int
+	for _, tn := range orig.Names() {
+		if mod.Tree(tn) == nil {
+			fmt.Fprintf(w, "tree %q: removed\n", tn)
+			changes++
+		}
+	}
+	for _, tn := range mod.Names() {
+		t := mod.Tree(tn)
+		o := orig.Tree(tn)
+		if o == nil {
+			fmt.Fprintf(w, "tree %q: added: %d terminals, root age %.6f\n", tn, t.NumTerms(), float64(t.Age(t.Root()))/millionYears)
+			changes++
+			continue
+		}
+		changes += compare(w, tn, o, t)
+	}
+	if changes == 0 {
+		fmt.Fprintf(w, "no changes\n")
+	}
+}
+
+// Compare writes the changes between two versions of a tree
+// and returns the number of changes.
+func compare(w io.Writer, name string, orig, mod *timetree.Tree) int {
+	var changes int
+	if orig.Offset() != mod.Offset() {
+		fmt.Fprintf(w, "tree %q: offset: %.6f -> %.6f\n", name, float64(orig.Offset())/millionYears, float64(mod.Offset())/millionYears)
+		changes++
+	}
+
+	names := renames[name]
+	common := make(map[string]bool)
+	for _, tax := range orig.Terms() {
+		if nn, ok := names[tax]; ok {
+			tax = nn
+		}
+		if _, ok := mod.TaxNode(tax); ok {
+			common[tax] = true
+		}
+	}
+
+	oNodes := clades(orig, names, common)
+	mNodes := clades(mod, nil, common)
+	for _, id := range orig.Nodes() {
+		if _, ok := oNodes.match(id, mNodes); !ok {
+			fmt.Fprintf(w, "tree %q: node removed: %s\n", name, desc(orig, id))
+			changes++
+		}
+	}
+	for _, id := range mod.Nodes() {
+		oID, ok := mNodes.match(id, oNodes)
+		if !ok {
+			fmt.Fprintf(w, "tree %q: node added: %s, age %.6f\n", name, desc(mod, id), float64(mod.Age(id))/millionYears)
+			changes++
+			continue
+		}
+
+		if oa, ma := orig.Age(oID), mod.Age(id); oa != ma {
+			fmt.Fprintf(w, "tree %q: age: %s: %.6f -> %.6f\n", name, desc(mod, id), float64(oa)/millionYears, float64(ma)/millionYears)
+			changes++
+		}
+		if on, mn := orig.Taxon(oID), mod.Taxon(id); on != mn {
+			fmt.Fprintf(w, "tree %q: name: %s: %q -> %q\n", name, desc(orig, oID), on, mn)
+			changes++
+		}
+
+		keys := append(orig.MetaKeys(oID), mod.MetaKeys(id)...)
+		slices.Sort(keys)
+		keys = slices.Compact(keys)
+		for _, k := range keys {
+			if ov, mv := orig.Meta(oID, k), mod.Meta(id, k); ov != mv {
+				fmt.Fprintf(w, "tree %q: metadata: %s: %s: %q -> %q\n", name, desc(mod, id), k, ov, mv)
+				changes++
+			}
+		}
+	}
+	return changes
+}
+
+// Desc returns a description of a node.
+func desc(t *timetree.Tree, id int) string {
+	if tax := t.Taxon(id); tax != "" {
+		return fmt.Sprintf("%q", tax)
+	}
+	return fmt.Sprintf("node %d", id)
+}
+
+// A cladeSet identifies the nodes of a tree
+// using a key made from its descendant terminals.
+type cladeSet struct {
+	keys map[int]uint64
+	ids  map[uint64]int
+}
+
+// Clades returns the keys of the nodes of a tree.
+// The key of a terminal is the hash of its name
+// (or its new name, if it was renamed),
+// and the key of an internal node
+// is the sum of the keys of its descendant terminals
+// that are found in both trees.
+// If two nodes have the same key,
+// the key identifies the youngest node.
+func clades(t *timetree.Tree, names map[string]string, common map[string]bool) cladeSet {
+	var ids []int
+	stack := []int{t.Root()}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ids = append(ids, id)
+		stack = append(stack, t.Children(id)...)
+	}
+
+	cs := cladeSet{
+		keys: make(map[int]uint64, len(ids)),
+		ids:  make(map[uint64]int, len(ids)),
+	}
+
+	// in reverse pre-order
+	// children are visited before their parents
+	sum := make(map[int]uint64, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		if t.IsTerm(id) {
+			tax := t.Taxon(id)
+			if nn, ok := names[tax]; ok {
+				tax = nn
+			}
+			h := fnv.New64a()
+			io.WriteString(h, tax)
+			cs.keys[id] = h.Sum64()
+			if common[tax] {
+				sum[id] = cs.keys[id]
+			}
+		} else {
+			for _, c := range t.Children(id) {
+				sum[id] += sum[c]
+			}
+			cs.keys[id] = sum[id]
+		}
+
+		k := cs.keys[id]
+		if _, ok := cs.ids[k]; k != 0 && !ok {
+			cs.ids[k] = id
+		}
+	}
+	return cs
+}
+
+// Match returns the ID of the node
+// in another tree
+// with the same key.
+func (cs cladeSet) match(id int, other cladeSet) (int, bool) {
+	k := cs.keys[id]
+	if k == 0 || cs.ids[k] != id {
+		return -1, false
+	}
+	oID, ok := other.ids[k]
+	return oID, ok
+}
@@ -0,0 +1,120 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package dryrun_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/scale"
+)
+
+func TestReport(t *testing.T) {
+	dryrun.Enabled = true
+	defer func() { dryrun.Enabled = false }()
+
+	c := timetree.NewCollection()
+	c.Add(newTree(t))
+	orig := dryrun.Copy(c)
+
+	var buf bytes.Buffer
+	dryrun.Report(&buf, orig, c)
+	if got := buf.String(); got != "no changes\n" {
+		t.Errorf("unchanged: got %q, want %q", got, "no changes\n")
+	}
+
+	tr := c.Tree("dry run")
+	id, _ := tr.TaxNode("Homo sapiens")
+	if err := tr.Set(tr.Parent(id), 3_000_000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf.Reset()
+	dryrun.Report(&buf, orig, c)
+	want := `tree "dry run": age: node 1: 6.000000 -> 3.000000` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("changed: got %q, want %q", got, want)
+	}
+}
+
+func TestCopyDisabled(t *testing.T) {
+	c := timetree.NewCollection()
+	c.Add(newTree(t))
+	if cp := dryrun.Copy(c); cp != nil {
+		t.Errorf("copy: got a collection, want nil")
+	}
+}
+
+func TestFileUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "trees.tab")
+
+	c := timetree.NewCollection()
+	c.Add(newTree(t))
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := buf.Bytes()
+	if err := os.WriteFile(fn, want, 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	app := &command.Command{
+		Usage:    "timetree <command> [<argument>...]",
+		Short:    "a test application",
+		SetFlags: dryrun.SetFlags,
+	}
+	app.Add(scale.Command)
+	var out bytes.Buffer
+	app.SetStdout(&out)
+	defer func() { dryrun.Enabled = false }()
+
+	if err := app.Execute([]string{"--dry-run", "scale", "--factor", "2", "-o", fn, fn}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("dry run: file %q changed", fn)
+	}
+	if !strings.Contains(out.String(), "age:") {
+		t.Errorf("dry run: got report %q, want age changes", out.String())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("dry run: got %d files, want %d", len(entries), 1)
+	}
+}
+
+func newTree(t testing.TB) *timetree.Tree {
+	t.Helper()
+
+	tr := timetree.New("dry run", 10_000_000)
+	if _, err := tr.Add(0, 4_000_000, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tx := range []string{"Homo sapiens", "Pan troglodytes"} {
+		if _, err := tr.Add(1, 6_000_000, tx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := tr.Add(0, 10_000_000, "Gorilla gorilla"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return tr
+}
@@ -0,0 +1,233 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package example implements a command to print
+// example tree collections.
+package example
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `example [--trees <number>] [-o|--output <file>]
+	[<example>]`,
+	Short: "print example trees",
+	Long: `
+Command example prints a built-in example tree collection in TSV format, so
+it can be used as the input of any other command (for example, to learn how a
+command works, or in integration tests).
+
+The name of the example is given as an argument. Valid examples are:
+
+	-dinosaurs  a small tree of dinosaurs, with extinct terminals
+	-primates   a tree of living primates, with approximated ages
+	-posterior  a sample of trees with the topology of the primates
+	            example, and random node ages, as a posterior sample of
+	            a dating analysis
+
+If no example is given, the list of valid examples will be printed.
+
+By default, the posterior example has 100 trees. Use the flag --trees to
+define a different number of trees. The posterior trees are created with a
+fixed random seed, so the same trees are always printed.
+
+By default, the trees will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var numTrees int
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().IntVar(&numTrees, "trees", 100, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+//go:embed data/*.tab
+var data embed.FS
+
+// Examples are the names
+// and descriptions
+// of the valid examples.
+var examples = []struct {
+	name string
+	desc string
+}{
+	{"dinosaurs", "a small tree of dinosaurs, with extinct terminals"},
+	{"primates", "a tree of living primates"},
+	{"posterior", "a sample of trees with random ages of the primates tree"},
+}
+
+// Seed is the seed used
+// for the random ages of the posterior example.
+const seed = 2022
+
+// MaxChange is the maximum relative change
+// of a node age
+// in the posterior example.
+const maxChange = 0.2
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return writeList(c.Stdout())
+	}
+	if numTrees <= 0 {
+		return fmt.Errorf("flag --trees: invalid value %d", numTrees)
+	}
+
+	var coll *timetree.Collection
+	switch name := strings.ToLower(strings.TrimSpace(args[0])); name {
+	case "dinosaurs", "primates":
+		var err error
+		coll, err = readExample(name)
+		if err != nil {
+			return err
+		}
+	case "posterior":
+		var err error
+		coll, err = posterior()
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown example %q", args[0])
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeList(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range examples {
+		fmt.Fprintf(bw, "%s\t%s\n", e.name, e.desc)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", "stdout", err)
+	}
+	return nil
+}
+
+func readExample(name string) (*timetree.Collection, error) {
+	f, err := data.Open("data/" + name + ".tab")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := timetree.ReadTSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("while reading example %q: %v", name, err)
+	}
+	return c, nil
+}
+
+// Posterior returns a collection of trees
+// with the topology of the primates example
+// and random ages.
+func posterior() (*timetree.Collection, error) {
+	pc, err := readExample("primates")
+	if err != nil {
+		return nil, err
+	}
+	p := pc.Tree("primates")
+
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	coll := timetree.NewCollection()
+	for i := 0; i < numTrees; i++ {
+		t := p.SubTree(p.Root(), fmt.Sprintf("posterior-%d", i))
+		randAge(t, t.Root(), rnd)
+		if err := coll.Add(t); err != nil {
+			return nil, err
+		}
+	}
+	return coll, nil
+}
+
+// RandAge sets a random age for a node
+// and its descendants.
+func randAge(t *timetree.Tree, id int, rnd *rand.Rand) {
+	children := t.Children(id)
+	if len(children) == 0 {
+		return
+	}
+
+	var min int64
+	for _, c := range children {
+		if a := t.Age(c); a > min {
+			min = a
+		}
+	}
+	max := int64(-1)
+	if !t.IsRoot(id) {
+		max = t.Age(t.Parent(id))
+	}
+
+	// the age is sampled around the current age,
+	// but strictly between the age of the parent
+	// and the age of the oldest descendant
+	age := t.Age(id)
+	lo := age - int64(float64(age)*maxChange)
+	hi := age + int64(float64(age)*maxChange)
+	if lo <= min {
+		lo = min + 1
+	}
+	if max >= 0 && hi >= max {
+		hi = max - 1
+	}
+	if lo < hi {
+		age = lo + rnd.Int64N(hi-lo)
+	} else if max >= 0 {
+		age = min + (max-min)/2
+	}
+	if err := t.Set(id, age); err != nil {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+
+	for _, c := range children {
+		randAge(t, c, rnd)
+	}
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
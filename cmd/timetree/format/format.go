@@ -9,14 +9,20 @@ package format
 import (
 	"fmt"
 	"io"
-	"os"
+	"strconv"
+	"strings"
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 )
 
 var Command = &command.Command{
-	Usage: "format [-o|--output <file>] [<treefile>...]",
+	Usage: `format [--tree <tree>] [--rotate <id>[,<id>...]]
+	[--order <id>:<child>,<child>[,<child>...]]
+	[-o|--output <file>] [<treefile>...]`,
 	Short: "format trees in a file",
 	Long: `
 Command format reads one or more trees in TSV format, and formatted it by
@@ -25,37 +31,62 @@ sorting its node IDs.
 One or more tree files can be given as arguments. If no file is given, it will
 read the trees from the standard input.
 
+Use the flag --rotate with a list of node IDs, separated by commas, to reverse
+the order of the children of the indicated nodes (i.e., a rotation). Node IDs
+are the IDs before the tree is formatted. The rotation does not modify the
+topology of the tree, and is kept in the output file, so it can be used to
+control the order in which terminals are drawn or exported. Rotating a node
+twice returns it to the default order. If the tree file contains more than one
+tree, the flag --tree must be used to indicate the tree to be rotated.
+
+Use the flag --order to set an explicit order for the children of a node. The
+value of the flag is the ID of the node, followed by a colon, and the list of
+the IDs of all of its children, separated by commas, in the desired order (for
+example "--order 4:7,5,6"). As with --rotate, node IDs are the IDs before the
+tree is formatted, and the flag --tree must be used if the tree file contains
+more than one tree. The order is stored in the "order" field of the output
+file, so it is kept in subsequent commands.
+
 The resulting tree file will be printed in the standard output. Use the flag
 --output, or -o, to define an output file.
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      outfile.Locked(&output, run),
 }
 
 var output string
+var treeName string
+var rotateFlag string
+var orderFlag string
 
 func setFlags(c *command.Command) {
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&rotateFlag, "rotate", "", "")
+	c.Flags().StringVar(&orderFlag, "order", "", "")
 	c.Flags().StringVar(&output, "output", "", "")
 	c.Flags().StringVar(&output, "o", "", "")
 }
 
 func run(c *command.Command, args []string) error {
-	coll := timetree.NewCollection()
-
 	if len(args) == 0 {
 		args = append(args, "-")
 	}
-	for _, a := range args {
-		nc, err := readCollection(c.Stdin(), a)
-		if err != nil {
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	if rotateFlag != "" {
+		if err := rotate(coll); err != nil {
 			return err
 		}
-
-		for _, tn := range nc.Names() {
-			t := nc.Tree(tn)
-			if err := coll.Add(t); err != nil {
-				return fmt.Errorf("when adding trees from %q: %v", a, err)
-			}
+	}
+	if orderFlag != "" {
+		if err := setOrder(coll); err != nil {
+			return err
 		}
 	}
 
@@ -65,44 +96,112 @@ func run(c *command.Command, args []string) error {
 		t.Format()
 	}
 
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
 	if err := writeTrees(c.Stdout(), coll); err != nil {
 		return err
 	}
 	return nil
 }
 
-func readCollection(r io.Reader, name string) (*timetree.Collection, error) {
-	if name != "-" {
-		f, err := os.Open(name)
+func rotate(c *timetree.Collection) error {
+	t, err := getTree(c, "rotate")
+	if err != nil {
+		return err
+	}
+	tn := t.Name()
+
+	for _, v := range strings.Split(rotateFlag, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.Atoi(v)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("flag --rotate: invalid node ID %q: %v", v, err)
+		}
+		if !t.IsRoot(id) && t.Parent(id) < 0 {
+			return fmt.Errorf("flag --rotate: node %d not in tree %q", id, tn)
 		}
-		defer f.Close()
-		r = f
-	} else {
-		name = "stdin"
+		t.Rotate(id)
 	}
+	return nil
+}
 
-	c, err := timetree.ReadTSV(r)
+func setOrder(c *timetree.Collection) error {
+	t, err := getTree(c, "order")
 	if err != nil {
-		return nil, fmt.Errorf("while reading file %q: %v", name, err)
+		return err
+	}
+
+	nv, cv, ok := strings.Cut(orderFlag, ":")
+	if !ok {
+		return fmt.Errorf("flag --order: expecting <id>:<child>,<child>...")
+	}
+	nv = strings.TrimSpace(nv)
+	id, err := strconv.Atoi(nv)
+	if err != nil {
+		return fmt.Errorf("flag --order: invalid node ID %q: %v", nv, err)
+	}
+	if !t.IsRoot(id) && t.Parent(id) < 0 {
+		return fmt.Errorf("flag --order: node %d not in tree %q", id, t.Name())
+	}
+
+	var children []int
+	for _, v := range strings.Split(cv, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		cID, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("flag --order: invalid node ID %q: %v", v, err)
+		}
+		children = append(children, cID)
+	}
+	if len(children) == 0 {
+		return fmt.Errorf("flag --order: node %d: undefined children", id)
+	}
+	if err := t.SetOrder(id, children); err != nil {
+		return fmt.Errorf("flag --order: %v", err)
+	}
+	return nil
+}
+
+func getTree(c *timetree.Collection, flag string) (*timetree.Tree, error) {
+	tn := treeName
+	if tn == "" {
+		ls := c.Names()
+		if len(ls) > 1 {
+			return nil, fmt.Errorf("flag --%s: flag --tree must be defined", flag)
+		}
+		tn = ls[0]
+	}
+	t := c.Tree(tn)
+	if t == nil {
+		return nil, fmt.Errorf("tree %q not found", tn)
 	}
-	return c, nil
+	return t, nil
 }
 
 func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
 	outName := "stdout"
 	if output != "" {
 		outName = output
-		f, err := os.Create(output)
+		var f *outfile.File
+		f, err = outfile.Create(output)
 		if err != nil {
 			return err
 		}
 		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
+			if err != nil {
+				f.Discard()
+				return
 			}
+			err = f.Close()
 		}()
 		w = f
 	}
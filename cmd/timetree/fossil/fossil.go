@@ -0,0 +1,180 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package fossil implements a command to add a fossil taxon
+// to the stem of a clade.
+package fossil
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `fossil [-o|--output <file>]
+	--tree <tree> --clade <node> --stem <age>
+	<taxon-name> <age> [<treefile>]`,
+	Short: "add a fossil to the stem of a clade",
+	Long: `
+Command fossil adds a new taxon, usually a fossil, as a terminal attached to
+the stem of a clade (i.e., the branch that ends at the clade), at a given
+attachment age. It is the usual operation used to place a fossil on a time
+tree, without the need to calculate the branch lengths or to know the IDs of
+the nodes.
+
+The first argument of the command is the name of the taxon, if the name has
+multiple words, enclosed it in quotations, for example:
+"Archaeopteryx lithographica".
+
+The second argument is the age of the taxon, in million years.
+
+The name of a tree file can be given as a third argument. If no file is given
+it will read the tree collection from the standard input.
+
+The flag --tree is required and indicates the name of the tree to be modified.
+
+The flag --clade is required and indicates the clade to which the stem the
+taxon will be attached. The clade can be defined by its node ID, by the name
+of a taxon (either a terminal or a named internal node), or by two or more
+taxon names separated by commas, in which case the clade will be the most
+recent common ancestor of the taxa. The clade can not be the root of the
+tree.
+
+The flag --stem is required and indicates the age, in million years, at which
+the taxon will be attached to the stem of the clade. The age must be older
+than the age of the clade and younger than the age of the parent of the clade,
+and it must be older than the age of the added taxon.
+
+The resulting tree will be printed as a tree file in the standard output. Use
+the flag --output, or -o, to define an output file. As this command modifies
+the tree, it is possible that node IDs will be modified in the process.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var output string
+var treeName string
+var clade string
+var stem float64
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&clade, "clade", "", "")
+	c.Flags().Float64Var(&stem, "stem", -1, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+const millionYears = 1_000_000
+
+func run(c *command.Command, args []string) error {
+	if len(args) < 2 {
+		return c.UsageError("expecting taxon name and age")
+	}
+
+	toAdd := args[0]
+	a, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return fmt.Errorf("on age %q: %v", args[1], err)
+	}
+	if a < 0 {
+		return fmt.Errorf("on age %q: invalid age", args[1])
+	}
+	age := int64(a * millionYears)
+
+	if treeName == "" {
+		return c.UsageError("--tree flag must be defined")
+	}
+	if strings.TrimSpace(clade) == "" {
+		return c.UsageError("--clade flag must be defined")
+	}
+	if stem < 0 {
+		return c.UsageError("--stem flag must be defined")
+	}
+	stemAge := int64(stem * millionYears)
+	if stemAge <= age {
+		return fmt.Errorf("flag --stem: attachment age %.6f, must be older than taxon age %.6f", stem, a)
+	}
+
+	in := "-"
+	if len(args) > 2 {
+		in = args[2]
+	}
+	tc, err := infile.Collection(c.Stdin(), in)
+	if err != nil {
+		return err
+	}
+	orig := dryrun.Copy(tc)
+
+	tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+	t := tc.Tree(tn)
+	if t == nil {
+		return fmt.Errorf("tree %q not found", treeName)
+	}
+	if err := infile.CheckUnits(t); err != nil {
+		return err
+	}
+
+	id, err := t.FindNode(clade)
+	if err != nil {
+		return fmt.Errorf("flag --clade: %v", err)
+	}
+	if id == t.Root() {
+		return fmt.Errorf("flag --clade: clade %q is the root of tree %q", clade, treeName)
+	}
+	p := t.Parent(id)
+	cAge, pAge := t.Age(id), t.Age(p)
+	if stemAge <= cAge || stemAge >= pAge {
+		return fmt.Errorf("flag --stem: attachment age %.6f, must be between %.6f and %.6f", stem, float64(cAge)/millionYears, float64(pAge)/millionYears)
+	}
+
+	if _, err := t.AddSister(id, age, stemAge-age, toAdd); err != nil {
+		return err
+	}
+	t.Format()
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, tc)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), tc); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package gentime implements a command to convert
+// the ages of a tree
+// between generations and years.
+package gentime
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `gentime --time <years> [--generations] [--clades <file>]
+	[--tree <tree>] [-o|--output <file>] <treefile>...`,
+	Short: "convert tree ages between generations and years",
+	Long: `
+Command gentime reads one or more trees in TSV format, and converts the ages
+of the nodes from generations to years, or from years to generations, using a
+generation time. It is useful to compare coalescent trees, measured in
+generations, with species trees, measured in years.
+
+One or more tree files must be given as arguments.
+
+The flag --time is required and defines the generation time, in years.
+
+By default, the ages are converted from generations to years. Use the flag
+--generations to convert the ages from years to generations.
+
+The unit of the ages of a tree is stored in the "unit" metadata field of the
+root node, either "generations" or "years". A tree already in the target unit
+will not be converted. Trees with ages in coalescent units can not be
+converted (use the command scale).
+
+Different clades can have different generation times. Use the flag --clades
+to define a TSV file without header, with the following columns:
+
+	-tree  the name of the tree
+	-node  the node that defines the clade
+	-time  the generation time of the clade, in years
+
+The node can be defined by its ID, by the name of a taxon, or by two or more
+taxon names separated by commas, in which case the node will be the most
+recent common ancestor of the taxa. The generation time of a clade is used in
+all of its branches (including the branch that ends in the clade), unless a
+descendant clade has its own generation time. The ages are calculated from
+the root, so when different generation times are used, the terminals might
+not keep their ages.
+
+By default, all the trees in the files will be converted. Use the flag --tree
+to convert a single tree.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var genTime float64
+var toGen bool
+var cladesFile string
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().Float64Var(&genTime, "time", 0, "")
+	c.Flags().BoolVar(&toGen, "generations", false, "")
+	c.Flags().StringVar(&cladesFile, "clades", "", "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+	if genTime <= 0 {
+		return c.UsageError("flag --time must be defined")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	names := coll.Names()
+	if treeName != "" {
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
+	}
+
+	clades := make(map[string]map[int]float64)
+	if cladesFile != "" {
+		var err error
+		clades, err = readClades(coll)
+		if err != nil {
+			return err
+		}
+	}
+
+	from, to := timetree.Generations, timetree.Years
+	if toGen {
+		from, to = timetree.Years, timetree.Generations
+	}
+	for _, tn := range names {
+		t := coll.Tree(tn)
+		if err := infile.CheckUnits(t); err != nil {
+			return err
+		}
+		u := t.Unit()
+		if u == to {
+			fmt.Fprintf(c.Stderr(), "tree %q: ages already in %s\n", tn, to)
+			continue
+		}
+		if u != "" && u != from {
+			return fmt.Errorf("tree %q: unknown age unit %q", tn, u)
+		}
+
+		factors := make(map[int]float64, len(clades[tn]))
+		for id, g := range clades[tn] {
+			factors[id] = factor(g)
+		}
+		if err := t.ScaleBranches(factor(genTime), factors); err != nil {
+			return fmt.Errorf("tree %q: %v", tn, err)
+		}
+		t.SetUnit(to)
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Factor returns the scale factor
+// of a generation time.
+func factor(g float64) float64 {
+	if toGen {
+		return 1 / g
+	}
+	return g
+}
+
+// ReadClades reads the generation times
+// of the clades of the trees.
+func readClades(c *timetree.Collection) (map[string]map[int]float64, error) {
+	f, err := os.Open(cladesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	clades := make(map[string]map[int]float64)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", cladesFile, ln, err)
+		}
+		if len(row) < 3 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", cladesFile, ln, len(row), 3)
+		}
+
+		name := strings.ToLower(strings.Join(strings.Fields(row[0]), " "))
+		if name == "" {
+			continue
+		}
+		t := c.Tree(name)
+		if t == nil {
+			continue
+		}
+		id, err := t.FindNode(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", cladesFile, ln, "node", err)
+		}
+		g, err := strconv.ParseFloat(strings.TrimSpace(row[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", cladesFile, ln, "time", err)
+		}
+		if g <= 0 {
+			return nil, fmt.Errorf("%q: on row %d: field %q: invalid generation time %v", cladesFile, ln, "time", g)
+		}
+
+		if clades[name] == nil {
+			clades[name] = make(map[int]float64)
+		}
+		clades[name][id] = g
+	}
+	return clades, nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package graft implements a command to attach a tree
+// as a clade of another tree.
+package graft
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `graft [-o|--output <file>]
+	--tree <tree> --node <id> --age <age> [--source <tree>]
+	<treefile> <source-treefile>`,
+	Short: "attach a tree as a clade of another tree",
+	Long: `
+Command graft reads a tree from a source tree file, and attaches it, as a
+clade, to a tree of a destination tree file. It is useful to assemble large
+composite trees from published clades.
+
+The first argument of the command is the destination tree file. The second
+argument is the source tree file.
+
+The flag --tree is required and indicates the name of the destination tree.
+
+The flag --node is required and is the ID of the node of the destination tree
+that will be the sister of the grafted clade.
+
+The flag --age is required and is the age, in million years, of the new node
+that joins the grafted clade with its sister node. The age must be older than
+the sister node and the root of the source tree, and younger than the parent
+of the sister node. If the sister node is the root, the new node will be the
+new root of the tree.
+
+If the source tree file has more than one tree, use the flag --source to
+indicate the name of the tree to be grafted.
+
+The terminals of the grafted tree must not be present in the destination tree.
+
+The resulting tree collection will be printed as a tree file in the standard
+output. Use the flag --output, or -o, to define an output file. If the output
+file name ends with ".gz", the output will be compressed with gzip. As this
+command modifies the tree, it is possible that node IDs will be modified in
+the process.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var output string
+var treeName string
+var srcName string
+var nodeID int
+var age float64
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&srcName, "source", "", "")
+	c.Flags().IntVar(&nodeID, "node", -1, "")
+	c.Flags().Float64Var(&age, "age", 0, "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) < 2 {
+		return c.UsageError("expecting destination and source tree files")
+	}
+	if treeName == "" {
+		return c.UsageError("flag --tree must be defined")
+	}
+	if nodeID < 0 {
+		return c.UsageError("flag --node must be defined")
+	}
+	if age <= 0 {
+		return c.UsageError("flag --age must be defined")
+	}
+
+	coll, err := infile.Collection(c.Stdin(), args[0])
+	if err != nil {
+		return err
+	}
+	t := coll.Tree(treeName)
+	if t == nil {
+		return fmt.Errorf("tree %q not found", treeName)
+	}
+
+	sc, err := infile.Collection(c.Stdin(), args[1])
+	if err != nil {
+		return err
+	}
+	src, err := sourceTree(sc, args[1])
+	if err != nil {
+		return err
+	}
+	for _, x := range []*timetree.Tree{t, src} {
+		if err := infile.CheckUnits(x); err != nil {
+			return err
+		}
+	}
+
+	orig := dryrun.Copy(coll)
+
+	if _, err := t.Graft(nodeID, src, int64(age*millionYears)); err != nil {
+		return fmt.Errorf("on tree %q: %v", treeName, err)
+	}
+	t.Format()
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+// millionYears is used to transform ages
+// from million years to years.
+const millionYears = 1_000_000
+
+func sourceTree(c *timetree.Collection, name string) (*timetree.Tree, error) {
+	if srcName != "" {
+		t := c.Tree(srcName)
+		if t == nil {
+			return nil, fmt.Errorf("flag --source: tree %q not found in %q", srcName, name)
+		}
+		return t, nil
+	}
+
+	names := c.Names()
+	if len(names) != 1 {
+		return nil, fmt.Errorf("file %q has %d trees: flag --source must be defined", name, len(names))
+	}
+	return c.Tree(names[0]), nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
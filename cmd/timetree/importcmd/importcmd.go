@@ -15,11 +15,15 @@ import (
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 )
 
 var Command = &command.Command{
-	Usage: `import [--format <format>] [--age <value>]
-	[--name <tree-name>]
+	Usage: `import [--format <format>] [--age <value>] [--offset <value>]
+	[--name <tree-name>] [--support-style <style>] [--units <unit>]
+	[--verbose]
 	[-o|--output <file>]
 	[<newick-file>...]`,
 	Short: "import a newick tree",
@@ -35,12 +39,18 @@ By default, the input file is assumed to be a raw newick file (i.e., a tree
 file only with the newick trees). With the flag --format, a different format
 can be defined. Valid formats are:
 	- newick, a traditional newick tree.
-	- nexus, a nexus file with a trees block.
+	- nexus, a nexus file with one or more trees blocks (several nexus
+	  documents can be concatenated in the same file, and trees with
+	  a repeated name are renamed with the number of the block, for
+	  example "tree1.2").
+	- nexml, a NeXML document.
+	- phyloxml, a phyloXML document.
+	- json, a JSON document (as produced by the command json).
 
-Trees in TSV format must have names. Nexus files already have named trees; if
-the file is in the newick format, the flag --name is required and sets the
-name of the tree. If multiple trees are found, the name will be append with
-sequential numbers.
+Trees in TSV format must have names. Nexus, NeXML, phyloXML, and JSON files
+already have named trees; if the file is in the newick format, the flag --name
+is required and sets the name of the tree. If multiple trees are found, the
+name will be append with sequential numbers.
 
 By default the output will be printed in the standard output. To define an
 output file use the flag --output, or -o. If the file already exists, imported
@@ -55,19 +65,63 @@ The output TSV file will contain the following fields:
 	- age, the age of the node (in years)
 	- taxon, the taxonomic name of the node
 
+Node annotations in the format used by BEAST and FigTree (for example
+"[&posterior=0.99]") will be stored as additional fields of the TSV file.
+
+Programs of maximum likelihood (for example, RAxML or IQ-TREE) store the
+support values as labels of the internal nodes (for example ")100:0.1" or
+")95.2/100:0.1"). By default, the labels (from newick and nexus files) are
+stored in the field "label" of the TSV file. Use the flag --support-style to
+define how the labels will be read. Valid styles are:
+	- label, the label is stored as is in the field "label".
+	- none, the labels are ignored.
+	- support, a numeric label is stored in the field "support".
+	- iqtree, a numeric label is stored in the field "support", and a dual
+	  label in the form "SH-aLRT/UFboot" (as produced by IQ-TREE), is stored
+	  in the fields "shalrt" and "ufboot".
+Labels that are not valid support values for the style are stored in the
+field "label". Labels defined as annotations (for example "[&label=95]") are
+also read.
+
 By default, the age of the tree will be calculated using the maximum branch
-length between the root and its terminals. Use the flag --age to set a
-different age for the root (in million years). The given age should be greater
-or equal to the maximum branch length.
+length between the root and its terminals (in NeXML and phyloXML files, if
+all nodes have an age annotation, the annotated ages will be used). Use the
+flag --age to set a different age for the root (in million years). The given
+age should be greater or equal to the maximum branch length.
+
+By default, branch lengths are assumed to be in million years. Some programs
+(for example, ASTRAL) produce trees with branch lengths in coalescent units.
+Use the flag --units with the value "coalescent" to import these trees. The
+branch lengths will be read as if they were in million years, but the trees
+will be tagged as "coalescent-units" in the "unit" metadata field of the root
+node, so the commands that modify the ages of the trees (add, bin, gentime,
+graft, merge, perturb, and set) will refuse to use them. Use the command scale
+to convert the branch lengths into million years.
+
+By default, the youngest terminal of a tree is assumed to be at the present.
+Some trees end before the present (for example, trees of entirely extinct
+clades). Use the flag --offset to set the age (in million years) of the
+present for the imported trees. If the flag --age is not defined, the offset
+will be added to the ages of all nodes (so a terminal at the present will be
+at the offset age). No node can be younger than the offset.
+
+Some issues found while reading the input files are not errors, and the
+values are silently fixed (for example, zero length branches are set to one
+year, and comments that are not node annotations are ignored). Use the flag
+--verbose to print these issues in the standard error.
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      outfile.Locked(&output, run),
 }
 
 var output string
 var age float64
+var offset float64
 var nameFlag string
 var format string
+var supportStyle string
+var units string
+var verbose bool
 
 func setFlags(c *command.Command) {
 	c.Flags().StringVar(&output, "output", "", "")
@@ -75,6 +129,10 @@ func setFlags(c *command.Command) {
 	c.Flags().StringVar(&nameFlag, "name", "", "")
 	c.Flags().StringVar(&format, "format", "newick", "")
 	c.Flags().Float64Var(&age, "age", 0, "")
+	c.Flags().Float64Var(&offset, "offset", 0, "")
+	c.Flags().StringVar(&supportStyle, "support-style", "label", "")
+	c.Flags().StringVar(&units, "units", "years", "")
+	c.Flags().BoolVar(&verbose, "verbose", false, "")
 }
 
 func run(c *command.Command, args []string) error {
@@ -85,37 +143,93 @@ func run(c *command.Command, args []string) error {
 			return c.UsageError("flag --name undefined")
 		}
 	case "nexus":
+	case "nexml":
+	case "phyloxml":
+	case "json":
 	default:
 		return c.UsageError(fmt.Sprintf("unknown format %q", format))
 	}
+	supportStyle = strings.ToLower(supportStyle)
+	switch supportStyle {
+	case "label":
+	case "none":
+	case "support":
+	case "iqtree":
+	default:
+		return c.UsageError(fmt.Sprintf("flag --support-style: unknown style %q", supportStyle))
+	}
+	units = strings.ToLower(units)
+	switch units {
+	case "years":
+	case "coalescent", timetree.CoalescentUnits:
+		units = timetree.CoalescentUnits
+	default:
+		return c.UsageError(fmt.Sprintf("flag --units: unknown unit %q", units))
+	}
 
 	coll, err := newTreeCollection()
 	if err != nil {
 		return err
 	}
+	orig := dryrun.Copy(coll)
 
 	if len(args) == 0 {
 		args = append(args, "-")
 	}
-	for i, a := range args {
+
+	colls, err := infile.ReadAll(args, func(i int, a string) (*timetree.Collection, error) {
 		nm := nameFlag
 		if i > 0 {
 			nm = fmt.Sprintf("%s.%d", nameFlag, i)
 		}
+		return readTrees(c.Stdin(), a, nm)
+	})
+	if err != nil {
+		return err
+	}
 
-		nc, err := readTrees(c.Stdin(), a, nm)
-		if err != nil {
-			return err
+	for i, a := range args {
+		nc := colls[i]
+		if verbose {
+			inName := a
+			if a == "-" {
+				inName = "stdin"
+			}
+			for _, w := range nc.Warnings() {
+				fmt.Fprintf(c.Stderr(), "%s: warning: %s\n", inName, w)
+			}
+		}
+		if supportStyle != "label" {
+			if err := setSupport(nc); err != nil {
+				return fmt.Errorf("on file %q: %v", a, err)
+			}
+		}
+		if offset > 0 {
+			if err := setOffset(nc); err != nil {
+				return fmt.Errorf("on file %q: %v", a, err)
+			}
 		}
 
 		for _, tn := range nc.Names() {
 			t := nc.Tree(tn)
+			if units == timetree.CoalescentUnits {
+				t.SetUnit(units)
+			}
 			if err := coll.Add(t); err != nil {
 				return fmt.Errorf("when adding trees from %q: %v", a, err)
 			}
 		}
 	}
 
+	for _, w := range coll.Warnings() {
+		fmt.Fprintf(c.Stderr(), "warning: %s\n", w)
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
 	if err := writeTrees(c.Stdout(), coll); err != nil {
 		return err
 	}
@@ -148,9 +262,25 @@ func newTreeCollection() (*timetree.Collection, error) {
 // into an integer in years.
 const millionYears = 1_000_000
 
+func setOffset(c *timetree.Collection) error {
+	off := int64(offset * millionYears)
+	for _, tn := range c.Names() {
+		t := c.Tree(tn)
+		if age == 0 {
+			if err := t.Move(t.Age(t.Root()) + off); err != nil {
+				return fmt.Errorf("tree %q: %v", tn, err)
+			}
+		}
+		if err := t.SetOffset(off); err != nil {
+			return fmt.Errorf("tree %q: %v", tn, err)
+		}
+	}
+	return nil
+}
+
 func readTrees(r io.Reader, treeFile, name string) (*timetree.Collection, error) {
 	if treeFile != "-" {
-		f, err := os.Open(treeFile)
+		f, err := infile.Open(treeFile)
 		if err != nil {
 			return nil, err
 		}
@@ -167,6 +297,27 @@ func readTrees(r io.Reader, treeFile, name string) (*timetree.Collection, error)
 		}
 		return c, nil
 	}
+	if format == "nexml" {
+		c, err := timetree.NeXML(r, int64(age*millionYears))
+		if err != nil {
+			return nil, fmt.Errorf("while reading file %q: %v", treeFile, err)
+		}
+		return c, nil
+	}
+	if format == "json" {
+		c, err := timetree.ReadJSON(r)
+		if err != nil {
+			return nil, fmt.Errorf("while reading file %q: %v", treeFile, err)
+		}
+		return c, nil
+	}
+	if format == "phyloxml" {
+		c, err := timetree.PhyloXML(r, int64(age*millionYears))
+		if err != nil {
+			return nil, fmt.Errorf("while reading file %q: %v", treeFile, err)
+		}
+		return c, nil
+	}
 	c, err := timetree.Nexus(r, int64(age*millionYears))
 	if err != nil {
 		return nil, fmt.Errorf("while reading file %q: %v", treeFile, err)
@@ -178,15 +329,17 @@ func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
 	outName := "stdout"
 	if output != "" {
 		outName = output
-		f, err := os.Create(output)
+		var f *outfile.File
+		f, err = outfile.Create(output)
 		if err != nil {
 			return err
 		}
 		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
+			if err != nil {
+				f.Discard()
+				return
 			}
+			err = f.Close()
 		}()
 		w = f
 	}
@@ -0,0 +1,68 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package importcmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/timetree"
+)
+
+// SetSupport parses the node labels
+// of the trees in a collection
+// into support fields.
+func setSupport(c *timetree.Collection) error {
+	for _, tn := range c.Names() {
+		t := c.Tree(tn)
+		for _, id := range t.Nodes() {
+			label := t.Meta(id, "label")
+			if label == "" {
+				continue
+			}
+			if supportStyle == "none" {
+				t.SetMeta(id, "label", "")
+				continue
+			}
+
+			fields := supportFields(label)
+			if fields == nil {
+				continue
+			}
+			for k, v := range fields {
+				if err := t.SetMeta(id, k, v); err != nil {
+					return err
+				}
+			}
+			t.SetMeta(id, "label", "")
+		}
+	}
+	return nil
+}
+
+// SupportFields returns the support fields
+// of a node label.
+// It returns nil
+// if the label is not a support value.
+func supportFields(label string) map[string]string {
+	vs := strings.Split(label, "/")
+	for i, v := range vs {
+		vs[i] = strings.TrimSpace(v)
+		if _, err := strconv.ParseFloat(vs[i], 64); err != nil {
+			return nil
+		}
+	}
+
+	switch {
+	case len(vs) == 1:
+		return map[string]string{"support": vs[0]}
+	case len(vs) == 2 && supportStyle == "iqtree":
+		return map[string]string{
+			"shalrt": vs[0],
+			"ufboot": vs[1],
+		}
+	}
+	return nil
+}
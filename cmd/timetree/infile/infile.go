@@ -0,0 +1,111 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package infile implements the opening of input files
+// that can be local files,
+// or HTTP(S) URLs.
+//
+// A file given as a URL is downloaded
+// and stored in a cache directory
+// (the "timetree" directory
+// in the user cache directory),
+// so any later use of the same URL
+// reads the stored copy
+// instead of downloading the file again.
+package infile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsURL returns true if a file name
+// is an HTTP or HTTPS URL.
+func IsURL(name string) bool {
+	n := strings.ToLower(name)
+	return strings.HasPrefix(n, "http://") || strings.HasPrefix(n, "https://")
+}
+
+// Open opens a file for reading.
+// If the name is a URL,
+// it opens the cached copy of the file,
+// downloading the file
+// if it is not in the cache.
+func Open(name string) (io.ReadCloser, error) {
+	if !IsURL(name) {
+		return os.Open(name)
+	}
+
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(name))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:]))
+
+	if f, err := os.Open(path); err == nil {
+		return f, nil
+	}
+	if err := download(name, path); err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// CacheDir returns the directory
+// used to store the downloaded files.
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "timetree")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Download downloads a URL
+// into a file.
+// The file is first written
+// in a temporary file,
+// so a partial download
+// is never stored in the cache.
+func download(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("while downloading %q: %s", url, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("while downloading %q: %v", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
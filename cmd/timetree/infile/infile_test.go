@@ -0,0 +1,226 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package infile_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+)
+
+func TestIsURL(t *testing.T) {
+	tests := map[string]bool{
+		"trees.tab":                     false,
+		"-":                             false,
+		"http://example.org/trees.tab":  true,
+		"HTTPS://example.org/trees.tab": true,
+		"ftp://example.org/trees.tab":   false,
+	}
+	for name, want := range tests {
+		if got := infile.IsURL(name); got != want {
+			t.Errorf("%q: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "trees.tab")
+	if err := os.WriteFile(fn, []byte("some data\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, fn); got != "some data\n" {
+		t.Errorf("got %q, want %q", got, "some data\n")
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	setCacheDir(t)
+
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/missing.tab" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "data from "+r.URL.Path+"\n")
+	}))
+	defer srv.Close()
+
+	// cache miss
+	url := srv.URL + "/trees.tab"
+	if got := readAll(t, url); got != "data from /trees.tab\n" {
+		t.Errorf("miss: got %q, want %q", got, "data from /trees.tab\n")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("miss: got %d requests, want %d", got, 1)
+	}
+
+	// cache hit
+	if got := readAll(t, url); got != "data from /trees.tab\n" {
+		t.Errorf("hit: got %q, want %q", got, "data from /trees.tab\n")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("hit: got %d requests, want %d", got, 1)
+	}
+
+	// a different URL
+	other := srv.URL + "/other.tab"
+	if got := readAll(t, other); got != "data from /other.tab\n" {
+		t.Errorf("other: got %q, want %q", got, "data from /other.tab\n")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("other: got %d requests, want %d", got, 2)
+	}
+
+	// a failed download is not stored
+	missing := srv.URL + "/missing.tab"
+	for i := 0; i < 2; i++ {
+		if _, err := infile.Open(missing); err == nil {
+			t.Errorf("missing: expecting error")
+		}
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("missing: got %d requests, want %d", got, 4)
+	}
+
+	dir, err := infile.CacheDir()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("cache: got %d files, want %d", len(entries), 2)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	dir := t.TempDir()
+
+	var names []string
+	for _, tn := range []string{"first", "second", "third"} {
+		names = append(names, writeTree(t, dir, tn, ""))
+	}
+
+	// the standard input
+	in, err := os.ReadFile(names[2])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names[2] = "-"
+
+	colls, err := infile.Collections(bytes.NewReader(in), names)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		if got := colls[i].Names(); len(got) != 1 || got[0] != want {
+			t.Errorf("file %d: got trees %v, want %q", i, got, want)
+		}
+	}
+
+	// the error of the first file that fails
+	names[0] = filepath.Join(dir, "missing.tab")
+	names[1] = filepath.Join(dir, "other.tab")
+	if _, err := infile.Collections(strings.NewReader(""), names); err == nil || !strings.Contains(err.Error(), "missing.tab") {
+		t.Errorf("missing: got error %v, want error for %q", err, names[0])
+	}
+}
+
+func TestTrees(t *testing.T) {
+	dir := t.TempDir()
+	years := writeTree(t, dir, "years", "")
+	gens := writeTree(t, dir, "generations", timetree.Generations)
+	coal := writeTree(t, dir, "coalescent", timetree.CoalescentUnits)
+
+	var stderr bytes.Buffer
+	c := &command.Command{}
+	c.SetStderr(&stderr)
+
+	coll, order, err := infile.Trees(c, []string{years, gens})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"years", "generations"}; !slices.Equal(order, want) {
+		t.Errorf("order: got %v, want %v", order, want)
+	}
+	if coll.Tree("generations") == nil {
+		t.Errorf("tree %q not found", "generations")
+	}
+	if !strings.HasPrefix(stderr.String(), "warning: ") {
+		t.Errorf("warnings: got %q, want a unit warning", stderr.String())
+	}
+
+	if _, _, err := infile.Trees(c, []string{years, coal}); err != nil {
+		t.Errorf("coalescent units: unexpected error: %v", err)
+	}
+	if _, _, err := infile.TimeTrees(c, []string{years, coal}); err == nil || !strings.Contains(err.Error(), "coalescent units") {
+		t.Errorf("coalescent units: got error %v, want coalescent units error", err)
+	}
+}
+
+// WriteTree writes a tree file
+// with a single tree.
+func writeTree(t testing.TB, dir, name, unit string) string {
+	t.Helper()
+
+	tr := timetree.New(name, 10_000_000)
+	tr.Add(0, 10_000_000, "Homo sapiens")
+	tr.Add(0, 10_000_000, "Pan troglodytes")
+	tr.SetUnit(unit)
+	c := timetree.NewCollection()
+	c.Add(tr)
+
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fn := filepath.Join(dir, name+".tab")
+	if err := os.WriteFile(fn, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return fn
+}
+
+// SetCacheDir sets the user cache directory
+// to a temporary directory.
+func setCacheDir(t testing.TB) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("LocalAppData", dir)
+}
+
+func readAll(t testing.TB, name string) string {
+	t.Helper()
+
+	f, err := infile.Open(name)
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %v", name, err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %v", name, err)
+	}
+	return string(b)
+}
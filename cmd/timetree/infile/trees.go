@@ -0,0 +1,145 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package infile
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+)
+
+// CheckUnits returns an error
+// if the ages of a tree are in coalescent units.
+func CheckUnits(t *timetree.Tree) error {
+	if t.AgeUnit() == timetree.CoalescentUnits {
+		return fmt.Errorf("tree %q: ages in coalescent units: use the command scale to convert them", t.Name())
+	}
+	return nil
+}
+
+// Collection reads a collection of trees
+// from a file in TSV format.
+// If the name is "-",
+// the trees will be read from r
+// (usually the standard input).
+func Collection(r io.Reader, name string) (*timetree.Collection, error) {
+	if name != "-" {
+		f, err := Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	c, err := timetree.ReadTSV(r)
+	if err != nil {
+		return nil, fmt.Errorf("while reading file %q: %v", name, err)
+	}
+	return c, nil
+}
+
+// Collections reads the collections of trees
+// from a set of files in TSV format.
+// The files are read concurrently.
+// If a name is "-",
+// the trees will be read from r.
+func Collections(r io.Reader, names []string) ([]*timetree.Collection, error) {
+	return ReadAll(names, func(_ int, name string) (*timetree.Collection, error) {
+		return Collection(r, name)
+	})
+}
+
+// ReadAll reads a set of files concurrently
+// using the indicated read function,
+// that receives the index and the name of a file.
+// It returns the collections
+// in the same order as the file names,
+// or the error of the first file,
+// in the order of the file names,
+// that was not read.
+func ReadAll(names []string, read func(i int, name string) (*timetree.Collection, error)) ([]*timetree.Collection, error) {
+	colls := make([]*timetree.Collection, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, n := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			colls[i], errs[i] = read(i, n)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return colls, nil
+}
+
+// Trees reads the trees from a set of files in TSV format
+// into a single collection,
+// and returns the collection
+// and the names of the trees,
+// in the order in which they were read.
+// The files are read concurrently.
+// If a name is "-",
+// the trees will be read from the standard input
+// of the command.
+// The warnings of the collection
+// (for example, trees with ages in different units)
+// are printed in the standard error
+// of the command.
+func Trees(c *command.Command, names []string) (*timetree.Collection, []string, error) {
+	return readTrees(c, names, false)
+}
+
+// TimeTrees is like Trees,
+// but returns an error
+// if the ages of a tree are in coalescent units.
+func TimeTrees(c *command.Command, names []string) (*timetree.Collection, []string, error) {
+	return readTrees(c, names, true)
+}
+
+func readTrees(c *command.Command, names []string, timeOnly bool) (*timetree.Collection, []string, error) {
+	colls, err := Collections(c.Stdin(), names)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	coll := timetree.NewCollection()
+	var order []string
+	for i, a := range names {
+		nc := colls[i]
+		for _, tn := range nc.Names() {
+			t := nc.Tree(tn)
+			if timeOnly {
+				if err := CheckUnits(t); err != nil {
+					return nil, nil, fmt.Errorf("on file %q: %v", a, err)
+				}
+			}
+			if err := coll.Add(t); err != nil {
+				return nil, nil, fmt.Errorf("when adding trees from %q: %v", a, err)
+			}
+			order = append(order, tn)
+		}
+	}
+
+	for _, w := range coll.Warnings() {
+		fmt.Fprintf(c.Stderr(), "warning: %s\n", w)
+	}
+	return coll, order, nil
+}
@@ -0,0 +1,278 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package join implements a command to add
+// the data of a taxon table
+// as metadata of the terminals of the trees.
+package join
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `join [--key <field>] [--fields <field>[,<field>...]]
+	[--partial] [-i|--input <file>] [-o|--output <file>]
+	<treefile>...`,
+	Short: "add taxon data to the terminals of the trees",
+	Long: `
+Command join reads one or more trees in TSV format, and a TSV table with data
+of the taxa (for example, traits, geographic ranges, or accession numbers),
+and adds the columns of the table as metadata fields of the terminals of the
+trees, so the tree file has all the data of an analysis.
+
+One or more tree files must be given as arguments.
+
+The table can be defined either with the flag --input, or -i, or provided in
+the standard input. The table is a TSV file with a header. By default, the
+column "taxon" has the names of the terminals. Use the flag --key to define a
+different column. By default, all the other columns are added as metadata
+fields, with the name of the column as the name of the field. Use the flag
+--fields to define the columns to add, separated by commas. The names of the
+columns must be different from the fields of a tree file (for example, "tree",
+"node", "parent", "age", or "taxon"). An empty value removes the field from
+the terminal.
+
+Every row of the table must match a terminal in at least one tree. The rows
+without a terminal, and the terminals without a row, are reported in the
+standard error as a TSV table with the following columns:
+
+	-type   either "row", for a row without a terminal, or "terminal", for
+	        a terminal without a row
+	-tree   the name of the tree (empty for rows)
+	-taxon  the name of the taxon
+
+By default, if a row does not match any terminal, the command ends with an
+error, and no tree file is written. Use the flag --partial to add the data of
+the matched rows anyway.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var keyFlag string
+var fieldsFlag string
+var partial bool
+var input string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&keyFlag, "key", "taxon", "")
+	c.Flags().StringVar(&fieldsFlag, "fields", "", "")
+	c.Flags().BoolVar(&partial, "partial", false, "")
+	c.Flags().StringVar(&input, "input", "", "")
+	c.Flags().StringVar(&input, "i", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+	keyFlag = strings.ToLower(strings.TrimSpace(keyFlag))
+	if keyFlag == "" {
+		return c.UsageError("flag --key: undefined field")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	tab, err := readTable(c.Stdin())
+	if err != nil {
+		return err
+	}
+
+	matched := make(map[string]bool)
+	fmt.Fprintf(c.Stderr(), "type\ttree\ttaxon\n")
+	for _, tn := range coll.Names() {
+		t := coll.Tree(tn)
+		for _, tax := range t.Terms() {
+			vals, ok := tab.rows[strings.ToLower(tax)]
+			if !ok {
+				fmt.Fprintf(c.Stderr(), "terminal\t%s\t%s\n", tn, tax)
+				continue
+			}
+			matched[strings.ToLower(tax)] = true
+			id, _ := t.TaxNode(tax)
+			for i, f := range tab.fields {
+				if err := t.SetMeta(id, f, vals[i]); err != nil {
+					return fmt.Errorf("tree %q: taxon %q: %v", tn, tax, err)
+				}
+			}
+		}
+	}
+
+	var unmatched int
+	for _, r := range tab.order {
+		if matched[strings.ToLower(r)] {
+			continue
+		}
+		fmt.Fprintf(c.Stderr(), "row\t\t%s\n", r)
+		unmatched++
+	}
+	if unmatched > 0 && !partial {
+		return fmt.Errorf("%q: %d rows without a terminal", input, unmatched)
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+// A table is a table of taxon data.
+type table struct {
+	// names of the metadata fields
+	fields []string
+
+	// values of the fields
+	// indexed by the lower case
+	// taxon name
+	rows map[string][]string
+
+	// taxon names
+	// in the order of the table
+	order []string
+}
+
+func readTable(r io.Reader) (*table, error) {
+	if input != "" {
+		f, err := infile.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		input = "stdin"
+	}
+
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("while reading %q: %v", input, err)
+	}
+	cols := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(strings.TrimSpace(h))
+		cols[h] = i
+	}
+	key, ok := cols[keyFlag]
+	if !ok {
+		return nil, fmt.Errorf("while reading %q: expecting field %q", input, keyFlag)
+	}
+
+	var fields []string
+	if fieldsFlag != "" {
+		for _, f := range strings.Split(fieldsFlag, ",") {
+			f = strings.ToLower(strings.TrimSpace(f))
+			if f == "" {
+				continue
+			}
+			if _, ok := cols[f]; !ok {
+				return nil, fmt.Errorf("flag --fields: field %q not in %q", f, input)
+			}
+			if f == keyFlag {
+				return nil, fmt.Errorf("flag --fields: field %q is the key field", f)
+			}
+			fields = append(fields, f)
+		}
+	} else {
+		for i, h := range head {
+			if i == key {
+				continue
+			}
+			fields = append(fields, strings.ToLower(strings.TrimSpace(h)))
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("while reading %q: no fields to add", input)
+	}
+
+	t := &table{
+		fields: fields,
+		rows:   make(map[string][]string),
+	}
+	for {
+		rw, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", input, ln, err)
+		}
+
+		name := strings.Join(strings.Fields(rw[key]), " ")
+		if name == "" {
+			continue
+		}
+		if _, dup := t.rows[strings.ToLower(name)]; dup {
+			return nil, fmt.Errorf("%q: on row %d: field %q: taxon %q repeated", input, ln, keyFlag, name)
+		}
+
+		vals := make([]string, len(fields))
+		for i, f := range fields {
+			vals[i] = rw[cols[f]]
+		}
+		t.rows[strings.ToLower(name)] = vals
+		t.order = append(t.order, name)
+	}
+	if len(t.order) == 0 {
+		return nil, fmt.Errorf("%q: no taxa defined", input)
+	}
+	return t, nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package json implements a command to output phylogenetic trees
+// from a TSV file into an equivalent JSON file.
+package json
+
+import (
+	"fmt"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `json [--tree <tree>] [-o|--output <file>]
+	[<tree-file>...]`,
+	Short: "writes trees in JSON format",
+	Long: `
+Command json reads trees in TSV format and write them into a JSON document.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+By default, all trees will be printed in the output. If the flag --tree is
+set, only the indicated tree will be exported.
+
+The output is an object with a "trees" array. Each tree is an object with the
+fields "name" and "nodes", and each node is an object with the fields "id",
+"parent" (-1 for the root), "age" (in years), "taxon" (for named nodes),
+"order" (if the order of the children of the parent node was set by the user),
+and "meta" (an object with the node annotations, if any).
+
+By default the output will be printed in the standard output. To define an
+output file use the flag --output, or -o.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	if treeName != "" {
+		t := coll.Tree(treeName)
+		if t == nil {
+			return fmt.Errorf("tree %q not found", treeName)
+		}
+		coll = timetree.NewCollection()
+		coll.Add(t)
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	if err := coll.JSON(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
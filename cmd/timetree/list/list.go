@@ -8,11 +8,9 @@ package list
 
 import (
 	"fmt"
-	"io"
-	"os"
 
 	"github.com/js-arias/command"
-	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
 )
 
 var Command = &command.Command{
@@ -29,23 +27,13 @@ given, the trees will be read from the standard input.
 }
 
 func run(c *command.Command, args []string) error {
-	coll := timetree.NewCollection()
-
 	if len(args) == 0 {
 		args = append(args, "-")
 	}
-	for _, a := range args {
-		nc, err := readCollection(c.Stdin(), a)
-		if err != nil {
-			return err
-		}
 
-		for _, tn := range nc.Names() {
-			t := nc.Tree(tn)
-			if err := coll.Add(t); err != nil {
-				return fmt.Errorf("when adding trees from %q: %v", a, err)
-			}
-		}
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
 	}
 
 	ls := coll.Names()
@@ -54,22 +42,3 @@ func run(c *command.Command, args []string) error {
 	}
 	return nil
 }
-
-func readCollection(r io.Reader, name string) (*timetree.Collection, error) {
-	if name != "-" {
-		f, err := os.Open(name)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		r = f
-	} else {
-		name = "stdin"
-	}
-
-	c, err := timetree.ReadTSV(r)
-	if err != nil {
-		return nil, fmt.Errorf("while reading file %q: %v", name, err)
-	}
-	return c, nil
-}
@@ -8,35 +8,139 @@ package main
 import (
 	"github.com/js-arias/command"
 	"github.com/js-arias/timetree/cmd/timetree/add"
+	"github.com/js-arias/timetree/cmd/timetree/ages"
+	"github.com/js-arias/timetree/cmd/timetree/assert"
+	"github.com/js-arias/timetree/cmd/timetree/audit"
+	"github.com/js-arias/timetree/cmd/timetree/backbone"
+	"github.com/js-arias/timetree/cmd/timetree/bin"
+	"github.com/js-arias/timetree/cmd/timetree/brlen"
+	"github.com/js-arias/timetree/cmd/timetree/calib"
+	"github.com/js-arias/timetree/cmd/timetree/cherries"
+	"github.com/js-arias/timetree/cmd/timetree/clades"
+	"github.com/js-arias/timetree/cmd/timetree/diff"
+	"github.com/js-arias/timetree/cmd/timetree/dist"
 	"github.com/js-arias/timetree/cmd/timetree/draw"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/example"
 	"github.com/js-arias/timetree/cmd/timetree/format"
+	"github.com/js-arias/timetree/cmd/timetree/fossil"
+	"github.com/js-arias/timetree/cmd/timetree/gentime"
+	"github.com/js-arias/timetree/cmd/timetree/graft"
 	"github.com/js-arias/timetree/cmd/timetree/importcmd"
+	"github.com/js-arias/timetree/cmd/timetree/join"
+	"github.com/js-arias/timetree/cmd/timetree/json"
 	"github.com/js-arias/timetree/cmd/timetree/list"
+	"github.com/js-arias/timetree/cmd/timetree/merge"
+	"github.com/js-arias/timetree/cmd/timetree/mono"
 	"github.com/js-arias/timetree/cmd/timetree/newick"
+	"github.com/js-arias/timetree/cmd/timetree/nexml"
+	"github.com/js-arias/timetree/cmd/timetree/perturb"
+	"github.com/js-arias/timetree/cmd/timetree/phyloxml"
+	"github.com/js-arias/timetree/cmd/timetree/prune"
+	"github.com/js-arias/timetree/cmd/timetree/rename"
+	"github.com/js-arias/timetree/cmd/timetree/revert"
+	"github.com/js-arias/timetree/cmd/timetree/root"
+	"github.com/js-arias/timetree/cmd/timetree/sample"
+	"github.com/js-arias/timetree/cmd/timetree/scale"
 	"github.com/js-arias/timetree/cmd/timetree/set"
 	"github.com/js-arias/timetree/cmd/timetree/sim"
+	"github.com/js-arias/timetree/cmd/timetree/snapshot"
+	"github.com/js-arias/timetree/cmd/timetree/stats"
 	"github.com/js-arias/timetree/cmd/timetree/sub"
+	"github.com/js-arias/timetree/cmd/timetree/swap"
 	"github.com/js-arias/timetree/cmd/timetree/tax"
 	"github.com/js-arias/timetree/cmd/timetree/terms"
+	"github.com/js-arias/timetree/cmd/timetree/treedist"
+	"github.com/js-arias/timetree/cmd/timetree/unique"
 )
 
 var app = &command.Command{
 	Usage: "timetree <command> [<argument>...]",
 	Short: "a tool to manipulate time calibrated phylogenetic trees",
+	Long: `
+Tree files compressed with gzip (for example, large posterior samples) can be
+used as input of any command, and are decompressed transparently, either from
+a file or from the standard input. Output tree files with the extension ".gz"
+will be compressed with gzip.
+
+Tree files, and the files of the flag --input, can be given as HTTP or HTTPS
+URLs (for example, "timetree list https://example.com/chronogram.tab"), so
+published trees can be used without a manual download. The file is downloaded
+once, and stored in the "timetree" directory of the user cache directory (for
+example, "~/.cache/timetree" in Linux), so later uses of the same URL read the
+stored copy. To download the file again, remove it from the cache directory.
+
+Output files are first written to a temporary file in the same directory, and
+replace the previous file only when the command finishes successfully, so a
+partial file is never seen by other commands, and if a command fails, the
+previous file is kept. While a command runs, from before reading its input to
+the end of writing, a lock file (the name of the output file with the extension
+".lock") is created, and any other command that tries to write the same file
+will fail with an error. If a command is interrupted, the lock file can be left
+behind, and should be removed by hand.
+
+The trees read by a command are combined in a single collection. If the
+combined trees have ages in different units (as stored in the "unit" metadata
+field of the root node, for example, years and generations), a warning is
+printed in the standard error.
+
+Commands that modify trees (add, backbone, brlen, format, fossil, gentime,
+graft, import, join, merge, prune, rename, revert, root, sample, scale, set,
+snapshot, sub, swap, tax, and unique) accept the global flag --dry-run, given
+before the command name (for example, "timetree --dry-run set --tozero
+trees.tab"). With this flag, the command performs all the parsing and
+validation, but instead of writing the resulting trees, it prints in the
+standard output the changes that would be made (trees and nodes added or
+removed, ages set, and names or metadata changed). Nothing is written.
+	`,
+	SetFlags: dryrun.SetFlags,
 }
 
 func init() {
 	app.Add(add.Command)
+	app.Add(ages.Command)
+	app.Add(assert.Command)
+	app.Add(audit.Command)
+	app.Add(backbone.Command)
+	app.Add(bin.Command)
+	app.Add(brlen.Command)
+	app.Add(calib.Command)
+	app.Add(cherries.Command)
+	app.Add(clades.Command)
+	app.Add(diff.Command)
+	app.Add(dist.Command)
 	app.Add(draw.Command)
+	app.Add(example.Command)
 	app.Add(format.Command)
+	app.Add(fossil.Command)
+	app.Add(gentime.Command)
+	app.Add(graft.Command)
 	app.Add(importcmd.Command)
+	app.Add(join.Command)
+	app.Add(json.Command)
 	app.Add(list.Command)
+	app.Add(merge.Command)
+	app.Add(mono.Command)
 	app.Add(newick.Command)
+	app.Add(nexml.Command)
+	app.Add(perturb.Command)
+	app.Add(phyloxml.Command)
+	app.Add(prune.Command)
+	app.Add(rename.Command)
+	app.Add(revert.Command)
+	app.Add(root.Command)
+	app.Add(sample.Command)
+	app.Add(scale.Command)
 	app.Add(set.Command)
 	app.Add(sim.Command)
+	app.Add(snapshot.Command)
+	app.Add(stats.Command)
 	app.Add(sub.Command)
+	app.Add(swap.Command)
 	app.Add(tax.Command)
 	app.Add(terms.Command)
+	app.Add(treedist.Command)
+	app.Add(unique.Command)
 }
 
 func main() {
@@ -0,0 +1,283 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package merge implements a command to merge
+// the trees of several tree files.
+package merge
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `merge [--prefix <tree>=<prefix>[,<tree>=<prefix>...]]
+	[--tree-prefix] [--map <file>] [--supertree <name>]
+	[-o|--output <file>] <treefile>...`,
+	Short: "merge trees from several files",
+	Long: `
+Command merge reads trees from one or more tree files in TSV format, and
+merge them into a single tree file.
+
+When merging trees from different sources, identical taxon names might have
+different meanings (for example, different subspecies concepts). To keep the
+taxon names unambiguous, a namespace prefix can be added to the taxa of a
+tree, so the taxon names will have the form "<prefix>/<taxon>". Use the flag
+--prefix to define the prefix of one or more trees, using the name of the
+tree, followed by an equal sign, and the prefix (for example,
+"--prefix dinos=msw3"). Multiple trees are separated by commas. If the flag
+--tree-prefix is defined, the name of each tree will be used as the prefix of
+the trees without an explicit prefix.
+
+If the flag --map is defined, a TSV file with the mapping between the
+original taxon names and the new taxon names will be written in the indicated
+file. The file contains the following columns:
+
+	-tree  the name of the tree
+	-taxon the original taxon name
+	-name  the taxon name with the prefix
+
+If the flag --supertree is defined, the trees will be combined into a single
+tree with the indicated name, using the taxa shared by the trees as a
+backbone. The first tree read is used as the backbone, and each of the other
+trees is merged, in the order in which they were read, into it. Each clade of
+a merged tree without shared taxa is attached as sister of the most recent
+common ancestor of the shared taxa of its sister group, using the age of its
+parent in the merged tree (or an age halfway between the sister and its
+parent, if that age is not valid). The ages of the nodes that define the same
+set of shared taxa in both trees are reconciled by taking the maximum age. Each
+merged tree must share at least two taxa with the growing tree, and all trees
+must have the ages in the same unit. Only the resulting tree will be written.
+
+The unit of the ages of a tree is stored in the "unit" metadata field of the
+root node (trees without a unit are assumed to be in years). If the merged
+trees have ages in different units (for example, years and generations), a
+warning will be printed in the standard error.
+
+The merged tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var treePrefix bool
+var prefixFlag string
+var mapFile string
+var superName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().BoolVar(&treePrefix, "tree-prefix", false, "")
+	c.Flags().StringVar(&prefixFlag, "prefix", "", "")
+	c.Flags().StringVar(&mapFile, "map", "", "")
+	c.Flags().StringVar(&superName, "supertree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+
+	prefixes, err := parsePrefix()
+	if err != nil {
+		return err
+	}
+
+	coll, order, err := infile.TimeTrees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	if units := coll.Units(); len(units) > 1 && superName != "" {
+		return fmt.Errorf("flag --supertree: trees with ages in different units: %s", strings.Join(units, ", "))
+	}
+
+	for tn := range prefixes {
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --prefix: tree %q not found", tn)
+		}
+	}
+
+	names := make(map[string]map[string]string)
+	for _, tn := range coll.Names() {
+		p, ok := prefixes[tn]
+		if !ok && treePrefix {
+			p = tn
+		}
+		if p == "" {
+			continue
+		}
+
+		t := coll.Tree(tn)
+		m, err := t.Prefix(p)
+		if err != nil {
+			return fmt.Errorf("tree %q: %v", tn, err)
+		}
+		names[tn] = m
+		if dryrun.Enabled {
+			for old, nn := range m {
+				dryrun.Rename(tn, old, nn)
+			}
+		}
+	}
+
+	if mapFile != "" && !dryrun.Enabled {
+		if err := writeMap(names); err != nil {
+			return err
+		}
+	}
+
+	if superName != "" {
+		st, err := supertree(coll, order)
+		if err != nil {
+			return err
+		}
+		coll = st
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parsePrefix() (map[string]string, error) {
+	prefixes := make(map[string]string)
+	if prefixFlag == "" {
+		return prefixes, nil
+	}
+
+	for _, v := range strings.Split(prefixFlag, ",") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		tn, p, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("flag --prefix: expecting <tree>=<prefix>, got %q", v)
+		}
+		tn = strings.ToLower(strings.Join(strings.Fields(tn), " "))
+		p = strings.TrimSpace(p)
+		if tn == "" || p == "" {
+			return nil, fmt.Errorf("flag --prefix: expecting <tree>=<prefix>, got %q", v)
+		}
+		prefixes[tn] = p
+	}
+	return prefixes, nil
+}
+
+// Supertree returns a collection with a single tree
+// built by merging the trees of a collection
+// in the indicated order.
+func supertree(c *timetree.Collection, order []string) (*timetree.Collection, error) {
+	if len(order) < 2 {
+		return nil, fmt.Errorf("flag --supertree: expecting two or more trees, got %d", len(order))
+	}
+
+	first := c.Tree(order[0])
+	st := first.SubTree(first.Root(), superName)
+	for _, tn := range order[1:] {
+		if err := st.Merge(c.Tree(tn)); err != nil {
+			return nil, fmt.Errorf("flag --supertree: when merging tree %q: %v", tn, err)
+		}
+	}
+	st.Format()
+
+	sc := timetree.NewCollection()
+	if err := sc.Add(st); err != nil {
+		return nil, fmt.Errorf("flag --supertree: %v", err)
+	}
+	return sc, nil
+}
+
+func writeMap(names map[string]map[string]string) (err error) {
+	f, err := outfile.Create(mapFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Discard()
+			return
+		}
+		err = f.Close()
+	}()
+
+	w := csv.NewWriter(f)
+	w.Comma = '\t'
+	w.UseCRLF = true
+
+	if err := w.Write([]string{"tree", "taxon", "name"}); err != nil {
+		return fmt.Errorf("while writing to %q: %v", mapFile, err)
+	}
+
+	trees := make([]string, 0, len(names))
+	for tn := range names {
+		trees = append(trees, tn)
+	}
+	slices.Sort(trees)
+	for _, tn := range trees {
+		m := names[tn]
+		taxa := make([]string, 0, len(m))
+		for tx := range m {
+			taxa = append(taxa, tx)
+		}
+		slices.Sort(taxa)
+		for _, tx := range taxa {
+			row := []string{tn, tx, m[tx]}
+			if err := w.Write(row); err != nil {
+				return fmt.Errorf("while writing to %q: %v", mapFile, err)
+			}
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", mapFile, err)
+	}
+	return nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
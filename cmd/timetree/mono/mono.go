@@ -0,0 +1,238 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package mono implements a command to report the frequency
+// of monophyly of a set of clades
+// in a tree collection.
+package mono
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `mono [-i|--input <file>] [-o|--output <file>]
+	<treefile>...`,
+	Short: "report monophyly frequency of clades",
+	Long: `
+Command mono reads one or more trees in TSV format, and a file with named sets
+of taxa, and reports, for each set, the fraction of trees in which the set is
+monophyletic, and the distribution of the age of the clade in the trees in
+which the set is monophyletic.
+
+One or more tree files must be given as arguments.
+
+The taxon sets can be defined either from an input file defined with the
+--input, or -i, flag, or provided in the standard input. The file is a TSV
+file without header, and the following columns:
+
+	-clade  the name of the taxon set
+	-taxon  the name of a taxon in the set
+
+A set is defined by all the rows that share the same clade name. Terminals of
+a set that are absent in a tree are ignored, and a set is only evaluated in a
+tree if at least two of its terminals are present in the tree.
+
+The output is a TSV table with the following columns:
+
+	-clade   the name of the taxon set
+	-trees   the number of trees in which the set was evaluated
+	-mono    the number of trees in which the set is monophyletic
+	-freq    the fraction of the trees in the collection in which the set
+	         is monophyletic
+	-mean    mean age of the clade (in million years)
+	-min     minimum age of the clade
+	-q025    2.5% quantile of the age of the clade
+	-median  median age of the clade
+	-q975    97.5% quantile of the age of the clade
+	-max     maximum age of the clade
+
+By default, the table will be printed in the standard output. Use the flag
+--output, or -o, to define an output file.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var input string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&input, "input", "", "")
+	c.Flags().StringVar(&input, "i", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	sets, names, err := readSets(c.Stdin())
+	if err != nil {
+		return err
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "clade\ttrees\tmono\tfreq\tmean\tmin\tq025\tmedian\tq975\tmax\n")
+	total := len(coll.Names())
+	for _, nm := range names {
+		var evaluated int
+		var ages []float64
+		for _, tn := range coll.Names() {
+			t := coll.Tree(tn)
+			id, ok := monophyly(t, sets[nm])
+			if !ok {
+				if id >= 0 {
+					evaluated++
+				}
+				continue
+			}
+			evaluated++
+			ages = append(ages, float64(t.Age(id))/millionYears)
+		}
+
+		freq := float64(len(ages)) / float64(total)
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%.6f", nm, evaluated, len(ages), freq)
+		if len(ages) == 0 {
+			fmt.Fprintf(bw, "\t\t\t\t\t\t\n")
+			continue
+		}
+		slices.Sort(ages)
+		var sum float64
+		for _, a := range ages {
+			sum += a
+		}
+		mean := sum / float64(len(ages))
+		fmt.Fprintf(bw, "\t%.6f\t%.6f\t%.6f\t%.6f\t%.6f\t%.6f\n", mean, ages[0], quantile(ages, 0.025), quantile(ages, 0.5), quantile(ages, 0.975), ages[len(ages)-1])
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+func readSets(r io.Reader) (map[string][]string, []string, error) {
+	if input != "" {
+		f, err := infile.Open(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		input = "stdin"
+	}
+
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	sets := make(map[string][]string)
+	var names []string
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%q: on row %d: %v", input, ln, err)
+		}
+		if len(row) < 2 {
+			return nil, nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", input, ln, len(row), 2)
+		}
+
+		name := strings.Join(strings.Fields(row[0]), " ")
+		if name == "" {
+			continue
+		}
+		tax := strings.Join(strings.Fields(row[1]), " ")
+		if tax == "" {
+			continue
+		}
+		if _, ok := sets[name]; !ok {
+			names = append(names, name)
+		}
+		sets[name] = append(sets[name], tax)
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("%q: no taxon sets defined", input)
+	}
+	return sets, names, nil
+}
+
+// Monophyly returns the ID of the most recent common ancestor
+// of the terminals of a set in a tree,
+// and true if the set is monophyletic.
+// If less than two terminals are in the tree,
+// it returns -1.
+func monophyly(t *timetree.Tree, set []string) (int, bool) {
+	var names []string
+	for _, tax := range set {
+		id, ok := t.TaxNode(tax)
+		if !ok || !t.IsTerm(id) {
+			continue
+		}
+		names = append(names, t.Taxon(id))
+	}
+	if len(names) < 2 {
+		return -1, false
+	}
+
+	mrca := t.MRCA(names...)
+	if t.CladeSize(mrca) != len(names) {
+		return mrca, false
+	}
+	return mrca, true
+}
+
+// Quantile returns the value at the given quantile
+// from a sorted slice of values.
+func quantile(v []float64, q float64) float64 {
+	i := int(q * float64(len(v)-1))
+	return v[i]
+}
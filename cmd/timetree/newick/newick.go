@@ -9,17 +9,16 @@ package newick
 import (
 	"bufio"
 	"fmt"
-	"io"
-	"os"
 	"strings"
 
 	"github.com/js-arias/command"
-	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 )
 
 var Command = &command.Command{
-	Usage: `newick [--tree <tree>] [-o|--output <file>]
-	[<tree-file>...]`,
+	Usage: `newick [--tree <tree>] [--names] [--list <file>]
+	[-o|--output <file>] [<tree-file>...]`,
 	Short: "writes a tree in newick format",
 	Long: `
 Command newick reads a tree in TSV format and write it into a newick
@@ -31,60 +30,73 @@ given, the trees will be read from the standard input.
 By default, all trees will be printed in the output. If the flag --tree is
 set, only the indicated tree will be exported.
 
+Each tree is written in a single line. By default, the name of the tree is not
+written. If the flag --names is set, each line will be prefixed with the tree
+name, as in a nexus trees block (for example "tree my_tree = (...);"). Spaces
+in tree names are replaced with underscores. Use the flag --list to write the
+tree names into a separate file, one name per line, in the same order as the
+trees in the newick output.
+
 By default the output will be printed in the standard output. To define an
 output file use the flag --output, or -o.
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      outfile.Locked(&output, run),
 }
 
 var treeName string
+var withNames bool
+var listFile string
 var output string
 
 func setFlags(c *command.Command) {
 	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().BoolVar(&withNames, "names", false, "")
+	c.Flags().StringVar(&listFile, "list", "", "")
 	c.Flags().StringVar(&output, "output", "", "")
 	c.Flags().StringVar(&output, "o", "", "")
 }
 
 func run(c *command.Command, args []string) (err error) {
-	coll := timetree.NewCollection()
-
 	if len(args) == 0 {
 		args = append(args, "-")
 	}
-	for _, a := range args {
-		nc, err := readCollection(c.Stdin(), a)
-		if err != nil {
-			return err
-		}
 
-		for _, tn := range nc.Names() {
-			t := nc.Tree(tn)
-			if err := coll.Add(t); err != nil {
-				return fmt.Errorf("when adding trees from %q: %v", a, err)
-			}
-		}
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
 	}
 
 	var names []string
 	if treeName != "" {
-		names = []string{treeName}
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
 	} else {
 		names = coll.Names()
 	}
 
+	if listFile != "" {
+		if err := writeList(names); err != nil {
+			return err
+		}
+	}
+
 	w := c.Stdout()
 	if output != "" {
-		f, err := os.Create(output)
+		var f *outfile.File
+		f, err = outfile.Create(output)
 		if err != nil {
 			return err
 		}
 		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
+			if err != nil {
+				f.Discard()
+				return
 			}
+			err = f.Close()
 		}()
 		w = f
 	} else {
@@ -94,7 +106,12 @@ func run(c *command.Command, args []string) (err error) {
 
 	for _, tn := range names {
 		t := coll.Tree(tn)
-		writeNode(bw, t, t.Root())
+		if withNames {
+			fmt.Fprintf(bw, "tree %s = ", strings.Join(strings.Fields(tn), "_"))
+		}
+		if err := t.Newick(bw); err != nil {
+			return fmt.Errorf("while writing to %q: %v", output, err)
+		}
 	}
 	if err := bw.Flush(); err != nil {
 		return fmt.Errorf("while writing to %q: %v", output, err)
@@ -102,54 +119,27 @@ func run(c *command.Command, args []string) (err error) {
 	return nil
 }
 
-func readCollection(r io.Reader, name string) (*timetree.Collection, error) {
-	if name != "-" {
-		f, err := os.Open(name)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		r = f
-	} else {
-		name = "stdin"
-	}
-
-	c, err := timetree.ReadTSV(r)
+// WriteList writes the names of the trees
+// into the list file.
+func writeList(names []string) (err error) {
+	f, err := outfile.Create(listFile)
 	if err != nil {
-		return nil, fmt.Errorf("while reading file %q: %v", name, err)
-	}
-	return c, nil
-}
-
-// millionYears is used to transform branch lengths
-// (an integer in years)
-// to a float in million years.
-const millionYears = 1_000_000
-
-func writeNode(w io.Writer, t *timetree.Tree, node int) {
-	p := t.Parent(node)
-	children := t.Children(node)
-	if len(children) == 0 {
-		brLen := float64(t.Age(p)-t.Age(node)) / millionYears
-		name := strings.Join(strings.Fields(t.Taxon(node)), "_")
-		fmt.Fprintf(w, "%s:%.6f", name, brLen)
-		return
+		return err
 	}
-
-	// an internal node
-	fmt.Fprintf(w, "(")
-	for i, c := range children {
-		if i > 0 {
-			fmt.Fprintf(w, ", ")
+	defer func() {
+		if err != nil {
+			f.Discard()
+			return
 		}
-		writeNode(w, t, c)
-	}
+		err = f.Close()
+	}()
 
-	if p < 0 {
-		// the root
-		fmt.Fprintf(w, ");\n")
-		return
+	bw := bufio.NewWriter(f)
+	for _, tn := range names {
+		fmt.Fprintf(bw, "%s\n", tn)
 	}
-	brLen := float64(t.Age(p)-t.Age(node)) / millionYears
-	fmt.Fprintf(w, "):%.6f", brLen)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", listFile, err)
+	}
+	return nil
 }
@@ -0,0 +1,92 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package nexml implements a command to output phylogenetic trees
+// from a TSV file into an equivalent NeXML file.
+package nexml
+
+import (
+	"fmt"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `nexml [--tree <tree>] [-o|--output <file>]
+	[<tree-file>...]`,
+	Short: "writes trees in NeXML format",
+	Long: `
+Command nexml reads trees in TSV format and write them into a NeXML document.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+By default, all trees will be printed in the output. If the flag --tree is
+set, only the indicated tree will be exported.
+
+Branch lengths are written in million years, and the age of each node (in
+years) is stored as a node annotation.
+
+By default the output will be printed in the standard output. To define an
+output file use the flag --output, or -o.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	if treeName != "" {
+		t := coll.Tree(treeName)
+		if t == nil {
+			return fmt.Errorf("tree %q not found", treeName)
+		}
+		coll = timetree.NewCollection()
+		coll.Add(t)
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	if err := coll.NeXML(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package outfile implements the creation of output files
+// that are safe to use by concurrent invocations
+// of the commands.
+//
+// An output file is written in a temporary file
+// in the same directory,
+// and only when the file is closed,
+// the temporary file is renamed
+// to the final name,
+// so a reader never sees a partial file.
+// If the command fails,
+// the file should be discarded,
+// so any previous file is kept.
+// While the file is written,
+// an advisory lock file
+// (the name of the file with the extension ".lock")
+// is created,
+// so a concurrent invocation
+// that writes the same file
+// will fail with an error,
+// instead of clobbering the file.
+// As a command might read the file
+// before writing it,
+// the lock can be taken with Lock
+// (or Locked, for the run function of a command)
+// at the start of the command,
+// and kept until the command ends.
+//
+// If the name of the file
+// ends with the extension ".gz",
+// the data is compressed with gzip.
+package outfile
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/js-arias/command"
+)
+
+// LockExt is the extension
+// of the lock files.
+const LockExt = ".lock"
+
+// ErrLocked is returned when a file
+// is being written by another process.
+var ErrLocked = errors.New("file locked by another process")
+
+// Locks held by the process.
+var (
+	mu   sync.Mutex
+	held = make(map[string]bool)
+)
+
+// Lock takes the lock of a file
+// with the given name,
+// and returns a function
+// that releases the lock.
+// While the lock is held,
+// the file can be created with Create
+// by the same process.
+// If the name is empty
+// (i.e., the output is the standard output),
+// it does nothing.
+// It returns ErrLocked if the file
+// is being written by another process.
+func Lock(name string) (unlock func(), err error) {
+	if name == "" {
+		return func() {}, nil
+	}
+	lock := name + LockExt
+	if err := lockFile(name, lock); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	held[lock] = true
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		delete(held, lock)
+		mu.Unlock()
+		os.Remove(lock)
+	}, nil
+}
+
+// Locked returns a command run function
+// that takes the lock of the output file
+// (given as a pointer to the flag variable,
+// as flags are parsed after the command is defined)
+// for the whole run of the command,
+// as the output file might be one of the input files,
+// or the trees already in the output file might be kept.
+func Locked(output *string, run func(c *command.Command, args []string) error) func(c *command.Command, args []string) error {
+	return func(c *command.Command, args []string) error {
+		unlock, err := Lock(*output)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		return run(c, args)
+	}
+}
+
+// LockFile creates the lock file of a file.
+func lockFile(name, lock string) error {
+	lf, err := os.OpenFile(lock, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: %q (if no other process is running, remove the file %q)", ErrLocked, name, lock)
+		}
+		return err
+	}
+	fmt.Fprintf(lf, "%d\n", os.Getpid())
+	lf.Close()
+	return nil
+}
+
+// A File is an output file.
+type File struct {
+	name string
+	tmp  *os.File
+
+	// lock file,
+	// empty if the lock was taken with Lock
+	lock string
+
+	// compressed writer,
+	// if the file is a gzip file
+	z *gzip.Writer
+
+	// first error found while writing
+	err error
+
+	// the file was already closed
+	// or discarded
+	done bool
+}
+
+// Create creates an output file
+// with the given name.
+// If the name ends with ".gz",
+// the written data will be compressed.
+// If the lock of the file
+// was taken with Lock,
+// the lock is kept after the file is closed.
+// It returns ErrLocked if the file
+// is being written by another process.
+func Create(name string) (*File, error) {
+	lock := name + LockExt
+	mu.Lock()
+	if held[lock] {
+		lock = ""
+	}
+	mu.Unlock()
+	if lock != "" {
+		if err := lockFile(name, lock); err != nil {
+			return nil, err
+		}
+	}
+
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		if lock != "" {
+			os.Remove(lock)
+		}
+		return nil, err
+	}
+
+	f := &File{
+		name: name,
+		lock: lock,
+		tmp:  tmp,
+	}
+	if strings.HasSuffix(name, ".gz") {
+		f.z = gzip.NewWriter(tmp)
+	}
+	return f, nil
+}
+
+// Name returns the name of the file.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Write writes data to the file.
+func (f *File) Write(p []byte) (int, error) {
+	var n int
+	var err error
+	if f.z != nil {
+		n, err = f.z.Write(p)
+	} else {
+		n, err = f.tmp.Write(p)
+	}
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// Close closes the file
+// and replaces any previous file
+// with the written data.
+// If an error was found while writing,
+// the written data is discarded,
+// and any previous file is kept.
+func (f *File) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	if f.lock != "" {
+		defer os.Remove(f.lock)
+	}
+
+	if f.z != nil {
+		if err := f.z.Close(); err != nil && f.err == nil {
+			f.err = err
+		}
+	}
+
+	tmpName := f.tmp.Name()
+	err := f.tmp.Close()
+	if f.err != nil || err != nil {
+		os.Remove(tmpName)
+		if err == nil {
+			err = f.err
+		}
+		return err
+	}
+
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(f.name); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, f.name); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// Discard closes the file
+// discarding the written data,
+// so any previous file is kept.
+// It should be used
+// when the command fails
+// after the file was created.
+func (f *File) Discard() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+	if f.lock != "" {
+		os.Remove(f.lock)
+	}
+}
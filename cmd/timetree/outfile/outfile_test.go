@@ -0,0 +1,213 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package outfile_test
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := map[string]string{
+		"plain":      filepath.Join(dir, "trees.tab"),
+		"compressed": filepath.Join(dir, "trees.tab.gz"),
+	}
+	for name, fn := range tests {
+		f, err := outfile.Create(fn)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if _, err := io.WriteString(f, "some data\n"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		if got := readFile(t, fn); got != "some data\n" {
+			t.Errorf("%s: got %q, want %q", name, got, "some data\n")
+		}
+		if _, err := os.Stat(fn + outfile.LockExt); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: lock file not removed", name)
+		}
+	}
+}
+
+func TestCreateLocked(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "trees.tab")
+
+	f, err := outfile.Create(fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := outfile.Create(fn); !errors.Is(err, outfile.ErrLocked) {
+		t.Errorf("create: got error %v, want %v", err, outfile.ErrLocked)
+	}
+	if _, err := outfile.Lock(fn); !errors.Is(err, outfile.ErrLocked) {
+		t.Errorf("lock: got error %v, want %v", err, outfile.ErrLocked)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// after closing the file
+	// the lock is released
+	f, err = outfile.Create(fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Discard()
+}
+
+func TestLock(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "trees.tab")
+	lock := fn + outfile.LockExt
+
+	unlock, err := outfile.Lock(fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := outfile.Lock(fn); !errors.Is(err, outfile.ErrLocked) {
+		t.Errorf("lock: got error %v, want %v", err, outfile.ErrLocked)
+	}
+
+	// a file locked by the process
+	// can be created
+	f, err := outfile.Create(fn)
+	if err != nil {
+		t.Fatalf("create: unexpected error: %v", err)
+	}
+	io.WriteString(f, "some data\n")
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(lock); err != nil {
+		t.Errorf("lock file removed after closing the file: %v", err)
+	}
+
+	unlock()
+	if _, err := os.Stat(lock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file not removed after unlock")
+	}
+
+	// a lock left by another process
+	if err := os.WriteFile(lock, []byte("1\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := outfile.Lock(fn); !errors.Is(err, outfile.ErrLocked) {
+		t.Errorf("lock: got error %v, want %v", err, outfile.ErrLocked)
+	}
+	if _, err := outfile.Create(fn); !errors.Is(err, outfile.ErrLocked) {
+		t.Errorf("create: got error %v, want %v", err, outfile.ErrLocked)
+	}
+
+	// the standard output
+	unlock, err = outfile.Lock("")
+	if err != nil {
+		t.Fatalf("lock: unexpected error for the standard output: %v", err)
+	}
+	unlock()
+}
+
+func TestLocked(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "trees.tab")
+	lock := fn + outfile.LockExt
+
+	output := fn
+	run := outfile.Locked(&output, func(c *command.Command, args []string) error {
+		if _, err := os.Stat(lock); err != nil {
+			t.Errorf("run: lock file not found: %v", err)
+		}
+		return errors.New("run error")
+	})
+	if err := run(nil, nil); err == nil || err.Error() != "run error" {
+		t.Errorf("run: got error %v, want %q", err, "run error")
+	}
+	if _, err := os.Stat(lock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file not removed after the run")
+	}
+
+	// the output is locked by another process
+	if err := os.WriteFile(lock, []byte("1\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := run(nil, nil); !errors.Is(err, outfile.ErrLocked) {
+		t.Errorf("run: got error %v, want %v", err, outfile.ErrLocked)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "trees.tab")
+	if err := os.WriteFile(fn, []byte("previous data\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, err := outfile.Create(fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	io.WriteString(f, "new data\n")
+	f.Discard()
+
+	// calling Close after Discard
+	// does nothing
+	if err := f.Close(); err != nil {
+		t.Errorf("close after discard: unexpected error: %v", err)
+	}
+
+	if got := readFile(t, fn); got != "previous data\n" {
+		t.Errorf("discard: got %q, want %q", got, "previous data\n")
+	}
+
+	// only the previous file is kept
+	// (no temporary or lock files)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "trees.tab" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("discard: got files %v, want %v", names, []string{"trees.tab"})
+	}
+}
+
+func readFile(t testing.TB, name string) string {
+	t.Helper()
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if filepath.Ext(name) == ".gz" {
+		z, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("file %q: unexpected error: %v", name, err)
+		}
+		defer z.Close()
+		r = z
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("file %q: unexpected error: %v", name, err)
+	}
+	return string(b)
+}
@@ -0,0 +1,341 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package perturb implements a command to create replicates
+// of a tree with randomly perturbed node ages.
+package perturb
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `perturb [--tree <tree>] [--replicates <number>]
+	[--abs <value>] [--rel <value>] [--shuffle]
+	[-o|--output <file>] [<tree-file>...]`,
+	Short: "create replicates with perturbed node ages",
+	Long: `
+Command perturb reads one or more trees in TSV format, and creates replicates
+of each tree in which the ages of the internal nodes are randomly perturbed.
+It is useful to test how sensitive a downstream analysis is to errors in the
+dating of the tree.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+By default, replicates will be created for all trees. If the flag --tree is
+set, only the indicated tree will be used.
+
+By default, 100 replicates will be created for each tree. Use the flag
+--replicates to define a different number of replicates. Each replicate will
+be named after the source tree, with a sequential number starting from 1.
+
+The age of each internal node will be sampled from a uniform distribution
+centered on its current age. Use the flag --abs to define the maximum
+deviation in million years, or the flag --rel to define the maximum deviation
+as a percentage of the node age. One of these flags must be defined.
+
+Sampled ages always respect the topology of the tree: a node will be always
+younger than its parent, and older than any of its descendants. The ages of
+terminals are never modified.
+
+Use the flag --shuffle, instead of --abs or --rel, to create replicates that
+keep the same set of ages of the internal nodes of the source tree, but in
+which the ages are randomly reassigned to the nodes. It is a null model to
+test if the age of a particular clade is unusually old, or young, given the
+ages of the tree. The ages are assigned from the oldest to the youngest, each
+one to a node randomly selected from the nodes whose parent has already an
+age, and that are older than any of its terminals, so the root always keeps
+its age, and the topology of the tree is always respected.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var numReps int
+var absFlag float64
+var relFlag float64
+var shuffleFlag bool
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().IntVar(&numReps, "replicates", 100, "")
+	c.Flags().Float64Var(&absFlag, "abs", 0, "")
+	c.Flags().Float64Var(&relFlag, "rel", 0, "")
+	c.Flags().BoolVar(&shuffleFlag, "shuffle", false, "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+// millionYears is used to transform the abs flag
+// (a float in million years)
+// into an integer in years.
+const millionYears = 1_000_000
+
+func run(c *command.Command, args []string) error {
+	var modes int
+	for _, m := range []bool{absFlag > 0, relFlag > 0, shuffleFlag} {
+		if m {
+			modes++
+		}
+	}
+	if modes == 0 {
+		return c.UsageError("either flag --abs, --rel, or --shuffle must be defined")
+	}
+	if modes > 1 {
+		return c.UsageError("only one of flags --abs, --rel, or --shuffle can be defined")
+	}
+	if numReps <= 0 {
+		return c.UsageError("flag --replicates must be greater than 0")
+	}
+
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.TimeTrees(c, args)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	if treeName != "" {
+		if coll.Tree(treeName) == nil {
+			return fmt.Errorf("tree %q not found", treeName)
+		}
+		names = []string{treeName}
+	} else {
+		names = coll.Names()
+	}
+
+	reps := timetree.NewCollection()
+	for _, tn := range names {
+		t := coll.Tree(tn)
+		for i := 0; i < numReps; i++ {
+			name := fmt.Sprintf("%s.%d", t.Name(), i+1)
+			var nt *timetree.Tree
+			if shuffleFlag {
+				var err error
+				nt, err = shuffle(t, name)
+				if err != nil {
+					return err
+				}
+			} else {
+				nt = perturb(t, name)
+			}
+			if err := reps.Add(nt); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writeTrees(c.Stdout(), reps); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Perturb returns a new tree
+// with the ages of internal nodes
+// sampled around the ages of the source tree.
+func perturb(t *timetree.Tree, name string) *timetree.Tree {
+	nodes := t.Nodes()
+	oldest := oldestTerms(t)
+
+	ages := make(map[int]int64, len(nodes))
+	for _, id := range nodes {
+		age := t.Age(id)
+		if t.IsTerm(id) {
+			ages[id] = age
+			continue
+		}
+
+		dev := int64(absFlag * millionYears)
+		if relFlag > 0 {
+			dev = int64(float64(age) * relFlag / 100)
+		}
+
+		upper := age + dev
+		if p := t.Parent(id); p >= 0 {
+			upper = ages[p]
+		}
+
+		min := age - dev
+		if lim := oldest[id] + 1; min < lim {
+			min = lim
+		}
+		max := age + dev
+		if lim := upper - 1; max > lim {
+			max = lim
+		}
+		if min > max {
+			// no room to move the node
+			// so keep it as close as possible
+			// to its original age,
+			// but younger than its parent.
+			if age >= upper {
+				age = upper - 1
+			}
+			if age < oldest[id] {
+				age = oldest[id]
+			}
+			ages[id] = age
+			continue
+		}
+		ages[id] = rand.Int64N(max-min+1) + min
+	}
+
+	return buildTree(t, name, ages)
+}
+
+// OldestTerms returns the age of the oldest terminal
+// of each clade of a tree,
+// which is the lower bound for the age of a node.
+func oldestTerms(t *timetree.Tree) map[int]int64 {
+	nodes := t.Nodes()
+	oldest := make(map[int]int64, len(nodes))
+	for i := len(nodes) - 1; i >= 0; i-- {
+		id := nodes[i]
+		if t.IsTerm(id) {
+			oldest[id] = t.Age(id)
+			continue
+		}
+		var max int64
+		for _, c := range t.Children(id) {
+			if oldest[c] > max {
+				max = oldest[c]
+			}
+		}
+		oldest[id] = max
+	}
+	return oldest
+}
+
+// MaxShuffle is the maximum number of attempts
+// to reassign the ages of a tree.
+const maxShuffle = 1000
+
+// Shuffle returns a new tree
+// with the ages of the internal nodes
+// of the source tree
+// randomly reassigned to the internal nodes.
+func shuffle(t *timetree.Tree, name string) (*timetree.Tree, error) {
+	oldest := oldestTerms(t)
+
+	var slots []int64
+	for _, id := range t.Nodes() {
+		if !t.IsTerm(id) {
+			slots = append(slots, t.Age(id))
+		}
+	}
+	slices.Sort(slots)
+	slices.Reverse(slots)
+
+	for range maxShuffle {
+		if ages, ok := assignAges(t, slots, oldest); ok {
+			return buildTree(t, name, ages), nil
+		}
+	}
+	return nil, fmt.Errorf("tree %q: unable to shuffle node ages after %d attempts", t.Name(), maxShuffle)
+}
+
+// AssignAges assigns the ages of the slots
+// (sorted from the oldest to the youngest)
+// to the internal nodes of a tree,
+// picking each time a random node
+// whose parent has already an age.
+// It returns false if a slot can not be assigned.
+func assignAges(t *timetree.Tree, slots []int64, oldest map[int]int64) (map[int]int64, bool) {
+	ages := make(map[int]int64, len(oldest))
+	for _, id := range t.Terms() {
+		tID, _ := t.TaxNode(id)
+		ages[tID] = t.Age(tID)
+	}
+
+	avail := []int{t.Root()}
+	for _, a := range slots {
+		var valid []int
+		for i, id := range avail {
+			if oldest[id] <= a {
+				valid = append(valid, i)
+			}
+		}
+		if len(valid) == 0 {
+			return nil, false
+		}
+		i := valid[rand.IntN(len(valid))]
+		id := avail[i]
+		avail = slices.Delete(avail, i, i+1)
+
+		ages[id] = a
+		for _, c := range t.Children(id) {
+			if !t.IsTerm(c) {
+				avail = append(avail, c)
+			}
+		}
+	}
+	return ages, true
+}
+
+// BuildTree returns a copy of a tree
+// with the indicated node ages.
+func buildTree(t *timetree.Tree, name string, ages map[int]int64) *timetree.Tree {
+	nodes := t.Nodes()
+	root := t.Root()
+	nt := timetree.New(name, ages[root])
+	newID := map[int]int{
+		root: nt.Root(),
+	}
+	for _, id := range nodes {
+		if id == root {
+			continue
+		}
+		p := t.Parent(id)
+		nID, err := nt.Add(newID[p], ages[p]-ages[id], t.Taxon(id))
+		if err != nil {
+			panic(fmt.Sprintf("unexpected error: %v", err))
+		}
+		newID[id] = nID
+	}
+	nt.Format()
+	return nt
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
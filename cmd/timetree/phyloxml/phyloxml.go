@@ -0,0 +1,95 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package phyloxml implements a command to output phylogenetic trees
+// from a TSV file into an equivalent phyloXML file.
+package phyloxml
+
+import (
+	"fmt"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `phyloxml [--tree <tree>] [-o|--output <file>]
+	[<tree-file>...]`,
+	Short: "writes trees in phyloXML format",
+	Long: `
+Command phyloxml reads trees in TSV format and write them into a phyloXML
+document.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+By default, all trees will be printed in the output. If the flag --tree is
+set, only the indicated tree will be exported.
+
+Branch lengths are written in million years. Support values (such as
+bootstrap or posterior) are stored as clade confidences, and the age of each
+node (in years), as well as any other node annotation, is stored as a clade
+property.
+
+By default the output will be printed in the standard output. To define an
+output file use the flag --output, or -o.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	if treeName != "" {
+		t := coll.Tree(treeName)
+		if t == nil {
+			return fmt.Errorf("tree %q not found", treeName)
+		}
+		coll = timetree.NewCollection()
+		coll.Add(t)
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	if err := coll.PhyloXML(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package prune implements a command to remove terminals
+// from a list of trees.
+package prune
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `prune [--keep] [--stem] [--report] [-i|--input <file>]
+	[-o|--output <file>] <treefile>...`,
+	Short: "remove terminals from a tree",
+	Long: `
+Command prune reads one or more trees in TSV format, and removes a list of
+terminals from the trees.
+
+One or more tree files must be given as arguments.
+
+The list of terminals can be defined either from an input file defined with
+the --input, or -i, flag, or provided in the standard input. The list is a TSV
+file without header, in which the first column is the name of the terminal to
+be removed. Any other column will be ignored. Names not found in a tree are
+ignored. At least two terminals must remain in each tree.
+
+Use the flag --keep to keep only the terminals in the list, and remove all
+other terminals.
+
+When terminals are removed, the internal nodes with a single descendant are
+also removed, so a named internal node, or an internal node with metadata (for
+example, a calibrated node), can vanish from the tree. In such cases, the name
+and metadata of the removed node will be attached to the most recent common
+ancestor of its remaining terminals, if that node is an internal node without a
+name. Any metadata field already defined in that node is not changed.
+
+If the pruning removes all the terminals of a child of the root, the root of
+the tree will be replaced by a younger node, and the age of the original root
+will be lost. Use the flag --stem to keep the age of the original root as the
+stem age of the new root, stored in the "stem" metadata field of the root
+node, with the age in the same unit as the ages of the tree (usually years).
+If the new root already has a "stem" field, it will not be changed.
+
+Use the flag --report to print in the standard error a TSV table with the
+named internal nodes, or internal nodes with metadata, that were removed by the
+pruning. The table has the following columns:
+
+	- tree     the name of the tree
+	- node     the ID of the node in the source tree
+	- age      the age of the node, in million years
+	- name     the name of the node
+	- status   either "moved", if the name and metadata were attached to
+	           another node, or "removed", if no node was found
+	- new      the ID of the node that receives the name and metadata, or -1
+	- new-age  the age of the new node, in million years
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var keep bool
+var stem bool
+var report bool
+var input string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().BoolVar(&keep, "keep", false, "")
+	c.Flags().BoolVar(&stem, "stem", false, "")
+	c.Flags().BoolVar(&report, "report", false, "")
+	c.Flags().StringVar(&input, "input", "", "")
+	c.Flags().StringVar(&input, "i", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	taxa, err := readTaxa(c.Stdin())
+	if err != nil {
+		return err
+	}
+
+	if report {
+		fmt.Fprintf(c.Stderr(), "tree\tnode\tage\tname\tstatus\tnew\tnew-age\n")
+	}
+	for _, tn := range coll.Names() {
+		t := coll.Tree(tn)
+		removed, err := prune(t, taxa)
+		if err != nil {
+			return fmt.Errorf("tree %q: %v", tn, err)
+		}
+		if report {
+			writeReport(c.Stderr(), tn, removed)
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readTaxa(r io.Reader) ([]string, error) {
+	if input != "" {
+		f, err := infile.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		input = "stdin"
+	}
+
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	var taxa []string
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", input, ln, err)
+		}
+
+		name := strings.Join(strings.Fields(row[0]), " ")
+		if name == "" {
+			continue
+		}
+		taxa = append(taxa, name)
+	}
+	return taxa, nil
+}
+
+// A Provenance is a named internal node,
+// or an internal node with metadata,
+// of a tree before pruning.
+type provenance struct {
+	id    int
+	age   int64
+	name  string
+	meta  map[string]string
+	terms []string
+
+	// status after pruning
+	status string
+	newID  int
+	newAge int64
+}
+
+// Prune removes the indicated terminals from a tree
+// (or all other terminals,
+// if the flag --keep is defined),
+// and returns the named internal nodes,
+// or internal nodes with metadata,
+// removed by the pruning.
+func prune(t *timetree.Tree, taxa []string) ([]*provenance, error) {
+	var prov []*provenance
+	for _, id := range t.Nodes() {
+		if t.IsTerm(id) {
+			continue
+		}
+		keys := t.MetaKeys(id)
+		if t.Taxon(id) == "" && len(keys) == 0 {
+			continue
+		}
+		p := &provenance{
+			id:    id,
+			age:   t.Age(id),
+			name:  t.Taxon(id),
+			meta:  make(map[string]string, len(keys)),
+			terms: t.CladeTerms(id),
+			newID: -1,
+		}
+		for _, k := range keys {
+			p.meta[k] = t.Meta(id, k)
+		}
+		prov = append(prov, p)
+	}
+
+	rootAge := t.Age(t.Root())
+
+	prune := t.Drop
+	if keep {
+		prune = t.Keep
+	}
+	if err := prune(taxa...); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]bool)
+	for _, id := range t.Nodes() {
+		nodes[id] = true
+	}
+
+	// visit the most inclusive nodes last,
+	// so the closest removed node
+	// is the one that is attached first
+	slices.SortStableFunc(prov, func(a, b *provenance) int {
+		return cmp.Compare(len(a.terms), len(b.terms))
+	})
+	var removed []*provenance
+	for _, p := range prov {
+		if nodes[p.id] {
+			continue
+		}
+		removed = append(removed, p)
+		p.status = "removed"
+
+		var remain []string
+		for _, tax := range p.terms {
+			if _, ok := t.TaxNode(tax); ok {
+				remain = append(remain, tax)
+			}
+		}
+		if len(remain) == 0 {
+			continue
+		}
+		mrca := t.MRCA(remain...)
+		if t.IsTerm(mrca) {
+			continue
+		}
+		if p.name != "" {
+			if t.Taxon(mrca) != "" {
+				continue
+			}
+			if err := t.SetName(mrca, p.name); err != nil {
+				return nil, err
+			}
+		}
+		for k, v := range p.meta {
+			if t.Meta(mrca, k) != "" {
+				continue
+			}
+			if err := t.SetMeta(mrca, k, v); err != nil {
+				return nil, err
+			}
+		}
+		p.status = "moved"
+		p.newID = mrca
+		p.newAge = t.Age(mrca)
+	}
+
+	if stem {
+		root := t.Root()
+		if t.Age(root) < rootAge && t.Meta(root, stemField) == "" {
+			if err := t.SetMeta(root, stemField, strconv.FormatInt(rootAge, 10)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// report in node order
+	slices.SortFunc(removed, func(a, b *provenance) int {
+		return cmp.Compare(a.id, b.id)
+	})
+	return removed, nil
+}
+
+// StemField is the metadata field
+// used to store the age of the original root.
+const stemField = "stem"
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+func writeReport(w io.Writer, name string, removed []*provenance) {
+	for _, p := range removed {
+		newAge := ""
+		if p.newID >= 0 {
+			newAge = fmt.Sprintf("%.6f", float64(p.newAge)/millionYears)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.6f\t%s\t%s\t%d\t%s\n", name, p.id, float64(p.age)/millionYears, p.name, p.status, p.newID, newAge)
+	}
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
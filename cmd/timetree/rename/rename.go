@@ -0,0 +1,377 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package rename implements a command to change
+// the taxon names of a list of trees.
+package rename
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `rename [-i|--input <file>] [--rules <file>]
+	[--sanitize] [--expand] [--tree <tree>]
+	[-o|--output <file>] <treefile>...`,
+	Short: "change the taxon names of a tree",
+	Long: `
+Command rename reads one or more trees in TSV format, and changes the taxon
+names of the trees, either from a table of names, or using substitution
+rules.
+
+One or more tree files must be given as arguments.
+
+The table of names can be defined either from an input file defined with the
+--input, or -i, flag, or provided in the standard input. The table is a TSV
+file without header, and the following columns:
+
+	-name  the current name of the taxon
+	-new   the new name of the taxon
+
+Names not found in a tree are ignored.
+
+Use the flag --rules to define a file with substitution rules. If the flag
+--rules (or the flag --sanitize) is defined, the table of names will be only
+read if the flag --input is defined. The rules file is a TSV file without header, and the following
+columns:
+
+	-pattern      a regular expression
+	-replacement  the replacement of the matched text
+
+The regular expressions use the syntax accepted by the Go regexp package
+(https://pkg.go.dev/regexp/syntax), and the replacement can include
+references to the submatches of the expression (for example, "$1"). An empty
+replacement removes the matched text. Each rule is applied, in order, to every
+taxon name (including the names of internal nodes) after the table of names.
+The rules are matched against the names as stored in the tree (i.e., with the
+first letter in upper case); use the "(?i)" flag for a case insensitive match.
+For example, the rule "_" -> " " replaces underscores with spaces, and the
+rule "\.[0-9]+$" -> "" removes an accession suffix.
+
+If the flag --sanitize is defined, the names of the terminals will be
+normalized after the table of names and the rules: accented letters are
+replaced by their unaccented equivalents, characters not allowed in an
+unquoted Newick label (brackets, colons, semicolons, commas, and quotes) are
+removed, and spaces are collapsed. If the flag --expand is defined (it implies
+the flag --sanitize), abbreviated genus names (for example "H. sapiens") are
+expanded using the genus of the other terminals of the tree, if there is a
+single genus that starts with the abbreviation. With the flag --sanitize, a
+report of each changed name (a TSV with the columns tree, taxon, and new) will
+be printed in the standard error.
+
+Taxon names are case insensitive, and stored with the first letter in upper
+case. The resulting names must be unique in each tree, and terminals can not
+have an empty name.
+
+By default, all the trees in the files will be changed. Use the flag --tree to
+change a single tree.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var input string
+var rulesFile string
+var sanitize bool
+var expand bool
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&input, "input", "", "")
+	c.Flags().StringVar(&input, "i", "", "")
+	c.Flags().StringVar(&rulesFile, "rules", "", "")
+	c.Flags().BoolVar(&sanitize, "sanitize", false, "")
+	c.Flags().BoolVar(&expand, "expand", false, "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+	if expand {
+		sanitize = true
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	var table map[string]string
+	if (rulesFile == "" && !sanitize) || input != "" {
+		var err error
+		table, err = readTable(c.Stdin())
+		if err != nil {
+			return err
+		}
+	}
+	var rules []rule
+	if rulesFile != "" {
+		var err error
+		rules, err = readRules()
+		if err != nil {
+			return err
+		}
+	}
+
+	names := coll.Names()
+	if treeName != "" {
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
+	}
+
+	if sanitize {
+		fmt.Fprintf(c.Stderr(), "tree\ttaxon\tnew\n")
+	}
+	for _, tn := range names {
+		changes, err := rename(coll.Tree(tn), table, rules)
+		if err != nil {
+			return fmt.Errorf("tree %q: %v", tn, err)
+		}
+		if sanitize {
+			for _, ch := range changes {
+				fmt.Fprintf(c.Stderr(), "%s\t%s\t%s\n", tn, ch[0], ch[1])
+			}
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+// A Rule is a substitution rule.
+type rule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// Rename changes the taxon names of a tree,
+// and returns the changed names.
+func rename(t *timetree.Tree, table map[string]string, rules []rule) ([][2]string, error) {
+	var order []string
+	nodes := make(map[string]int)
+	cur := make(map[string]string)
+	for _, id := range t.Nodes() {
+		name := t.Taxon(id)
+		if name == "" {
+			continue
+		}
+		nodes[name] = id
+		order = append(order, name)
+
+		nn := name
+		if v, ok := table[strings.ToLower(name)]; ok {
+			nn = v
+		}
+		for _, r := range rules {
+			nn = r.re.ReplaceAllString(nn, r.repl)
+		}
+		if sanitize && t.IsTerm(id) {
+			nn = sanitizeName(nn)
+		}
+		cur[name] = strings.Join(strings.Fields(nn), " ")
+	}
+	if expand {
+		expandGenus(t, order, cur)
+	}
+
+	news := make(map[string]string)
+	for _, name := range order {
+		nn := cur[name]
+		if strings.EqualFold(nn, name) {
+			continue
+		}
+		if nn == "" && t.IsTerm(nodes[name]) {
+			return nil, fmt.Errorf("terminal %q: empty new name", name)
+		}
+		news[name] = nn
+	}
+
+	// check that the new names are unique
+	final := make(map[string]string, len(nodes))
+	for _, name := range order {
+		nn, ok := news[name]
+		if !ok {
+			nn = name
+		}
+		if nn == "" {
+			continue
+		}
+		k := strings.ToLower(nn)
+		if prev, dup := final[k]; dup {
+			return nil, fmt.Errorf("taxa %q and %q renamed to %q", prev, name, nn)
+		}
+		final[k] = name
+	}
+
+	// use temporary names,
+	// so names can be swapped
+	for _, name := range order {
+		if _, ok := news[name]; !ok {
+			continue
+		}
+		if err := t.SetName(nodes[name], fmt.Sprintf("rename-tmp-%d", nodes[name])); err != nil {
+			return nil, fmt.Errorf("taxon %q: %v", name, err)
+		}
+	}
+	var changes [][2]string
+	for _, name := range order {
+		nn, ok := news[name]
+		if !ok {
+			continue
+		}
+		id := nodes[name]
+		if err := t.SetName(id, nn); err != nil {
+			return nil, fmt.Errorf("taxon %q: %v", name, err)
+		}
+		changes = append(changes, [2]string{name, t.Taxon(id)})
+		if dryrun.Enabled && t.IsTerm(id) {
+			dryrun.Rename(t.Name(), name, t.Taxon(id))
+		}
+	}
+	return changes, nil
+}
+
+func readTable(r io.Reader) (map[string]string, error) {
+	if input != "" {
+		f, err := infile.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		input = "stdin"
+	}
+
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	table := make(map[string]string)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", input, ln, err)
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", input, ln, len(row), 2)
+		}
+
+		name := strings.ToLower(strings.Join(strings.Fields(row[0]), " "))
+		if name == "" {
+			continue
+		}
+		nn := strings.Join(strings.Fields(row[1]), " ")
+		if nn == "" {
+			return nil, fmt.Errorf("%q: on row %d: taxon %q: empty new name", input, ln, row[0])
+		}
+		table[name] = nn
+	}
+	return table, nil
+}
+
+func readRules() ([]rule, error) {
+	f, err := os.Open(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+	tab.LazyQuotes = true
+
+	var rules []rule
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", rulesFile, ln, err)
+		}
+		if row[0] == "" {
+			continue
+		}
+		re, err := regexp.Compile(row[0])
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", rulesFile, ln, err)
+		}
+		var repl string
+		if len(row) > 1 {
+			repl = row[1]
+		}
+		rules = append(rules, rule{re: re, repl: repl})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%q: no rules defined", rulesFile)
+	}
+	return rules, nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
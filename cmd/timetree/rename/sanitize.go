@@ -0,0 +1,118 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package rename
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/js-arias/timetree"
+)
+
+// Accents are the replacements
+// of accented letters.
+var accents = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s",
+	'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+	'æ': "ae", 'œ': "oe", 'ß': "ss", 'þ': "th", 'ð': "d",
+}
+
+// SanitizeName returns a name
+// without accents,
+// characters not allowed in Newick labels,
+// and repeated spaces.
+func sanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch r {
+		case '(', ')', '[', ']', ':', ';', ',', '\'', '"':
+			continue
+		}
+		if unicode.IsSpace(r) {
+			b.WriteRune(' ')
+			continue
+		}
+		up := unicode.IsUpper(r)
+		lr := unicode.ToLower(r)
+		if s, ok := accents[lr]; ok {
+			if up {
+				s = strings.ToUpper(s[:1]) + s[1:]
+			}
+			b.WriteString(s)
+			continue
+		}
+		if !unicode.IsPrint(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// ExpandGenus replaces abbreviated genus names
+// of the terminals
+// with the genus of other terminals of the tree.
+func expandGenus(t *timetree.Tree, order []string, cur map[string]string) {
+	// genus by initial letter
+	genera := make(map[string]map[string]bool)
+	for _, name := range order {
+		id, _ := t.TaxNode(name)
+		if !t.IsTerm(id) {
+			continue
+		}
+		f := strings.Fields(cur[name])
+		if len(f) < 2 || isAbbrev(f[0]) {
+			continue
+		}
+		g := strings.ToLower(f[0])
+		in := g[:1]
+		if genera[in] == nil {
+			genera[in] = make(map[string]bool)
+		}
+		genera[in][g] = true
+	}
+
+	for _, name := range order {
+		id, _ := t.TaxNode(name)
+		if !t.IsTerm(id) {
+			continue
+		}
+		f := strings.Fields(cur[name])
+		if len(f) < 2 || !isAbbrev(f[0]) {
+			continue
+		}
+		gs := genera[strings.ToLower(f[0][:1])]
+		if len(gs) != 1 {
+			continue
+		}
+		for g := range gs {
+			f[0] = g
+		}
+		cur[name] = strings.Join(f, " ")
+	}
+}
+
+// IsAbbrev returns true if a word
+// is an abbreviated genus name
+// (a single letter followed by a dot).
+func isAbbrev(w string) bool {
+	if len(w) != 2 || w[1] != '.' {
+		return false
+	}
+	return unicode.IsLetter(rune(w[0]))
+}
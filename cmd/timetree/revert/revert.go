@@ -0,0 +1,135 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package revert implements a command to replace
+// the trees of a tree file
+// with one of its snapshots.
+package revert
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `revert --label <label> [--tree <tree>]
+	[-o|--output <file>] [<treefile>]`,
+	Short: "replace the trees with a snapshot",
+	Long: `
+Command revert reads a tree file in TSV format, and replaces the trees with a
+copy of a snapshot stored with the command snapshot.
+
+The name of a tree file can be given as an argument. If no file is given, the
+trees will be read from the standard input.
+
+The flag --label is required, and defines the label of the snapshot. The
+snapshot is kept in the file, so it is possible to revert to it again, and
+the current version of the tree is discarded (use the command snapshot before
+reverting to keep it).
+
+By default, all the trees with a snapshot with the given label will be
+reverted. Use the flag --tree to revert a single tree.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var label string
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&label, "label", "", "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	in := "-"
+	if len(args) > 0 {
+		in = args[0]
+	}
+
+	label = strings.ToLower(strings.Join(strings.Fields(label), " "))
+	if label == "" {
+		return c.UsageError("flag --label: undefined label")
+	}
+	treeName = strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+
+	tc, err := infile.Collection(c.Stdin(), in)
+	if err != nil {
+		return err
+	}
+	orig := dryrun.Copy(tc)
+
+	if treeName != "" {
+		if tc.Tree(treeName) == nil {
+			return fmt.Errorf("tree %q not found", treeName)
+		}
+		if err := tc.Revert(treeName, label); err != nil {
+			return err
+		}
+	} else {
+		var found bool
+		for _, tn := range tc.Names() {
+			if !slices.Contains(tc.Snapshots(tn), label) {
+				continue
+			}
+			if err := tc.Revert(tn, label); err != nil {
+				return err
+			}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("snapshot %q not found", label)
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, tc)
+		return nil
+	}
+	if err := writeTrees(c.Stdout(), tc); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
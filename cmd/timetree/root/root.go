@@ -0,0 +1,221 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package root implements a command to change
+// the root of a tree.
+package root
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `root [--outgroup <taxon>[,<taxon>...]] [--mad]
+	[--tree <tree>] [-o|--output <file>] <treefile>...`,
+	Short: "change the root of a tree",
+	Long: `
+Command root reads one or more trees in TSV format, and moves the root of the
+trees to a different branch, using the branch lengths stored in the tree (for
+example, to root a tree imported from a program that produces unrooted trees,
+or trees with an arbitrary root).
+
+One or more tree files must be given as arguments.
+
+Either the flag --outgroup or the flag --mad must be defined. The flag
+--outgroup defines one or more terminals, separated by commas, that form the
+outgroup, and the root is placed at the midpoint of the branch that separates
+the outgroup from the other terminals. The flag --mad places the root using the
+minimal ancestor deviation method (Tria et al. 2017, Nat. Ecol. Evol. 1: 0193),
+that searches the root position in which the midpoint of the path between any
+pair of terminals is closest to their common ancestor. It is useful for trees
+without a clear outgroup. It requires a time proportional to the cube of the
+number of terminals, so it can be slow with large trees.
+
+The branch lengths are kept, and the ages of the nodes are set so the age of
+the youngest terminal is not changed. The clades that are changed by the new
+root lose their names and metadata.
+
+By default, all the trees in the files will be rerooted. Use the flag --tree
+to reroot a single tree.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var outgroup string
+var madFlag bool
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&outgroup, "outgroup", "", "")
+	c.Flags().BoolVar(&madFlag, "mad", false, "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+	var out []string
+	for _, tx := range strings.Split(outgroup, ",") {
+		tx = strings.Join(strings.Fields(tx), " ")
+		if tx == "" {
+			continue
+		}
+		out = append(out, tx)
+	}
+	if len(out) == 0 && !madFlag {
+		return c.UsageError("either flag --outgroup or flag --mad must be defined")
+	}
+	if len(out) > 0 && madFlag {
+		return c.UsageError("flags --outgroup and --mad can not be used together")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	names := coll.Names()
+	if treeName != "" {
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
+	}
+
+	// reroot trees concurrently
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, tn := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			t := coll.Tree(tn)
+			if madFlag {
+				id, dist, _ := t.MAD()
+				if err := t.Reroot(id, dist); err != nil {
+					errs[i] = fmt.Errorf("flag --mad: tree %q: %v", tn, err)
+				}
+				return
+			}
+			if err := rootOutgroup(t, out); err != nil {
+				errs[i] = fmt.Errorf("flag --outgroup: tree %q: %v", tn, err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RootOutgroup places the root of a tree
+// at the midpoint of the branch
+// that separates the outgroup
+// from the other terminals.
+func rootOutgroup(t *timetree.Tree, out []string) error {
+	in := make(map[string]bool, len(out))
+	names := make([]string, 0, len(out))
+	for _, tx := range out {
+		id, ok := t.TaxNode(tx)
+		if !ok || !t.IsTerm(id) {
+			return fmt.Errorf("terminal %q not found", tx)
+		}
+		nm := t.Taxon(id)
+		in[nm] = true
+		names = append(names, nm)
+	}
+
+	id := t.MRCA(names...)
+	size := len(names)
+	if id == t.Root() {
+		// the outgroup includes the root,
+		// so the branch is defined by the ingroup
+		var ingroup []string
+		for _, tx := range t.Terms() {
+			if !in[tx] {
+				ingroup = append(ingroup, tx)
+			}
+		}
+		if len(ingroup) == 0 {
+			return fmt.Errorf("outgroup includes all terminals")
+		}
+		id = t.MRCA(ingroup...)
+		size = len(ingroup)
+	}
+	if id == t.Root() || t.CladeSize(id) != size {
+		return fmt.Errorf("outgroup is not monophyletic")
+	}
+
+	l := t.BranchLen(id)
+	if p := t.Parent(id); p == t.Root() && len(t.Children(p)) == 2 {
+		for _, s := range t.Children(p) {
+			if s != id {
+				l += t.BranchLen(s)
+			}
+		}
+	}
+	return t.Reroot(id, l/2)
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package sample implements a command to keep
+// a random subset of the terminals
+// of a list of trees.
+package sample
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `sample [--size <number>] [--fraction <value>]
+	[--stratified] [--per-clade <number>] [--clades <file>]
+	[-o|--output <file>] <treefile>...`,
+	Short: "keep a random subset of terminals",
+	Long: `
+Command sample reads one or more trees in TSV format, and keeps a random
+subset of the terminals of each tree. It is useful to create reduced trees
+for expensive downstream analyses.
+
+One or more tree files must be given as arguments.
+
+Either the flag --size or the flag --fraction must be defined. The flag --size
+sets the number of terminals to keep in each tree. The flag --fraction sets the
+proportion of the terminals to keep in each tree (a value between 0 and 1). At
+least two terminals will be kept in each tree. If a tree has fewer terminals
+than the requested number, the tree will not be changed.
+
+Internal nodes that end with a single descendant are removed, and the ages of
+the remaining nodes are not changed.
+
+By default, the terminals are selected at random. If the flag --stratified is
+defined, at least one terminal of each named internal node (i.e., a named
+clade) will be kept. If the number of named clades is larger than the
+requested number of terminals, more terminals will be kept.
+
+Use the flag --per-clade to define the minimum number of terminals kept for
+each clade (if the clade has fewer terminals, all of its terminals will be
+kept). This flag implies the flag --stratified.
+
+By default, the clades are the named internal nodes of each tree. Use the flag
+--clades to define the clades from a file (for example, a taxonomy). The file
+is a TSV file without header, and the following columns:
+
+	-clade  the name of the clade
+	-taxon  the name of a terminal in the clade
+
+A clade is defined by all the rows that share the same clade name. Terminals
+absent in a tree are ignored. This flag implies the flag --stratified.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var size int
+var fraction float64
+var stratified bool
+var perClade int
+var cladesFile string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().IntVar(&size, "size", 0, "")
+	c.Flags().Float64Var(&fraction, "fraction", 0, "")
+	c.Flags().BoolVar(&stratified, "stratified", false, "")
+	c.Flags().IntVar(&perClade, "per-clade", 0, "")
+	c.Flags().StringVar(&cladesFile, "clades", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+	if size == 0 && fraction == 0 {
+		return c.UsageError("either flag --size or flag --fraction must be defined")
+	}
+	if size != 0 && fraction != 0 {
+		return c.UsageError("flags --size and --fraction can not be used together")
+	}
+	if size < 0 {
+		return c.UsageError(fmt.Sprintf("flag --size: invalid value %d", size))
+	}
+	if fraction < 0 || fraction > 1 {
+		return c.UsageError(fmt.Sprintf("flag --fraction: invalid value %.6f", fraction))
+	}
+	if perClade < 0 {
+		return c.UsageError(fmt.Sprintf("flag --per-clade: invalid value %d", perClade))
+	}
+	if perClade > 0 || cladesFile != "" {
+		stratified = true
+	}
+	if perClade == 0 {
+		perClade = 1
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	var sets map[string][]string
+	if cladesFile != "" {
+		var err error
+		sets, err = readClades()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tn := range coll.Names() {
+		t := coll.Tree(tn)
+		n := size
+		if fraction > 0 {
+			n = int(math.Round(fraction * float64(t.NumTerms())))
+		}
+		if n < 2 {
+			n = 2
+		}
+		if n >= t.NumTerms() {
+			continue
+		}
+
+		if err := t.Keep(sample(t, n, sets)...); err != nil {
+			return fmt.Errorf("tree %q: %v", tn, err)
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Sample returns a random sample of terminals
+// of a tree.
+// If sets is defined,
+// it will be used as the clades for stratification.
+func sample(t *timetree.Tree, n int, sets map[string][]string) []string {
+	keep := make(map[string]bool, n)
+	if stratified {
+		// visit the smallest clades first,
+		// so a terminal of a nested clade
+		// is also a terminal of the including clade
+		clades := treeClades(t, sets)
+		slices.SortStableFunc(clades, func(a, b []string) int {
+			return cmp.Compare(len(a), len(b))
+		})
+
+		for _, cl := range clades {
+			var rest []string
+			for _, tax := range cl {
+				if !keep[tax] {
+					rest = append(rest, tax)
+				}
+			}
+			need := min(perClade, len(cl)) - (len(cl) - len(rest))
+			rand.Shuffle(len(rest), func(i, j int) {
+				rest[i], rest[j] = rest[j], rest[i]
+			})
+			for i := 0; i < need; i++ {
+				keep[rest[i]] = true
+			}
+		}
+	}
+
+	var rest []string
+	for _, tax := range t.Terms() {
+		if !keep[tax] {
+			rest = append(rest, tax)
+		}
+	}
+	rand.Shuffle(len(rest), func(i, j int) {
+		rest[i], rest[j] = rest[j], rest[i]
+	})
+
+	sample := make([]string, 0, n)
+	for tax := range keep {
+		sample = append(sample, tax)
+	}
+	for _, tax := range rest {
+		if len(sample) >= n {
+			break
+		}
+		sample = append(sample, tax)
+	}
+	return sample
+}
+
+// TreeClades returns the terminals of the clades of a tree.
+// If sets is defined,
+// the clades are the sets,
+// otherwise,
+// the clades are the named internal nodes.
+func treeClades(t *timetree.Tree, sets map[string][]string) [][]string {
+	var clades [][]string
+	if sets == nil {
+		for _, id := range t.Nodes() {
+			if t.IsTerm(id) || t.Taxon(id) == "" {
+				continue
+			}
+			clades = append(clades, t.CladeTerms(id))
+		}
+		return clades
+	}
+
+	names := make([]string, 0, len(sets))
+	for nm := range sets {
+		names = append(names, nm)
+	}
+	slices.Sort(names)
+	for _, nm := range names {
+		var cl []string
+		for _, tax := range sets[nm] {
+			id, ok := t.TaxNode(tax)
+			if !ok || !t.IsTerm(id) {
+				continue
+			}
+			cl = append(cl, t.Taxon(id))
+		}
+		if len(cl) == 0 {
+			continue
+		}
+		clades = append(clades, cl)
+	}
+	return clades
+}
+
+// ReadClades reads the terminals of each clade
+// from the clades file.
+func readClades() (map[string][]string, error) {
+	f, err := os.Open(cladesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	sets := make(map[string][]string)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", cladesFile, ln, err)
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", cladesFile, ln, len(row), 2)
+		}
+
+		name := strings.Join(strings.Fields(row[0]), " ")
+		if name == "" {
+			continue
+		}
+		tax := strings.Join(strings.Fields(row[1]), " ")
+		if tax == "" {
+			continue
+		}
+		sets[name] = append(sets[name], tax)
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("%q: no clades defined", cladesFile)
+	}
+	return sets, nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package scale implements a command to rescale
+// the node ages of a tree.
+package scale
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `scale [--factor <value>] [--root <age>] [--tree <tree>]
+	[-o|--output <file>] <treefile>...`,
+	Short: "rescale the ages of the nodes of a tree",
+	Long: `
+Command scale reads one or more trees in TSV format, and rescale the ages of
+all the nodes of the trees, keeping the relative length of the branches. It is
+useful, for example, to transform a tree with branch lengths in substitutions
+into a time calibrated tree, or a tree with branch lengths in coalescent units
+(for example, as produced by ASTRAL) into a tree in million years. If the tree
+was tagged as a tree in coalescent units, the tag will be removed.
+
+One or more tree files must be given as arguments.
+
+Either the flag --factor or the flag --root must be defined. The flag --factor
+defines a value used to multiply the age of each node. The flag --root defines
+the age of the root (in million years), and the ages of all other nodes will be
+updated proportionally. If the tree has an offset, the ages are measured from
+the offset, so the offset of the tree is not changed.
+
+By default, all the trees in the files will be rescaled. Use the flag --tree
+to rescale a single tree.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var factor float64
+var rootAge float64
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().Float64Var(&factor, "factor", 0, "")
+	c.Flags().Float64Var(&rootAge, "root", 0, "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+	if factor == 0 && rootAge == 0 {
+		return c.UsageError("either flag --factor or flag --root must be defined")
+	}
+	if factor != 0 && rootAge != 0 {
+		return c.UsageError("flags --factor and --root can not be used together")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	names := coll.Names()
+	if treeName != "" {
+		tn := strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+		if coll.Tree(tn) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{tn}
+	}
+
+	for _, tn := range names {
+		t := coll.Tree(tn)
+		if factor != 0 {
+			if err := t.Scale(factor); err != nil {
+				return fmt.Errorf("flag --factor: tree %q: %v", tn, err)
+			}
+		} else if err := t.ScaleTo(int64(rootAge * millionYears)); err != nil {
+			return fmt.Errorf("flag --root: tree %q: %v", tn, err)
+		}
+		if t.AgeUnit() == timetree.CoalescentUnits {
+			t.SetUnit("")
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+// millionYears is used to transform ages
+// from million years to years.
+const millionYears = 1_000_000
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package set
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/timetree"
+)
+
+// A Calibration is an age constraint
+// of a node.
+type calibration struct {
+	t    *timetree.Tree
+	id   int
+	line int
+
+	// name of the clade,
+	// for calibrations defined by clade
+	clade string
+
+	// age range, in years
+	min, max int64
+}
+
+// Where returns the position of the calibration
+// in the calibration file.
+func (cal calibration) where() string {
+	if cal.clade != "" {
+		return fmt.Sprintf("clade %q", cal.clade)
+	}
+	return fmt.Sprintf("on row %d", cal.line)
+}
+
+// Valid returns true if the age of the node
+// is inside the age range.
+func (cal calibration) valid() bool {
+	age := cal.t.Age(cal.id)
+	return age >= cal.min && age <= cal.max
+}
+
+func readCalibrations(c *timetree.Collection) ([]calibration, error) {
+	data, err := os.ReadFile(calibrate)
+	if err != nil {
+		return nil, err
+	}
+	if isCladeFile(data) {
+		return readCladeCalibrations(c, data)
+	}
+
+	tab := csv.NewReader(bytes.NewReader(data))
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	var cals []calibration
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", calibrate, ln, err)
+		}
+		if len(row) < 4 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", calibrate, ln, len(row), 4)
+		}
+
+		name := strings.ToLower(strings.Join(strings.Fields(row[0]), " "))
+		if name == "" {
+			continue
+		}
+		t := c.Tree(name)
+		if t == nil {
+			continue
+		}
+		id, err := t.FindNode(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", calibrate, ln, "node", err)
+		}
+
+		cal := calibration{
+			t:    t,
+			id:   id,
+			line: ln,
+			min:  t.Offset(),
+			max:  math.MaxInt64,
+		}
+		if v := strings.TrimSpace(row[2]); v != "" {
+			a, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q: on row %d: field %q: %v", calibrate, ln, "min", err)
+			}
+			cal.min = max(cal.min, int64(a*millionYears))
+		}
+		if v := strings.TrimSpace(row[3]); v != "" {
+			a, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q: on row %d: field %q: %v", calibrate, ln, "max", err)
+			}
+			cal.max = int64(a * millionYears)
+		}
+		if cal.max < cal.min {
+			return nil, fmt.Errorf("%q: on row %d: invalid age range", calibrate, ln)
+		}
+		cals = append(cals, cal)
+	}
+	return cals, nil
+}
+
+// IsCladeFile returns true
+// if the calibration file has a header
+// with a "clade" field,
+// i.e.,
+// the calibrations are defined by clade names
+// instead of tree nodes.
+func isCladeFile(data []byte) bool {
+	for _, ln := range strings.Split(string(data), "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		for _, f := range strings.Split(ln, "\t") {
+			if strings.ToLower(strings.TrimSpace(f)) == "clade" {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// ReadCladeCalibrations reads calibrations
+// defined by clade names.
+// Calibrations of clades absent in a tree
+// are ignored.
+func readCladeCalibrations(c *timetree.Collection, data []byte) ([]calibration, error) {
+	cc, err := timetree.ReadCalibrations(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", calibrate, err)
+	}
+
+	var cals []calibration
+	for _, tn := range c.Names() {
+		t := c.Tree(tn)
+		for _, cl := range cc {
+			id := cl.Node(t)
+			if id < 0 {
+				continue
+			}
+			clade := cl.Clade
+			if clade == "" {
+				clade = strings.Join(cl.Taxa, ",")
+			}
+			cals = append(cals, calibration{
+				t:     t,
+				id:    id,
+				clade: clade,
+				min:   max(t.Offset(), cl.Min),
+				max:   cl.Max,
+			})
+		}
+	}
+	return cals, nil
+}
+
+// CheckCalibrations writes the nodes
+// that violate a calibration.
+func checkCalibrations(w io.Writer, cals []calibration) error {
+	var bad int
+	for _, cal := range cals {
+		if cal.valid() {
+			continue
+		}
+		if bad == 0 {
+			fmt.Fprintf(w, "tree\tnode\ttaxon\tage\tmin\tmax\n")
+		}
+		bad++
+		maxAge := ""
+		if cal.max < math.MaxInt64 {
+			maxAge = fmt.Sprintf("%.6f", float64(cal.max)/millionYears)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%.6f\t%.6f\t%s\n", cal.t.Name(), cal.id, cal.t.Taxon(cal.id), float64(cal.t.Age(cal.id))/millionYears, float64(cal.min)/millionYears, maxAge)
+	}
+	if bad > 0 {
+		return fmt.Errorf("%q: %d of %d calibrations violated", calibrate, bad, len(cals))
+	}
+	return nil
+}
+
+// AdjustCalibrations sets the nodes
+// that violate a calibration
+// to the closest valid age.
+func adjustCalibrations(w io.Writer, cals []calibration) error {
+	fmt.Fprintf(w, "tree\tnode\ttaxon\tage\tnew-age\treason\n")
+	for _, cal := range cals {
+		if cal.valid() {
+			continue
+		}
+
+		t := cal.t
+		age := t.Age(cal.id)
+		var nodes []int
+		var reason string
+		if age < cal.min {
+			age = cal.min
+			reason = "min"
+
+			nodes = append(youngerAnc(t, cal.id, age), cal.id)
+		} else {
+			age = cal.max
+			reason = "max"
+
+			// descendants are set from the youngest
+			desc, err := olderDesc(t, cal.id, age)
+			if err != nil {
+				return fmt.Errorf("%q: %s: %v", calibrate, cal.where(), err)
+			}
+			nodes = append(desc, cal.id)
+		}
+
+		for _, id := range nodes {
+			r := reason
+			if id != cal.id {
+				r = "ancestor"
+				if reason == "max" {
+					r = "descendant"
+				}
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%.6f\t%.6f\t%s\n", t.Name(), id, t.Taxon(id), float64(t.Age(id))/millionYears, float64(age)/millionYears, r)
+			if err := t.Set(id, age); err != nil {
+				return fmt.Errorf("%q: %s: node %d: %v", calibrate, cal.where(), id, err)
+			}
+		}
+	}
+
+	for _, cal := range cals {
+		if !cal.valid() {
+			return fmt.Errorf("%q: %s: calibration violated after adjustments: node %d: age %.6f", calibrate, cal.where(), cal.id, float64(cal.t.Age(cal.id))/millionYears)
+		}
+	}
+	return nil
+}
+
+// YoungerAnc returns the ancestors of a node
+// younger than a given age,
+// with the oldest nodes first.
+func youngerAnc(t *timetree.Tree, id int, age int64) []int {
+	var anc []int
+	for p := t.Parent(id); p >= 0 && t.Age(p) < age; p = t.Parent(p) {
+		anc = append([]int{p}, anc...)
+	}
+	return anc
+}
+
+// OlderDesc returns the descendants of a node
+// older than a given age,
+// with the youngest nodes first.
+// It returns an error if a terminal
+// is older than the age.
+func olderDesc(t *timetree.Tree, id int, age int64) ([]int, error) {
+	var desc []int
+	for _, c := range t.Children(id) {
+		if t.Age(c) <= age {
+			continue
+		}
+		if t.IsTerm(c) {
+			return nil, fmt.Errorf("terminal %q: age %.6f older than %.6f", t.Taxon(c), float64(t.Age(c))/millionYears, float64(age)/millionYears)
+		}
+		d, err := olderDesc(t, c, age)
+		if err != nil {
+			return nil, err
+		}
+		desc = append(desc, d...)
+		desc = append(desc, c)
+	}
+	return desc, nil
+}
@@ -17,10 +17,14 @@ import (
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 )
 
 var Command = &command.Command{
-	Usage: `set [--tozero]  [-i|--input <file>]
+	Usage: `set [--tozero] [--offset <age>] [-i|--input <file>]
+	[--calibrate <file> [--adjust]] [--tips <file>]
 	[-o|--output <file>] <treefile>...`,
 	Short: "set ages of the nodes of a tree",
 	Long: `
@@ -34,31 +38,110 @@ the --input, or -i, flag, or provided in the standard input. The ages file is
 a TSV file without header, and the following columns:
 
 	-tree  the name of the tree
-	-node  the ID of the node to set
+	-node  the node to set
 	-age   the age (in million years) of the node
 
+The node can be defined by its ID, by the name of a taxon (either a terminal,
+or a named internal node), or by two or more taxon names separated by commas
+(for example "Tyrannosaurus rex,Passer domesticus"), in which case the node
+will be the most recent common ancestor of the taxa. As node IDs can change
+when a tree is edited, using taxon names is more robust.
+
 The node ages must be consistent with any other age already defined on the
 tree. The changes are made sequentially.
 
 As an usual operation is to set ages of all terminals to 0 (present), the flag
 --tozero is provided to automatize this action. Note that the flag will set
-all terminals in the tree collection.
+all terminals in the tree collection. If a tree has an offset, the terminals
+will be set to the age of the offset.
+
+Some trees end before the present (for example, trees of entirely extinct
+clades). Use the flag --offset to set the age (in million years) of the
+present for all the trees in the collection. No node can be younger than the
+offset of its tree. If the flag --offset is defined, the ages file will be
+only read if the flag --input is defined.
+
+Use the flag --tips to set the ages of the terminals using their names. The
+flag defines a TSV file without header, and the following columns:
+
+	-taxon  the name of the terminal
+	-age    the age (in million years) of the terminal
+
+The ages will be set in all the trees of the collection that have the
+terminal. If a terminal is set to an age older than its parent, the ancestors
+younger than the new age will be set to the same age. With the flag --tips, the
+ages file is not read. Each ancestor adjustment will be printed in the
+standard error, as a TSV table with the following columns: tree, node, taxon,
+age, new-age, and reason (always "ancestor").
+
+Use the flag --calibrate to define a file with age constraints (for example,
+the minimum and maximum ages of a fossil calibration). The file is a TSV file
+without header, and the following columns:
+
+	-tree  the name of the tree
+	-node  the constrained node
+	-min   the minimum age (in million years) of the node
+	-max   the maximum age (in million years) of the node
+
+The node is defined as in the ages file. An empty minimum or maximum age is
+not constrained.
+
+As node IDs change when a tree is edited, the calibrations can also be
+defined by clade names, in a TSV file with a header and the following
+columns:
+
+	-clade  the name of the clade
+	-taxa   the taxa that define the clade, separated by commas
+	-min    the minimum age (in million years) of the clade
+	-max    the maximum age (in million years) of the clade
+	-tree   optional, the name of the tree of the calibration
+
+The clade is the most recent common ancestor of the taxa, or, if the taxa
+field is empty, the node with the name of the clade. If the tree field is
+empty, or not defined, the calibration is used in all the trees with the
+clade. Calibrations of clades absent in a tree are ignored. The file is
+recognized by the "clade" field in its header, and the same file can be used
+with the commands assert and draw. Use the command calib to convert a file
+with calibrations defined by nodes into this format. With the flag --calibrate, the ages file is not read, and the
+ages of the constrained nodes are verified. The nodes that violate their
+constraints are printed in the standard output, as a TSV table with the
+following columns: tree, node, taxon, age, min, and max. In this case, no tree
+file is written, and the command ends with an error if any constraint is
+violated.
+
+If the flag --adjust is defined, the nodes that violate their constraints are
+set to the closest valid age. If a node is set to an older age, any ancestor
+younger than the new age will be set to the same age, and if a node is set to
+a younger age, any internal descendant older than the new age will be set to
+the same age. The constraints are applied sequentially, and after all the
+adjustments, all the constraints are verified again. Each adjustment will be
+printed in the standard error, as a TSV table with the following columns:
+tree, node, taxon, age, new-age, and reason (either "min" or "max" for a
+constrained node, or "ancestor" or "descendant" for an adjusted node).
 
 The resulting tree file will be printed in the standard output. Use the flag
 --output, or -o, to define an output file.
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      outfile.Locked(&output, run),
 }
 
 var toZero bool
+var offset float64
 var input string
+var calibrate string
+var adjust bool
+var tips string
 var output string
 
 func setFlags(c *command.Command) {
 	c.Flags().BoolVar(&toZero, "tozero", false, "")
+	c.Flags().Float64Var(&offset, "offset", -1, "")
 	c.Flags().StringVar(&input, "input", "", "")
 	c.Flags().StringVar(&input, "i", "", "")
+	c.Flags().StringVar(&calibrate, "calibrate", "", "")
+	c.Flags().BoolVar(&adjust, "adjust", false, "")
+	c.Flags().StringVar(&tips, "tips", "", "")
 	c.Flags().StringVar(&output, "output", "", "")
 	c.Flags().StringVar(&output, "o", "", "")
 }
@@ -67,53 +150,67 @@ func run(c *command.Command, args []string) error {
 	if len(args) == 0 {
 		return c.UsageError("expecting one or more tree files")
 	}
+	if adjust && calibrate == "" {
+		return c.UsageError("flag --adjust requires flag --calibrate")
+	}
+	if tips != "" && calibrate != "" {
+		return c.UsageError("flags --tips and --calibrate can not be used together")
+	}
 
-	coll := timetree.NewCollection()
-	for _, a := range args {
-		nc, err := readCollection(a)
-		if err != nil {
-			return err
-		}
+	coll, _, err := infile.TimeTrees(c, args)
+	if err != nil {
+		return err
+	}
 
-		for _, tn := range nc.Names() {
-			t := nc.Tree(tn)
-			if err := coll.Add(t); err != nil {
-				return fmt.Errorf("when adding trees from %q: %v", a, err)
-			}
+	orig := dryrun.Copy(coll)
+
+	if offset >= 0 {
+		if err := setOffset(coll); err != nil {
+			return err
 		}
 	}
 
 	if toZero {
 		termsToZero(coll)
-	} else if err := readAges(c.Stdin(), coll); err != nil {
-		return err
 	}
 
-	if err := writeTrees(c.Stdout(), coll); err != nil {
-		return err
+	if tips != "" {
+		if err := setTips(c.Stderr(), coll); err != nil {
+			return err
+		}
+	} else if calibrate != "" {
+		cals, err := readCalibrations(coll)
+		if err != nil {
+			return err
+		}
+		if !adjust {
+			return checkCalibrations(c.Stdout(), cals)
+		}
+		if err := adjustCalibrations(c.Stderr(), cals); err != nil {
+			return err
+		}
+	} else if !toZero && (offset < 0 || input != "") {
+		if err := readAges(c.Stdin(), coll); err != nil {
+			return err
+		}
 	}
-	return nil
-}
 
-func readCollection(name string) (*timetree.Collection, error) {
-	f, err := os.Open(name)
-	if err != nil {
-		return nil, err
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
 	}
-	defer f.Close()
 
-	c, err := timetree.ReadTSV(f)
-	if err != nil {
-		return nil, fmt.Errorf("while reading file %q: %v", name, err)
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
 	}
-	return c, nil
+	return nil
 }
 
 const millionYears = 1_000_000
 
 func readAges(r io.Reader, c *timetree.Collection) error {
 	if input != "" {
-		f, err := os.Open(input)
+		f, err := infile.Open(input)
 		if err != nil {
 			return err
 		}
@@ -156,7 +253,7 @@ func readAges(r io.Reader, c *timetree.Collection) error {
 			continue
 		}
 		f = "node"
-		id, err := strconv.Atoi(row[fields[f]])
+		id, err := t.FindNode(row[fields[f]])
 		if err != nil {
 			return fmt.Errorf("%q: on row %d: field %q: %v", input, ln, f, err)
 		}
@@ -174,12 +271,85 @@ func readAges(r io.Reader, c *timetree.Collection) error {
 	return nil
 }
 
+// SetTips sets the ages of the terminals
+// from the tips file.
+func setTips(w io.Writer, c *timetree.Collection) error {
+	f, err := os.Open(tips)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	var header bool
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return fmt.Errorf("%q: on row %d: %v", tips, ln, err)
+		}
+		if len(row) < 2 {
+			return fmt.Errorf("%q: on row %d: got %d fields, want %d", tips, ln, len(row), 2)
+		}
+
+		name := strings.Join(strings.Fields(row[0]), " ")
+		if name == "" {
+			continue
+		}
+		ageF, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			return fmt.Errorf("%q: on row %d: field %q: %v", tips, ln, "age", err)
+		}
+		age := int64(ageF * millionYears)
+
+		for _, tn := range c.Names() {
+			t := c.Tree(tn)
+			id, ok := t.TaxNode(name)
+			if !ok || !t.IsTerm(id) {
+				continue
+			}
+
+			for _, a := range youngerAnc(t, id, age) {
+				if !header {
+					fmt.Fprintf(w, "tree\tnode\ttaxon\tage\tnew-age\treason\n")
+					header = true
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%.6f\t%.6f\t%s\n", t.Name(), a, t.Taxon(a), float64(t.Age(a))/millionYears, float64(age)/millionYears, "ancestor")
+				if err := t.Set(a, age); err != nil {
+					return fmt.Errorf("%q: on row %d: tree %q: node %d: %v", tips, ln, tn, a, err)
+				}
+			}
+			if err := t.Set(id, age); err != nil {
+				return fmt.Errorf("%q: on row %d: tree %q: %v", tips, ln, tn, err)
+			}
+		}
+	}
+	return nil
+}
+
+func setOffset(c *timetree.Collection) error {
+	age := int64(offset * millionYears)
+	for _, tn := range c.Names() {
+		t := c.Tree(tn)
+		if err := t.SetOffset(age); err != nil {
+			return fmt.Errorf("flag --offset: tree %q: %v", tn, err)
+		}
+	}
+	return nil
+}
+
 func termsToZero(c *timetree.Collection) {
 	for _, tn := range c.Names() {
 		t := c.Tree(tn)
 		for _, n := range t.Terms() {
 			v, _ := t.TaxNode(n)
-			t.Set(v, 0)
+			t.Set(v, t.Offset())
 		}
 	}
 }
@@ -188,15 +358,17 @@ func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
 	outName := "stdout"
 	if output != "" {
 		outName = output
-		f, err := os.Create(output)
+		var f *outfile.File
+		f, err = outfile.Create(output)
 		if err != nil {
 			return err
 		}
 		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
+			if err != nil {
+				f.Discard()
+				return
 			}
+			err = f.Close()
 		}()
 		w = f
 	}
@@ -7,23 +7,35 @@
 package sim
 
 import (
+	"bufio"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"math/rand/v2"
 	"os"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/js-arias/command"
+	"github.com/js-arias/gbifer/taxonomy"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 	"github.com/js-arias/timetree/simulate"
 )
 
 var Command = &command.Command{
-	Usage: `sim [-o|--output <file>] [--name <tree-name>]
-	[--trees <tree-number]
-	[--coalescent <number>]
+	Usage: `sim [-o|--output <file>] [--format <format>] [--name <tree-name>]
+	[--trees <tree-number] [--seed <number>]
+	[--coalescent <number>] [--skyline <file>] [--growth <rate>]
 	[--yule <rate>]
-	[--bd <rate,rate>]
+	[--bd <rate,rate>] [--crown] [--shifts <file>]
+	[--names <file>] [--shuffle] [--tip-ages <file>]
+	[--taxonomy <file> [--tax-ages <file>]]
 	--terms <term-number> [--min <age>] --max <age>`,
 	Short: "simulate trees",
 	Long: `
@@ -32,12 +44,31 @@ Command sim creates one on more random trees.
 By default, the output will be printed in the standard output. Use the flag
 --output, or -o, to define an output file. It will replace any previous file.
 
+By default, the trees are written in TSV format. Use the flag --format to
+define a different output format, for example, to use the trees as input of
+other programs (such as sequence simulators). Valid formats are:
+
+	tsv     the TSV format used by timetree (the default)
+	newick  a tree per line in newick (parenthetical) format, with branch
+	        lengths in million years
+	nexus   a nexus file with a trees block, with branch lengths in
+	        million years
+
 By default, the trees will be named "random-tree" with a number. Use the flag
 --name to modify the prefix name of the tree.
 
 By default, a single tree will be created. Use the flag --trees to define a
 different number of trees.
 
+By default, each run of the command creates different trees. Use the flag
+--seed to define the seed of the random number generator, so the same trees
+are created in each run with the same seed and flags.
+
+When several trees are created, the trees are simulated concurrently. Each
+tree uses its own random number generator (derived from the seed and the
+number of the tree), so the trees are the same regardless of the number of
+processors.
+
 The flag --terms is required and indicates the number of terms that the tree
 should have.
 
@@ -47,18 +78,109 @@ omitted; its default value is 0.000001 (i.e. a year before present).
 
 By default, it creates uniform trees. Use the flag --coalescent with the "size
 of the population" to create a coalescent tree. A rule of thumb using as size
-the same value of the maximum age. Use the flag --yule with the speciation rate
+the same value of the maximum age.
+
+Use the flag --skyline to define a file with changes in the population size
+of a coalescent tree (for example, to simulate a population expansion, or a
+bottleneck). The size of the flag --coalescent is used from the present to
+the youngest change. The file is a TSV file without header, and the following
+columns:
+
+	-age   the age of the change, in million years
+	-size  the size of the population
+
+The size of a change is used from the age of the change to the age of the next
+(older) change. Lines starting with '#' are ignored.
+
+Use the flag --growth with a growth rate per million years to define a
+coalescent tree with a population that grows exponentially. The size of the
+flag --coalescent is the size at the present, and at a given age t (in
+million years) the size is the size at the present multiplied by
+exp(-rate*t). A large growth rate produces star-like trees (for example, in
+epidemiological simulations). The flag --growth can not be used with the flag
+--skyline.
+
+Use the flag --yule with the speciation rate
 per million years to create a Yule tree. Use the flag --bd with an speciation
 and extinction rate per million years to create a birth-death tree, the format
 for the rates are "<value>,<value>" for example "0.1,0.01" will indicate a
 speciation rate of 0.1 and an extinction rate of 0.01.
 
+Yule and birth-death trees are simulated forward in time, from the root, and
+trees with less than two terminals are discarded, so the resulting trees can
+have less terminals than the indicated by the flag --terms. Use the flag
+--crown to simulate the birth-death process conditioned on the age of the
+root and the number of terminals: the resulting trees will always have the
+indicated number of terminals, all of them at the present (i.e., extinct
+lineages are not included), and the sampled root age. As ages are stored in
+years, the root age must have at least as many years as the number of
+internal nodes, otherwise the command ends with an error.
+
+Use the flag --shifts to define a file with shifts in the diversification
+rates of a Yule or a birth-death tree (for example, to simulate a
+diversification slowdown, or a radiation). The rates of the flags --yule or
+--bd are used from the root to the oldest shift. The file is a TSV file
+without header, and the following columns:
+
+	-age         the age of the shift, in million years
+	-speciation  the speciation rate per million years
+	-extinction  the extinction rate per million years (it can be omitted,
+	             and its default value is 0)
+
+The rates of a shift are used from the age of the shift to the age of the next
+shift, or the present. Lines starting with '#' are ignored. The flag --shifts
+can not be used with the flag --crown.
+
+By default, the terminals are named "term" with a number. Use the flag --names
+to define a file with the names of the terminals, one name per line (empty
+lines, and lines starting with '#' are ignored). If the flag --terms is not
+defined, the number of terminals will be the number of names in the file,
+otherwise, the file must have at least as many names as terminals. By
+default, the names are assigned in order (i.e., "term0" is named with the
+first name of the file). Use the flag --shuffle to assign the names at random
+in each tree.
+
+By default, uniform trees have all the terminals at the present. Use the flag
+--tip-ages to define a file with the names and ages of the terminals (for
+example, to simulate trees with fossil terminals). The file is a TSV file
+without header, and the following columns:
+
+	-taxon  the name of the terminal
+	-age    the age of the terminal, in million years
+
+Lines starting with '#' are ignored. The terminals of the trees will be the
+taxa of the file, so the flag --terms can be omitted (if defined, it must be
+equal to the number of taxa in the file), and the flags --names and --shuffle
+can not be used. The root age will be older than the oldest terminal. The flag
+--tip-ages can only be used with uniform trees.
+
+Use the flag --taxonomy to define a taxonomy file (for example, to build a
+placeholder tree for a group without a phylogeny). The format of the file is
+the same format used by the command tax. The terminals of the trees will be
+the accepted species of the taxonomy, and each accepted taxon with two or more
+descendants will be a named monophyletic group, with random relationships
+inside each taxon. The flag --terms can be omitted (if defined, it must be
+equal to the number of species in the taxonomy). The ages of the nodes are
+sampled uniformly, and the root age is sampled between the flags --min and
+--max. Use the flag --tax-ages to define a file with the bounds of the age of
+the crown of the taxa. The file is a TSV file without header, and the
+following columns:
+
+	-taxon  the name of the taxon
+	-min    the minimum age of the taxon, in million years
+	-max    the maximum age of the taxon, in million years (it can be
+	        omitted, and then only the minimum age will be used)
+
+Lines starting with '#' are ignored. The flag --taxonomy can only be used with
+uniform trees, and can not be used with the flags --names, --shuffle, or
+--tip-ages.
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      outfile.Locked(&output, run),
 }
 
 var output string
+var format string
 var nameFlag string
 var birthDeath string
 var numTrees int
@@ -67,6 +189,16 @@ var minAge float64
 var maxAge float64
 var coalescent float64
 var yule float64
+var crown bool
+var shiftsFile string
+var skylineFile string
+var growth float64
+var namesFile string
+var shuffle bool
+var tipAgesFile string
+var taxFile string
+var taxAgesFile string
+var seed uint64
 
 func setFlags(c *command.Command) {
 	c.Flags().IntVar(&numTrees, "trees", 1, "")
@@ -76,14 +208,97 @@ func setFlags(c *command.Command) {
 	c.Flags().Float64Var(&coalescent, "coalescent", 0, "")
 	c.Flags().Float64Var(&yule, "yule", 0, "")
 	c.Flags().StringVar(&birthDeath, "bd", "", "")
+	c.Flags().BoolVar(&crown, "crown", false, "")
+	c.Flags().StringVar(&shiftsFile, "shifts", "", "")
+	c.Flags().StringVar(&skylineFile, "skyline", "", "")
+	c.Flags().Float64Var(&growth, "growth", 0, "")
+	c.Flags().StringVar(&namesFile, "names", "", "")
+	c.Flags().BoolVar(&shuffle, "shuffle", false, "")
+	c.Flags().StringVar(&tipAgesFile, "tip-ages", "", "")
+	c.Flags().StringVar(&taxFile, "taxonomy", "", "")
+	c.Flags().StringVar(&taxAgesFile, "tax-ages", "", "")
+	c.Flags().Uint64Var(&seed, "seed", 0, "")
 	c.Flags().StringVar(&output, "output", "", "")
 	c.Flags().StringVar(&output, "o", "", "")
+	c.Flags().StringVar(&format, "format", "tsv", "")
 	c.Flags().StringVar(&nameFlag, "name", "random-tree", "")
 }
 
 const millionYears = 1_000_000
 
 func run(c *command.Command, args []string) (err error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != "tsv" && format != "newick" && format != "nexus" {
+		return c.UsageError(fmt.Sprintf("flag --format: unknown format %q", format))
+	}
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	var names []string
+	if namesFile != "" {
+		var err error
+		names, err = readNames()
+		if err != nil {
+			return err
+		}
+		if numTerms == 0 {
+			numTerms = len(names)
+		}
+		if len(names) < numTerms {
+			return fmt.Errorf("flag --names: got %d names, want %d", len(names), numTerms)
+		}
+	}
+
+	var tips []tipAge
+	if tipAgesFile != "" {
+		if namesFile != "" || shuffle {
+			return c.UsageError("flag --tip-ages can not be used with flags --names or --shuffle")
+		}
+		if coalescent > 0 || yule > 0 || birthDeath != "" {
+			return c.UsageError("flag --tip-ages can only be used with uniform trees")
+		}
+		var err error
+		tips, err = readTipAges()
+		if err != nil {
+			return err
+		}
+		if numTerms == 0 {
+			numTerms = len(tips)
+		}
+		if numTerms != len(tips) {
+			return fmt.Errorf("flag --tip-ages: got %d taxa, want %d", len(tips), numTerms)
+		}
+	}
+
+	var tax *simulate.Taxon
+	if taxFile != "" {
+		if namesFile != "" || shuffle || tipAgesFile != "" {
+			return c.UsageError("flag --taxonomy can not be used with flags --names, --shuffle, or --tip-ages")
+		}
+		if coalescent > 0 || yule > 0 || birthDeath != "" {
+			return c.UsageError("flag --taxonomy can only be used with uniform trees")
+		}
+		var err error
+		var terms int
+		tax, terms, err = readTaxonomy()
+		if err != nil {
+			return err
+		}
+		if numTerms == 0 {
+			numTerms = terms
+		}
+		if numTerms != terms {
+			return fmt.Errorf("flag --taxonomy: got %d species, want %d", terms, numTerms)
+		}
+		if taxAgesFile != "" {
+			if err := readTaxAges(tax); err != nil {
+				return err
+			}
+		}
+	} else if taxAgesFile != "" {
+		return c.UsageError("flag --tax-ages requires flag --taxonomy")
+	}
+
 	if numTerms <= 0 {
 		return c.UsageError("flag --terms must be defined")
 	}
@@ -111,22 +326,119 @@ func run(c *command.Command, args []string) (err error) {
 		}
 	}
 
+	if crown {
+		if yule <= 0 && spRate <= 0 {
+			return c.UsageError("flag --crown requires flag --yule or --bd")
+		}
+		if numTerms < 2 {
+			return c.UsageError("flag --crown requires at least two terminals")
+		}
+	}
+
+	var shifts []simulate.Shift
+	if shiftsFile != "" {
+		if yule <= 0 && spRate <= 0 {
+			return c.UsageError("flag --shifts requires flag --yule or --bd")
+		}
+		if crown {
+			return c.UsageError("flag --shifts can not be used with flag --crown")
+		}
+		var err error
+		shifts, err = readShifts()
+		if err != nil {
+			return err
+		}
+	}
+
+	var epochs []simulate.Epoch
+	if skylineFile != "" {
+		if coalescent <= 0 {
+			return c.UsageError("flag --skyline requires flag --coalescent")
+		}
+		var err error
+		epochs, err = readSkyline()
+		if err != nil {
+			return err
+		}
+	}
+
+	if growth != 0 {
+		if coalescent <= 0 {
+			return c.UsageError("flag --growth requires flag --coalescent")
+		}
+		if skylineFile != "" {
+			return c.UsageError("flag --growth can not be used with flag --skyline")
+		}
+		if growth < 0 {
+			return fmt.Errorf("flag --growth: invalid value %.6f", growth)
+		}
+	}
+
 	ages := make([]int64, numTerms)
+	for i, tp := range tips {
+		ages[i] = tp.age
+		if tp.age >= max {
+			return fmt.Errorf("flag --tip-ages: taxon %q: age %.6f older than flag --max", tp.name, float64(tp.age)/millionYears)
+		}
+	}
 
-	coll := timetree.NewCollection()
-	for i := 0; i < numTrees; i++ {
+	// simTree simulates the tree i
+	// using its own random number generator,
+	// so the trees are the same
+	// regardless of the order of the simulations.
+	simTree := func(i int) (*timetree.Tree, error) {
+		rnd := rand.New(rand.NewPCG(seed, uint64(i)))
 		name := fmt.Sprintf("%s-%d", nameFlag, i)
 
+		// the ages are shuffled by the simulation
+		ages := slices.Clone(ages)
+
 		var t *timetree.Tree
 		switch {
+		case tax != nil:
+			var err error
+			t, err = simulate.Taxonomy(rnd, name, tax, min, max)
+			if err != nil {
+				return nil, fmt.Errorf("flag --taxonomy: %v", err)
+			}
+		case crown && (extRate > 0 || yule > 0):
+			root := max
+			if min < max {
+				root = rnd.Int64N(max-min) + min
+			}
+			sp := spRate
+			if extRate == 0 {
+				sp = yule
+			}
+			var err error
+			t, err = simulate.Conditioned(rnd, name, sp, extRate, root, numTerms)
+			if err != nil {
+				return nil, fmt.Errorf("flag --crown: %v", err)
+			}
+		case shifts != nil:
+			root := max
+			if min < max {
+				root = rnd.Int64N(max-min) + min
+			}
+			sp := spRate
+			if extRate == 0 {
+				sp = yule
+			}
+			for {
+				var ok bool
+				t, ok = simulate.RateShifts(rnd, name, sp, extRate, shifts, root, numTerms)
+				if ok {
+					break
+				}
+			}
 		case extRate > 0:
 			root := max
 			if min < max {
-				root = rand.Int64N(max-min) + min
+				root = rnd.Int64N(max-min) + min
 			}
 			for {
 				var ok bool
-				t, ok = simulate.BirthDeath(name, spRate, extRate, root, numTerms)
+				t, ok = simulate.BirthDeath(rnd, name, spRate, extRate, root, numTerms)
 				if ok {
 					break
 				}
@@ -134,49 +446,255 @@ func run(c *command.Command, args []string) (err error) {
 		case yule > 0:
 			root := max
 			if min < max {
-				root = rand.Int64N(max-min) + min
+				root = rnd.Int64N(max-min) + min
 			}
 			for {
 				var ok bool
-				t, ok = simulate.Yule(name, yule, root, numTerms)
+				t, ok = simulate.Yule(rnd, name, yule, root, numTerms)
 				if ok {
 					break
 				}
 			}
+		case epochs != nil:
+			t = simulate.Skyline(rnd, name, coalescent*millionYears, epochs, max, numTerms)
+		case growth > 0:
+			t = simulate.Growth(rnd, name, coalescent*millionYears, growth, max, numTerms)
 		case coalescent > 0:
-			t = simulate.Coalescent(name, coalescent*millionYears, max, numTerms)
+			t = simulate.Coalescent(rnd, name, coalescent*millionYears, max, numTerms)
 		default:
-			t = simulate.Uniform(name, max, min, ages)
+			t = simulate.Uniform(rnd, name, max, min, ages)
+		}
+		if tips != nil {
+			if err := setNames(rnd, t, tipNames(tips, ages)); err != nil {
+				return nil, err
+			}
+		}
+		if names != nil {
+			if err := setNames(rnd, t, names); err != nil {
+				return nil, err
+			}
 		}
 		t.Format()
-		coll.Add(t)
+		return t, nil
+	}
+
+	// simulate trees concurrently
+	// with a fixed pool of workers
+	trees := make([]*timetree.Tree, numTrees)
+	errs := make([]error, numTrees)
+	jobs := make(chan int)
+	workers := runtime.GOMAXPROCS(0)
+	if workers > numTrees {
+		workers = numTrees
+	}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				trees[i], errs[i] = simTree(i)
+			}
+		}()
+	}
+	for i := range trees {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	coll := timetree.NewCollection()
+	for i, t := range trees {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		if err := coll.Add(t); err != nil {
+			return fmt.Errorf("tree %d: %v", i, err)
+		}
 	}
 
 	w := c.Stdout()
 	if output != "" {
-		var f *os.File
-		f, err = os.Create(output)
+		var f *outfile.File
+		f, err = outfile.Create(output)
 		if err != nil {
 			return err
 		}
 		w = f
 		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
+			if err != nil {
+				f.Discard()
+				return
 			}
+			err = f.Close()
 		}()
 	} else {
 		output = "stdout"
 	}
 
-	if err := coll.TSV(w); err != nil {
+	write := coll.TSV
+	switch format {
+	case "newick":
+		write = coll.Newick
+	case "nexus":
+		write = coll.Nexus
+	}
+	if err := write(w); err != nil {
 		return fmt.Errorf("while writing to %q: %v", output, err)
 	}
 
 	return nil
 }
 
+func readNames() ([]string, error) {
+	f, err := os.Open(namesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	seen := make(map[string]int)
+	s := bufio.NewScanner(f)
+	for ln := 1; s.Scan(); ln++ {
+		name := strings.Join(strings.Fields(s.Text()), " ")
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		k := strings.ToLower(name)
+		if p, ok := seen[k]; ok {
+			return nil, fmt.Errorf("%q: on line %d: name %q repeated (first on line %d)", namesFile, ln, name, p)
+		}
+		seen[k] = ln
+		names = append(names, name)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%q: %v", namesFile, err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%q: no names defined", namesFile)
+	}
+	return names, nil
+}
+
+// SetNames sets the names of the terminals
+// of a simulated tree.
+func setNames(rnd *rand.Rand, t *timetree.Tree, names []string) error {
+	perm := make([]int, len(names))
+	for i := range perm {
+		perm[i] = i
+	}
+	if shuffle {
+		rnd.Shuffle(len(perm), func(i, j int) {
+			perm[i], perm[j] = perm[j], perm[i]
+		})
+	}
+
+	// rename in two steps,
+	// so a new name can not collide
+	// with the name of a simulated terminal
+	terms := make(map[int]int)
+	for _, id := range t.Nodes() {
+		if !t.IsTerm(id) {
+			continue
+		}
+		tax := strings.ToLower(t.Taxon(id))
+		i, err := strconv.Atoi(strings.TrimPrefix(tax, "term"))
+		if err != nil || i >= len(names) {
+			return fmt.Errorf("tree %q: unexpected terminal %q", t.Name(), t.Taxon(id))
+		}
+		terms[id] = i
+		if err := t.SetName(id, fmt.Sprintf("sim-term-%d", id)); err != nil {
+			return fmt.Errorf("tree %q: %v", t.Name(), err)
+		}
+	}
+	for id, i := range terms {
+		if err := t.SetName(id, names[perm[i]]); err != nil {
+			return fmt.Errorf("tree %q: %v", t.Name(), err)
+		}
+	}
+	return nil
+}
+
+// A tipAge is a terminal
+// with a given age.
+type tipAge struct {
+	name string
+	age  int64
+}
+
+func readTipAges() ([]tipAge, error) {
+	f, err := os.Open(tipAgesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	var tips []tipAge
+	seen := make(map[string]bool)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", tipAgesFile, ln, err)
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", tipAgesFile, ln, len(row), 2)
+		}
+
+		name := strings.Join(strings.Fields(row[0]), " ")
+		if name == "" {
+			return nil, fmt.Errorf("%q: on row %d: field %q: empty name", tipAgesFile, ln, "taxon")
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("%q: on row %d: field %q: taxon %q repeated", tipAgesFile, ln, "taxon", name)
+		}
+		seen[strings.ToLower(name)] = true
+		age, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", tipAgesFile, ln, "age", err)
+		}
+		if age < 0 {
+			return nil, fmt.Errorf("%q: on row %d: field %q: invalid age %v", tipAgesFile, ln, "age", age)
+		}
+
+		tips = append(tips, tipAge{
+			name: name,
+			age:  int64(math.Round(age * millionYears)),
+		})
+	}
+	if len(tips) < 2 {
+		return nil, fmt.Errorf("%q: got %d taxa, want at least 2", tipAgesFile, len(tips))
+	}
+	return tips, nil
+}
+
+// TipNames returns the names of the terminals
+// of a simulated tree,
+// in which the terminal i has the age ages[i].
+func tipNames(tips []tipAge, ages []int64) []string {
+	byAge := make(map[int64][]string)
+	for _, tp := range tips {
+		byAge[tp.age] = append(byAge[tp.age], tp.name)
+	}
+
+	names := make([]string, len(ages))
+	for i, a := range ages {
+		ns := byAge[a]
+		names[i] = ns[len(ns)-1]
+		byAge[a] = ns[:len(ns)-1]
+	}
+	return names
+}
+
 func parseRates() (sp, e float64, err error) {
 	sv := strings.Split(birthDeath, ",")
 	if len(sv) != 2 {
@@ -201,3 +719,262 @@ func parseRates() (sp, e float64, err error) {
 
 	return sp, e, nil
 }
+
+func readShifts() ([]simulate.Shift, error) {
+	f, err := os.Open(shiftsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	var shifts []simulate.Shift
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", shiftsFile, ln, err)
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", shiftsFile, ln, len(row), 2)
+		}
+
+		age, err := strconv.ParseFloat(strings.TrimSpace(row[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", shiftsFile, ln, "age", err)
+		}
+		if age <= 0 {
+			return nil, fmt.Errorf("%q: on row %d: field %q: invalid age %v", shiftsFile, ln, "age", age)
+		}
+		sp, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", shiftsFile, ln, "speciation", err)
+		}
+		if sp < 0 {
+			return nil, fmt.Errorf("%q: on row %d: field %q: invalid rate %v", shiftsFile, ln, "speciation", sp)
+		}
+		var e float64
+		if len(row) > 2 && strings.TrimSpace(row[2]) != "" {
+			e, err = strconv.ParseFloat(strings.TrimSpace(row[2]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q: on row %d: field %q: %v", shiftsFile, ln, "extinction", err)
+			}
+			if e < 0 {
+				return nil, fmt.Errorf("%q: on row %d: field %q: invalid rate %v", shiftsFile, ln, "extinction", e)
+			}
+		}
+
+		shifts = append(shifts, simulate.Shift{
+			Age:        int64(age * millionYears),
+			Speciation: sp,
+			Extinction: e,
+		})
+	}
+	if len(shifts) == 0 {
+		return nil, fmt.Errorf("%q: no rate shifts defined", shiftsFile)
+	}
+	return shifts, nil
+}
+
+func readSkyline() ([]simulate.Epoch, error) {
+	f, err := os.Open(skylineFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	var epochs []simulate.Epoch
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", skylineFile, ln, err)
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("%q: on row %d: got %d fields, want %d", skylineFile, ln, len(row), 2)
+		}
+
+		age, err := strconv.ParseFloat(strings.TrimSpace(row[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", skylineFile, ln, "age", err)
+		}
+		if age <= 0 {
+			return nil, fmt.Errorf("%q: on row %d: field %q: invalid age %v", skylineFile, ln, "age", age)
+		}
+		size, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", skylineFile, ln, "size", err)
+		}
+		if size <= 0 {
+			return nil, fmt.Errorf("%q: on row %d: field %q: invalid size %v", skylineFile, ln, "size", size)
+		}
+
+		epochs = append(epochs, simulate.Epoch{
+			Age:  int64(age * millionYears),
+			Size: size * millionYears,
+		})
+	}
+	if len(epochs) == 0 {
+		return nil, fmt.Errorf("%q: no population sizes defined", skylineFile)
+	}
+	return epochs, nil
+}
+
+// ReadTaxonomy returns the root
+// of the accepted taxa of a taxonomy,
+// and the number of species.
+func readTaxonomy() (*simulate.Taxon, int, error) {
+	f, err := os.Open(taxFile)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	tx, err := taxonomy.Read(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("on file %q: %v", taxFile, err)
+	}
+
+	nodes := make(map[int64]*simulate.Taxon)
+	ranks := make(map[*simulate.Taxon]taxonomy.Rank)
+	ids := tx.IDs()
+	for _, id := range ids {
+		tax := tx.Taxon(id)
+		if tax.Status != "accepted" {
+			continue
+		}
+		if tax.Parent != 0 && tx.Rank(tax.Parent) >= taxonomy.Species {
+			// taxa below species are ignored
+			continue
+		}
+		n := &simulate.Taxon{Name: tax.Name}
+		nodes[id] = n
+		ranks[n] = tax.Rank
+	}
+
+	var roots []*simulate.Taxon
+	for _, id := range ids {
+		n, ok := nodes[id]
+		if !ok {
+			continue
+		}
+		if p, ok := nodes[tx.Taxon(id).Parent]; ok {
+			p.Children = append(p.Children, n)
+			continue
+		}
+		roots = append(roots, n)
+	}
+
+	// remove the taxa without species
+	species := 0
+	var prune func(n *simulate.Taxon) bool
+	prune = func(n *simulate.Taxon) bool {
+		if ranks[n] == taxonomy.Species {
+			n.Children = nil
+			species++
+			return true
+		}
+		var children []*simulate.Taxon
+		for _, c := range n.Children {
+			if prune(c) {
+				children = append(children, c)
+			}
+		}
+		n.Children = children
+		return len(children) > 0
+	}
+	root := &simulate.Taxon{}
+	for _, n := range roots {
+		if prune(n) {
+			root.Children = append(root.Children, n)
+		}
+	}
+	if len(root.Children) == 1 {
+		root = root.Children[0]
+	}
+	if species < 2 {
+		return nil, 0, fmt.Errorf("on file %q: got %d species, want at least 2", taxFile, species)
+	}
+	return root, species, nil
+}
+
+// ReadTaxAges sets the age bounds
+// of the taxa.
+func readTaxAges(root *simulate.Taxon) error {
+	taxa := make(map[string]*simulate.Taxon)
+	var add func(n *simulate.Taxon)
+	add = func(n *simulate.Taxon) {
+		taxa[strings.ToLower(n.Name)] = n
+		for _, c := range n.Children {
+			add(c)
+		}
+	}
+	add(root)
+
+	f, err := os.Open(taxAgesFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return fmt.Errorf("%q: on row %d: %v", taxAgesFile, ln, err)
+		}
+		if len(row) < 2 {
+			return fmt.Errorf("%q: on row %d: got %d fields, want %d", taxAgesFile, ln, len(row), 2)
+		}
+
+		name := strings.Join(strings.Fields(row[0]), " ")
+		n, ok := taxa[strings.ToLower(name)]
+		if !ok || name == "" {
+			return fmt.Errorf("%q: on row %d: field %q: taxon %q not in taxonomy", taxAgesFile, ln, "taxon", name)
+		}
+		min, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			return fmt.Errorf("%q: on row %d: field %q: %v", taxAgesFile, ln, "min", err)
+		}
+		if min < 0 {
+			return fmt.Errorf("%q: on row %d: field %q: invalid age %v", taxAgesFile, ln, "min", min)
+		}
+		var max float64
+		if len(row) > 2 && strings.TrimSpace(row[2]) != "" {
+			max, err = strconv.ParseFloat(strings.TrimSpace(row[2]), 64)
+			if err != nil {
+				return fmt.Errorf("%q: on row %d: field %q: %v", taxAgesFile, ln, "max", err)
+			}
+			if max <= 0 || max < min {
+				return fmt.Errorf("%q: on row %d: field %q: invalid age %v", taxAgesFile, ln, "max", max)
+			}
+		}
+
+		n.MinAge = int64(math.Round(min * millionYears))
+		n.MaxAge = int64(math.Round(max * millionYears))
+	}
+	return nil
+}
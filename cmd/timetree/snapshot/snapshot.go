@@ -0,0 +1,179 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package snapshot implements a command to store
+// named versions of the trees
+// in a tree file.
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `snapshot [--label <label>] [--list] [--tree <tree>]
+	[-o|--output <file>] [<treefile>]`,
+	Short: "store a named version of the trees",
+	Long: `
+Command snapshot reads a tree file in TSV format, and adds to the file a copy
+of the trees with a given label, so the current version of the trees can be
+recovered later with the command revert. In this way, the curation history of
+the trees (for example, "raw-import", "calibrated-v1", "calibrated-v2") is
+kept with the data.
+
+The name of a tree file can be given as an argument. If no file is given, the
+trees will be read from the standard input.
+
+The flag --label is required, and defines the label of the snapshot. Labels
+are case insensitive, and must be unique for each tree.
+
+A snapshot is stored as a tree named with the name of the tree and the label,
+separated by "@" (for example, "vireya@raw-import"). The root of the snapshot
+stores the name of the tree in the field "snapshot-of", and the label in the
+field "snapshot". Snapshots are regular trees of the file, so they are also
+modified by commands that change all the trees of a file, unless the flag
+--tree is used. A snapshot of a snapshot is not allowed.
+
+By default, a snapshot of all the trees in the file (except the snapshots)
+will be stored. Use the flag --tree to store a snapshot of a single tree.
+
+Use the flag --list to print the snapshots in the file instead of adding a
+new snapshot. The list is a TSV table with the columns tree and label.
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var label string
+var list bool
+var treeName string
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&label, "label", "", "")
+	c.Flags().BoolVar(&list, "list", false, "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	in := "-"
+	if len(args) > 0 {
+		in = args[0]
+	}
+
+	treeName = strings.ToLower(strings.Join(strings.Fields(treeName), " "))
+	if !list && strings.TrimSpace(label) == "" {
+		return c.UsageError("flag --label: undefined label")
+	}
+
+	tc, err := infile.Collection(c.Stdin(), in)
+	if err != nil {
+		return err
+	}
+	if treeName != "" && tc.Tree(treeName) == nil {
+		return fmt.Errorf("tree %q not found", treeName)
+	}
+
+	if list {
+		return writeList(c.Stdout(), tc)
+	}
+	orig := dryrun.Copy(tc)
+
+	for _, tn := range tc.Names() {
+		if treeName != "" && strings.ToLower(tn) != treeName {
+			continue
+		}
+		t := tc.Tree(tn)
+		if treeName == "" && t.Meta(t.Root(), "snapshot-of") != "" {
+			continue
+		}
+		if err := tc.Snapshot(tn, label); err != nil {
+			return err
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, tc)
+		return nil
+	}
+	if err := writeTrees(c.Stdout(), tc); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeList(w io.Writer, tc *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "tree\tlabel\n")
+	for _, tn := range tc.Names() {
+		if treeName != "" && strings.ToLower(tn) != treeName {
+			continue
+		}
+		for _, l := range tc.Snapshots(tn) {
+			fmt.Fprintf(bw, "%s\t%s\n", tn, l)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
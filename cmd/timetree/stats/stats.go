@@ -0,0 +1,175 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package stats implements a command to print
+// summary statistics of the trees in a tree file.
+package stats
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `stats [--tolerance <age>] [--tips]
+	[-o|--output <file>] [<tree-file>...]`,
+	Short: "print summary statistics of trees",
+	Long: `
+Command stats reads one or more tree files in TSV format and prints summary
+statistics of each tree.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input.
+
+The output is a TSV table with the following columns:
+
+	-tree        the name of the tree
+	-terms       the number of terminals
+	-internal    the number of internal nodes
+	-polytomies  the number of internal nodes with more than two
+	             descendants
+	-extinct     the number of terminals older than the present of the
+	             tree (i.e., its offset)
+	-root        the age of the root, in million years
+	-length      the total length of the tree, in million years
+	-min-term    the age of the youngest terminal, in million years
+	-max-term    the age of the oldest terminal, in million years
+	-ultrametric "true" if the tree is ultrametric, "false" otherwise
+
+A tree is ultrametric if all of its terminals have the same distance to the
+root. By default, any difference is considered. Use the flag --tolerance to
+define the maximum difference, in million years, between the distance of a
+terminal and the maximum root-to-tip distance, accepted in an ultrametric tree.
+
+If the flag --tips is defined, instead of the summary table, it will print the
+terminals that deviate from the maximum root-to-tip distance. The output is a
+TSV table with the following columns:
+
+	-tree       the name of the tree
+	-taxon      the name of the terminal
+	-age        the age of the terminal, in million years
+	-deviation  the difference between the distance of the terminal to the
+	            root and the maximum root-to-tip distance, in million
+	            years
+
+By default, the table will be printed in the standard output. Use the flag
+--output, or -o, to define an output file.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var tolerance float64
+var tips bool
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().Float64Var(&tolerance, "tolerance", 0, "")
+	c.Flags().BoolVar(&tips, "tips", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	if tolerance < 0 {
+		return c.UsageError("flag --tolerance must be a positive value")
+	}
+
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+
+	tol := int64(tolerance * millionYears)
+	bw := bufio.NewWriter(w)
+	if tips {
+		fmt.Fprintf(bw, "tree\ttaxon\tage\tdeviation\n")
+		for _, tn := range coll.Names() {
+			t := coll.Tree(tn)
+			s := treeStats(t)
+			for _, tax := range t.NonUltrametric(tol) {
+				id, _ := t.TaxNode(tax)
+				age := t.Age(id)
+				fmt.Fprintf(bw, "%s\t%s\t%.6f\t%.6f\n", t.Name(), tax, float64(age)/millionYears, float64(age-s.minTerm)/millionYears)
+			}
+		}
+	} else {
+		fmt.Fprintf(bw, "tree\tterms\tinternal\tpolytomies\textinct\troot\tlength\tmin-term\tmax-term\tultrametric\n")
+		for _, tn := range coll.Names() {
+			t := coll.Tree(tn)
+			s := treeStats(t)
+			fmt.Fprintf(bw, "%s\t%d\t%d\t%d\t%d\t%.6f\t%.6f\t%.6f\t%.6f\t%v\n", t.Name(), t.NumTerms(), t.NumInternal(), s.polytomies, s.extinct, float64(t.Age(t.Root()))/millionYears, float64(t.Len())/millionYears, float64(s.minTerm)/millionYears, float64(s.maxTerm)/millionYears, t.IsUltrametric(tol))
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+// Stats are the summary values of a tree
+// not provided directly by a tree.
+type stats struct {
+	polytomies int
+	extinct    int
+
+	// terminal ages
+	minTerm int64
+	maxTerm int64
+}
+
+func treeStats(t *timetree.Tree) stats {
+	s := stats{
+		minTerm: t.Age(t.Root()),
+	}
+	for _, id := range t.Nodes() {
+		if !t.IsTerm(id) {
+			if len(t.Children(id)) > 2 {
+				s.polytomies++
+			}
+			continue
+		}
+
+		age := t.Age(id)
+		if age > t.Offset() {
+			s.extinct++
+		}
+		s.minTerm = min(s.minTerm, age)
+		s.maxTerm = max(s.maxTerm, age)
+	}
+	return s
+}
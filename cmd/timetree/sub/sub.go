@@ -11,15 +11,20 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 )
 
 var Command = &command.Command{
 	Usage: `sub [-i|--input <file>] [-o|--output <file>]
 	[--name <tree-name>] --tree <tree-name>
-	<taxon-1> <taxon-2> [<taxon-n>...]`,
+	[--age-window <old,young>] [<taxon-1> <taxon-2> [<taxon-n>...]]`,
 	Short: "retrieve a sub-tree",
 	Long: `
 Command sub reads a tree file in TSV format and selects the clade that contains
@@ -41,15 +46,25 @@ ID in that tree. Use the flag --name to define a name for the resulting tree.
 The arguments of the command are the names of at least two taxons named in the
 source tree; the most recent common ancestor of the indicated names will be
 used as the root node for the resulting tree.
+
+Use the flag --age-window, with two ages in million years separated by a comma
+(the oldest and the youngest age), to retrieve all the maximal clades whose
+crown age is inside the time window (for example, "--age-window 23.03,5.333"
+to retrieve all the radiations of the Miocene). A clade is maximal if it is
+not included in a larger clade that is also inside the window. Each clade is
+added as a separate tree, named as in the default (and by the name of the
+flag --name, followed by the number of the clade, if the flag is defined).
+With this flag, no taxon names must be given.
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      outfile.Locked(&output, run),
 }
 
 var input string
 var output string
 var nameFlag string
 var treeFlag string
+var ageWindow string
 
 func setFlags(c *command.Command) {
 	c.Flags().StringVar(&input, "input", "", "")
@@ -58,17 +73,32 @@ func setFlags(c *command.Command) {
 	c.Flags().StringVar(&output, "o", "", "")
 	c.Flags().StringVar(&nameFlag, "name", "", "")
 	c.Flags().StringVar(&treeFlag, "tree", "", "")
+	c.Flags().StringVar(&ageWindow, "age-window", "", "")
 }
 
 func run(c *command.Command, args []string) error {
 	if treeFlag == "" {
 		return c.UsageError("flag --tree must be defined")
 	}
-	if len(args) < 2 {
+	var old, young int64
+	if ageWindow != "" {
+		if len(args) > 0 {
+			return c.UsageError("flag --age-window: taxon names can not be given")
+		}
+		var err error
+		old, young, err = parseWindow(ageWindow)
+		if err != nil {
+			return fmt.Errorf("flag --age-window: %v", err)
+		}
+	} else if len(args) < 2 {
 		return c.UsageError("at least two taxon names must be given")
 	}
 
-	coll, err := readCollection(c.Stdin(), input)
+	in := input
+	if in == "" {
+		in = "-"
+	}
+	coll, err := infile.Collection(c.Stdin(), in)
 	if err != nil {
 		return err
 	}
@@ -77,37 +107,87 @@ func run(c *command.Command, args []string) error {
 		return fmt.Errorf("tree %q not found", treeFlag)
 	}
 
-	mrca := t.MRCA(args...)
-	if mrca < 0 {
-		return fmt.Errorf("most recent common ancestor of %v not found on tree %q", args, treeFlag)
+	var ts []*timetree.Tree
+	if ageWindow != "" {
+		ids := windowClades(t, old, young)
+		if len(ids) == 0 {
+			return fmt.Errorf("flag --age-window: no clades in window %q on tree %q", ageWindow, treeFlag)
+		}
+		for i, id := range ids {
+			name := nameFlag
+			if name != "" {
+				name = fmt.Sprintf("%s-%d", name, i+1)
+			}
+			ts = append(ts, t.SubTree(id, name))
+		}
+	} else {
+		mrca := t.MRCA(args...)
+		if mrca < 0 {
+			return fmt.Errorf("most recent common ancestor of %v not found on tree %q", args, treeFlag)
+		}
+		ts = append(ts, t.SubTree(mrca, nameFlag))
+	}
+
+	if dryrun.Enabled {
+		return reportTree(c.Stdout(), ts)
 	}
-	nt := t.SubTree(mrca, nameFlag)
 
-	if err := writeTrees(c.Stdout(), nt); err != nil {
+	if err := writeTrees(c.Stdout(), ts); err != nil {
 		return err
 	}
 	return nil
 }
 
-func readCollection(r io.Reader, name string) (*timetree.Collection, error) {
-	if name != "" {
-		f, err := os.Open(name)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		r = f
-		name = "stdin"
-	}
+// millionYears is used to transform ages
+// from million years to years.
+const millionYears = 1_000_000
 
-	c, err := timetree.ReadTSV(r)
+// ParseWindow returns the oldest and youngest ages
+// (in years)
+// of a time window
+// defined in million years.
+func parseWindow(w string) (old, young int64, err error) {
+	v := strings.Split(w, ",")
+	if len(v) != 2 {
+		return 0, 0, fmt.Errorf("invalid value %q: expecting <old,young>", w)
+	}
+	o, err := strconv.ParseFloat(strings.TrimSpace(v[0]), 64)
 	if err != nil {
-		return nil, fmt.Errorf("while reading file %q: %v", name, err)
+		return 0, 0, fmt.Errorf("invalid value %q: %v", w, err)
 	}
-	return c, nil
+	y, err := strconv.ParseFloat(strings.TrimSpace(v[1]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid value %q: %v", w, err)
+	}
+	if y < 0 || o < y {
+		return 0, 0, fmt.Errorf("invalid value %q: expecting <old,young>", w)
+	}
+	return int64(o * millionYears), int64(y * millionYears), nil
 }
 
-func writeTrees(w io.Writer, t *timetree.Tree) (err error) {
+// WindowClades returns the IDs
+// of the maximal clades of a tree
+// with a crown age inside a time window.
+func windowClades(t *timetree.Tree, old, young int64) []int {
+	in := func(id int) bool {
+		a := t.Age(id)
+		return a <= old && a >= young
+	}
+
+	var ids []int
+	for _, id := range t.Nodes() {
+		if t.IsTerm(id) || !in(id) {
+			continue
+		}
+		if p := t.Parent(id); p >= 0 && in(p) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func writeTrees(w io.Writer, ts []*timetree.Tree) (err error) {
 	var c *timetree.Collection
 	if output != "" {
 		c, err = getCollection()
@@ -115,15 +195,17 @@ func writeTrees(w io.Writer, t *timetree.Tree) (err error) {
 			return err
 		}
 
-		f, err := os.Create(output)
+		var f *outfile.File
+		f, err = outfile.Create(output)
 		if err != nil {
 			return err
 		}
 		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
+			if err != nil {
+				f.Discard()
+				return
 			}
+			err = f.Close()
 		}()
 		w = f
 	} else {
@@ -133,8 +215,10 @@ func writeTrees(w io.Writer, t *timetree.Tree) (err error) {
 	if c == nil {
 		c = timetree.NewCollection()
 	}
-	if err := c.Add(t); err != nil {
-		return err
+	for _, t := range ts {
+		if err := c.Add(t); err != nil {
+			return err
+		}
 	}
 
 	if err := c.TSV(w); err != nil {
@@ -143,6 +227,31 @@ func writeTrees(w io.Writer, t *timetree.Tree) (err error) {
 	return nil
 }
 
+// ReportTree prints the changes
+// in the output collection
+// after adding the trees.
+func reportTree(w io.Writer, ts []*timetree.Tree) error {
+	c := timetree.NewCollection()
+	if output != "" {
+		oc, err := getCollection()
+		if err != nil {
+			return err
+		}
+		if oc != nil {
+			c = oc
+		}
+	}
+
+	orig := dryrun.Copy(c)
+	for _, t := range ts {
+		if err := c.Add(t); err != nil {
+			return err
+		}
+	}
+	dryrun.Report(w, orig, c)
+	return nil
+}
+
 func getCollection() (*timetree.Collection, error) {
 	f, err := os.Open(output)
 	if errors.Is(err, os.ErrNotExist) {
@@ -0,0 +1,181 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package swap implements a command to replace
+// a clade of a tree
+// with the same clade from another tree.
+package swap
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `swap [-o|--output <file>] [--fit]
+	--tree <tree> --node <node> [--source <tree>]
+	<treefile> <source-treefile>`,
+	Short: "replace a clade with the clade of another tree",
+	Long: `
+Command swap reads a clade from a source tree file, and replaces, with it, the
+clade with the same terminals in a tree of a destination tree file. It is
+useful to replace a poorly resolved, or poorly dated, clade of a backbone tree
+with the clade from a focused study.
+
+The first argument of the command is the destination tree file. The second
+argument is the source tree file.
+
+The flag --tree is required and indicates the name of the destination tree.
+
+The flag --node is required and indicates the clade of the destination tree
+that will be replaced. The node can be defined by its ID, by the name of a
+taxon, or by two or more taxon names separated by commas, in which case the
+node will be the most recent common ancestor of the taxa. The clade of the
+source tree is the most recent common ancestor of the terminals of the clade,
+and both clades must have the same terminals.
+
+If the source tree file has more than one tree, use the flag --source to
+indicate the name of the source tree.
+
+The crown age of the source clade must be younger than the age of the parent
+of the replaced node (the attachment point). Use the flag --fit to rescale the
+ages of a source clade that is too old: the age of the youngest node of the
+clade is kept, and the crown age will be the age of the replaced node.
+
+The resulting tree collection will be printed as a tree file in the standard
+output. Use the flag --output, or -o, to define an output file. If the output
+file name ends with ".gz", the output will be compressed with gzip. As this
+command modifies the tree, it is possible that node IDs will be modified in
+the process.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var output string
+var treeName string
+var srcName string
+var nodeFlag string
+var fit bool
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().StringVar(&srcName, "source", "", "")
+	c.Flags().StringVar(&nodeFlag, "node", "", "")
+	c.Flags().BoolVar(&fit, "fit", false, "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) < 2 {
+		return c.UsageError("expecting destination and source tree files")
+	}
+	if treeName == "" {
+		return c.UsageError("flag --tree must be defined")
+	}
+	if strings.TrimSpace(nodeFlag) == "" {
+		return c.UsageError("flag --node must be defined")
+	}
+
+	coll, err := infile.Collection(c.Stdin(), args[0])
+	if err != nil {
+		return err
+	}
+	t := coll.Tree(treeName)
+	if t == nil {
+		return fmt.Errorf("tree %q not found", treeName)
+	}
+	id, err := t.FindNode(nodeFlag)
+	if err != nil {
+		return fmt.Errorf("flag --node: %v", err)
+	}
+
+	sc, err := infile.Collection(c.Stdin(), args[1])
+	if err != nil {
+		return err
+	}
+	src, err := sourceTree(sc, args[1])
+	if err != nil {
+		return err
+	}
+	for _, x := range []*timetree.Tree{t, src} {
+		if err := infile.CheckUnits(x); err != nil {
+			return err
+		}
+	}
+
+	terms := t.CladeTerms(id)
+	for _, tn := range terms {
+		if _, ok := src.TaxNode(tn); !ok {
+			return fmt.Errorf("taxon %q not in source tree %q", tn, src.Name())
+		}
+	}
+	srcID := src.MRCA(terms...)
+
+	orig := dryrun.Copy(coll)
+
+	if err := t.Swap(id, src, srcID, fit); err != nil {
+		return fmt.Errorf("on tree %q: %v", treeName, err)
+	}
+	t.Format()
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, coll)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), coll); err != nil {
+		return err
+	}
+	return nil
+}
+
+func sourceTree(c *timetree.Collection, name string) (*timetree.Tree, error) {
+	if srcName != "" {
+		t := c.Tree(srcName)
+		if t == nil {
+			return nil, fmt.Errorf("flag --source: tree %q not found in %q", srcName, name)
+		}
+		return t, nil
+	}
+
+	names := c.Names()
+	if len(names) != 1 {
+		return nil, fmt.Errorf("file %q has %d trees: flag --source must be defined", name, len(names))
+	}
+	return c.Tree(names[0]), nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -7,18 +7,27 @@
 package tax
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/js-arias/command"
+	"github.com/js-arias/gbifer/gbif"
 	"github.com/js-arias/gbifer/taxonomy"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
 )
 
 var Command = &command.Command{
-	Usage: `tax [--taxonomy <file>] [--set]
-	[-o|--output <file>] <treefile>...`,
+	Usage: `tax [--taxonomy <file>] [--gbif] [--set] [--prune]
+	[--fuzzy <distance>] [-o|--output <file>] <treefile>...`,
 	Short: "validate terminal names of a tree",
 	Long: `
 Command tax reads one or more trees in TSV format and uses a taxonomy to
@@ -40,24 +49,56 @@ in the standard input. This file is a TSV file with the following columns:
 To be valid, a taxon must have "accepted" status, and with a valid rank
 (different from unranked).
 
+Use the flag --gbif to search the names of the terminals directly in the GBIF
+species API, instead of reading a taxonomy file. It requires an internet
+connection. The requests are made one at a time, with a short wait between
+requests, to avoid overloading the GBIF server. The taxa found are stored in
+the file "gbif-taxonomy.tab" of the "timetree" directory of the user cache
+directory (for example, "~/.cache/timetree" in Linux), so later searches only
+request the names not found in that file. To search all the names again,
+remove the file. Names with multiple resolutions in GBIF are reported in the
+standard error, and are treated as names not found in the taxonomy.
+
 By default, matches with synonym names will be reported to the standard error.
 Use the flag --set to change the name of the terminal to the accepted name
 from the taxonomy.
+
+By default, names not found in the taxonomy are only reported. Use the flag
+--fuzzy, with the maximum number of edits (insertions, deletions, or
+substitutions of a character), to report the names of the taxonomy that are
+similar to each absent name, for example, to find misspelled names. The genus
+and the epithet of a species are compared separately, so a candidate must
+have a similar genus and a similar epithet, and epithets that differ only in
+the gender ending (for example, "-us" and "-a") are considered equal. The
+candidates are only reported, and never used to change a name.
+
+Use the flag --prune to remove the terminals not found in the taxonomy (for
+example, to clean a tree before linking it with occurrence data). Internal
+nodes left with a single descendant are also removed, and the ages of the
+remaining nodes are not changed. At least two terminals must remain in each
+tree.
 	
-The resulting tree file will be printed on the standard output. Use the
---output, or -o flag, to define an output file.
+If the flag --set or the flag --prune is defined, the resulting tree file will
+be printed on the standard output. Use the --output, or -o flag, to define an
+output file.
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      outfile.Locked(&output, run),
 }
 
 var setFlag bool
+var pruneFlag bool
+var fuzzy int
 var taxFile string
+var gbifFlag bool
 var output string
 
 func setFlags(c *command.Command) {
 	c.Flags().BoolVar(&setFlag, "set", false, "")
+	c.Flags().BoolVar(&pruneFlag, "prune", false, "")
+	c.Flags().IntVar(&fuzzy, "fuzzy", 0, "")
 	c.Flags().StringVar(&taxFile, "taxonomy", "", "")
+	c.Flags().BoolVar(&gbifFlag, "gbif", false, "")
 	c.Flags().StringVar(&output, "output", "", "")
 	c.Flags().StringVar(&output, "o", "", "")
 }
@@ -66,35 +107,47 @@ func run(c *command.Command, args []string) error {
 	if len(args) == 0 {
 		return c.UsageError("expecting one or more tree files")
 	}
+	if fuzzy < 0 {
+		return fmt.Errorf("flag --fuzzy: invalid value %d", fuzzy)
+	}
+	if gbifFlag && taxFile != "" {
+		return c.UsageError("flags --gbif and --taxonomy can not be used together")
+	}
 
-	coll := timetree.NewCollection()
-	for _, a := range args {
-		nc, err := readCollection(a)
-		if err != nil {
-			return err
-		}
-
-		for _, tn := range nc.Names() {
-			t := nc.Tree(tn)
-			if err := coll.Add(t); err != nil {
-				return fmt.Errorf("when adding trees from %q: %v", a, err)
-			}
-		}
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
 	}
 
-	tx, err := readTaxonomy(c.Stdin())
+	orig := dryrun.Copy(coll)
+
+	var tx *taxonomy.Taxonomy
+	if gbifFlag {
+		tx, err = gbifTaxonomy(c.Stderr(), coll)
+	} else {
+		tx, err = readTaxonomy(c.Stdin())
+	}
 	if err != nil {
 		return err
 	}
 
+	var names []string
+	if fuzzy > 0 {
+		names = taxonNames(tx)
+	}
+
 	for _, tn := range coll.Names() {
 		t := coll.Tree(tn)
-		if err := validateTree(c.Stderr(), t, tx); err != nil {
+		if err := validateTree(c.Stderr(), t, tx, names); err != nil {
 			return err
 		}
 	}
 
-	if setFlag {
+	if setFlag || pruneFlag {
+		if dryrun.Enabled {
+			dryrun.Report(c.Stdout(), orig, coll)
+			return nil
+		}
 		if err := writeTrees(c.Stdout(), coll); err != nil {
 			return err
 		}
@@ -103,20 +156,6 @@ func run(c *command.Command, args []string) error {
 	return nil
 }
 
-func readCollection(name string) (*timetree.Collection, error) {
-	f, err := os.Open(name)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	c, err := timetree.ReadTSV(f)
-	if err != nil {
-		return nil, fmt.Errorf("while reading file %q: %v", name, err)
-	}
-	return c, nil
-}
-
 func readTaxonomy(r io.Reader) (*taxonomy.Taxonomy, error) {
 	if taxFile != "" {
 		f, err := os.Open(taxFile)
@@ -136,7 +175,83 @@ func readTaxonomy(r io.Reader) (*taxonomy.Taxonomy, error) {
 	return tx, nil
 }
 
-func validateTree(w io.Writer, t *timetree.Tree, tx *taxonomy.Taxonomy) error {
+// GBIFCache is the file name
+// of the taxonomy with the taxa found in GBIF,
+// in the cache directory.
+const gbifCache = "gbif-taxonomy.tab"
+
+// GBIFTaxonomy returns a taxonomy
+// with the terminal names of the trees
+// searched in GBIF.
+func gbifTaxonomy(w io.Writer, c *timetree.Collection) (*taxonomy.Taxonomy, error) {
+	dir, err := infile.CacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("flag --gbif: %v", err)
+	}
+	name := filepath.Join(dir, gbifCache)
+
+	tx := taxonomy.NewTaxonomy()
+	if f, err := os.Open(name); err == nil {
+		tx, err = taxonomy.Read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: %v", name, err)
+		}
+	}
+
+	gbif.Open()
+	seen := make(map[string]bool)
+	var added bool
+	for _, tn := range c.Names() {
+		t := c.Tree(tn)
+		for _, term := range t.Terms() {
+			n := taxonomy.Canon(term)
+			if seen[n] || len(tx.ByName(n)) > 0 {
+				continue
+			}
+			seen[n] = true
+
+			if err := tx.AddNameFromGBIF(n, taxonomy.Species); err != nil {
+				var amb *taxonomy.ErrAmbiguous
+				if errors.As(err, &amb) {
+					fmt.Fprintf(w, "gbif: %v\n", err)
+					continue
+				}
+				return nil, fmt.Errorf("flag --gbif: %v", err)
+			}
+			added = true
+		}
+	}
+	tx.Stage()
+
+	if added {
+		if err := writeCache(name, tx); err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+func writeCache(name string, tx *taxonomy.Taxonomy) (err error) {
+	f, err := outfile.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Discard()
+			return
+		}
+		err = f.Close()
+	}()
+
+	if err := tx.Write(f); err != nil {
+		return fmt.Errorf("while writing to %q: %v", name, err)
+	}
+	return nil
+}
+
+func validateTree(w io.Writer, t *timetree.Tree, tx *taxonomy.Taxonomy, names []string) error {
 	ls := t.Terms()
 
 	absent := make(map[string]bool)
@@ -204,6 +319,9 @@ func validateTree(w io.Writer, t *timetree.Tree, tx *taxonomy.Taxonomy) error {
 			if err := t.SetName(tID, tax.Name); err != nil {
 				return err
 			}
+			if dryrun.Enabled {
+				dryrun.Rename(t.Name(), term, t.Taxon(tID))
+			}
 			continue
 		}
 
@@ -230,25 +348,147 @@ func validateTree(w io.Writer, t *timetree.Tree, tx *taxonomy.Taxonomy) error {
 		for n := range absent {
 			id, _ := t.TaxNode(n)
 			fmt.Fprintf(w, "\t%s [%d]\n", n, id)
+			for _, cn := range candidates(n, names) {
+				for _, v := range tx.ByName(cn.name) {
+					fmt.Fprintf(w, "\t\tcandidate: %s [tax:%d] (distance %d)\n", cn.name, v, cn.dist)
+				}
+			}
+		}
+	}
+
+	if pruneFlag && len(absent) > 0 {
+		drop := make([]string, 0, len(absent))
+		for n := range absent {
+			drop = append(drop, n)
+		}
+		if err := t.Drop(drop...); err != nil {
+			return fmt.Errorf("flag --prune: tree %q: %v", t.Name(), err)
 		}
 	}
 
 	return nil
 }
 
+// TaxonNames returns the names
+// of the taxa in a taxonomy.
+func taxonNames(tx *taxonomy.Taxonomy) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, id := range tx.IDs() {
+		n := tx.Taxon(id).Name
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		names = append(names, n)
+	}
+	return names
+}
+
+// A candidate is a taxon name
+// similar to a name.
+type candidate struct {
+	name string
+	dist int
+}
+
+// Candidates returns the taxon names
+// similar to a name,
+// sorted by the edit distance.
+func candidates(name string, names []string) []candidate {
+	genus, epithet := splitName(name)
+
+	var cs []candidate
+	for _, n := range names {
+		g, e := splitName(n)
+		if (epithet == "") != (e == "") {
+			continue
+		}
+		d := editDistance(genus, g)
+		if d > fuzzy {
+			continue
+		}
+		if epithet != "" && stem(epithet) != stem(e) {
+			d += editDistance(epithet, e)
+		}
+		if d > fuzzy {
+			continue
+		}
+		cs = append(cs, candidate{name: n, dist: d})
+	}
+	slices.SortFunc(cs, func(a, b candidate) int {
+		if c := cmp.Compare(a.dist, b.dist); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return cs
+}
+
+// SplitName returns the genus
+// and the epithet
+// (including any infraspecific epithet)
+// of a name,
+// in lower case.
+func splitName(name string) (genus, epithet string) {
+	genus, epithet, _ = strings.Cut(strings.ToLower(taxonomy.Canon(name)), " ")
+	return genus, epithet
+}
+
+// Endings are the gender endings
+// of the Latin adjectives
+// used as epithets.
+var endings = []string{"us", "um", "is", "a", "e"}
+
+// Stem returns an epithet
+// without its gender ending.
+func stem(epithet string) string {
+	for _, e := range endings {
+		if s, ok := strings.CutSuffix(epithet, e); ok && len(s) > 2 {
+			return s
+		}
+	}
+	return epithet
+}
+
+// EditDistance returns the Levenshtein distance
+// between two strings.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
 func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
 	outName := "stdout"
 	if output != "" {
 		outName = output
-		f, err := os.Create(output)
+		var f *outfile.File
+		f, err = outfile.Create(output)
 		if err != nil {
 			return err
 		}
 		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
+			if err != nil {
+				f.Discard()
+				return
 			}
+			err = f.Close()
 		}()
 		w = f
 	}
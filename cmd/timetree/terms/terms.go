@@ -7,17 +7,22 @@
 package terms
 
 import (
+	"bufio"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"slices"
+	"strings"
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
 )
 
 var Command = &command.Command{
-	Usage: "terms [--tree <tree-name>] [<tree-file>...]",
+	Usage: `terms [--tree <tree-name>] [--ages] [--format <format>]
+	[--clades <file>] [<tree-file>...]`,
 	Short: "print a list of tree terminals from a file",
 	Long: `
 Command terms reads a tree file in TSV format and print the list of the
@@ -28,35 +33,97 @@ given, the trees will be read from the standard input.
 
 By default all terminals will be printed. If the flag --tree is set, only the
 terminals of the indicated tree will be printed.
+
+By default, the output is a list of the names of the terminals. Use the flag
+--ages to print a TSV table with the age of each terminal of each tree, with
+the following columns:
+
+	-tree    the name of the tree
+	-taxon   the name of the terminal
+	-age     the age of the terminal, in million years
+	-status  either "extant", if the terminal is at the present of the tree
+	         (age 0, or the offset of the tree), or "extinct"
+
+Use the flag --format to define a different format. Valid formats are:
+
+	list        a list of the names of the terminals (the default)
+	taxa-table  a TSV table with a row for each terminal of each tree (for
+	            example, to share the data of the terminals as a flat
+	            table)
+
+The taxa table has the following columns:
+
+	-tree    the name of the tree
+	-node    the ID of the terminal
+	-taxon   the name of the terminal
+	-age     the age of the terminal, in million years
+	-clades  the names of the clades that include the terminal, separated
+	         by commas, from the most inclusive clade
+
+followed by a column for each metadata field defined in any terminal (for
+example, the fields added with the command join). By default, the clades are
+the named internal nodes of the tree. Use the flag --clades to define a file
+with additional clades. The file is a TSV file without header, and the
+following columns:
+
+	-clade  the name of the clade
+	-taxon  the name of a taxon in the clade
+
+As in the command draw, a clade is the most recent common ancestor of the
+taxa in the clade, or, if the taxon field is empty, the node with the name of
+the clade. Lines starting with '#' are ignored.
 	`,
 	SetFlags: setFlags,
 	Run:      run,
 }
 
 var treeName string
+var agesFlag bool
+var format string
+var cladesFile string
 
 func setFlags(c *command.Command) {
 	c.Flags().StringVar(&treeName, "tree", "", "")
+	c.Flags().BoolVar(&agesFlag, "ages", false, "")
+	c.Flags().StringVar(&format, "format", "list", "")
+	c.Flags().StringVar(&cladesFile, "clades", "", "")
 }
 
 func run(c *command.Command, args []string) error {
-	coll := timetree.NewCollection()
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != "list" && format != "taxa-table" {
+		return c.UsageError(fmt.Sprintf("flag --format: unknown format %q", format))
+	}
+	if cladesFile != "" && format != "taxa-table" {
+		return c.UsageError("flag --clades requires format taxa-table")
+	}
+	if agesFlag && format != "list" {
+		return c.UsageError("flag --ages can not be used with format " + format)
+	}
 
 	if len(args) == 0 {
 		args = append(args, "-")
 	}
-	for _, a := range args {
-		nc, err := readCollection(c.Stdin(), a)
-		if err != nil {
-			return err
-		}
 
-		for _, tn := range nc.Names() {
-			t := nc.Tree(tn)
-			if err := coll.Add(t); err != nil {
-				return fmt.Errorf("when adding trees from %q: %v", a, err)
+	coll, _, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	if format == "taxa-table" {
+		var clades []clade
+		if cladesFile != "" {
+			var err error
+			clades, err = readClades()
+			if err != nil {
+				return err
 			}
 		}
+		return writeTable(c.Stdout(), coll, clades)
+	}
+
+	if agesFlag {
+		return writeAges(c.Stdout(), coll)
 	}
 
 	ls := makeList(coll)
@@ -67,25 +134,6 @@ func run(c *command.Command, args []string) error {
 	return nil
 }
 
-func readCollection(r io.Reader, name string) (*timetree.Collection, error) {
-	if name != "-" {
-		f, err := os.Open(name)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		r = f
-	} else {
-		name = "stdin"
-	}
-
-	c, err := timetree.ReadTSV(r)
-	if err != nil {
-		return nil, fmt.Errorf("while reading file %q: %v", name, err)
-	}
-	return c, nil
-}
-
 func makeList(c *timetree.Collection) []string {
 	if treeName != "" {
 		t := c.Tree(treeName)
@@ -111,3 +159,190 @@ func makeList(c *timetree.Collection) []string {
 
 	return termList
 }
+
+// A clade is a named set of taxa.
+type clade struct {
+	name string
+	taxa []string
+}
+
+func readClades() ([]clade, error) {
+	f, err := infile.Open(cladesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	var clades []clade
+	idx := make(map[string]int)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", cladesFile, ln, err)
+		}
+
+		nm := strings.Join(strings.Fields(row[0]), " ")
+		if nm == "" {
+			continue
+		}
+		i, ok := idx[nm]
+		if !ok {
+			i = len(clades)
+			idx[nm] = i
+			clades = append(clades, clade{name: nm})
+		}
+		if len(row) < 2 {
+			continue
+		}
+		if tax := strings.Join(strings.Fields(row[1]), " "); tax != "" {
+			clades[i].taxa = append(clades[i].taxa, tax)
+		}
+	}
+	return clades, nil
+}
+
+// CladeNode returns the node of a clade
+// in a tree,
+// or -1 if the clade is not in the tree.
+func cladeNode(t *timetree.Tree, cl clade) int {
+	if len(cl.taxa) == 0 {
+		id, ok := t.TaxNode(cl.name)
+		if !ok {
+			return -1
+		}
+		return id
+	}
+
+	var names []string
+	for _, tax := range cl.taxa {
+		id, ok := t.TaxNode(tax)
+		if !ok {
+			continue
+		}
+		names = append(names, t.Taxon(id))
+	}
+	if len(names) == 0 {
+		return -1
+	}
+	return t.MRCA(names...)
+}
+
+// millionYears is used to transform ages
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+func writeAges(w io.Writer, c *timetree.Collection) error {
+	names := c.Names()
+	if treeName != "" {
+		if c.Tree(treeName) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{c.Tree(treeName).Name()}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "tree\ttaxon\tage\tstatus\n")
+	for _, tn := range names {
+		t := c.Tree(tn)
+		for _, tax := range t.Terms() {
+			id, _ := t.TaxNode(tax)
+			age := t.Age(id)
+			status := "extinct"
+			if age == t.Offset() {
+				status = "extant"
+			}
+			fmt.Fprintf(bw, "%s\t%s\t%.6f\t%s\n", tn, tax, float64(age)/millionYears, status)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", "stdout", err)
+	}
+	return nil
+}
+
+func writeTable(w io.Writer, c *timetree.Collection, clades []clade) error {
+	names := c.Names()
+	if treeName != "" {
+		if c.Tree(treeName) == nil {
+			return fmt.Errorf("flag --tree: tree %q not found", treeName)
+		}
+		names = []string{c.Tree(treeName).Name()}
+	}
+
+	// metadata fields of the terminals
+	fields := make(map[string]bool)
+	for _, tn := range names {
+		t := c.Tree(tn)
+		for _, tax := range t.Terms() {
+			id, _ := t.TaxNode(tax)
+			for _, k := range t.MetaKeys(id) {
+				fields[k] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "tree\tnode\ttaxon\tage\tclades")
+	for _, k := range keys {
+		fmt.Fprintf(bw, "\t%s", k)
+	}
+	fmt.Fprintf(bw, "\n")
+
+	for _, tn := range names {
+		t := c.Tree(tn)
+
+		// clades of the file
+		in := make(map[string][]string)
+		for _, cl := range clades {
+			id := cladeNode(t, cl)
+			if id < 0 {
+				continue
+			}
+			for _, tax := range t.CladeTerms(id) {
+				in[tax] = append(in[tax], cl.name)
+			}
+		}
+
+		for _, tax := range t.Terms() {
+			id, _ := t.TaxNode(tax)
+
+			var cls []string
+			for p := t.Parent(id); p >= 0; p = t.Parent(p) {
+				if nm := t.Taxon(p); nm != "" {
+					cls = append(cls, nm)
+				}
+			}
+			slices.Reverse(cls)
+			for _, nm := range in[tax] {
+				if !slices.Contains(cls, nm) {
+					cls = append(cls, nm)
+				}
+			}
+
+			fmt.Fprintf(bw, "%s\t%d\t%s\t%.6f\t%s", tn, id, tax, float64(t.Age(id))/millionYears, strings.Join(cls, ","))
+			for _, k := range keys {
+				fmt.Fprintf(bw, "\t%s", t.Meta(id, k))
+			}
+			fmt.Fprintf(bw, "\n")
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", "stdout", err)
+	}
+	return nil
+}
@@ -0,0 +1,481 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package treedist implements a command to output
+// the distances between the trees of a collection.
+package treedist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+	"gonum.org/v1/gonum/mat"
+)
+
+var Command = &command.Command{
+	Usage: `treedist [--metric <metric>]
+	[--cluster <distance> [--split <prefix>] | --mds <dimensions>]
+	[-o|--output <file>] [<tree-file>...]`,
+	Short: "print a distance matrix of trees",
+	Long: `
+Command treedist reads one or more tree files in TSV format and prints the
+distance between each pair of trees, for example, to explore if a posterior
+sample of trees is multimodal.
+
+One or more tree files in TSV format can be given as arguments. If no file is
+given, the trees will be read from the standard input. All the trees must have
+the same terminals.
+
+By default, the distance is the Robinson-Foulds distance, i.e., the number of
+clades found in only one of the trees. Use the flag --metric to define a
+different distance. Valid metrics are:
+
+	rf  the Robinson-Foulds distance (the default)
+	bs  the branch score distance, i.e., the square root of the sum of the
+	    squared differences of the branch lengths of the clades and
+	    terminals of the trees (a clade absent in a tree has a branch of
+	    length 0), in million years
+
+By default, the output is a TSV square matrix, with a header with the name of
+each tree.
+
+Use the flag --cluster to group the trees with single-linkage clustering,
+using the given distance as the cutoff: two trees are in the same cluster if
+they are connected by a chain of trees separated by a distance equal or
+smaller than the cutoff. With this flag, the output is a TSV table with the
+following columns:
+
+	-tree     the name of the tree
+	-cluster  the number of the cluster, starting from 1, in the order in
+	          which the clusters are found
+	-size     the number of trees in the cluster
+
+Use the flag --split, with a prefix, to write the trees of each cluster in
+its own file, so each cluster can be analyzed separately (for example, the
+distinct modes of a posterior sample). The trees of each cluster will be
+written in a file with the name "<prefix>-<cluster>.tab". A summary tree of
+each cluster will be written in the file "<prefix>-summary.tab", named
+"<prefix>-<cluster>". The summary tree is a copy of the maximum clade
+credibility tree of the cluster, i.e., the tree of the cluster with the
+largest product of the frequencies of its clades in the trees of the cluster.
+The flag --split requires the flag --cluster.
+
+Use the flag --mds to calculate the coordinates of the trees with classical
+multidimensional scaling, using the given number of dimensions. With this
+flag, the output is a TSV table with a column with the name of the tree, and
+a column for each dimension (named "dim1", "dim2", ...), for example, to
+plot the trees in a scatter plot.
+
+By default the output will be printed in the standard output. To define an
+output file use the flag --output, or -o.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var metric string
+var cluster float64
+var split string
+var dims int
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().StringVar(&metric, "metric", "rf", "")
+	c.Flags().Float64Var(&cluster, "cluster", -1, "")
+	c.Flags().StringVar(&split, "split", "", "")
+	c.Flags().IntVar(&dims, "mds", 0, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) (err error) {
+	metric = strings.ToLower(strings.TrimSpace(metric))
+	if metric != "rf" && metric != "bs" {
+		return c.UsageError(fmt.Sprintf("flag --metric: unknown metric %q", metric))
+	}
+	if dims < 0 {
+		return fmt.Errorf("flag --mds: invalid value %d", dims)
+	}
+	if cluster >= 0 && dims > 0 {
+		return c.UsageError("flags --cluster and --mds are incompatible")
+	}
+	if split != "" && cluster < 0 {
+		return c.UsageError("flag --split requires flag --cluster")
+	}
+
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	coll, order, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	var trees []*timetree.Tree
+	for _, tn := range order {
+		trees = append(trees, coll.Tree(tn))
+	}
+	if len(trees) < 2 {
+		return fmt.Errorf("expecting two or more trees, got %d", len(trees))
+	}
+	if dims >= len(trees) {
+		return fmt.Errorf("flag --mds: %d dimensions for %d trees", dims, len(trees))
+	}
+
+	m, err := distances(trees)
+	if err != nil {
+		return err
+	}
+	var cl []int
+	if cluster >= 0 {
+		cl = singleLinkage(m, cluster)
+		if split != "" {
+			if err := writeSplit(trees, cl); err != nil {
+				return err
+			}
+		}
+	}
+
+	w := c.Stdout()
+	if output != "" {
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	} else {
+		output = "stdout"
+	}
+	bw := bufio.NewWriter(w)
+
+	switch {
+	case cluster >= 0:
+		writeClusters(bw, trees, cl)
+	case dims > 0:
+		writeMDS(bw, trees, mds(m, dims))
+	default:
+		writeMatrix(bw, trees, m)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing to %q: %v", output, err)
+	}
+	return nil
+}
+
+// millionYears is used to transform distances
+// (an integer in years)
+// to a float in million years.
+const millionYears = 1_000_000
+
+// Distances returns the distances
+// between each pair of trees.
+func distances(trees []*timetree.Tree) ([][]float64, error) {
+	m := make([][]float64, len(trees))
+	for i := range m {
+		m[i] = make([]float64, len(trees))
+	}
+
+	// calculate the rows concurrently
+	errs := make([]error, len(trees))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, a := range trees {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			for j := i + 1; j < len(trees); j++ {
+				d, err := distance(a, trees[j])
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				m[i][j] = d
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range trees {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for j := i + 1; j < len(trees); j++ {
+			m[j][i] = m[i][j]
+		}
+	}
+	return m, nil
+}
+
+// Distance returns the distance
+// between two trees
+// using the metric of the --metric flag.
+func distance(a, b *timetree.Tree) (float64, error) {
+	if metric == "bs" {
+		d, err := timetree.BranchScore(a, b)
+		if err != nil {
+			return 0, err
+		}
+		return d / millionYears, nil
+	}
+	d, err := timetree.RF(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return float64(d), nil
+}
+
+// SingleLinkage returns the cluster of each tree
+// using single-linkage clustering
+// with the indicated cutoff distance.
+// Clusters are numbered from 1,
+// in the order in which they are found.
+func singleLinkage(m [][]float64, cutoff float64) []int {
+	parent := make([]int, len(m))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range m {
+		for j := i + 1; j < len(m); j++ {
+			if m[i][j] > cutoff {
+				continue
+			}
+			if a, b := find(i), find(j); a != b {
+				parent[b] = a
+			}
+		}
+	}
+
+	ids := make(map[int]int)
+	cl := make([]int, len(m))
+	for i := range m {
+		r := find(i)
+		if _, ok := ids[r]; !ok {
+			ids[r] = len(ids) + 1
+		}
+		cl[i] = ids[r]
+	}
+	return cl
+}
+
+// WriteSplit writes the trees of each cluster
+// in its own file,
+// and the summary trees of the clusters.
+func writeSplit(trees []*timetree.Tree, cl []int) error {
+	var clusters [][]*timetree.Tree
+	for i, t := range trees {
+		if cl[i] > len(clusters) {
+			clusters = append(clusters, nil)
+		}
+		clusters[cl[i]-1] = append(clusters[cl[i]-1], t)
+	}
+
+	summary := timetree.NewCollection()
+	for i, ts := range clusters {
+		cc := timetree.NewCollection()
+		for _, t := range ts {
+			cc.Add(t)
+		}
+		name := fmt.Sprintf("%s-%d.tab", split, i+1)
+		if err := writeTrees(name, cc); err != nil {
+			return err
+		}
+
+		mcc := maxCladeCredibility(ts)
+		st := mcc.SubTree(mcc.Root(), fmt.Sprintf("%s-%d", split, i+1))
+		if err := summary.Add(st); err != nil {
+			return err
+		}
+	}
+
+	return writeTrees(split+"-summary.tab", summary)
+}
+
+// MaxCladeCredibility returns the tree
+// with the largest product
+// of the frequencies of its clades
+// in a set of trees.
+func maxCladeCredibility(trees []*timetree.Tree) *timetree.Tree {
+	freq := make(map[string]int)
+	for _, t := range trees {
+		for _, k := range cladeKeys(t) {
+			freq[k]++
+		}
+	}
+
+	var best *timetree.Tree
+	bestScore := math.Inf(-1)
+	for _, t := range trees {
+		var score float64
+		for _, k := range cladeKeys(t) {
+			score += math.Log(float64(freq[k]) / float64(len(trees)))
+		}
+		if score > bestScore {
+			best = t
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// CladeKeys returns the keys of the clades
+// (the internal nodes)
+// of a tree.
+func cladeKeys(t *timetree.Tree) []string {
+	var keys []string
+	for _, id := range t.Nodes() {
+		if t.IsTerm(id) {
+			continue
+		}
+		keys = append(keys, strings.Join(t.CladeTerms(id), "\n"))
+	}
+	return keys
+}
+
+// MDS returns the coordinates of the trees
+// in the indicated number of dimensions
+// using classical multidimensional scaling.
+func mds(m [][]float64, dims int) [][]float64 {
+	n := len(m)
+
+	// double centering of the squared distances
+	sq := make([]float64, n*n)
+	rows := make([]float64, n)
+	var total float64
+	for i := range m {
+		for j, d := range m[i] {
+			v := d * d
+			sq[i*n+j] = v
+			rows[i] += v
+			total += v
+		}
+	}
+	b := mat.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			v := sq[i*n+j] - rows[i]/float64(n) - rows[j]/float64(n) + total/float64(n*n)
+			b.SetSym(i, j, -v/2)
+		}
+	}
+
+	var eig mat.EigenSym
+	coords := make([][]float64, n)
+	for i := range coords {
+		coords[i] = make([]float64, dims)
+	}
+	if !eig.Factorize(b, true) {
+		return coords
+	}
+	values := eig.Values(nil)
+	var vectors mat.Dense
+	eig.VectorsTo(&vectors)
+
+	// eigenvalues are in ascending order
+	for k := 0; k < dims; k++ {
+		col := n - 1 - k
+		l := values[col]
+		if l <= 0 {
+			continue
+		}
+		s := math.Sqrt(l)
+		for i := range coords {
+			coords[i][k] = vectors.At(i, col) * s
+		}
+	}
+	return coords
+}
+
+func writeMatrix(w io.Writer, trees []*timetree.Tree, m [][]float64) {
+	fmt.Fprintf(w, "tree")
+	for _, t := range trees {
+		fmt.Fprintf(w, "\t%s", t.Name())
+	}
+	fmt.Fprintf(w, "\n")
+
+	for i, t := range trees {
+		fmt.Fprintf(w, "%s", t.Name())
+		for _, d := range m[i] {
+			if metric == "rf" {
+				fmt.Fprintf(w, "\t%d", int(d))
+				continue
+			}
+			fmt.Fprintf(w, "\t%.6f", d)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func writeClusters(w io.Writer, trees []*timetree.Tree, cl []int) {
+	size := make(map[int]int)
+	for _, c := range cl {
+		size[c]++
+	}
+
+	fmt.Fprintf(w, "tree\tcluster\tsize\n")
+	for i, t := range trees {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", t.Name(), cl[i], size[cl[i]])
+	}
+}
+
+func writeMDS(w io.Writer, trees []*timetree.Tree, coords [][]float64) {
+	fmt.Fprintf(w, "tree")
+	for k := range coords[0] {
+		fmt.Fprintf(w, "\tdim%d", k+1)
+	}
+	fmt.Fprintf(w, "\n")
+
+	for i, t := range trees {
+		fmt.Fprintf(w, "%s", t.Name())
+		for _, v := range coords[i] {
+			fmt.Fprintf(w, "\t%.6f", v)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func writeTrees(name string, c *timetree.Collection) (err error) {
+	f, err := outfile.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Discard()
+			return
+		}
+		err = f.Close()
+	}()
+
+	if err := c.TSV(f); err != nil {
+		return fmt.Errorf("while writing to %q: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package unique implements a command to remove
+// duplicated trees from a tree file.
+package unique
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/cmd/timetree/dryrun"
+	"github.com/js-arias/timetree/cmd/timetree/infile"
+	"github.com/js-arias/timetree/cmd/timetree/outfile"
+)
+
+var Command = &command.Command{
+	Usage: `unique [--report] [-o|--output <file>] <treefile>...`,
+	Short: "remove duplicated trees",
+	Long: `
+Command unique reads trees from one or more tree files in TSV format, and
+removes the duplicated trees, i.e., trees with the same topology, taxon names,
+ages, and age units. Node IDs, the order of the children of the nodes, tree
+names, and metadata other than the age unit are ignored, so two trees are
+duplicated regardless of how they were built or edited. The first tree read is
+kept, and any other copy of the tree is removed.
+
+One or more tree files must be given as arguments.
+
+Use the flag --report to print in the standard error a TSV table with the
+removed trees. The table has the following columns:
+
+	- tree  the name of the removed tree
+	- kept  the name of the kept tree
+	- hash  the hash of the trees
+
+The resulting tree file will be printed in the standard output. Use the flag
+--output, or -o, to define an output file. If the output file name ends with
+".gz", the output will be compressed with gzip.
+	`,
+	SetFlags: setFlags,
+	Run:      outfile.Locked(&output, run),
+}
+
+var report bool
+var output string
+
+func setFlags(c *command.Command) {
+	c.Flags().BoolVar(&report, "report", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting one or more tree files")
+	}
+
+	coll, order, err := infile.Trees(c, args)
+	if err != nil {
+		return err
+	}
+
+	orig := dryrun.Copy(coll)
+
+	if report {
+		fmt.Fprintf(c.Stderr(), "tree\tkept\thash\n")
+	}
+	uc := timetree.NewCollection()
+	kept := make(map[string]string)
+	for _, tn := range order {
+		t := coll.Tree(tn)
+		h := t.Hash()
+		if k, ok := kept[h]; ok {
+			if report {
+				fmt.Fprintf(c.Stderr(), "%s\t%s\t%s\n", tn, k, h)
+			}
+			continue
+		}
+		kept[h] = tn
+		if err := uc.Add(t); err != nil {
+			return err
+		}
+	}
+
+	if dryrun.Enabled {
+		dryrun.Report(c.Stdout(), orig, uc)
+		return nil
+	}
+
+	if err := writeTrees(c.Stdout(), uc); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeTrees(w io.Writer, c *timetree.Collection) (err error) {
+	outName := "stdout"
+	if output != "" {
+		outName = output
+		var f *outfile.File
+		f, err = outfile.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				f.Discard()
+				return
+			}
+			err = f.Close()
+		}()
+		w = f
+	}
+
+	if err := c.TSV(w); err != nil {
+		return fmt.Errorf("while writing to %q: %v", outName, err)
+	}
+	return nil
+}
@@ -15,17 +15,40 @@ import (
 var (
 	ErrTreeNoName   = errors.New("tree without name")
 	ErrTreeRepeated = errors.New("repeated tree name")
+	ErrTreeNotFound = errors.New("tree not found")
+	ErrSnapshot     = errors.New("invalid snapshot")
+)
+
+// SnapshotSep is the separator between a tree name
+// and the label of a snapshot
+// in the name of a snapshot tree.
+const SnapshotSep = "@"
+
+// Metadata fields of the root node
+// of a snapshot tree.
+const (
+	snapshotField   = "snapshot"
+	snapshotOfField = "snapshot-of"
 )
 
 // A Collection is a collection of phylogenetic trees.
 type Collection struct {
 	trees map[string]*Tree
+
+	// name of the first tree added
+	// with a given age unit
+	units map[string]string
+
+	// non-fatal issues found
+	// while reading the collection
+	warns warnings
 }
 
 // NewCollection returns a new empty collection.
 func NewCollection() *Collection {
 	return &Collection{
 		trees: make(map[string]*Tree),
+		units: make(map[string]string),
 	}
 }
 
@@ -33,6 +56,10 @@ func NewCollection() *Collection {
 // It will return an error if a the collection
 // has a tree with the name of the added tree
 // or the tree name is empty.
+// If the ages of the tree are in a unit
+// different from the unit of the trees
+// already in the collection,
+// a warning will be added to the collection.
 func (c *Collection) Add(t *Tree) error {
 	name := strings.ToLower(strings.Join(strings.Fields(t.Name()), " "))
 	if name == "" {
@@ -42,6 +69,15 @@ func (c *Collection) Add(t *Tree) error {
 		return fmt.Errorf("%w: %s", ErrTreeRepeated, name)
 	}
 	c.trees[name] = t
+
+	u := t.AgeUnit()
+	if _, ok := c.units[u]; !ok {
+		for ou, on := range c.units {
+			c.warns.add("tree %s: ages in %s, but tree %s has ages in %s", name, u, on, ou)
+			break
+		}
+		c.units[u] = name
+	}
 	return nil
 }
 
@@ -55,6 +91,101 @@ func (c *Collection) Names() []string {
 	return names
 }
 
+// Revert replaces a tree
+// with a copy of one of its snapshots.
+// The snapshot is kept in the collection.
+func (c *Collection) Revert(name, label string) error {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	t, ok := c.trees[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTreeNotFound, name)
+	}
+	label = snapshotLabel(label)
+	s, ok := c.trees[name+SnapshotSep+label]
+	if !ok || s.Meta(s.Root(), snapshotOfField) != name {
+		return fmt.Errorf("%w: tree %s: label %q not found", ErrSnapshot, name, label)
+	}
+
+	nt := s.Clone()
+	nt.name = t.name
+	nt.SetMeta(nt.Root(), snapshotField, "")
+	nt.SetMeta(nt.Root(), snapshotOfField, "")
+	c.trees[name] = nt
+	return nil
+}
+
+// Snapshot adds to the collection
+// a copy of a tree,
+// with a given label,
+// so the current version of the tree
+// can be recovered later with Revert.
+// The snapshot is stored as a tree
+// named with the name of the tree
+// and the label
+// (separated by SnapshotSep),
+// and the root of the snapshot
+// stores the name of the tree
+// and the label
+// as metadata.
+// A snapshot of a snapshot is not allowed.
+func (c *Collection) Snapshot(name, label string) error {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	t, ok := c.trees[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTreeNotFound, name)
+	}
+	if t.Meta(t.Root(), snapshotOfField) != "" {
+		return fmt.Errorf("%w: tree %s is a snapshot", ErrSnapshot, name)
+	}
+	label = snapshotLabel(label)
+	if label == "" || strings.Contains(label, SnapshotSep) {
+		return fmt.Errorf("%w: tree %s: invalid label %q", ErrSnapshot, name, label)
+	}
+	sn := name + SnapshotSep + label
+	if _, dup := c.trees[sn]; dup {
+		return fmt.Errorf("%w: %s", ErrTreeRepeated, sn)
+	}
+
+	s := t.Clone()
+	s.name = t.name + SnapshotSep + label
+	s.SetMeta(s.Root(), snapshotField, label)
+	s.SetMeta(s.Root(), snapshotOfField, name)
+	c.trees[sn] = s
+	return nil
+}
+
+// Snapshots returns the labels
+// of the snapshots of a tree.
+func (c *Collection) Snapshots(name string) []string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	var labels []string
+	for _, t := range c.trees {
+		if t.Meta(t.Root(), snapshotOfField) != name {
+			continue
+		}
+		labels = append(labels, t.Meta(t.Root(), snapshotField))
+	}
+	slices.Sort(labels)
+	return labels
+}
+
+// Units returns the units of the ages
+// of the trees in the collection.
+// Trees without a defined unit
+// are assumed to be in years.
+func (c *Collection) Units() []string {
+	var units []string
+	for _, t := range c.trees {
+		u := t.AgeUnit()
+		if slices.Contains(units, u) {
+			continue
+		}
+		units = append(units, u)
+	}
+	slices.Sort(units)
+	return units
+}
+
 // Tree returns a tree with a given name.
 func (c *Collection) Tree(name string) *Tree {
 	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
@@ -63,3 +194,30 @@ func (c *Collection) Tree(name string) *Tree {
 	}
 	return c.trees[name]
 }
+
+// Warnings returns the non-fatal issues
+// found while reading a collection
+// (for example,
+// a zero length branch set to one year,
+// or an ignored comment),
+// so it is possible to audit
+// the changes made during the import.
+func (c *Collection) Warnings() []string {
+	return slices.Clone(c.warns)
+}
+
+// SnapshotLabel returns a label
+// in lower case
+// and without repeated spaces.
+func snapshotLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// Warnings is a list of non-fatal issues
+// found while reading a file.
+type warnings []string
+
+// Add adds a new warning message.
+func (w *warnings) add(format string, a ...any) {
+	*w = append(*w, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,108 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// ErrDistTerms is returned when the distance
+// between two trees with different terminals
+// is requested.
+var ErrDistTerms = errors.New("trees with different terminals")
+
+// RF returns the Robinson-Foulds distance
+// between two rooted trees,
+// i.e.,
+// the number of clades
+// found in only one of the trees.
+// Both trees must have the same terminals.
+func RF(a, b *Tree) (int, error) {
+	if !slices.Equal(a.Terms(), b.Terms()) {
+		return 0, fmt.Errorf("%w: %q and %q", ErrDistTerms, a.name, b.name)
+	}
+
+	sa := a.splits()
+	sb := b.splits()
+	var d int
+	for k, n := range sa {
+		if n.isTerm() {
+			continue
+		}
+		if _, ok := sb[k]; !ok {
+			d++
+		}
+	}
+	for k, n := range sb {
+		if n.isTerm() {
+			continue
+		}
+		if _, ok := sa[k]; !ok {
+			d++
+		}
+	}
+	return d, nil
+}
+
+// BranchScore returns the branch score distance
+// (in years)
+// between two rooted trees,
+// i.e.,
+// the square root of the sum of the squared differences
+// of the branch lengths
+// of the clades and terminals of the trees,
+// in which a clade absent in a tree
+// has a branch of length 0.
+// Both trees must have the same terminals,
+// and the ages must be in the same units.
+func BranchScore(a, b *Tree) (float64, error) {
+	if !slices.Equal(a.Terms(), b.Terms()) {
+		return 0, fmt.Errorf("%w: %q and %q", ErrDistTerms, a.name, b.name)
+	}
+	if ua, ub := a.AgeUnit(), b.AgeUnit(); ua != ub {
+		return 0, fmt.Errorf("%w: %s and %s", ErrMergeUnits, ua, ub)
+	}
+
+	sa := a.splits()
+	sb := b.splits()
+	var sum float64
+	for k, n := range sa {
+		var l int64
+		if o, ok := sb[k]; ok {
+			l = o.brLen
+		}
+		d := float64(n.brLen - l)
+		sum += d * d
+	}
+	for k, n := range sb {
+		if _, ok := sa[k]; ok {
+			continue
+		}
+		d := float64(n.brLen)
+		sum += d * d
+	}
+	return math.Sqrt(sum), nil
+}
+
+// Splits returns the nodes of the tree
+// (except the root)
+// indexed by the sorted names
+// of its descendant terminals.
+func (t *Tree) splits() map[string]*node {
+	s := make(map[string]*node, len(t.nodes))
+	for _, n := range t.root.preOrder(nil) {
+		if n.parent == nil {
+			continue
+		}
+		terms := n.terms(nil)
+		slices.Sort(terms)
+		s[strings.Join(terms, "\n")] = n
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/timetree"
+)
+
+var otherDinos = `other	0	-1	235000000	
+other	1	0	230000000	Eoraptor lunensis
+other	2	0	230000000	
+other	3	2	170000000	
+other	4	3	145000000	Ceratosaurus nasicornis
+other	5	3	71000000	Carnotaurus sastrei
+other	6	2	170000000	
+other	7	6	160000000	
+other	8	7	68000000	Tyrannosaurus rex
+other	9	7	150000000	Archaeopteryx lithographica
+other	10	6	0	Passer domesticus
+`
+
+func TestDistance(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree + otherDinos))
+	if err != nil {
+		t.Fatalf("distance: unexpected error: %v", err)
+	}
+	a := c.Tree("dinos")
+	b := c.Tree("other")
+
+	tests := map[string]struct {
+		a, b *timetree.Tree
+		rf   int
+		bs   float64
+	}{
+		"same tree": {
+			a: a,
+			b: a.Clone(),
+		},
+		"different trees": {
+			a:  a,
+			b:  b,
+			rf: 2,
+			bs: 20_000_000,
+		},
+		"symmetric": {
+			a:  b,
+			b:  a,
+			rf: 2,
+			bs: 20_000_000,
+		},
+	}
+
+	for name, test := range tests {
+		rf, err := timetree.RF(test.a, test.b)
+		if err != nil {
+			t.Errorf("%s: rf: unexpected error: %v", name, err)
+			continue
+		}
+		if rf != test.rf {
+			t.Errorf("%s: rf: got %d, want %d", name, rf, test.rf)
+		}
+
+		bs, err := timetree.BranchScore(test.a, test.b)
+		if err != nil {
+			t.Errorf("%s: branch score: unexpected error: %v", name, err)
+			continue
+		}
+		if bs != test.bs {
+			t.Errorf("%s: branch score: got %.6f, want %.6f", name, bs, test.bs)
+		}
+	}
+
+	p := a.Clone()
+	if err := p.Drop("Eoraptor lunensis"); err != nil {
+		t.Fatalf("distance: unexpected error: %v", err)
+	}
+	if _, err := timetree.RF(a, p); !errors.Is(err, timetree.ErrDistTerms) {
+		t.Errorf("distance: rf: got error %v, want %v", err, timetree.ErrDistTerms)
+	}
+	if _, err := timetree.BranchScore(a, p); !errors.Is(err, timetree.ErrDistTerms) {
+		t.Errorf("distance: branch score: got error %v, want %v", err, timetree.ErrDistTerms)
+	}
+}
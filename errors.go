@@ -0,0 +1,132 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Reading error categories.
+// Any error returned by a reader
+// (ReadTSV, ReadJSON, Newick, Nexus, NeXML, or PhyloXML)
+// wraps one of these errors,
+// so an application can use errors.Is
+// to distinguish a bad file
+// from a bad tree,
+// or from a failure of the input stream.
+var (
+	// ErrSyntax is returned when the input
+	// is not a well formed file
+	// of the expected format.
+	ErrSyntax = errors.New("syntax error")
+
+	// ErrInvalidTree is returned when the input
+	// is well formed,
+	// but it defines an invalid tree
+	// (for example, a node older than its parent).
+	ErrInvalidTree = errors.New("invalid tree")
+
+	// ErrIO is returned when the input
+	// can not be read.
+	ErrIO = errors.New("input error")
+)
+
+// SemanticErrs are the errors
+// that indicate an invalid tree.
+var semanticErrs = []error{
+	ErrAddNoParent,
+	ErrAddRepeated,
+	ErrAddInvalidBrLen,
+	ErrAddNoSister,
+	ErrAddRootSister,
+	ErrValSingleChild,
+	ErrValUnnamedTerm,
+	ErrInvalidRootAge,
+	ErrInvalidOffset,
+	ErrOlderAge,
+	ErrYoungerAge,
+	ErrMetaKey,
+	ErrOrderChildren,
+	ErrTreeNoName,
+	ErrTreeRepeated,
+}
+
+// SyntaxErrs are the errors
+// that indicate a bad formed file.
+var syntaxErrs = []error{
+	ErrNotNewick,
+	ErrUnexpBrLen,
+	ErrNotNeXML,
+	ErrNotPhyloXML,
+	io.EOF,
+	io.ErrUnexpectedEOF,
+	gzip.ErrHeader,
+	gzip.ErrChecksum,
+}
+
+// ReadError wraps an error returned by a reader
+// with its category.
+// If the error is already categorized,
+// it is returned as is.
+// Errors not recognized as syntax
+// or tree errors
+// are considered as input errors.
+func readError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrSyntax) || errors.Is(err, ErrInvalidTree) || errors.Is(err, ErrIO) {
+		return err
+	}
+
+	if isSyntax(err) {
+		return fmt.Errorf("%w: %w", ErrSyntax, err)
+	}
+	for _, e := range semanticErrs {
+		if errors.Is(err, e) {
+			return fmt.Errorf("%w: %w", ErrInvalidTree, err)
+		}
+	}
+	return fmt.Errorf("%w: %w", ErrIO, err)
+}
+
+// IsSyntax returns true if the error
+// is produced by a bad formed file.
+func isSyntax(err error) bool {
+	for _, e := range syntaxErrs {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	var csvErr *csv.ParseError
+	var numErr *strconv.NumError
+	var jsonErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var xmlErr *xml.SyntaxError
+	var unmarshalErr xml.UnmarshalError
+	switch {
+	case errors.As(err, &csvErr):
+		return true
+	case errors.As(err, &numErr):
+		return true
+	case errors.As(err, &jsonErr):
+		return true
+	case errors.As(err, &typeErr):
+		return true
+	case errors.As(err, &xmlErr):
+		return true
+	case errors.As(err, &unmarshalErr):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/js-arias/timetree"
+)
+
+func TestReadErrors(t *testing.T) {
+	readTSV := func(r io.Reader) error {
+		_, err := timetree.ReadTSV(r)
+		return err
+	}
+	readJSON := func(r io.Reader) error {
+		_, err := timetree.ReadJSON(r)
+		return err
+	}
+	readNewick := func(r io.Reader) error {
+		_, err := timetree.Newick(r, "tree", 0)
+		return err
+	}
+	readNexus := func(r io.Reader) error {
+		_, err := timetree.Nexus(r, 0)
+		return err
+	}
+	readNeXML := func(r io.Reader) error {
+		_, err := timetree.NeXML(r, 0)
+		return err
+	}
+	readPhyloXML := func(r io.Reader) error {
+		_, err := timetree.PhyloXML(r, 0)
+		return err
+	}
+
+	tests := map[string]struct {
+		read func(io.Reader) error
+		in   string
+		err  error
+	}{
+		"tsv: missing field": {
+			read: readTSV,
+			in:   "tree\tnode\tparent\tage\n",
+			err:  timetree.ErrSyntax,
+		},
+		"tsv: invalid node ID": {
+			read: readTSV,
+			in:   "tree\tnode\tparent\tage\ttaxon\nx\tone\t-1\t10\t\n",
+			err:  timetree.ErrSyntax,
+		},
+		"tsv: missing parent": {
+			read: readTSV,
+			in:   "tree\tnode\tparent\tage\ttaxon\nx\t0\t-1\t10\t\nx\t1\t5\t5\tA\n",
+			err:  timetree.ErrInvalidTree,
+		},
+		"tsv: repeated root": {
+			read: readTSV,
+			in:   "tree\tnode\tparent\tage\ttaxon\nx\t0\t-1\t10\t\nx\t1\t-1\t5\tA\n",
+			err:  timetree.ErrInvalidTree,
+		},
+		"json: bad document": {
+			read: readJSON,
+			in:   `{"trees": [`,
+			err:  timetree.ErrSyntax,
+		},
+		"json: undefined root": {
+			read: readJSON,
+			in:   `{"trees": [{"name": "x", "nodes": []}]}`,
+			err:  timetree.ErrInvalidTree,
+		},
+		"newick: not a tree": {
+			read: readNewick,
+			in:   "no tree",
+			err:  timetree.ErrSyntax,
+		},
+		"newick: incomplete tree": {
+			read: readNewick,
+			in:   "((A:1,B:1):2,C",
+			err:  timetree.ErrSyntax,
+		},
+		"newick: invalid branch length": {
+			read: readNewick,
+			in:   "(A:x,B:1);",
+			err:  timetree.ErrSyntax,
+		},
+		"newick: repeated terminal": {
+			read: readNewick,
+			in:   "(A:1,(A:1,B:1):1);",
+			err:  timetree.ErrInvalidTree,
+		},
+		"nexus: bad header": {
+			read: readNexus,
+			in:   "#nexml",
+			err:  timetree.ErrSyntax,
+		},
+		"nexml: not a nexml file": {
+			read: readNeXML,
+			in:   "(A,B);",
+			err:  timetree.ErrSyntax,
+		},
+		"phyloxml: without clades": {
+			read: readPhyloXML,
+			in:   "<phyloxml><phylogeny></phylogeny></phyloxml>",
+			err:  timetree.ErrInvalidTree,
+		},
+	}
+
+	for name, test := range tests {
+		err := test.read(strings.NewReader(test.in))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", name, err, test.err)
+		}
+	}
+
+	// input errors
+	ioErr := errors.New("broken input")
+	readers := map[string]func(io.Reader) error{
+		"tsv":      readTSV,
+		"json":     readJSON,
+		"newick":   readNewick,
+		"nexus":    readNexus,
+		"nexml":    readNeXML,
+		"phyloxml": readPhyloXML,
+	}
+	for name, read := range readers {
+		err := read(iotest.ErrReader(ioErr))
+		if !errors.Is(err, timetree.ErrIO) || !errors.Is(err, ioErr) {
+			t.Errorf("%s: input error: got error %v, want %v", name, err, timetree.ErrIO)
+		}
+	}
+}
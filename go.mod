@@ -5,7 +5,11 @@ go 1.22
 require (
 	github.com/js-arias/command v0.0.0-20220321160405-bad66700a180
 	github.com/js-arias/gbifer v0.0.0-20230905173919-aa63af247b21
+	golang.org/x/image v0.18.0
 	gonum.org/v1/gonum v0.14.0
 )
 
-require golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
+require (
+	golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)
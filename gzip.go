@@ -0,0 +1,36 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// gzipMagic are the first bytes of a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Decompress returns a reader
+// that decompress the content of r
+// if it is a gzip stream,
+// detected by its magic bytes.
+// Otherwise it returns a reader
+// with the content of r.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+
+	z, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("while reading gzip data: %w", err)
+	}
+	return z, nil
+}
@@ -0,0 +1,237 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ReadJSON reads one or more phylogenetic trees
+// from a JSON document.
+//
+// The document must be an object
+// with a "trees" array.
+// Each tree is an object with the following fields:
+//
+//	-name, for the name of the tree
+//	-offset, the age of the present for the tree
+//	    (optional, in years, see Tree.SetOffset)
+//	-nodes, an array with the nodes of the tree
+//
+// Each node is an object with the following fields:
+//
+//	-id, for the ID of the node
+//	-parent, for the ID of the parent node
+//	    (-1 is used for the root)
+//	-age, the age of the node (in years)
+//	-taxon, the taxonomic name of the node
+//	    (optional)
+//	-order, the position of the node among its siblings
+//	    (optional, see Tree.SetOrder)
+//	-meta, an object with the metadata fields of the node
+//	    (optional)
+//
+// As in a TSV file,
+// parent nodes should be defined
+// before any children node,
+// and terminal nodes should have a unique taxonomic name.
+//
+// Here is an example document:
+//
+//	{
+//		"trees": [
+//			{
+//				"name": "dinosaurs",
+//				"nodes": [
+//					{"id": 0, "parent": -1, "age": 235000000},
+//					{"id": 1, "parent": 0, "age": 230000000, "taxon": "Eoraptor lunensis"},
+//					{"id": 2, "parent": 0, "age": 170000000},
+//					{"id": 3, "parent": 2, "age": 145000000, "taxon": "Ceratosaurus nasicornis"},
+//					{"id": 4, "parent": 2, "age": 71000000, "taxon": "Carnotaurus sastrei"}
+//				]
+//			}
+//		]
+//	}
+//
+// Any returned error wraps either ErrSyntax,
+// ErrInvalidTree,
+// or ErrIO.
+func ReadJSON(r io.Reader) (*Collection, error) {
+	c, err := readJSON(r)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return c, nil
+}
+
+func readJSON(r io.Reader) (*Collection, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc jsonDoc
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("while reading data: %w", err)
+	}
+
+	c := NewCollection()
+	for _, jt := range doc.Trees {
+		t, err := jt.tree()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Add(t); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// JSON encodes a collection of phylogenetic trees
+// into a JSON document,
+// using the schema described in ReadJSON.
+func (c *Collection) JSON(w io.Writer) error {
+	doc := jsonDoc{
+		Trees: []jsonTree{},
+	}
+	for _, nm := range c.Names() {
+		t := c.trees[nm]
+		jt := jsonTree{
+			Name:   t.name,
+			Offset: t.offset,
+			Nodes:  make([]jsonNode, 0, len(t.nodes)),
+		}
+		for _, n := range t.preOrder(nil, t.root) {
+			jn := jsonNode{
+				ID:     n.id,
+				Parent: -1,
+				Age:    n.age,
+				Taxon:  n.taxon,
+			}
+			if n.parent != nil {
+				jn.Parent = n.parent.id
+				if n.parent.fixed {
+					o := slices.Index(n.parent.children, n)
+					jn.Order = &o
+				}
+			}
+			if len(n.meta) > 0 {
+				jn.Meta = n.meta
+			}
+			jt.Nodes = append(jt.Nodes, jn)
+		}
+		doc.Trees = append(doc.Trees, jt)
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	if err := e.Encode(doc); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+type jsonDoc struct {
+	Trees []jsonTree `json:"trees"`
+}
+
+type jsonTree struct {
+	Name   string     `json:"name"`
+	Offset int64      `json:"offset,omitempty"`
+	Nodes  []jsonNode `json:"nodes"`
+}
+
+type jsonNode struct {
+	ID     int               `json:"id"`
+	Parent int               `json:"parent"`
+	Age    int64             `json:"age"`
+	Taxon  string            `json:"taxon,omitempty"`
+	Order  *int              `json:"order,omitempty"`
+	Meta   map[string]string `json:"meta,omitempty"`
+}
+
+func (jt jsonTree) tree() (*Tree, error) {
+	name := strings.ToLower(strings.Join(strings.Fields(jt.Name), " "))
+	if name == "" {
+		return nil, ErrTreeNoName
+	}
+
+	t := &Tree{
+		name:  name,
+		nodes: make(map[int]*node, len(jt.Nodes)),
+		taxa:  make(map[string]*node),
+	}
+	order := make(map[*node]int)
+	for _, jn := range jt.Nodes {
+		if _, dup := t.nodes[jn.ID]; dup {
+			return nil, fmt.Errorf("%w: tree %s: node %d: node ID already used", ErrInvalidTree, name, jn.ID)
+		}
+
+		var p *node
+		if jn.Parent >= 0 {
+			var ok bool
+			p, ok = t.nodes[jn.Parent]
+			if !ok {
+				return nil, fmt.Errorf("tree %s: node %d: %w: %d", name, jn.ID, ErrAddNoParent, jn.Parent)
+			}
+		} else if t.root != nil {
+			return nil, fmt.Errorf("%w: tree %s: node %d: root already defined", ErrInvalidTree, name, jn.ID)
+		}
+
+		if p != nil && p.age < jn.Age {
+			return nil, fmt.Errorf("tree %s: node %d: %w: age %d, parent age %d", name, jn.ID, ErrOlderAge, jn.Age, p.age)
+		}
+
+		tax := canon(jn.Taxon)
+		if tax != "" {
+			if _, dup := t.taxa[tax]; dup {
+				return nil, fmt.Errorf("tree %s: node %d: %w: %s", name, jn.ID, ErrAddRepeated, tax)
+			}
+		}
+
+		n := &node{
+			id:     jn.ID,
+			parent: p,
+			age:    jn.Age,
+			taxon:  tax,
+		}
+		t.nodes[n.id] = n
+		if p != nil {
+			p.children = append(p.children, n)
+			n.brLen = p.age - n.age
+			if jn.Order != nil {
+				order[n] = *jn.Order
+				p.fixed = true
+			}
+		} else {
+			t.root = n
+		}
+		if n.taxon != "" {
+			t.taxa[n.taxon] = n
+		}
+
+		for k, v := range jn.Meta {
+			n.setMeta(metaKey(k), v)
+		}
+	}
+	if t.root == nil {
+		return nil, fmt.Errorf("%w: tree %s: undefined root node", ErrInvalidTree, name)
+	}
+
+	t.root.setRotation()
+	t.fixOrder(order)
+	t.Format()
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("tree %s: %w", name, err)
+	}
+	if err := t.SetOffset(jt.Offset); err != nil {
+		return nil, fmt.Errorf("tree %s: %w", name, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,94 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/timetree"
+)
+
+var jsonTest = `{
+	"trees": [
+		{
+			"name": "Dinosaurs",
+			"nodes": [
+				{"id": 0, "parent": -1, "age": 235000000},
+				{"id": 1, "parent": 0, "age": 230000000, "taxon": "Eoraptor lunensis"},
+				{"id": 2, "parent": 0, "age": 170000000, "meta": {"Posterior": "0.95"}},
+				{"id": 3, "parent": 2, "age": 145000000, "taxon": "Ceratosaurus nasicornis"},
+				{"id": 4, "parent": 2, "age": 71000000, "taxon": "Carnotaurus sastrei"}
+			]
+		}
+	]
+}`
+
+func TestReadJSON(t *testing.T) {
+	c, err := timetree.ReadJSON(strings.NewReader(jsonTest))
+	if err != nil {
+		t.Fatalf("json: unexpected error: %v", err)
+	}
+	tr := c.Tree("dinosaurs")
+	if tr == nil {
+		t.Fatalf("json: tree %q not found", "dinosaurs")
+	}
+
+	want := []string{"Carnotaurus sastrei", "Ceratosaurus nasicornis", "Eoraptor lunensis"}
+	if got := tr.Terms(); !reflect.DeepEqual(got, want) {
+		t.Errorf("json: terms: got %v, want %v", got, want)
+	}
+	if got := tr.Age(tr.MRCA("Carnotaurus sastrei", "Ceratosaurus nasicornis")); got != 170_000_000 {
+		t.Errorf("json: age: got %d, want %d", got, 170_000_000)
+	}
+	if got := tr.Meta(tr.MRCA("Carnotaurus sastrei", "Ceratosaurus nasicornis"), "posterior"); got != "0.95" {
+		t.Errorf("json: metadata: got %q, want %q", got, "0.95")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("json: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+	d.SetMeta(8, "posterior", "0.95")
+	d.Rotate(0)
+	d.Format()
+
+	var buf bytes.Buffer
+	if err := c.JSON(&buf); err != nil {
+		t.Fatalf("json: while writing data: %v", err)
+	}
+
+	nc, err := timetree.ReadJSON(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("json: while reading data: %v", err)
+	}
+	nt := nc.Tree("dinos")
+	if nt == nil {
+		t.Fatalf("json: tree %q not found", "dinos")
+	}
+	for _, id := range d.Nodes() {
+		got := getNode(nt, id)
+		want := getNode(d, id)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("json: node %d: got %v, want %v", id, got, want)
+		}
+		if got, want := nt.Meta(id, "posterior"), d.Meta(id, "posterior"); got != want {
+			t.Errorf("json: node %d: metadata: got %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestReadJSONError(t *testing.T) {
+	doc := `{"trees": [{"name": "bad", "nodes": [{"id": 0, "parent": -1, "age": 10}, {"id": 1, "parent": 5, "age": 0, "taxon": "a"}]}]}`
+	if _, err := timetree.ReadJSON(strings.NewReader(doc)); !errors.Is(err, timetree.ErrAddNoParent) {
+		t.Errorf("json: got error %v, want %v", err, timetree.ErrAddNoParent)
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package layout calculates the coordinates
+// used to draw a time calibrated tree.
+//
+// The layout is independent of any graphics library,
+// so it can be used to render a tree
+// with any drawing tool.
+package layout
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/js-arias/timetree"
+)
+
+// Default values for the layout options.
+const (
+	// DefaultXStep is the default number of units
+	// per time scale unit.
+	DefaultXStep = 10
+
+	// DefaultYStep is the default number of units
+	// between two consecutive terminals.
+	DefaultYStep = 12
+
+	// DefaultScale is the default time scale
+	// (in years),
+	// i.e., million years.
+	DefaultScale = 1_000_000
+)
+
+// Options are the parameters used to build a layout.
+type Options struct {
+	// XStep is the number of units
+	// per time scale unit.
+	// If zero,
+	// DefaultXStep will be used.
+	XStep float64
+
+	// YStep is the number of units
+	// between two consecutive terminals.
+	// If zero,
+	// DefaultYStep will be used.
+	YStep float64
+
+	// Scale is the time scale unit
+	// (in years).
+	// If zero,
+	// DefaultScale will be used.
+	Scale float64
+
+	// Order is an external order for the terminals
+	// (for example, latitude, or stratigraphic position).
+	// If defined,
+	// the nodes will be rotated
+	// so the order of the terminals
+	// is as close as possible to the external order.
+	// Terminals with smaller values will be placed first,
+	// and terminals without a value
+	// will be placed after terminals with values.
+	Order map[string]float64
+
+	// Collapse are the IDs of the internal nodes
+	// that will be collapsed,
+	// i.e., the node will be removed from the layout
+	// and its children will be attached
+	// to the parent of the node,
+	// making a polytomy.
+	// The root is never collapsed.
+	Collapse map[int]bool
+
+	// Triangles are the IDs of the internal nodes
+	// that will be drawn as triangles,
+	// i.e., all the descendants of the node
+	// will be removed from the layout,
+	// and the node will be placed
+	// in a single row,
+	// as a terminal.
+	// If a triangle is inside another triangle,
+	// only the outer triangle is used.
+	Triangles map[int]bool
+}
+
+// A Node is a node of a tree layout.
+type Node struct {
+	// ID is the ID of the node in the tree.
+	ID int
+
+	// Parent is the ID of the parent node.
+	// It is -1 for the root.
+	// If the parent was collapsed,
+	// it is the ID of the first ancestor
+	// that is not collapsed.
+	Parent int
+
+	// Taxon is the taxon name of the node.
+	Taxon string
+
+	// Age is the age of the node
+	// (in years).
+	Age int64
+
+	// X and Y are the coordinates of the node.
+	// X grows from the root
+	// (at X = 0)
+	// to the present,
+	// and Y grows from the first terminal
+	// (at Y = 0)
+	// to the last terminal.
+	X, Y float64
+
+	// Top and Bottom are the Y coordinates
+	// of the first and last children of the node.
+	// For terminals,
+	// they are equal to Y.
+	Top, Bottom float64
+
+	// Children are the IDs of the children of the node
+	// in drawing order.
+	Children []int
+
+	// Triangle is true
+	// if the node is drawn as a triangle.
+	Triangle bool
+
+	// Terms is the number of terminals
+	// descendant from a triangle node.
+	Terms int
+
+	// MinAge is the age of the youngest descendant
+	// of a triangle node
+	// (in years).
+	MinAge int64
+}
+
+// A Layout is a set of nodes
+// with coordinates
+// used to draw a tree.
+type Layout struct {
+	// Nodes are the nodes of the tree
+	// in pre-order
+	// (i.e., a node is always
+	// before its descendants).
+	Nodes []Node
+
+	// Width and Height are the size of the layout.
+	Width, Height float64
+
+	// RootAge is the age of the root
+	// (in years).
+	RootAge int64
+
+	// MinAge is the age of the youngest node,
+	// or the offset of the tree,
+	// if it is younger
+	// (in years).
+	MinAge int64
+
+	xStep float64
+	scale float64
+}
+
+// Rectangular returns a rectangular layout of a tree,
+// in which the nodes are placed
+// at the X coordinate defined by its age,
+// terminals are placed in consecutive Y coordinates,
+// and internal nodes are placed
+// at the middle of its first and last children.
+func Rectangular(t *timetree.Tree, opts Options) Layout {
+	if opts.XStep == 0 {
+		opts.XStep = DefaultXStep
+	}
+	if opts.YStep == 0 {
+		opts.YStep = DefaultYStep
+	}
+	if opts.Scale == 0 {
+		opts.Scale = DefaultScale
+	}
+
+	root := t.Root()
+	l := Layout{
+		RootAge: t.Age(root),
+		MinAge:  t.Age(root),
+		xStep:   opts.XStep,
+		scale:   opts.Scale,
+	}
+
+	children := make(map[int][]int)
+	parent := make(map[int]int)
+	for _, id := range t.Nodes() {
+		children[id] = t.Children(id)
+		parent[id] = t.Parent(id)
+		if a := t.Age(id); a < l.MinAge {
+			l.MinAge = a
+		}
+	}
+
+	if len(opts.Collapse) > 0 {
+		collapse(root, children, parent, opts.Collapse)
+	}
+
+	// the time scale ends at the offset of the tree
+	if off := t.Offset(); off > 0 && off < l.MinAge {
+		l.MinAge = off
+	}
+
+	if len(opts.Order) > 0 {
+		rotate(t, preOrder(root, children), children, opts.Order)
+	}
+
+	triangles := make(map[int]Node)
+	if len(opts.Triangles) > 0 {
+		triangles = makeTriangles(root, children, opts.Triangles, t)
+	}
+
+	ids := preOrder(root, children)
+	index := make(map[int]int, len(ids))
+	l.Nodes = make([]Node, len(ids))
+	var y float64
+	for i, id := range ids {
+		index[id] = i
+		n := Node{
+			ID:       id,
+			Parent:   parent[id],
+			Taxon:    t.Taxon(id),
+			Age:      t.Age(id),
+			X:        l.X(t.Age(id)),
+			Children: children[id],
+		}
+		if tr, ok := triangles[id]; ok {
+			n.Triangle = true
+			n.Terms = tr.Terms
+			n.MinAge = tr.MinAge
+		}
+		if len(n.Children) == 0 {
+			n.Y = y
+			n.Top = y
+			n.Bottom = y
+			y += opts.YStep
+		}
+		l.Nodes[i] = n
+	}
+
+	// in reverse pre-order
+	// children are visited before their parents
+	for i := len(l.Nodes) - 1; i >= 0; i-- {
+		n := &l.Nodes[i]
+		if len(n.Children) == 0 {
+			continue
+		}
+		n.Top = l.Nodes[index[n.Children[0]]].Y
+		n.Bottom = l.Nodes[index[n.Children[len(n.Children)-1]]].Y
+		n.Y = n.Top + (n.Bottom-n.Top)/2
+	}
+
+	l.Width = l.X(l.MinAge)
+	l.Height = y
+	return l
+}
+
+// X returns the X coordinate
+// of a given age
+// (in years).
+func (l Layout) X(age int64) float64 {
+	return float64(l.RootAge-age) / l.scale * l.xStep
+}
+
+// PreOrder returns the IDs of the nodes
+// in pre-order.
+func preOrder(root int, children map[int][]int) []int {
+	var ids []int
+	stack := []int{root}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ids = append(ids, id)
+		c := children[id]
+		for i := len(c) - 1; i >= 0; i-- {
+			stack = append(stack, c[i])
+		}
+	}
+	return ids
+}
+
+// Collapse removes the collapsed nodes,
+// attaching its children to the parent of the node.
+func collapse(root int, children map[int][]int, parent map[int]int, nodes map[int]bool) {
+	for _, id := range preOrder(root, children) {
+		if id == root || !nodes[id] || len(children[id]) == 0 {
+			continue
+		}
+
+		p := parent[id]
+		desc := make([]int, 0, len(children[p])+len(children[id]))
+		for _, c := range children[p] {
+			if c != id {
+				desc = append(desc, c)
+				continue
+			}
+			desc = append(desc, children[id]...)
+		}
+		children[p] = desc
+		for _, c := range children[id] {
+			parent[c] = p
+		}
+		delete(children, id)
+	}
+}
+
+// MakeTriangles removes the descendants of the triangle nodes,
+// and returns the number of terminals
+// and the age of the youngest descendant
+// of each triangle.
+func makeTriangles(root int, children map[int][]int, nodes map[int]bool, t *timetree.Tree) map[int]Node {
+	triangles := make(map[int]Node)
+	hidden := make(map[int]bool)
+	for _, id := range preOrder(root, children) {
+		if hidden[id] || !nodes[id] || len(children[id]) == 0 {
+			continue
+		}
+
+		tr := Node{MinAge: t.Age(id)}
+		for _, d := range preOrder(id, children) {
+			if d == id {
+				continue
+			}
+			hidden[d] = true
+			if len(children[d]) == 0 {
+				tr.Terms++
+			}
+			if a := t.Age(d); a < tr.MinAge {
+				tr.MinAge = a
+			}
+		}
+		triangles[id] = tr
+		children[id] = nil
+	}
+	return triangles
+}
+
+// Rotate sorts the children of each node
+// using the mean of the external order values
+// of their terminals.
+func rotate(t *timetree.Tree, ids []int, children map[int][]int, order map[string]float64) {
+	sum := make(map[int]float64, len(ids))
+	count := make(map[int]int, len(ids))
+	for tax, v := range order {
+		id, ok := t.TaxNode(tax)
+		if !ok || len(children[id]) > 0 {
+			continue
+		}
+		sum[id] = v
+		count[id] = 1
+	}
+
+	// in reverse pre-order
+	// children are visited before their parents
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		desc := children[id]
+		if len(desc) == 0 {
+			continue
+		}
+
+		for _, d := range desc {
+			sum[id] += sum[d]
+			count[id] += count[d]
+		}
+		slices.SortStableFunc(desc, func(a, b int) int {
+			if count[a] == 0 || count[b] == 0 {
+				// nodes without values go last
+				if count[a] > 0 {
+					return -1
+				}
+				if count[b] > 0 {
+					return 1
+				}
+				return 0
+			}
+			return cmp.Compare(sum[a]/float64(count[a]), sum[b]/float64(count[b]))
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package layout_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/layout"
+)
+
+var tree = "(Gallus_gallus:324,(Macropus_fuliginosus:176,(Macaca_mulatta:25,'homo  sapiens':25):151):148);"
+
+type coords struct {
+	x, y        float64
+	top, bottom float64
+}
+
+func TestRectangular(t *testing.T) {
+	c, err := timetree.Newick(strings.NewReader(tree), "mammals", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tr := c.Tree("mammals")
+
+	tests := map[string]struct {
+		opts   layout.Options
+		order  []int
+		coords map[int]coords
+		width  float64
+		height float64
+
+		// parents of nodes
+		// with a collapsed parent
+		parents map[int]int
+
+		// terminals of triangle nodes
+		terms map[int]int
+	}{
+		"default": {
+			order: []int{0, 1, 2, 3, 4, 5, 6},
+			coords: map[int]coords{
+				0: {x: 0, y: 10.5, top: 0, bottom: 21},
+				1: {x: 3240, y: 0, top: 0, bottom: 0},
+				2: {x: 1480, y: 21, top: 12, bottom: 30},
+				3: {x: 3240, y: 12, top: 12, bottom: 12},
+				4: {x: 2990, y: 30, top: 24, bottom: 36},
+				5: {x: 3240, y: 24, top: 24, bottom: 24},
+				6: {x: 3240, y: 36, top: 36, bottom: 36},
+			},
+			width:  3240,
+			height: 48,
+		},
+		"steps": {
+			opts:  layout.Options{XStep: 1, YStep: 2},
+			order: []int{0, 1, 2, 3, 4, 5, 6},
+			coords: map[int]coords{
+				0: {x: 0, y: 1.75, top: 0, bottom: 3.5},
+				1: {x: 324, y: 0, top: 0, bottom: 0},
+				2: {x: 148, y: 3.5, top: 2, bottom: 5},
+				3: {x: 324, y: 2, top: 2, bottom: 2},
+				4: {x: 299, y: 5, top: 4, bottom: 6},
+				5: {x: 324, y: 4, top: 4, bottom: 4},
+				6: {x: 324, y: 6, top: 6, bottom: 6},
+			},
+			width:  324,
+			height: 8,
+		},
+		"order": {
+			opts: layout.Options{
+				Order: map[string]float64{
+					"gallus gallus": 3,
+					"Homo sapiens":  1,
+				},
+			},
+			order: []int{0, 2, 4, 5, 6, 3, 1},
+			coords: map[int]coords{
+				0: {x: 0, y: 25.5, top: 15, bottom: 36},
+				1: {x: 3240, y: 36, top: 36, bottom: 36},
+				2: {x: 1480, y: 15, top: 6, bottom: 24},
+				3: {x: 3240, y: 24, top: 24, bottom: 24},
+				4: {x: 2990, y: 6, top: 0, bottom: 12},
+				5: {x: 3240, y: 0, top: 0, bottom: 0},
+				6: {x: 3240, y: 12, top: 12, bottom: 12},
+			},
+			width:  3240,
+			height: 48,
+		},
+		"collapse": {
+			opts:  layout.Options{Collapse: map[int]bool{2: true}},
+			order: []int{0, 1, 3, 4, 5, 6},
+			coords: map[int]coords{
+				0: {x: 0, y: 15, top: 0, bottom: 30},
+				1: {x: 3240, y: 0, top: 0, bottom: 0},
+				3: {x: 3240, y: 12, top: 12, bottom: 12},
+				4: {x: 2990, y: 30, top: 24, bottom: 36},
+				5: {x: 3240, y: 24, top: 24, bottom: 24},
+				6: {x: 3240, y: 36, top: 36, bottom: 36},
+			},
+			width:   3240,
+			height:  48,
+			parents: map[int]int{3: 0, 4: 0},
+		},
+		"triangle": {
+			opts:  layout.Options{Triangles: map[int]bool{4: true, 5: true}},
+			order: []int{0, 1, 2, 3, 4},
+			coords: map[int]coords{
+				0: {x: 0, y: 9, top: 0, bottom: 18},
+				1: {x: 3240, y: 0, top: 0, bottom: 0},
+				2: {x: 1480, y: 18, top: 12, bottom: 24},
+				3: {x: 3240, y: 12, top: 12, bottom: 12},
+				4: {x: 2990, y: 24, top: 24, bottom: 24},
+			},
+			width:  3240,
+			height: 36,
+			terms:  map[int]int{4: 2},
+		},
+	}
+
+	for name, test := range tests {
+		l := layout.Rectangular(tr, test.opts)
+		if l.Width != test.width {
+			t.Errorf("%s: width: got %.2f, want %.2f", name, l.Width, test.width)
+		}
+		if l.Height != test.height {
+			t.Errorf("%s: height: got %.2f, want %.2f", name, l.Height, test.height)
+		}
+
+		var order []int
+		for _, n := range l.Nodes {
+			order = append(order, n.ID)
+			p := tr.Parent(n.ID)
+			if v, ok := test.parents[n.ID]; ok {
+				p = v
+			}
+			if n.Parent != p {
+				t.Errorf("%s: node %d: parent: got %d, want %d", name, n.ID, n.Parent, p)
+			}
+			if n.Age != tr.Age(n.ID) {
+				t.Errorf("%s: node %d: age: got %d, want %d", name, n.ID, n.Age, tr.Age(n.ID))
+			}
+			if n.Triangle != (test.terms[n.ID] > 0) {
+				t.Errorf("%s: node %d: triangle: got %v, want %v", name, n.ID, n.Triangle, test.terms[n.ID] > 0)
+			}
+			if n.Terms != test.terms[n.ID] {
+				t.Errorf("%s: node %d: terminals: got %d, want %d", name, n.ID, n.Terms, test.terms[n.ID])
+			}
+			got := coords{x: n.X, y: n.Y, top: n.Top, bottom: n.Bottom}
+			if want := test.coords[n.ID]; got != want {
+				t.Errorf("%s: node %d: got %v, want %v", name, n.ID, got, want)
+			}
+		}
+		if !reflect.DeepEqual(order, test.order) {
+			t.Errorf("%s: order: got %v, want %v", name, order, test.order)
+		}
+	}
+}
+
+func TestRectangularX(t *testing.T) {
+	c, err := timetree.Newick(strings.NewReader(tree), "mammals", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tr := c.Tree("mammals")
+
+	l := layout.Rectangular(tr, layout.Options{})
+	if x := l.X(100_000_000); x != 2240 {
+		t.Errorf("age %d: got %.2f, want %.2f", 100_000_000, x, 2240.0)
+	}
+	if x := l.X(l.RootAge); x != 0 {
+		t.Errorf("root age: got %.2f, want %.2f", x, 0.0)
+	}
+}
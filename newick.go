@@ -6,9 +6,11 @@ package timetree
 
 import (
 	"bufio"
+	"cmp"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -28,11 +30,30 @@ var (
 // from the largest branch length
 // between any terminal and the root.
 // Branch lengths will be interpreted as million years.
+// Node labels
+// (for example, support values of internal nodes)
+// are stored in the "label" metadata field.
 // Name sets the name of the first tree,
 // any other tree name will be
 // in the form <name>.<number>
 // starting from 1.
+//
+// Any returned error wraps either ErrSyntax,
+// ErrInvalidTree,
+// or ErrIO.
 func Newick(r io.Reader, name string, age int64) (*Collection, error) {
+	c, err := readNewickTrees(r, name, age)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return c, nil
+}
+
+func readNewickTrees(r io.Reader, name string, age int64) (*Collection, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
 	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
 	if name == "" {
 		return nil, ErrTreeNoName
@@ -46,7 +67,7 @@ func Newick(r io.Reader, name string, age int64) (*Collection, error) {
 		if i > 0 {
 			nm = fmt.Sprintf("%s.%d", name, i)
 		}
-		t, err := newick(bw, nm, age)
+		t, err := newick(bw, nm, age, &c.warns)
 		if err != nil {
 			return nil, err
 		}
@@ -63,7 +84,7 @@ func Newick(r io.Reader, name string, age int64) (*Collection, error) {
 	return c, nil
 }
 
-func newick(r *bufio.Reader, name string, age int64) (*Tree, error) {
+func newick(r *bufio.Reader, name string, age int64, w *warnings) (*Tree, error) {
 	// search for the first parenthesis of the tree.
 	for {
 		r1, _, err := r.ReadRune()
@@ -85,7 +106,8 @@ func newick(r *bufio.Reader, name string, age int64) (*Tree, error) {
 	}
 
 	last := ""
-	root, err := t.readNewick(r, nil, &last)
+	var tw warnings
+	root, err := t.readNewick(r, nil, &last, &tw)
 	if err != nil {
 		return nil, err
 	}
@@ -102,25 +124,117 @@ func newick(r *bufio.Reader, name string, age int64) (*Tree, error) {
 
 	t.Format()
 
+	for _, m := range tw {
+		w.add("tree %s: %s", name, m)
+	}
 	return t, nil
 }
 
+// Newick writes the trees of a collection
+// in newick (parenthetical) format,
+// one tree per line,
+// sorted by the tree names.
+// See Tree.Newick for details of the format.
+func (c *Collection) Newick(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, nm := range c.Names() {
+		c.trees[nm].newick(bw)
+	}
+	return bw.Flush()
+}
+
+// Newick writes a tree
+// in newick (parenthetical) format,
+// in a single line.
+// Branch lengths are written in million years,
+// and spaces in terminal names
+// are replaced with underscores.
+// The names of the internal nodes,
+// and the metadata,
+// are not written.
+func (t *Tree) Newick(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	t.newick(bw)
+	return bw.Flush()
+}
+
+func (t *Tree) newick(w *bufio.Writer) {
+	t.root.newick(w)
+	w.WriteString(";\n")
+}
+
+// Newick writes a node
+// and all of its descendants
+// in newick format.
+// It uses an explicit stack of open nodes,
+// so deep trees can be written.
+func (n *node) newick(w *bufio.Writer) {
+	type frame struct {
+		n        *node
+		children []*node
+		next     int
+	}
+
+	stack := []frame{{n: n}}
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		if f.n.isTerm() {
+			name := strings.Join(strings.Fields(f.n.taxon), "_")
+			fmt.Fprintf(w, "%s:%.6f", name, float64(f.n.brLen)/millionYears)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		if f.next == 0 {
+			// children are written
+			// in the order of their IDs
+			f.children = slices.Clone(f.n.children)
+			slices.SortFunc(f.children, func(a, b *node) int {
+				return cmp.Compare(a.id, b.id)
+			})
+			w.WriteString("(")
+		}
+		if f.next < len(f.children) {
+			if f.next > 0 {
+				w.WriteString(", ")
+			}
+			c := f.children[f.next]
+			f.next++
+			stack = append(stack, frame{n: c})
+			continue
+		}
+
+		// close the node
+		w.WriteString(")")
+		if f.n.parent != nil {
+			fmt.Fprintf(w, ":%.6f", float64(f.n.brLen)/millionYears)
+		}
+		stack = stack[:len(stack)-1]
+	}
+}
+
 // MillionYears is used to transform newick branch lengths
 // (a float in million years)
 // to an integer in years.
 const millionYears = 1_000_000
 
-func (t *Tree) readNewick(r *bufio.Reader, parent *node, last *string) (*node, error) {
-	n := &node{
+// ReadNewick reads the nodes of a newick tree,
+// after its first parenthesis.
+// It uses an explicit stack of open nodes
+// (through the parent pointers),
+// so deep trees can be read.
+func (t *Tree) readNewick(r *bufio.Reader, parent *node, last *string, w *warnings) (*node, error) {
+	root := &node{
 		id:     len(t.nodes),
 		parent: parent,
 	}
-	t.nodes[n.id] = n
+	t.nodes[root.id] = root
 
+	n := root
 	for {
 		r1, _, err := r.ReadRune()
 		if err != nil {
-			return nil, fmt.Errorf("%v: last read terminal: %s", err, *last)
+			return nil, fmt.Errorf("%w: last read terminal: %s", err, *last)
 		}
 		if r1 == ':' {
 			return nil, fmt.Errorf("%w: last read terminal: %s", ErrUnexpBrLen, *last)
@@ -130,24 +244,58 @@ func (t *Tree) readNewick(r *bufio.Reader, parent *node, last *string) (*node, e
 		}
 		if r1 == '(' {
 			// an internal node
-			child, err := t.readNewick(r, n, last)
-			if err != nil {
-				return nil, err
+			child := &node{
+				id:     len(t.nodes),
+				parent: n,
 			}
+			t.nodes[child.id] = child
 			n.children = append(n.children, child)
+			n = child
 			continue
 		}
-		if r1 == ')' {
-			break
+		if r1 == ')' || r1 == ';' {
+			if r1 == ';' {
+				r.UnreadRune()
+			}
+
+			// close the node
+			if len(n.children) < 2 {
+				return nil, fmt.Errorf("%w: last read terminal: %s", ErrValSingleChild, *last)
+			}
+			bl, meta, err := readBrLen(r, w, internalNode(*last))
+			if err != nil {
+				return nil, fmt.Errorf("%w: last read terminal: %s", err, *last)
+			}
+			n.brLen = int64(bl * millionYears)
+			n.meta = meta
+
+			if n == root {
+				return root, nil
+			}
+			n = n.parent
+			continue
 		}
-		if r1 == ';' {
-			r.UnreadRune()
-			break
+
+		if r1 == '[' {
+			// a comment after a branch length
+			com, err := readComment(r)
+			if err != nil {
+				return nil, fmt.Errorf("%w: last read terminal: %s", err, *last)
+			}
+			if len(n.children) > 0 {
+				c := n.children[len(n.children)-1]
+				nm := "terminal " + c.taxon
+				if !c.isTerm() {
+					nm = internalNode(*last)
+				}
+				c.meta = annotation(c.meta, com, w, nm)
+			}
+			continue
 		}
 
 		// a terminal
 		r.UnreadRune()
-		term, bl, err := readTerm(r)
+		term, bl, meta, err := readTerm(r, w)
 		if err != nil {
 			if term != "" {
 				*last = term
@@ -162,24 +310,71 @@ func (t *Tree) readNewick(r *bufio.Reader, parent *node, last *string) (*node, e
 			parent: n,
 			taxon:  term,
 			brLen:  int64(bl * millionYears),
+			meta:   meta,
 		}
 		t.nodes[child.id] = child
 		n.children = append(n.children, child)
 		t.taxa[term] = child
 		*last = term
 	}
+}
+
+// InternalNode returns a description
+// of an internal node
+// used in warning messages.
+func internalNode(last string) string {
+	return "internal node after terminal " + last
+}
 
-	if len(n.children) < 2 {
-		return nil, fmt.Errorf("%w: last read terminal: %s", ErrValSingleChild, *last)
+// Annotation adds the values of a node annotation
+// (a comment in the form [&key=value,key=value])
+// as used by BEAST and FigTree,
+// to a map of metadata values.
+// Any other kind of comment is ignored.
+func annotation(meta map[string]string, com string, w *warnings, node string) map[string]string {
+	com = strings.TrimSpace(com)
+	if !strings.HasPrefix(com, "&") {
+		w.add("%s: comment %q ignored", node, com)
+		return meta
 	}
+	com = com[1:]
 
-	bl, err := readBrLen(r)
-	if err != nil {
-		return nil, fmt.Errorf("%w: last read terminal: %s", err, *last)
+	var fields []string
+	depth := 0
+	start := 0
+	for i, r1 := range com {
+		switch r1 {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth > 0 {
+				continue
+			}
+			fields = append(fields, com[start:i])
+			start = i + 1
+		}
 	}
-	n.brLen = int64(bl * millionYears)
+	fields = append(fields, com[start:])
 
-	return n, nil
+	for _, f := range fields {
+		key, value, _ := strings.Cut(f, "=")
+		key = metaKey(key)
+		if isReserved(key) {
+			w.add("%s: annotation field %q ignored", node, strings.TrimSpace(f))
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if value == "" {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[key] = value
+	}
+	return meta
 }
 
 // ReadBlock reads a string
@@ -203,17 +398,22 @@ func readBlock(r *bufio.Reader, delim rune) (string, error) {
 }
 
 // ReadBrLen reads the length of the branch
-// connecting the node with its ancestor.
-func readBrLen(r *bufio.Reader) (float64, error) {
+// connecting the node with its ancestor,
+// and any annotation or label of the node.
+func readBrLen(r *bufio.Reader, w *warnings, node string) (float64, map[string]string, error) {
+	var meta map[string]string
+	var label strings.Builder
 	for {
 		r1, _, err := r.ReadRune()
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		if r1 == '[' {
-			if _, err := readBlock(r, ']'); err != nil {
-				return 0, err
+			com, err := readComment(r)
+			if err != nil {
+				return 0, nil, err
 			}
+			meta = annotation(meta, com, w, node)
 			continue
 		}
 
@@ -221,30 +421,42 @@ func readBrLen(r *bufio.Reader) (float64, error) {
 			break
 		}
 		if r1 == ',' || unicode.IsSpace(r1) {
-			return 0, nil
+			return 0, nodeLabel(meta, label.String()), nil
 		}
 		if r1 == '\'' {
-			if _, err := readBlock(r, '\''); err != nil {
-				return 0, err
+			b, err := readBlock(r, '\'')
+			if err != nil {
+				return 0, nil, err
 			}
+			label.WriteString(b)
 			continue
 		}
 		if r1 == '(' || r1 == ')' || r1 == ';' {
 			r.UnreadRune()
-			return 0, nil
+			return 0, nodeLabel(meta, label.String()), nil
 		}
+		label.WriteRune(r1)
 	}
 
 	var b strings.Builder
 	for {
 		r1, _, err := r.ReadRune()
 		if err != nil {
-			return 0, nil
+			return 0, nodeLabel(meta, label.String()), nil
+		}
+		if r1 == '[' && b.Len() == 0 {
+			// annotation between colon and the length
+			com, err := readComment(r)
+			if err != nil {
+				return 0, nil, err
+			}
+			meta = annotation(meta, com, w, node)
+			continue
 		}
 		if unicode.IsSpace(r1) || r1 == ',' {
 			break
 		}
-		if r1 == '(' || r1 == ')' {
+		if r1 == '(' || r1 == ')' || r1 == ';' || r1 == '[' {
 			r.UnreadRune()
 			break
 		}
@@ -253,17 +465,59 @@ func readBrLen(r *bufio.Reader) (float64, error) {
 	s := b.String()
 	v, err := strconv.ParseFloat(s, 64)
 	if err != nil {
-		return 0, fmt.Errorf("%w: invalid value %q", ErrAddInvalidBrLen, s)
+		return 0, nil, fmt.Errorf("%w: %w: invalid value %q", ErrSyntax, ErrAddInvalidBrLen, s)
 	}
 	if v < 0 {
-		return 0, fmt.Errorf("%w: invalid value %q", ErrAddInvalidBrLen, s)
+		return 0, nil, fmt.Errorf("%w: invalid value %q", ErrAddInvalidBrLen, s)
 	}
 
 	// Set 0 length branches to be equal to a year
 	if v < 1.0/millionYears {
+		w.add("%s: branch length %q set to one year", node, s)
 		v = 1.0 / millionYears
 	}
-	return v, nil
+	return v, nodeLabel(meta, label.String()), nil
+}
+
+// LabelField is the metadata field
+// used to store the label of a node
+// (for example, a support value).
+const labelField = "label"
+
+// NodeLabel adds the label of a node
+// to a map of metadata values.
+// If the node already has a label annotation,
+// the label is ignored.
+func nodeLabel(meta map[string]string, label string) map[string]string {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return meta
+	}
+	if _, ok := meta[labelField]; ok {
+		return meta
+	}
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	meta[labelField] = label
+	return meta
+}
+
+// ReadComment reads the content of a comment
+// (a block delimited by square brackets).
+func readComment(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		r1, _, err := r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		if r1 == ']' {
+			break
+		}
+		b.WriteRune(r1)
+	}
+	return b.String(), nil
 }
 
 // ReadName reads a terminal name.
@@ -274,6 +528,11 @@ func readName(r *bufio.Reader) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if r1 == '[' {
+			// a comment after the name
+			r.UnreadRune()
+			break
+		}
 		if unicode.IsSpace(r1) {
 			break
 		}
@@ -285,20 +544,15 @@ func readName(r *bufio.Reader) (string, error) {
 			b.WriteRune(' ')
 			continue
 		}
-		if r1 == '[' {
-			if _, err := readBlock(r, ']'); err != nil {
-				return "", err
-			}
-			break
-		}
 		b.WriteRune(r1)
 	}
 	return b.String(), nil
 }
 
-// ReadTerm reads a terminal name
-// and its branch length
-func readTerm(r *bufio.Reader) (string, float64, error) {
+// ReadTerm reads a terminal name,
+// its branch length,
+// and its annotations.
+func readTerm(r *bufio.Reader, w *warnings) (string, float64, map[string]string, error) {
 	r1, _, _ := r.ReadRune()
 
 	var name string
@@ -310,17 +564,17 @@ func readTerm(r *bufio.Reader) (string, float64, error) {
 		name, err = readName(r)
 	}
 	if err != nil {
-		return "", 0, err
+		return "", 0, nil, err
 	}
 
 	name = canon(name)
 	if name == "" {
-		return "", 0, ErrValUnnamedTerm
+		return "", 0, nil, ErrValUnnamedTerm
 	}
 
-	bl, err := readBrLen(r)
+	bl, meta, err := readBrLen(r, w, "terminal "+name)
 	if err != nil {
-		return name, 0, err
+		return name, 0, nil, err
 	}
-	return name, bl, nil
+	return name, bl, meta, nil
 }
@@ -5,7 +5,9 @@
 package timetree_test
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -327,3 +329,184 @@ func TestNewickError(t *testing.T) {
 		})
 	}
 }
+
+func TestNewickAnnotation(t *testing.T) {
+	in := "((A[&height=0,posterior=1.0]:1.0,B:1.0[&rate=0.5]):2.0[&height_95%_HPD={2.5,3.5},posterior=0.99,!name=\"AB\"],C:3.0[comment]);"
+
+	coll, err := timetree.Newick(strings.NewReader(in), "annotated", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tr := coll.Tree("annotated")
+
+	a, _ := tr.TaxNode("A")
+	b, _ := tr.TaxNode("B")
+	c, _ := tr.TaxNode("C")
+	ab := tr.MRCA("A", "B")
+
+	tests := map[string]struct {
+		id   int
+		key  string
+		want string
+	}{
+		"terminal after name":   {id: a, key: "posterior", want: "1.0"},
+		"terminal after length": {id: b, key: "rate", want: "0.5"},
+		"internal with braces":  {id: ab, key: "height_95%_HPD", want: "{2.5,3.5}"},
+		"internal":              {id: ab, key: "posterior", want: "0.99"},
+		"quoted":                {id: ab, key: "!name", want: "AB"},
+		"plain comment":         {id: c, key: "comment", want: ""},
+		"undefined":             {id: a, key: "rate", want: ""},
+	}
+	for name, test := range tests {
+		if got := tr.Meta(test.id, test.key); got != test.want {
+			t.Errorf("%s: got %q, want %q", name, got, test.want)
+		}
+	}
+
+	keys := tr.MetaKeys(ab)
+	want := []string{"!name", "height_95%_hpd", "posterior"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys: got %v, want %v", keys, want)
+	}
+	if tr.Age(ab) != 1_000_000 {
+		t.Errorf("age: got %d, want %d", tr.Age(ab), 1_000_000)
+	}
+}
+
+func TestNewickDeep(t *testing.T) {
+	// a pectinate tree
+	// with a large number of terminals
+	const numTerms = 100_000
+
+	var b strings.Builder
+	for i := 0; i < numTerms-1; i++ {
+		fmt.Fprintf(&b, "(t%d:1,", i)
+	}
+	fmt.Fprintf(&b, "t%d:1,t%d:1", numTerms-1, numTerms)
+	for i := 0; i < numTerms-1; i++ {
+		fmt.Fprintf(&b, "):1")
+	}
+	b.WriteString(";\n")
+
+	c, err := timetree.Newick(strings.NewReader(b.String()), "deep", 0)
+	if err != nil {
+		t.Fatalf("deep: unexpected error: %v", err)
+	}
+	tr := c.Tree("deep")
+	if got := len(tr.Terms()); got != numTerms+1 {
+		t.Errorf("deep: got %d terminals, want %d", got, numTerms+1)
+	}
+	tr.Format()
+
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("deep: unexpected error: %v", err)
+	}
+	nc, err := timetree.ReadTSV(&buf)
+	if err != nil {
+		t.Fatalf("deep: unexpected error: %v", err)
+	}
+	nt := nc.Tree("deep")
+	if got, want := nt.Len(), tr.Len(); got != want {
+		t.Errorf("deep: got length %d, want %d", got, want)
+	}
+	if got, want := len(nt.Nodes()), len(tr.Nodes()); got != want {
+		t.Errorf("deep: got %d nodes, want %d", got, want)
+	}
+	if !nt.Equal(tr) {
+		t.Errorf("deep: trees are different")
+	}
+
+	// the written tree
+	// is the same after reading it
+	buf.Reset()
+	if err := c.Newick(&buf); err != nil {
+		t.Fatalf("deep: while writing newick: %v", err)
+	}
+	want := buf.String()
+	wc, err := timetree.Newick(strings.NewReader(want), "deep", 0)
+	if err != nil {
+		t.Fatalf("deep: while reading newick: %v", err)
+	}
+	buf.Reset()
+	if err := wc.Newick(&buf); err != nil {
+		t.Fatalf("deep: while writing newick: %v", err)
+	}
+	if buf.String() != want {
+		t.Errorf("deep: newick: written trees are different")
+	}
+}
+
+func TestNewickWarnings(t *testing.T) {
+	in := "((A:1.0,B:0.0)AB:2.0[a comment],C:3.0[&age=10]);"
+
+	coll, err := timetree.Newick(strings.NewReader(in), "warnings", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`tree warnings: terminal B: branch length "0.0" set to one year`,
+		`tree warnings: internal node after terminal B: comment "a comment" ignored`,
+		`tree warnings: terminal C: annotation field "age=10" ignored`,
+	}
+	got := coll.Warnings()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings: got %q, want %q", got, want)
+	}
+}
+
+func TestNewickLabels(t *testing.T) {
+	in := "((A:1.0,B:1.0)'95/100':2.0,(C:1.5,D:1.5)80:1.5[&label=0.9],(E:1.0,F:1.0)[&posterior=0.5]:2.0)root;"
+
+	coll, err := timetree.Newick(strings.NewReader(in), "labels", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tr := coll.Tree("labels")
+
+	tests := map[string]struct {
+		terms []string
+		label string
+	}{
+		"quoted":     {[]string{"A", "B"}, "95/100"},
+		"annotation": {[]string{"C", "D"}, "0.9"},
+		"no label":   {[]string{"E", "F"}, ""},
+		"root":       {[]string{"A", "F"}, "root"},
+	}
+	for name, test := range tests {
+		id := tr.MRCA(test.terms...)
+		if got := tr.Meta(id, "label"); got != test.label {
+			t.Errorf("%s: label: got %q, want %q", name, got, test.label)
+		}
+	}
+}
+
+func TestNewickRoundTrip(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("newick: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	var buf bytes.Buffer
+	if err := c.Newick(&buf); err != nil {
+		t.Fatalf("newick: while writing data: %v", err)
+	}
+
+	nc, err := timetree.Newick(strings.NewReader(buf.String()), "dinos", 0)
+	if err != nil {
+		t.Fatalf("newick: while reading data: %v", err)
+	}
+	nt := nc.Tree("dinos")
+	if nt == nil {
+		t.Fatalf("newick: tree %q not found", "dinos")
+	}
+	for _, id := range d.Nodes() {
+		got := getNode(nt, id)
+		want := getNode(d, id)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("newick: node %d: got %v, want %v", id, got, want)
+		}
+	}
+}
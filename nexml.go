@@ -0,0 +1,416 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// NeXML errors
+var ErrNotNeXML = errors.New("not a NeXML file")
+
+// NeXML reads one or more trees
+// from a NeXML document.
+//
+// Terminal names are taken from the label
+// of the OTU associated with each node.
+// If all the nodes of a tree have an age annotation
+// (a meta element with property "age",
+// in years),
+// the annotated ages will be used.
+// Otherwise,
+// edge lengths will be interpreted as million years,
+// and age set the age of the root node
+// (in years);
+// if age is 0,
+// the age of the root node will be inferred
+// from the largest branch length
+// between any terminal and the root.
+//
+// Any returned error wraps either ErrSyntax,
+// ErrInvalidTree,
+// or ErrIO.
+func NeXML(r io.Reader, age int64) (*Collection, error) {
+	c, err := readNeXML(r, age)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return c, nil
+}
+
+func readNeXML(r io.Reader, age int64) (*Collection, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc nexmlDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		if !isSyntax(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrNotNeXML, err)
+	}
+	if doc.XMLName.Local != "nexml" {
+		return nil, fmt.Errorf("%w: root element %q", ErrNotNeXML, doc.XMLName.Local)
+	}
+
+	otus := make(map[string]string)
+	for _, ob := range doc.OTUs {
+		for _, o := range ob.OTU {
+			otus[o.ID] = o.Label
+		}
+	}
+
+	c := NewCollection()
+	for _, tb := range doc.Trees {
+		for _, nt := range tb.Tree {
+			t, err := nt.tree(otus, age, &c.warns)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.Add(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(c.trees) == 0 {
+		return nil, fmt.Errorf("%w: file without trees", ErrNotNeXML)
+	}
+
+	return c, nil
+}
+
+// NeXML encodes a collection of phylogenetic trees
+// into a NeXML document.
+// Edge lengths are written in million years,
+// and node ages,
+// in years,
+// as well as any metadata field
+// with a valid XML name,
+// are stored as meta annotations.
+func (c *Collection) NeXML(w io.Writer) error {
+	doc := nexmlDoc{
+		Version: "0.9",
+		XMLNS:   "http://www.nexml.org/2009",
+		NEX:     "http://www.nexml.org/2009",
+		XSI:     "http://www.w3.org/2001/XMLSchema-instance",
+		XSD:     "http://www.w3.org/2001/XMLSchema#",
+		TT:      "https://github.com/js-arias/timetree#",
+	}
+
+	otus := nexmlOTUs{ID: "otus1"}
+	otuID := make(map[string]string)
+	trees := nexmlTrees{ID: "trees1", OTUs: otus.ID}
+	for i, nm := range c.Names() {
+		t := c.trees[nm]
+		nt := nexmlTree{
+			ID:    fmt.Sprintf("tree%d", i+1),
+			Label: t.name,
+			Type:  "nex:FloatTree",
+		}
+		for _, id := range t.Nodes() {
+			n := t.nodes[id]
+			nn := nexmlNode{
+				ID: fmt.Sprintf("n%d", id),
+				Meta: []nexmlMeta{{
+					Type:     "nex:LiteralMeta",
+					Property: "tt:age",
+					Datatype: "xsd:long",
+					Content:  strconv.FormatInt(n.age, 10),
+				}},
+			}
+			for _, k := range t.MetaKeys(id) {
+				if !isXMLName(k) {
+					continue
+				}
+				nn.Meta = append(nn.Meta, nexmlMeta{
+					Type:     "nex:LiteralMeta",
+					Property: "tt:" + k,
+					Datatype: "xsd:string",
+					Content:  n.meta[k],
+				})
+			}
+			if n.parent == nil {
+				nn.Root = "true"
+			}
+			if n.taxon != "" {
+				nn.Label = n.taxon
+			}
+			if n.isTerm() {
+				o, ok := otuID[n.taxon]
+				if !ok {
+					o = fmt.Sprintf("otu%d", len(otuID)+1)
+					otuID[n.taxon] = o
+					otus.OTU = append(otus.OTU, nexmlOTU{ID: o, Label: n.taxon})
+				}
+				nn.OTU = o
+			}
+			nt.Node = append(nt.Node, nn)
+
+			if n.parent == nil {
+				continue
+			}
+			nt.Edge = append(nt.Edge, nexmlEdge{
+				ID:     fmt.Sprintf("e%d", id),
+				Source: fmt.Sprintf("n%d", n.parent.id),
+				Target: nn.ID,
+				Length: strconv.FormatFloat(float64(n.parent.age-n.age)/millionYears, 'f', 6, 64),
+			})
+		}
+		trees.Tree = append(trees.Tree, nt)
+	}
+	doc.OTUs = []nexmlOTUs{otus}
+	doc.Trees = []nexmlTrees{trees}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "\t")
+	if err := e.Encode(doc); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+type nexmlDoc struct {
+	XMLName xml.Name `xml:"nexml"`
+	Version string   `xml:"version,attr,omitempty"`
+	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	NEX     string   `xml:"xmlns:nex,attr,omitempty"`
+	XSI     string   `xml:"xmlns:xsi,attr,omitempty"`
+	XSD     string   `xml:"xmlns:xsd,attr,omitempty"`
+	TT      string   `xml:"xmlns:tt,attr,omitempty"`
+
+	OTUs  []nexmlOTUs  `xml:"otus"`
+	Trees []nexmlTrees `xml:"trees"`
+}
+
+type nexmlOTUs struct {
+	ID  string     `xml:"id,attr"`
+	OTU []nexmlOTU `xml:"otu"`
+}
+
+type nexmlOTU struct {
+	ID    string `xml:"id,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type nexmlTrees struct {
+	ID   string      `xml:"id,attr"`
+	OTUs string      `xml:"otus,attr"`
+	Tree []nexmlTree `xml:"tree"`
+}
+
+type nexmlTree struct {
+	ID    string      `xml:"id,attr"`
+	Label string      `xml:"label,attr,omitempty"`
+	Type  string      `xml:"xsi:type,attr,omitempty"`
+	Node  []nexmlNode `xml:"node"`
+	Edge  []nexmlEdge `xml:"edge"`
+}
+
+type nexmlNode struct {
+	ID    string      `xml:"id,attr"`
+	Label string      `xml:"label,attr,omitempty"`
+	OTU   string      `xml:"otu,attr,omitempty"`
+	Root  string      `xml:"root,attr,omitempty"`
+	Meta  []nexmlMeta `xml:"meta"`
+}
+
+type nexmlEdge struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type nexmlMeta struct {
+	Type     string `xml:"xsi:type,attr,omitempty"`
+	Property string `xml:"property,attr"`
+	Datatype string `xml:"datatype,attr,omitempty"`
+	Content  string `xml:"content,attr"`
+}
+
+func (nt nexmlTree) tree(otus map[string]string, age int64, w *warnings) (*Tree, error) {
+	name := nt.Label
+	if strings.TrimSpace(name) == "" {
+		name = nt.ID
+	}
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+
+	t := &Tree{
+		name:  name,
+		nodes: make(map[int]*node),
+		taxa:  make(map[string]*node),
+	}
+
+	nodes := make(map[string]*node, len(nt.Node))
+	withAge := true
+	for _, nn := range nt.Node {
+		if _, dup := nodes[nn.ID]; dup {
+			return nil, fmt.Errorf("%w: tree %s: node %q: repeated node ID", ErrInvalidTree, name, nn.ID)
+		}
+		n := &node{
+			id: len(t.nodes),
+		}
+		label := nn.Label
+		if nn.OTU != "" {
+			l, ok := otus[nn.OTU]
+			if !ok {
+				return nil, fmt.Errorf("%w: tree %s: node %q: undefined OTU %q", ErrInvalidTree, name, nn.ID, nn.OTU)
+			}
+			label = l
+		}
+		n.taxon = canon(strings.ReplaceAll(label, "_", " "))
+		if n.taxon != "" {
+			if _, dup := t.taxa[n.taxon]; dup {
+				return nil, fmt.Errorf("tree %s: node %q: %w: %s", name, nn.ID, ErrAddRepeated, n.taxon)
+			}
+			t.taxa[n.taxon] = n
+		}
+
+		hasAge := false
+		for _, m := range nn.Meta {
+			_, key, _ := strings.Cut(m.Property, ":")
+			if key == "" {
+				key = m.Property
+			}
+			key = metaKey(key)
+			if key == "age" {
+				v, err := strconv.ParseFloat(m.Content, 64)
+				if err != nil {
+					return nil, fmt.Errorf("tree %s: node %q: invalid age %q: %w", name, nn.ID, m.Content, err)
+				}
+				n.age = int64(v)
+				hasAge = true
+				continue
+			}
+			n.setMeta(key, m.Content)
+		}
+		if !hasAge {
+			withAge = false
+		}
+
+		nodes[nn.ID] = n
+		t.nodes[n.id] = n
+		if nn.Root == "true" {
+			if t.root != nil {
+				return nil, fmt.Errorf("%w: tree %s: node %q: root already defined", ErrInvalidTree, name, nn.ID)
+			}
+			t.root = n
+		}
+	}
+
+	withLen := true
+	var clamped []string
+	for _, e := range nt.Edge {
+		p, ok := nodes[e.Source]
+		if !ok {
+			return nil, fmt.Errorf("%w: tree %s: edge %q: undefined source node %q", ErrInvalidTree, name, e.ID, e.Source)
+		}
+		n, ok := nodes[e.Target]
+		if !ok {
+			return nil, fmt.Errorf("%w: tree %s: edge %q: undefined target node %q", ErrInvalidTree, name, e.ID, e.Target)
+		}
+		if n.parent != nil {
+			return nil, fmt.Errorf("%w: tree %s: edge %q: node %q with multiple parents", ErrInvalidTree, name, e.ID, e.Target)
+		}
+		n.parent = p
+		p.children = append(p.children, n)
+
+		if e.Length == "" {
+			withLen = false
+			continue
+		}
+		v, err := strconv.ParseFloat(e.Length, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("tree %s: edge %q: %w: invalid value %q", name, e.ID, ErrAddInvalidBrLen, e.Length)
+		}
+		// Set 0 length branches to be equal to a year
+		if v < 1.0/millionYears {
+			clamped = append(clamped, e.ID)
+			v = 1.0 / millionYears
+		}
+		n.brLen = int64(v * millionYears)
+	}
+
+	if t.root == nil {
+		for _, n := range t.nodes {
+			if n.parent != nil {
+				continue
+			}
+			if t.root != nil {
+				return nil, fmt.Errorf("%w: tree %s: multiple root nodes", ErrInvalidTree, name)
+			}
+			t.root = n
+		}
+	}
+	if t.root == nil || t.root.parent != nil {
+		return nil, fmt.Errorf("%w: tree %s: undefined root node", ErrInvalidTree, name)
+	}
+	if len(t.preOrder(nil, t.root)) != len(t.nodes) {
+		return nil, fmt.Errorf("%w: tree %s: nodes not connected to the root", ErrInvalidTree, name)
+	}
+
+	switch {
+	case withAge:
+		for _, n := range t.nodes {
+			if n.parent == nil {
+				continue
+			}
+			if n.age > n.parent.age {
+				return nil, fmt.Errorf("tree %s: node %d: %w: age %d, parent age %d", name, n.id, ErrOlderAge, n.age, n.parent.age)
+			}
+			n.brLen = n.parent.age - n.age
+		}
+	case withLen:
+		max := t.root.maxLen()
+		rAge := age
+		if rAge == 0 {
+			rAge = max
+		}
+		if max > rAge {
+			return nil, fmt.Errorf("tree %s: %w: age should be greater than %d years", name, ErrInvalidRootAge, max)
+		}
+		for _, id := range clamped {
+			w.add("tree %s: edge %q: zero length branch set to one year", name, id)
+		}
+		t.root.age = rAge
+		t.root.propagateAge()
+	default:
+		return nil, fmt.Errorf("%w: tree %s: edges without lengths and nodes without ages", ErrInvalidTree, name)
+	}
+
+	t.Format()
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("tree %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// IsXMLName returns true if a string
+// can be used as a XML name.
+func isXMLName(s string) bool {
+	for i, r1 := range s {
+		if unicode.IsLetter(r1) || r1 == '_' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r1) || r1 == '-' || r1 == '.') {
+			continue
+		}
+		return false
+	}
+	return s != ""
+}
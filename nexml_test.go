@@ -0,0 +1,135 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/timetree"
+)
+
+var nexmlTest = `<?xml version="1.0" encoding="UTF-8"?>
+<nex:nexml xmlns:nex="http://www.nexml.org/2009" xmlns="http://www.nexml.org/2009" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" version="0.9">
+	<otus id="taxa1">
+		<otu id="t1" label="Eoraptor lunensis"/>
+		<otu id="t2" label="Ceratosaurus nasicornis"/>
+		<otu id="t3" label="Carnotaurus sastrei"/>
+		<otu id="t4" label="Tyrannosaurus rex"/>
+		<otu id="t5" label="Archaeopteryx lithographica"/>
+		<otu id="t6" label="Passer domesticus"/>
+	</otus>
+	<trees id="trees1" otus="taxa1">
+		<tree id="tree1" label="Tree1" xsi:type="nex:FloatTree">
+			<node id="n1" root="true"/>
+			<node id="n2" otu="t1"/>
+			<node id="n3"/>
+			<node id="n4"/>
+			<node id="n5" otu="t2"/>
+			<node id="n6" otu="t3"/>
+			<node id="n7"/>
+			<node id="n8" otu="t4"/>
+			<node id="n9"/>
+			<node id="n10" otu="t5"/>
+			<node id="n11" otu="t6"/>
+			<edge id="e2" source="n1" target="n2" length="5"/>
+			<edge id="e3" source="n1" target="n3" length="5"/>
+			<edge id="e4" source="n3" target="n4" length="60"/>
+			<edge id="e5" source="n4" target="n5" length="25"/>
+			<edge id="e6" source="n4" target="n6" length="99"/>
+			<edge id="e7" source="n3" target="n7" length="60"/>
+			<edge id="e8" source="n7" target="n8" length="102"/>
+			<edge id="e9" source="n7" target="n9" length="10"/>
+			<edge id="e10" source="n9" target="n10" length="10"/>
+			<edge id="e11" source="n9" target="n11" length="160"/>
+		</tree>
+	</trees>
+</nex:nexml>
+`
+
+func TestNeXML(t *testing.T) {
+	want := treeTest{
+		name: "tree1",
+		nodes: []node{
+			{id: 0, parent: -1, age: 235_000_000, children: []int{1, 2}},
+			{id: 1, parent: 0, age: 230_000_000, taxon: "Eoraptor lunensis", toRoot: 5_000_000, depth: 1},
+			{id: 2, parent: 0, age: 230_000_000, children: []int{3, 6}, toRoot: 5_000_000, depth: 1},
+			{id: 3, parent: 2, age: 170_000_000, children: []int{4, 5}, toRoot: 65_000_000, depth: 2},
+			{id: 4, parent: 3, age: 145_000_000, taxon: "Ceratosaurus nasicornis", toRoot: 90_000_000, depth: 3},
+			{id: 5, parent: 3, age: 71_000_000, taxon: "Carnotaurus sastrei", toRoot: 164_000_000, depth: 3},
+			{id: 6, parent: 2, age: 170_000_000, children: []int{7, 8}, toRoot: 65_000_000, depth: 2},
+			{id: 7, parent: 6, age: 68_000_000, taxon: "Tyrannosaurus rex", toRoot: 167_000_000, depth: 3},
+			{id: 8, parent: 6, age: 160_000_000, children: []int{9, 10}, toRoot: 75_000_000, depth: 3},
+			{id: 9, parent: 8, age: 150_000_000, taxon: "Archaeopteryx lithographica", toRoot: 85_000_000, depth: 4},
+			{id: 10, parent: 8, age: 0, taxon: "Passer domesticus", toRoot: 235_000_000, depth: 4},
+		},
+		terms: []string{
+			"Archaeopteryx lithographica",
+			"Carnotaurus sastrei",
+			"Ceratosaurus nasicornis",
+			"Eoraptor lunensis",
+			"Passer domesticus",
+			"Tyrannosaurus rex",
+		},
+		totLen: 536_000_000,
+	}
+
+	coll, err := timetree.NeXML(strings.NewReader(nexmlTest), 0)
+	if err != nil {
+		t.Fatalf("nexml: unexpected error: %v", err)
+	}
+	if names := coll.Names(); len(names) != 1 {
+		t.Fatalf("nexml: read %d trees, want %d", len(names), 1)
+	}
+	testTree(t, coll.Tree("tree1"), want)
+}
+
+func TestNeXMLRoundTrip(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("nexml: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+	if err := d.SetMeta(8, "posterior", "0.95"); err != nil {
+		t.Fatalf("nexml: unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.NeXML(&buf); err != nil {
+		t.Fatalf("nexml: while writing data: %v", err)
+	}
+
+	// use an age different from the root age
+	// to check that node ages are read
+	// from the annotations.
+	nc, err := timetree.NeXML(strings.NewReader(buf.String()), 500_000_000)
+	if err != nil {
+		t.Fatalf("nexml: while reading data: %v", err)
+	}
+	if got := nc.Names(); !reflect.DeepEqual(got, c.Names()) {
+		t.Fatalf("nexml: read trees %v, want %v", got, c.Names())
+	}
+
+	nt := nc.Tree("dinos")
+	for _, id := range d.Nodes() {
+		got := getNode(nt, id)
+		want := getNode(d, id)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("nexml: node %d: got %v, want %v", id, got, want)
+		}
+	}
+	if got := nt.Meta(8, "posterior"); got != "0.95" {
+		t.Errorf("nexml: metadata: got %q, want %q", got, "0.95")
+	}
+}
+
+func TestNeXMLError(t *testing.T) {
+	if _, err := timetree.NeXML(strings.NewReader("(A,B);"), 0); !errors.Is(err, timetree.ErrNotNeXML) {
+		t.Errorf("nexml: got error %v, want %v", err, timetree.ErrNotNeXML)
+	}
+}
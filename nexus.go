@@ -6,6 +6,7 @@ package timetree
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -15,6 +16,22 @@ import (
 
 // Nexus reads one or more tree
 // from a nexus file.
+// All the trees blocks of the file are read,
+// as well as the trees blocks
+// of any nexus document
+// concatenated in the same stream.
+// Trees with a name already used
+// in a previous block
+// are renamed using the number of the block
+// as a suffix
+// (for example "tree1.2"),
+// and a warning is added to the collection.
+// Commands of a trees block
+// other than translate and tree
+// (for example "link" or "options")
+// as well as comments
+// (including nested comments)
+// are ignored.
 // Age set the age of the root node
 // (in years)
 // if age is 0,
@@ -22,83 +39,154 @@ import (
 // from the largest branch length
 // between any terminal and the root.
 // Branch lengths will be interpreted as million years.
+//
+// Any returned error wraps either ErrSyntax,
+// ErrInvalidTree,
+// or ErrIO.
 func Nexus(r io.Reader, age int64) (*Collection, error) {
+	c, err := readNexus(r, age)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return c, nil
+}
+
+// Nexus writes the trees of a collection
+// as a trees block
+// of a nexus file,
+// sorted by the tree names.
+// Spaces in tree names
+// are replaced with underscores,
+// and each tree is written
+// in newick format
+// (see Tree.Newick).
+func (c *Collection) Nexus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("#NEXUS\n\nbegin trees;\n")
+	for _, nm := range c.Names() {
+		fmt.Fprintf(bw, "\ttree %s = [&R] ", strings.Join(strings.Fields(nm), "_"))
+		c.trees[nm].newick(bw)
+	}
+	bw.WriteString("end;\n")
+	return bw.Flush()
+}
+
+func readNexus(r io.Reader, age int64) (*Collection, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
 	nxf := bufio.NewReader(r)
 	token := &strings.Builder{}
 
 	// header
 	if _, err := readToken(nxf, token); err != nil {
-		return nil, fmt.Errorf("expecting '#nexus' header: %v", err)
+		return nil, fmt.Errorf("expecting '#nexus' header: %w", err)
 	}
 	if t := strings.ToLower(token.String()); t != "#nexus" {
-		return nil, fmt.Errorf("got %q, expecting '#nexus' header", t)
+		return nil, fmt.Errorf("%w: got %q, expecting '#nexus' header", ErrSyntax, t)
 	}
 
-	// ignore all blocks except tree block
-	for {
-		if _, err := readToken(nxf, token); err != nil {
-			return nil, fmt.Errorf("expecting 'begin' token: %v", err)
+	// read all the trees blocks,
+	// ignoring any other block
+	c := NewCollection()
+	for block := 0; ; {
+		_, err := readToken(nxf, token)
+		if errors.Is(err, io.EOF) && token.Len() == 0 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("expecting 'begin' token: %w", err)
+		}
+		t := strings.ToLower(token.String())
+
+		// concatenated nexus documents
+		if t == "#nexus" {
+			continue
 		}
-		if t := strings.ToLower(token.String()); t != "begin" {
-			return nil, fmt.Errorf("got %q, expecting 'begin' block", t)
+		if t != "begin" {
+			return nil, fmt.Errorf("%w: got %q, expecting 'begin' block", ErrSyntax, t)
 		}
 
 		if _, err := readToken(nxf, token); err != nil {
-			return nil, fmt.Errorf("expecting block name: %v", err)
+			return nil, fmt.Errorf("expecting block name: %w", err)
 		}
-		block := strings.ToLower(token.String())
-		if block == "trees" {
-			break
+		name := strings.ToLower(token.String())
+		if name != "trees" {
+			if err := skipBlock(nxf, token); err != nil {
+				return nil, fmt.Errorf("incomplete block %q: %w", name, err)
+			}
+			continue
 		}
 
-		if err := skipBlock(nxf, token); err != nil {
-			return nil, fmt.Errorf("incomplete block %q: %v", block, err)
+		block++
+		if err := readTreesBlock(nxf, token, c, block, age); err != nil {
+			return nil, err
 		}
 	}
 
-	c := NewCollection()
+	if len(c.Names()) == 0 {
+		return nil, fmt.Errorf("%w: file without trees", ErrSyntax)
+	}
+
+	return c, nil
+}
+
+// ReadTreesBlock reads the trees of a trees block
+// into a collection.
+// If a tree name is already in the collection
+// (for example,
+// when reading several trees blocks
+// from different runs),
+// the tree will be renamed
+// with the number of the block as a suffix.
+func readTreesBlock(r *bufio.Reader, token *strings.Builder, c *Collection, block int, age int64) error {
 	var labels map[string]string
 	for {
-		if _, err := readToken(nxf, token); err != nil {
-			return nil, fmt.Errorf("incomplete block 'trees': %v", err)
+		if _, err := readToken(r, token); err != nil {
+			return fmt.Errorf("incomplete block 'trees': %w", err)
 		}
 		t := strings.ToLower(token.String())
 		if t == "end" || t == "endblock" {
-			break
+			return nil
 		}
 		if t == "translate" {
 			var err error
-			labels, err = readTranslate(nxf, token)
+			labels, err = readTranslate(r, token)
 			if err != nil {
-				return nil, fmt.Errorf("invalid tree block: %v", err)
+				return fmt.Errorf("invalid tree block: %w", err)
 			}
 			continue
 		}
-		if t == "tree" {
-			tr, err := readTreeNewick(nxf, token, age)
+		// "utree" is used by PAUP
+		// for unrooted trees
+		if t == "tree" || t == "utree" {
+			tr, err := readTreeNewick(r, token, age, &c.warns)
 			if err != nil {
-				return nil, fmt.Errorf("incomplete block 'trees': %v", err)
+				return fmt.Errorf("incomplete block 'trees': %w", err)
+			}
+			translateTree(tr, labels, &c.warns)
+			if c.Tree(tr.name) != nil {
+				name := tr.name
+				tr.name = fmt.Sprintf("%s.%d", name, block)
+				for i := 2; c.Tree(tr.name) != nil; i++ {
+					tr.name = fmt.Sprintf("%s.%d.%d", name, block, i)
+				}
+				c.warns.add("trees block %d: tree %s renamed as %s", block, name, tr.name)
 			}
-			translateTree(tr, labels)
 			if err := c.Add(tr); err != nil {
-				return nil, fmt.Errorf("when adding tree %q: %v", tr.Name(), err)
+				return fmt.Errorf("when adding tree %q: %w", tr.Name(), err)
 			}
 			continue
 		}
 
-		if err := skipDefinition(nxf, token); err != nil {
-			return nil, fmt.Errorf("incomplete block 'characters', token %q: %v", t, err)
+		if err := skipDefinition(r, token); err != nil {
+			return fmt.Errorf("incomplete block 'trees', token %q: %w", t, err)
 		}
 	}
-
-	if len(c.Names()) == 0 {
-		return nil, fmt.Errorf("file without trees")
-	}
-
-	return c, nil
 }
 
-func translateTree(t *Tree, labels map[string]string) {
+func translateTree(t *Tree, labels map[string]string, w *warnings) {
 	if len(labels) == 0 {
 		return
 	}
@@ -112,31 +200,42 @@ func translateTree(t *Tree, labels map[string]string) {
 		if !ok {
 			continue
 		}
-		t.SetName(nID, tax)
+		if err := t.SetName(nID, tax); err != nil {
+			w.add("tree %s: label %q: translation %q ignored: %v", t.name, id, tax, err)
+		}
 	}
 }
 
-func readTreeNewick(r *bufio.Reader, token *strings.Builder, age int64) (*Tree, error) {
+func readTreeNewick(r *bufio.Reader, token *strings.Builder, age int64, w *warnings) (*Tree, error) {
 	// read tree name
 	if _, err := readToken(r, token); err != nil {
-		return nil, fmt.Errorf("while reading tree name: %v", err)
+		return nil, fmt.Errorf("while reading tree name: %w", err)
 	}
 	name := strings.ToLower(token.String())
+
+	// PAUP marks the default tree
+	// with an asterisk
+	if name == "*" {
+		if _, err := readToken(r, token); err != nil {
+			return nil, fmt.Errorf("while reading tree name: %w", err)
+		}
+		name = strings.ToLower(token.String())
+	}
 	if err := skipSpaces(r); err != nil {
-		return nil, fmt.Errorf("expecting newick tree: %v", err)
+		return nil, fmt.Errorf("expecting newick tree: %w", err)
 	}
 
-	t, err := newick(r, name, age)
+	t, err := newick(r, name, age, w)
 	if err != nil {
 		return nil, err
 	}
 
 	delim, err := readToken(r, token)
 	if err != nil {
-		return nil, fmt.Errorf("while reading tree %q: %v", name, err)
+		return nil, fmt.Errorf("while reading tree %q: %w", name, err)
 	}
 	if delim != ';' {
-		return nil, fmt.Errorf("while reading tree %q: unexpected delimiter %q", name, string(delim))
+		return nil, fmt.Errorf("%w: while reading tree %q: unexpected delimiter %q", ErrSyntax, name, string(delim))
 	}
 
 	return t, nil
@@ -145,23 +244,29 @@ func readTreeNewick(r *bufio.Reader, token *strings.Builder, age int64) (*Tree,
 func readTranslate(r *bufio.Reader, token *strings.Builder) (map[string]string, error) {
 	labels := make(map[string]string)
 	for i := 0; ; i++ {
-		if _, err := readToken(r, token); err != nil {
-			return nil, fmt.Errorf("while reading tree translate labels: %v, last label read: %d", err, i)
+		delim, err := readToken(r, token)
+		if err != nil {
+			return nil, fmt.Errorf("while reading tree translate labels: %w, last label read: %d", err, i)
 		}
 
+		// a comma before the semicolon
+		// (as in MrBayes files)
 		label := token.String()
+		if label == "" && delim == ';' && i > 0 {
+			break
+		}
 		id, err := strconv.Atoi(label)
 		if err != nil {
-			return nil, fmt.Errorf("while reading tree translate labels: taxon %d [%q]: %v", i+1, token.String(), err)
+			return nil, fmt.Errorf("while reading tree translate labels: taxon %d [%q]: %w", i+1, token.String(), err)
 		}
 		if id != i+1 {
-			return nil, fmt.Errorf("while reading tree translate labels: taxon %d [%q]: expecting %d", i+1, token.String(), i+1)
+			return nil, fmt.Errorf("%w: while reading tree translate labels: taxon %d [%q]: expecting %d", ErrSyntax, i+1, token.String(), i+1)
 		}
 
 		// read taxon name
-		delim, err := readToken(r, token)
+		delim, err = readToken(r, token)
 		if err != nil {
-			return nil, fmt.Errorf("while reading tree translate labels: taxon %d [%q]: %v", i+1, token.String(), err)
+			return nil, fmt.Errorf("while reading tree translate labels: taxon %d [%q]: %w", i+1, token.String(), err)
 		}
 
 		taxName := strings.ReplaceAll(token.String(), "_", " ")
@@ -246,6 +351,13 @@ func readToken(r *bufio.Reader, token *strings.Builder) (delim rune, err error)
 				delim = ' '
 				break
 			}
+
+			// a comment just after the token
+			if r1 == '[' {
+				r.UnreadRune()
+				delim = ' '
+				break
+			}
 			if r1 == ';' || r1 == ',' || r1 == '/' || r1 == '=' {
 				delim = r1
 				break
@@ -293,16 +405,23 @@ func skipSpaces(r *bufio.Reader) error {
 	}
 }
 
+// SkipComment skips a comment,
+// including any nested comment.
 func skipComment(r *bufio.Reader) error {
-	for {
+	for depth := 1; ; {
 		r1, _, err := r.ReadRune()
 		if err != nil {
 			return err
 		}
 
-		// a comment
+		if r1 == '[' {
+			depth++
+		}
 		if r1 == ']' {
-			return nil
+			depth--
+			if depth == 0 {
+				return nil
+			}
 		}
 	}
 }
@@ -5,6 +5,9 @@
 package timetree_test
 
 import (
+	"bytes"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 
@@ -84,3 +87,227 @@ func TestNexus(t *testing.T) {
 	}
 	testTree(t, coll.Tree("tree1"), want)
 }
+
+func TestNexusBlocks(t *testing.T) {
+	in := nexusTest + `
+Begin trees;
+	tree tree2 = (Eoraptor_lunensis:5,(Passer_domesticus:230,Tyrannosaurus_rex:162):5);
+End;
+
+#NEXUS
+Begin trees;
+	Translate
+		1 Passer_domesticus,
+		2 Tyrannosaurus_rex,
+		3 Eoraptor_lunensis
+		;
+	tree tree1 = (3:5,(1:230,2:162):5);
+	tree tree3 = ((1:230,2:162):5,3:5);
+End;
+`
+	coll, err := timetree.Nexus(strings.NewReader(in), 0)
+	if err != nil {
+		t.Fatalf("nexus blocks: unexpected error: %v", err)
+	}
+
+	want := []string{"tree1", "tree1.3", "tree2", "tree3"}
+	if got := coll.Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("nexus blocks: trees: got %v, want %v", got, want)
+	}
+
+	// translation labels are only valid
+	// in its own block
+	tr := coll.Tree("tree1.3")
+	if tr == nil {
+		t.Fatalf("nexus blocks: tree %q not found", "tree1.3")
+	}
+	terms := []string{"Eoraptor lunensis", "Passer domesticus", "Tyrannosaurus rex"}
+	if got := tr.Terms(); !reflect.DeepEqual(got, terms) {
+		t.Errorf("nexus blocks: terminals: got %v, want %v", got, terms)
+	}
+	if got := coll.Tree("tree2").Terms(); !reflect.DeepEqual(got, terms) {
+		t.Errorf("nexus blocks: terminals of %q: got %v, want %v", "tree2", got, terms)
+	}
+
+	warn := "trees block 3: tree tree1 renamed as tree1.3"
+	if !slices.Contains(coll.Warnings(), warn) {
+		t.Errorf("nexus blocks: warnings: got %v, want %q", coll.Warnings(), warn)
+	}
+}
+
+func TestNexusTolerance(t *testing.T) {
+	tests := map[string]struct {
+		in    string
+		names []string
+	}{
+		"mesquite": {
+			in: `#NEXUS
+[written Tue Oct 14 10:00:00 ART 2025 by Mesquite  version 3.81 (build 955)]
+
+BEGIN TAXA;
+	TITLE Taxa;
+	DIMENSIONS NTAX=3;
+	TAXLABELS
+		Eoraptor_lunensis Passer_domesticus Tyrannosaurus_rex 
+	;
+END;
+
+BEGIN TREES;
+	Title 'Trees from "dinos.nex"';
+	LINK Taxa = Taxa;
+	TRANSLATE
+[0] 		1 Eoraptor_lunensis,
+[1] 		2 Passer_domesticus,
+[2] 		3 Tyrannosaurus_rex;
+	TREE 'Tree # 1' = ((2:230,3:162):5,1:5)[% ] [% ] [%  setBetweenDouble = branchLength; ];
+	DEFAULT 'Tree # 1';
+
+END;
+
+Begin MESQUITE;
+		MESQUITESCRIPTVERSION 2;
+		TITLE AUTO;
+		tell ProjectCoordinator;
+		endTell;
+end;
+`,
+			names: []string{"tree # 1"},
+		},
+		"mrbayes": {
+			in: `#NEXUS
+[ID: 9409050143]
+[Param: tree{all}=(1,2,3)]
+begin trees;
+   translate
+      1 Eoraptor_lunensis,
+      2 Passer_domesticus,
+      3 Tyrannosaurus_rex,
+      ;
+   tree gen.0 = [&U] ((2:230,3:162):5,1:5);
+   tree gen.1000 = [&U] ((2:230,3:162):5[&prob=1.0,prob_stddev=0.0,prob_range={1.0,1.0}],1:5);
+end;
+`,
+			names: []string{"gen.0", "gen.1000"},
+		},
+		"beast": {
+			in: `#NEXUS
+
+Begin taxa;
+	Dimensions ntax=3;
+	Taxlabels
+		Eoraptor_lunensis
+		Passer_domesticus
+		Tyrannosaurus_rex
+		;
+End;
+Begin trees;
+	Translate
+		1 Eoraptor_lunensis,
+		2 Passer_domesticus,
+		3 Tyrannosaurus_rex
+		;
+tree STATE_0[&lnP=-123.45,posterior=-123.45] = [&R] ((2[&rate=1.0]:230.0,3[&rate=1.0]:162.0)[&rate=1.0]:5.0,1[&rate=1.0]:5.0);
+tree STATE_10000 [&lnP=-120.1,posterior=-120.1] = [&R] ((2:230.0,3:162.0):5.0,1:5.0);
+End;
+`,
+			names: []string{"state_0", "state_10000"},
+		},
+		"paup": {
+			in: `#NEXUS
+
+[!
+>Data file = dinos.nex
+>Neighbor-joining search settings:
+>  Distance measure = uncorrected ("p")
+]
+
+begin trees;  [Treefile saved Tuesday, October 14, 2025 10:00 AM]
+[!
+>Data file = dinos.nex
+]
+	translate
+		1 Eoraptor_lunensis,
+		2 Passer_domesticus,
+		3 Tyrannosaurus_rex
+		;
+tree * PAUP_1 = [&R] ((2:230,3:162):5,1:5);
+utree PAUP_2 = [&U] ((2:230,3:162):5,1:5);
+end;
+`,
+			names: []string{"paup_1", "paup_2"},
+		},
+		"nested comments": {
+			in: `#NEXUS
+[a comment [with a nested comment]; and a semicolon]
+begin trees[the trees];
+	tree tree1[a [nested] comment] = ((Passer_domesticus:230,Tyrannosaurus_rex:162):5,Eoraptor_lunensis:5);
+end;
+`,
+			names: []string{"tree1"},
+		},
+	}
+
+	terms := []string{"Eoraptor lunensis", "Passer domesticus", "Tyrannosaurus rex"}
+	for name, test := range tests {
+		coll, err := timetree.Nexus(strings.NewReader(test.in), 0)
+		if err != nil {
+			t.Errorf("nexus %s: unexpected error: %v", name, err)
+			continue
+		}
+		if got := coll.Names(); !reflect.DeepEqual(got, test.names) {
+			t.Errorf("nexus %s: trees: got %v, want %v", name, got, test.names)
+			continue
+		}
+		for _, tn := range test.names {
+			tr := coll.Tree(tn)
+			if got := tr.Terms(); !reflect.DeepEqual(got, terms) {
+				t.Errorf("nexus %s: tree %q: terminals: got %v, want %v", name, tn, got, terms)
+			}
+			if got := tr.Age(tr.Root()); got != 235_000_000 {
+				t.Errorf("nexus %s: tree %q: root age: got %d, want %d", name, tn, got, 235_000_000)
+			}
+		}
+	}
+}
+
+func TestNexusRoundTrip(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("nexus: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+	nd := d.SubTree(d.MRCA("Tyrannosaurus rex", "Passer domesticus"), "tetanurae dinos")
+	if err := c.Add(nd); err != nil {
+		t.Fatalf("nexus: unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Nexus(&buf); err != nil {
+		t.Fatalf("nexus: while writing data: %v", err)
+	}
+
+	nc, err := timetree.Nexus(strings.NewReader(buf.String()), 0)
+	if err != nil {
+		t.Fatalf("nexus: while reading data: %v", err)
+	}
+	if got, want := nc.Names(), []string{"dinos", "tetanurae_dinos"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("nexus: read trees %v, want %v", got, want)
+	}
+
+	for _, p := range []struct {
+		orig *timetree.Tree
+		name string
+	}{
+		{d, "dinos"},
+		{nd, "tetanurae_dinos"},
+	} {
+		nt := nc.Tree(p.name)
+		for _, id := range p.orig.Nodes() {
+			got := getNode(nt, id)
+			want := getNode(p.orig, id)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("nexus: tree %q: node %d: got %v, want %v", p.name, id, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PhyloXML errors
+var ErrNotPhyloXML = errors.New("not a phyloXML file")
+
+// confidenceTypes are the metadata fields
+// that are stored as confidence values
+// in a phyloXML file.
+var confidenceTypes = []string{
+	"bootstrap",
+	"confidence",
+	"posterior",
+	"probability",
+	"support",
+}
+
+// PhyloXML reads one or more trees
+// from a phyloXML document.
+//
+// Terminal names are taken from the name of the clade,
+// or from the scientific name of its taxonomy.
+// Confidence values are stored as metadata fields,
+// using the type of the confidence as the name of the field.
+// If all the clades of a tree have an age property
+// (in years),
+// the annotated ages will be used.
+// Otherwise,
+// branch lengths will be interpreted as million years,
+// and age set the age of the root node
+// (in years);
+// if age is 0,
+// the age of the root node will be inferred
+// from the largest branch length
+// between any terminal and the root.
+//
+// Any returned error wraps either ErrSyntax,
+// ErrInvalidTree,
+// or ErrIO.
+func PhyloXML(r io.Reader, age int64) (*Collection, error) {
+	c, err := readPhyloXMLTrees(r, age)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return c, nil
+}
+
+func readPhyloXMLTrees(r io.Reader, age int64) (*Collection, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc pxDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		if !isSyntax(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrNotPhyloXML, err)
+	}
+	if doc.XMLName.Local != "phyloxml" {
+		return nil, fmt.Errorf("%w: root element %q", ErrNotPhyloXML, doc.XMLName.Local)
+	}
+
+	c := NewCollection()
+	for i, p := range doc.Phylogeny {
+		name := strings.ToLower(strings.Join(strings.Fields(p.Name), " "))
+		if name == "" {
+			name = fmt.Sprintf("phylogeny.%d", i+1)
+		}
+		if p.Clade == nil {
+			return nil, fmt.Errorf("%w: tree %s: phylogeny without clades", ErrInvalidTree, name)
+		}
+
+		t := &Tree{
+			name:  name,
+			nodes: make(map[int]*node),
+			taxa:  make(map[string]*node),
+		}
+		withAge := true
+		withLen := true
+		var clamped []string
+		root, err := t.readPhyloXML(p.Clade, &withAge, &withLen, &clamped)
+		if err != nil {
+			return nil, fmt.Errorf("tree %s: %w", name, err)
+		}
+		t.root = root
+
+		switch {
+		case withAge:
+			for _, n := range t.nodes {
+				if n.parent == nil {
+					continue
+				}
+				if n.age > n.parent.age {
+					return nil, fmt.Errorf("tree %s: node %d: %w: age %d, parent age %d", name, n.id, ErrOlderAge, n.age, n.parent.age)
+				}
+				n.brLen = n.parent.age - n.age
+			}
+		case withLen:
+			max := t.root.maxLen()
+			rAge := age
+			if rAge == 0 {
+				rAge = max
+			}
+			if max > rAge {
+				return nil, fmt.Errorf("tree %s: %w: age should be greater than %d years", name, ErrInvalidRootAge, max)
+			}
+			for _, cl := range clamped {
+				c.warns.add("tree %s: %s: zero length branch set to one year", name, cl)
+			}
+			t.root.age = rAge
+			t.root.propagateAge()
+		default:
+			return nil, fmt.Errorf("%w: tree %s: clades without branch lengths or ages", ErrInvalidTree, name)
+		}
+
+		t.Format()
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("tree %s: %w", name, err)
+		}
+		if err := c.Add(t); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.trees) == 0 {
+		return nil, fmt.Errorf("%w: file without trees", ErrNotPhyloXML)
+	}
+
+	return c, nil
+}
+
+// PhyloXML encodes a collection of phylogenetic trees
+// into a phyloXML document.
+// Branch lengths are written in million years,
+// the metadata fields used for support values
+// (bootstrap, confidence, posterior, probability, and support)
+// are written as confidence values,
+// and node ages,
+// in years,
+// as well as any other metadata field,
+// are stored as clade properties.
+func (c *Collection) PhyloXML(w io.Writer) error {
+	doc := pxDoc{
+		XMLNS: "http://www.phyloxml.org",
+	}
+	for _, nm := range c.Names() {
+		t := c.trees[nm]
+		doc.Phylogeny = append(doc.Phylogeny, pxPhylogeny{
+			Rooted: "true",
+			Name:   t.name,
+			Clade:  t.root.phyloXML(),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "\t")
+	if err := e.Encode(doc); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+type pxDoc struct {
+	XMLName   xml.Name      `xml:"phyloxml"`
+	XMLNS     string        `xml:"xmlns,attr,omitempty"`
+	Phylogeny []pxPhylogeny `xml:"phylogeny"`
+}
+
+type pxPhylogeny struct {
+	Rooted string   `xml:"rooted,attr"`
+	Name   string   `xml:"name,omitempty"`
+	Clade  *pxClade `xml:"clade"`
+}
+
+type pxClade struct {
+	BrLenAttr  string         `xml:"branch_length,attr,omitempty"`
+	Name       string         `xml:"name,omitempty"`
+	BrLen      string         `xml:"branch_length,omitempty"`
+	Confidence []pxConfidence `xml:"confidence"`
+	Taxonomy   *pxTaxonomy    `xml:"taxonomy"`
+	Property   []pxProperty   `xml:"property"`
+	Clade      []*pxClade     `xml:"clade"`
+}
+
+type pxConfidence struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type pxTaxonomy struct {
+	ScientificName string `xml:"scientific_name"`
+}
+
+type pxProperty struct {
+	Ref       string `xml:"ref,attr"`
+	Datatype  string `xml:"datatype,attr"`
+	AppliesTo string `xml:"applies_to,attr"`
+	Value     string `xml:",chardata"`
+}
+
+// ReadPhyloXML reads a clade
+// and its descendants.
+// Clades with zero length branches
+// are stored in clamped.
+// It uses an explicit stack of clades,
+// so deep trees can be read.
+func (t *Tree) readPhyloXML(pc *pxClade, withAge, withLen *bool, clamped *[]string) (*node, error) {
+	type item struct {
+		parent *node
+		pc     *pxClade
+	}
+
+	var root *node
+	stack := []item{{pc: pc}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		n, err := t.readClade(it.parent, it.pc, withAge, withLen, clamped)
+		if err != nil {
+			return nil, err
+		}
+		if it.parent == nil {
+			root = n
+		} else {
+			it.parent.children = append(it.parent.children, n)
+		}
+
+		// children are added in reverse order,
+		// so they are read in the order of the document
+		for i := len(it.pc.Clade) - 1; i >= 0; i-- {
+			stack = append(stack, item{parent: n, pc: it.pc.Clade[i]})
+		}
+	}
+	return root, nil
+}
+
+// ReadClade reads the data of a clade,
+// without its descendants.
+func (t *Tree) readClade(parent *node, pc *pxClade, withAge, withLen *bool, clamped *[]string) (*node, error) {
+	n := &node{
+		id:     len(t.nodes),
+		parent: parent,
+	}
+	t.nodes[n.id] = n
+
+	name := pc.Name
+	if pc.Taxonomy != nil && len(pc.Clade) == 0 && strings.TrimSpace(pc.Taxonomy.ScientificName) != "" {
+		name = pc.Taxonomy.ScientificName
+	}
+	n.taxon = canon(strings.ReplaceAll(name, "_", " "))
+	if n.taxon != "" {
+		if _, dup := t.taxa[n.taxon]; dup {
+			return nil, fmt.Errorf("%w: %s", ErrAddRepeated, n.taxon)
+		}
+		t.taxa[n.taxon] = n
+	}
+
+	bl := strings.TrimSpace(pc.BrLen)
+	if bl == "" {
+		bl = strings.TrimSpace(pc.BrLenAttr)
+	}
+	if bl != "" {
+		v, err := strconv.ParseFloat(bl, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%w: invalid value %q", ErrAddInvalidBrLen, bl)
+		}
+		// Set 0 length branches to be equal to a year
+		if v < 1.0/millionYears {
+			cl := fmt.Sprintf("clade %d", n.id)
+			if n.taxon != "" {
+				cl = fmt.Sprintf("clade %q", n.taxon)
+			}
+			*clamped = append(*clamped, cl)
+			v = 1.0 / millionYears
+		}
+		n.brLen = int64(v * millionYears)
+	} else if parent != nil {
+		*withLen = false
+	}
+
+	for _, cf := range pc.Confidence {
+		key := metaKey(cf.Type)
+		if key == "" || key == "unknown" {
+			key = "confidence"
+		}
+		n.setMeta(key, cf.Value)
+	}
+
+	hasAge := false
+	for _, p := range pc.Property {
+		_, key, _ := strings.Cut(p.Ref, ":")
+		if key == "" {
+			key = p.Ref
+		}
+		key = metaKey(key)
+		if key == "age" {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p.Value), 64)
+			if err != nil {
+				return nil, fmt.Errorf("node %d: invalid age %q: %w", n.id, p.Value, err)
+			}
+			n.age = int64(v)
+			hasAge = true
+			continue
+		}
+		n.setMeta(key, p.Value)
+	}
+	if !hasAge {
+		*withAge = false
+	}
+	return n, nil
+}
+
+// PhyloXML returns the phyloXML clade
+// of a node
+// and all of its descendants.
+// The nodes are visited in pre-order
+// (without recursion),
+// so deep trees can be written.
+func (n *node) phyloXML() *pxClade {
+	clades := make(map[*node]*pxClade)
+	for _, d := range n.preOrder(nil) {
+		pc := d.pxClade()
+		clades[d] = pc
+		if d != n {
+			p := clades[d.parent]
+			p.Clade = append(p.Clade, pc)
+		}
+	}
+	return clades[n]
+}
+
+// PxClade returns the phyloXML clade
+// of a node,
+// without its descendants.
+func (n *node) pxClade() *pxClade {
+	pc := &pxClade{
+		Name: n.taxon,
+	}
+	if n.parent != nil {
+		pc.BrLen = strconv.FormatFloat(float64(n.parent.age-n.age)/millionYears, 'f', 6, 64)
+	}
+
+	keys := make([]string, 0, len(n.meta))
+	for k := range n.meta {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if !slices.Contains(confidenceTypes, k) {
+			continue
+		}
+		pc.Confidence = append(pc.Confidence, pxConfidence{
+			Type:  k,
+			Value: n.meta[k],
+		})
+	}
+	if n.isTerm() {
+		pc.Taxonomy = &pxTaxonomy{
+			ScientificName: n.taxon,
+		}
+	}
+
+	pc.Property = append(pc.Property, pxProperty{
+		Ref:       "timetree:age",
+		Datatype:  "xsd:long",
+		AppliesTo: "node",
+		Value:     strconv.FormatInt(n.age, 10),
+	})
+	for _, k := range keys {
+		if slices.Contains(confidenceTypes, k) {
+			continue
+		}
+		pc.Property = append(pc.Property, pxProperty{
+			Ref:       "timetree:" + k,
+			Datatype:  "xsd:string",
+			AppliesTo: "node",
+			Value:     n.meta[k],
+		})
+	}
+	return pc
+}
@@ -0,0 +1,175 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/timetree"
+)
+
+var phyloXMLTest = `<?xml version="1.0" encoding="UTF-8"?>
+<phyloxml xmlns="http://www.phyloxml.org">
+	<phylogeny rooted="true">
+		<name>Tree1</name>
+		<clade>
+			<clade branch_length="5">
+				<name>Eoraptor_lunensis</name>
+			</clade>
+			<clade branch_length="5">
+				<confidence type="bootstrap">95</confidence>
+				<clade branch_length="60">
+					<clade branch_length="25">
+						<taxonomy><scientific_name>Ceratosaurus nasicornis</scientific_name></taxonomy>
+					</clade>
+					<clade branch_length="99"><name>Carnotaurus sastrei</name></clade>
+				</clade>
+				<clade>
+					<branch_length>60</branch_length>
+					<clade branch_length="102"><name>Tyrannosaurus rex</name></clade>
+					<clade branch_length="10">
+						<clade branch_length="10"><name>Archaeopteryx lithographica</name></clade>
+						<clade branch_length="160"><name>Passer domesticus</name></clade>
+					</clade>
+				</clade>
+			</clade>
+		</clade>
+	</phylogeny>
+</phyloxml>
+`
+
+func TestPhyloXML(t *testing.T) {
+	want := treeTest{
+		name: "tree1",
+		nodes: []node{
+			{id: 0, parent: -1, age: 235_000_000, children: []int{1, 2}},
+			{id: 1, parent: 0, age: 230_000_000, taxon: "Eoraptor lunensis", toRoot: 5_000_000, depth: 1},
+			{id: 2, parent: 0, age: 230_000_000, children: []int{3, 6}, toRoot: 5_000_000, depth: 1},
+			{id: 3, parent: 2, age: 170_000_000, children: []int{4, 5}, toRoot: 65_000_000, depth: 2},
+			{id: 4, parent: 3, age: 145_000_000, taxon: "Ceratosaurus nasicornis", toRoot: 90_000_000, depth: 3},
+			{id: 5, parent: 3, age: 71_000_000, taxon: "Carnotaurus sastrei", toRoot: 164_000_000, depth: 3},
+			{id: 6, parent: 2, age: 170_000_000, children: []int{7, 8}, toRoot: 65_000_000, depth: 2},
+			{id: 7, parent: 6, age: 68_000_000, taxon: "Tyrannosaurus rex", toRoot: 167_000_000, depth: 3},
+			{id: 8, parent: 6, age: 160_000_000, children: []int{9, 10}, toRoot: 75_000_000, depth: 3},
+			{id: 9, parent: 8, age: 150_000_000, taxon: "Archaeopteryx lithographica", toRoot: 85_000_000, depth: 4},
+			{id: 10, parent: 8, age: 0, taxon: "Passer domesticus", toRoot: 235_000_000, depth: 4},
+		},
+		terms: []string{
+			"Archaeopteryx lithographica",
+			"Carnotaurus sastrei",
+			"Ceratosaurus nasicornis",
+			"Eoraptor lunensis",
+			"Passer domesticus",
+			"Tyrannosaurus rex",
+		},
+		totLen: 536_000_000,
+	}
+
+	coll, err := timetree.PhyloXML(strings.NewReader(phyloXMLTest), 0)
+	if err != nil {
+		t.Fatalf("phyloxml: unexpected error: %v", err)
+	}
+	if names := coll.Names(); len(names) != 1 {
+		t.Fatalf("phyloxml: read %d trees, want %d", len(names), 1)
+	}
+	tr := coll.Tree("tree1")
+	testTree(t, tr, want)
+	if got := tr.Meta(2, "bootstrap"); got != "95" {
+		t.Errorf("phyloxml: confidence: got %q, want %q", got, "95")
+	}
+}
+
+func TestPhyloXMLRoundTrip(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("phyloxml: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+	d.SetMeta(8, "posterior", "0.95")
+	d.SetMeta(8, "height_95%_hpd", "{155,165}")
+
+	var buf bytes.Buffer
+	if err := c.PhyloXML(&buf); err != nil {
+		t.Fatalf("phyloxml: while writing data: %v", err)
+	}
+
+	nc, err := timetree.PhyloXML(strings.NewReader(buf.String()), 500_000_000)
+	if err != nil {
+		t.Fatalf("phyloxml: while reading data: %v", err)
+	}
+	if got := nc.Names(); !reflect.DeepEqual(got, c.Names()) {
+		t.Fatalf("phyloxml: read trees %v, want %v", got, c.Names())
+	}
+
+	nt := nc.Tree("dinos")
+	for _, id := range d.Nodes() {
+		got := getNode(nt, id)
+		want := getNode(d, id)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("phyloxml: node %d: got %v, want %v", id, got, want)
+		}
+	}
+	for _, k := range d.MetaKeys(8) {
+		if got := nt.Meta(8, k); got != d.Meta(8, k) {
+			t.Errorf("phyloxml: metadata %q: got %q, want %q", k, got, d.Meta(8, k))
+		}
+	}
+}
+
+func TestPhyloXMLDeep(t *testing.T) {
+	// a pectinate tree,
+	// below the nesting limit
+	// of the XML decoder
+	// (as the output is indented,
+	// its size grows with the square
+	// of the number of terminals)
+	const numTerms = 1_000
+
+	var b strings.Builder
+	for i := 0; i < numTerms-1; i++ {
+		fmt.Fprintf(&b, "(t%d:1,", i)
+	}
+	fmt.Fprintf(&b, "t%d:1,t%d:1", numTerms-1, numTerms)
+	for i := 0; i < numTerms-1; i++ {
+		fmt.Fprintf(&b, ")")
+		if i < numTerms-2 {
+			fmt.Fprintf(&b, ":1")
+		}
+	}
+	b.WriteString(";\n")
+
+	c, err := timetree.Newick(strings.NewReader(b.String()), "deep", 0)
+	if err != nil {
+		t.Fatalf("deep: unexpected error: %v", err)
+	}
+	tr := c.Tree("deep")
+
+	var buf bytes.Buffer
+	if err := c.PhyloXML(&buf); err != nil {
+		t.Fatalf("deep: while writing data: %v", err)
+	}
+	nc, err := timetree.PhyloXML(strings.NewReader(buf.String()), 0)
+	if err != nil {
+		t.Fatalf("deep: while reading data: %v", err)
+	}
+	nt := nc.Tree("deep")
+	if nt == nil {
+		t.Fatalf("deep: tree %q not found", "deep")
+	}
+	if !nt.Equal(tr) {
+		t.Errorf("deep: trees are different")
+	}
+}
+
+func TestPhyloXMLError(t *testing.T) {
+	if _, err := timetree.PhyloXML(strings.NewReader("<nexml></nexml>"), 0); !errors.Is(err, timetree.ErrNotPhyloXML) {
+		t.Errorf("phyloxml: got error %v, want %v", err, timetree.ErrNotPhyloXML)
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// Rerooting errors
+	ErrRerootNode = errors.New("invalid rerooting node")
+	ErrRerootDist = errors.New("invalid rerooting distance")
+)
+
+// Reroot moves the root of the tree
+// to the branch that ends in the indicated node,
+// at the indicated distance
+// (in years)
+// from the node.
+// If the root of the tree has two children,
+// the branches of both children
+// are taken as a single branch,
+// so the distance can be as long
+// as the sum of both branches.
+// The branch lengths are kept,
+// and the new ages are set
+// so the age of the youngest terminal
+// is the same as before.
+// The clades that are not preserved
+// after rerooting
+// lose their names and metadata,
+// and the name and metadata of the old root
+// are moved to the new root.
+// The node IDs are updated.
+func (t *Tree) Reroot(id int, dist int64) error {
+	n, ok := t.nodes[id]
+	if !ok || n.parent == nil {
+		return fmt.Errorf("%w: %d", ErrRerootNode, id)
+	}
+
+	other := n.parent
+	l := n.brLen
+	removed := len(t.root.children) == 2
+	if removed && other == t.root {
+		other = t.root.children[0]
+		if other == n {
+			other = t.root.children[1]
+		}
+		l += other.brLen
+	}
+	if dist < 0 || dist > l {
+		return fmt.Errorf("%w: %d for node %d with branch length %d", ErrRerootDist, dist, id, l)
+	}
+
+	// nodes whose clade is changed
+	flipped := make(map[*node]bool)
+	for p := n.parent; p != nil; p = p.parent {
+		if p == t.root && removed {
+			break
+		}
+		flipped[p] = true
+	}
+
+	youngest := int64(math.MaxInt64)
+	for _, d := range t.root.preOrder(nil) {
+		if d.isTerm() && d.age < youngest {
+			youngest = d.age
+		}
+	}
+
+	adj := t.unrooted()
+	adj[n] = removeEdge(adj[n], other)
+	adj[other] = removeEdge(adj[other], n)
+
+	old := t.root
+	root := &node{
+		taxon: old.taxon,
+		meta:  old.meta,
+	}
+	adj[root] = []edge{{to: n, len: dist}, {to: other, len: l - dist}}
+	adj[n] = append(adj[n], edge{to: root, len: dist})
+	adj[other] = append(adj[other], edge{to: root, len: l - dist})
+
+	if old.taxon != "" {
+		t.taxa[old.taxon] = root
+	}
+	old.taxon = ""
+	old.meta = nil
+
+	// set the new parents
+	stack := []*node{root}
+	for len(stack) > 0 {
+		d := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d.children = nil
+		for _, e := range adj[d] {
+			if e.to == d.parent {
+				continue
+			}
+			e.to.parent = d
+			e.to.brLen = e.len
+			d.children = append(d.children, e.to)
+			stack = append(stack, e.to)
+		}
+	}
+
+	for d := range flipped {
+		if d.taxon != "" {
+			delete(t.taxa, d.taxon)
+		}
+		d.taxon = ""
+		d.meta = nil
+		d.rotated = false
+		d.fixed = false
+	}
+
+	t.root = root
+	root.age = youngest + root.maxLen()
+	root.propagateAge()
+
+	t.invalidate()
+	t.Format()
+	return nil
+}
+
+// MAD returns the position of the root
+// that minimizes the ancestor deviation
+// (Tria et al. 2017, Nat. Ecol. Evol. 1: 0193),
+// i.e.,
+// the root position for which the midpoint
+// of the path between any pair of terminals
+// is closest to their common ancestor.
+// It returns the ID of the node
+// whose branch has the root,
+// the distance
+// (in years)
+// from the node to the root,
+// as used by Reroot,
+// and the ancestor deviation
+// of that root position.
+// The branch lengths are taken as an unrooted tree,
+// so the current root is ignored.
+func (t *Tree) MAD() (id int, dist int64, dev float64) {
+	ns := t.root.preOrder(nil)
+	idx := make(map[*node]int, len(ns))
+	for i, n := range ns {
+		idx[n] = i
+	}
+	var terms []*node
+	for _, n := range ns {
+		if n.isTerm() {
+			terms = append(terms, n)
+		}
+	}
+
+	// distances from each terminal
+	// to each node
+	adj := t.unrooted()
+	d := make([][]float64, len(terms))
+	for i, tm := range terms {
+		d[i] = make([]float64, len(ns))
+		seen := map[*node]bool{tm: true}
+		stack := []*node{tm}
+		for len(stack) > 0 {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, e := range adj[n] {
+				if seen[e.to] {
+					continue
+				}
+				seen[e.to] = true
+				d[i][idx[e.to]] = d[i][idx[n]] + float64(e.len)
+				stack = append(stack, e.to)
+			}
+		}
+	}
+
+	id = -1
+	dev = math.Inf(1)
+	removed := len(t.root.children) == 2
+	below := make([]bool, len(terms))
+	for _, n := range ns {
+		if n.parent == nil {
+			continue
+		}
+		l := float64(n.brLen)
+		if removed && n.parent == t.root {
+			if n != t.root.children[0] {
+				continue
+			}
+			l += float64(t.root.children[1].brLen)
+		}
+
+		desc := make(map[*node]bool)
+		for _, c := range n.preOrder(nil) {
+			desc[c] = true
+		}
+		for i, tm := range terms {
+			below[i] = desc[tm]
+		}
+		ni := idx[n]
+
+		// the best position
+		// in the branch
+		var num, den float64
+		for i := range terms {
+			for j := range terms {
+				if !below[i] || below[j] {
+					continue
+				}
+				dij := d[i][idx[terms[j]]]
+				if dij == 0 {
+					continue
+				}
+				num += (dij - 2*d[i][ni]) / (dij * dij)
+				den += 1 / (dij * dij)
+			}
+		}
+		rho := 0.5
+		if l > 0 && den > 0 {
+			rho = num / (2 * l * den)
+		}
+		rho = math.Min(math.Max(rho, 0), 1)
+
+		var sum float64
+		var pairs int
+		for i := range terms {
+			for j := i + 1; j < len(terms); j++ {
+				dij := d[i][idx[terms[j]]]
+				if dij == 0 {
+					continue
+				}
+				var r float64
+				switch {
+				case below[i] && !below[j]:
+					r = 2*(d[i][ni]+rho*l)/dij - 1
+				case below[j] && !below[i]:
+					r = 2*(d[j][ni]+rho*l)/dij - 1
+				default:
+					r = (d[i][ni] - d[j][ni]) / dij
+				}
+				sum += r * r
+				pairs++
+			}
+		}
+		var v float64
+		if pairs > 0 {
+			v = math.Sqrt(sum / float64(pairs))
+		}
+		if v < dev {
+			id = n.id
+			dist = int64(math.Round(rho * l))
+			dev = v
+		}
+	}
+	if id < 0 {
+		dev = 0
+	}
+	return id, dist, dev
+}
+
+// An edge is a branch of an unrooted tree.
+type edge struct {
+	to  *node
+	len int64
+}
+
+// Unrooted returns the branches of the tree
+// as an unrooted tree.
+// If the root has two children,
+// the root is removed,
+// and its children are joined
+// by a single branch.
+func (t *Tree) unrooted() map[*node][]edge {
+	adj := make(map[*node][]edge, len(t.nodes))
+	for _, n := range t.root.preOrder(nil) {
+		if n.parent == nil {
+			continue
+		}
+		adj[n.parent] = append(adj[n.parent], edge{to: n, len: n.brLen})
+		adj[n] = append(adj[n], edge{to: n.parent, len: n.brLen})
+	}
+
+	if len(t.root.children) != 2 {
+		return adj
+	}
+	a := t.root.children[0]
+	b := t.root.children[1]
+	l := a.brLen + b.brLen
+	adj[a] = append(removeEdge(adj[a], t.root), edge{to: b, len: l})
+	adj[b] = append(removeEdge(adj[b], t.root), edge{to: a, len: l})
+	delete(adj, t.root)
+	return adj
+}
+
+// RemoveEdge removes the branch to a node
+// from a list of branches.
+func removeEdge(es []edge, to *node) []edge {
+	for i, e := range es {
+		if e.to == to {
+			return append(es[:i:i], es[i+1:]...)
+		}
+	}
+	return es
+}
@@ -0,0 +1,124 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package timetree_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/timetree"
+)
+
+func TestReroot(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("Reroot: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+	if err := d.SetName(d.Root(), "Dinosauria"); err != nil {
+		t.Fatalf("Reroot: unexpected error: %v", err)
+	}
+	if err := d.SetName(2, "Theropoda"); err != nil {
+		t.Fatalf("Reroot: unexpected error: %v", err)
+	}
+	if err := d.SetName(3, "Ceratosauria"); err != nil {
+		t.Fatalf("Reroot: unexpected error: %v", err)
+	}
+
+	// root in the branch of Passer domesticus
+	term, _ := d.TaxNode("Passer domesticus")
+	if err := d.Reroot(term, 10_000_000); err != nil {
+		t.Fatalf("Reroot: unexpected error: %v", err)
+	}
+
+	if got := d.Taxon(d.Root()); got != "Dinosauria" {
+		t.Errorf("Reroot: root name: got %q, want %q", got, "Dinosauria")
+	}
+	if _, ok := d.TaxNode("Theropoda"); ok {
+		t.Errorf("Reroot: taxon %q should be removed", "Theropoda")
+	}
+	if id, ok := d.TaxNode("Ceratosauria"); !ok {
+		t.Errorf("Reroot: taxon %q not found", "Ceratosauria")
+	} else if got := d.CladeTerms(id); len(got) != 2 {
+		t.Errorf("Reroot: taxon %q: got terminals %v", "Ceratosauria", got)
+	}
+	term, _ = d.TaxNode("Passer domesticus")
+	if d.Parent(term) != d.Root() {
+		t.Errorf("Reroot: taxon %q: got parent %d, want %d", "Passer domesticus", d.Parent(term), d.Root())
+	}
+	if got := d.BranchLen(term); got != 10_000_000 {
+		t.Errorf("Reroot: taxon %q: branch length: got %d, want %d", "Passer domesticus", got, 10_000_000)
+	}
+	if got := d.Age(term); got != 369_000_000 {
+		t.Errorf("Reroot: taxon %q: age: got %d, want %d", "Passer domesticus", got, 369_000_000)
+	}
+	cs, _ := d.TaxNode("Carnotaurus sastrei")
+	if got := d.Age(cs); got != 0 {
+		t.Errorf("Reroot: taxon %q: age: got %d, want %d", "Carnotaurus sastrei", got, 0)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Reroot: unexpected error: %v", err)
+	}
+
+	if err := d.Reroot(d.Root(), 0); !errors.Is(err, timetree.ErrRerootNode) {
+		t.Errorf("Reroot: got error %v, want %v", err, timetree.ErrRerootNode)
+	}
+	if err := d.Reroot(term, 500_000_000); !errors.Is(err, timetree.ErrRerootDist) {
+		t.Errorf("Reroot: got error %v, want %v", err, timetree.ErrRerootDist)
+	}
+}
+
+var clockTree = `tree	node	parent	age	taxon
+clock	0	-1	30000000	
+clock	1	0	10000000	
+clock	2	1	0	A
+clock	3	1	0	B
+clock	4	0	20000000	
+clock	5	4	0	C
+clock	6	4	5000000	
+clock	7	6	0	D
+clock	8	6	0	E
+`
+
+func TestMAD(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(clockTree))
+	if err != nil {
+		t.Fatalf("MAD: unexpected error: %v", err)
+	}
+	d := c.Tree("clock")
+	want := d.Canonical()
+
+	// in a clock-like tree
+	// the original root has no deviation
+	id, dist, dev := d.MAD()
+	if dev > 1e-9 {
+		t.Errorf("MAD: deviation: got %.6f, want %.6f", dev, 0.0)
+	}
+	if err := d.Reroot(id, dist); err != nil {
+		t.Fatalf("MAD: unexpected error: %v", err)
+	}
+	if got := d.Canonical(); got != want {
+		t.Errorf("MAD: got tree %q, want %q", got, want)
+	}
+
+	term, _ := d.TaxNode("D")
+	if err := d.Reroot(term, 2_000_000); err != nil {
+		t.Fatalf("MAD: unexpected error: %v", err)
+	}
+	if d.Canonical() == want {
+		t.Fatalf("MAD: tree not rerooted")
+	}
+	id, dist, dev = d.MAD()
+	if dev > 1e-9 {
+		t.Errorf("MAD: deviation: got %.6f, want %.6f", dev, 0.0)
+	}
+	if err := d.Reroot(id, dist); err != nil {
+		t.Fatalf("MAD: unexpected error: %v", err)
+	}
+	if got := d.Canonical(); got != want {
+		t.Errorf("MAD: got tree %q, want %q", got, want)
+	}
+}
@@ -3,11 +3,21 @@
 // Distributed under BSD2 license that can be found in the LICENSE file.
 
 // Package simulate creates random trees.
+//
+// All the generators take a random number generator,
+// so it is possible to control the determinism of a simulation
+// (for example, using a generator with a fixed seed),
+// or to run concurrent simulations
+// each one with its own generator.
+// If the generator is nil,
+// the global generator of the package math/rand/v2
+// is used.
 package simulate
 
 import (
 	"cmp"
 	"fmt"
+	"math"
 	"math/rand/v2"
 	"slices"
 
@@ -21,6 +31,39 @@ type Rander interface {
 	Rand() float64
 }
 
+// GlobalSource is a random source
+// that uses the global generator.
+type globalSource struct{}
+
+func (globalSource) Uint64() uint64 {
+	return rand.Uint64()
+}
+
+// RandGen returns the random number generator
+// used by a simulation.
+func randGen(rnd *rand.Rand) *rand.Rand {
+	if rnd == nil {
+		return rand.New(globalSource{})
+	}
+	return rnd
+}
+
+// Source adapts a random number generator
+// to the source used by the gonum distributions.
+type source struct {
+	rnd *rand.Rand
+}
+
+func (s source) Uint64() uint64 {
+	return s.rnd.Uint64()
+}
+
+// Seed is required by the source interface
+// used by the gonum distributions,
+// but the generator is never seeded
+// by a distribution.
+func (s source) Seed(uint64) {}
+
 // Uniform creates a random tree using a uniform prior
 // based on the method described by
 // Ronquist et al. (2012)
@@ -29,23 +72,25 @@ type Rander interface {
 // Syst. Biol. 61: 973-999.
 // doi:10.1093/sysbio/sys058.
 // Uniform panics if len(ages) < 2,
-func Uniform(name string, max, min int64, ages []int64) *timetree.Tree {
+func Uniform(rnd *rand.Rand, name string, max, min int64, ages []int64) *timetree.Tree {
 	if len(ages) < 2 {
 		panic("expecting more than two terminals")
 	}
+	rnd = randGen(rnd)
 
-	for _, a := range ages[1:] {
-		if a > min {
-			min = a
+	// the root must be older than any terminal
+	for _, a := range ages {
+		if a >= min {
+			min = a + 1
 		}
 	}
 	rootAge := max
 	if max > min {
-		rootAge = rand.Int64N(max-min) + min
+		rootAge = rnd.Int64N(max-min) + min
 	}
 
 	// shuffle terminals
-	rand.Shuffle(len(ages), func(i, j int) {
+	rnd.Shuffle(len(ages), func(i, j int) {
 		ages[i], ages[j] = ages[j], ages[i]
 	})
 
@@ -61,7 +106,7 @@ func Uniform(name string, max, min int64, ages []int64) *timetree.Tree {
 
 	for i, a := range ages[2:] {
 		// pick sister
-		s := added[rand.IntN(i+2)]
+		s := added[rnd.IntN(i+2)]
 		sis, _ := t.TaxNode(s)
 
 		// pick age
@@ -69,7 +114,7 @@ func Uniform(name string, max, min int64, ages []int64) *timetree.Tree {
 		if sa := t.Age(sis); sa > a {
 			oldest = sa
 		}
-		age := rootAge - rand.Int64N(rootAge-oldest) + 1
+		age := rootAge - rnd.Int64N(rootAge-oldest) + 1
 
 		// search coalescent sister
 		for {
@@ -96,24 +141,262 @@ func Uniform(name string, max, min int64, ages []int64) *timetree.Tree {
 // with a population size of n.
 // see Felsenstein J. (2004)
 // "Inferring Phylogenies", Sinauer, p.456.
-// Coalescent panics if terms < 2.
-func Coalescent(name string, n float64, max int64, terms int) *timetree.Tree {
+// The coalescence events are simulated
+// as in Skyline,
+// with a single epoch.
+// Coalescent panics if terms < 2,
+// or if n is not positive.
+func Coalescent(rnd *rand.Rand, name string, n float64, max int64, terms int) *timetree.Tree {
 	if terms < 2 {
 		panic("expecting more than two terminals")
 	}
+	rnd = randGen(rnd)
 
-	ages := make([]int64, terms-1)
-	for i := range ages {
-		rate := float64((i+2)*(i+1)) / (4 * n)
-		exp := distuv.Exponential{
-			Rate: rate,
+	ages := coalescentAges(rnd, newSkyline(n, nil), max, terms)
+	return coalescentTree(rnd, name, ages)
+}
+
+// Growth creates a random tree
+// using the Kingman coalescence
+// with a population that grows exponentially,
+// with a size of n at the present,
+// and the indicated growth rate
+// per million years,
+// so at a given age t
+// (in million years)
+// the population size is n*exp(-rate*t).
+// A fast growing population produces
+// star-like trees.
+// If the rate is zero,
+// the population size is constant.
+// The coalescence events are simulated
+// from the present to the past,
+// and each waiting time
+// starts at the age of the previous event.
+// The waiting times are conditioned
+// on events not older than max.
+// Growth panics if terms < 2,
+// or if the rate is negative.
+func Growth(rnd *rand.Rand, name string, n, rate float64, max int64, terms int) *timetree.Tree {
+	if terms < 2 {
+		panic("expecting more than two terminals")
+	}
+	if rate < 0 {
+		panic("expecting a non negative growth rate")
+	}
+	rnd = randGen(rnd)
+
+	// rate per year
+	gr := growth{n: n, g: rate / 1_000_000}
+
+	ages := coalescentAges(rnd, gr, max, terms)
+	return coalescentTree(rnd, name, ages)
+}
+
+// An Epoch is a change
+// in the population size
+// of a coalescent
+// at a given age.
+type Epoch struct {
+	// Age of the start of the epoch,
+	// in years.
+	Age int64
+
+	// Size of the population
+	// from the age of the epoch
+	// to the next (older) epoch.
+	Size float64
+}
+
+// Skyline creates a random tree
+// using the Kingman coalescence
+// with a piecewise constant population size
+// (a skyline).
+// The size n is used from the present
+// to the youngest epoch.
+// The coalescence events are simulated
+// from the present to the past,
+// and each waiting time
+// starts at the age of the previous event,
+// so each population size is used
+// only in the time of its epoch.
+// The waiting times are conditioned
+// on events not older than max.
+// Skyline panics if terms < 2,
+// or if a population size is not positive.
+func Skyline(rnd *rand.Rand, name string, n float64, epochs []Epoch, max int64, terms int) *timetree.Tree {
+	if terms < 2 {
+		panic("expecting more than two terminals")
+	}
+	rnd = randGen(rnd)
+	sky := newSkyline(n, epochs)
+
+	ages := coalescentAges(rnd, sky, max, terms)
+	return coalescentTree(rnd, name, ages)
+}
+
+// A popSize is the size of a population
+// through time.
+type popSize interface {
+	// Intensity returns the integral
+	// of the inverse of the population size
+	// between two ages
+	// (in years).
+	intensity(from, to float64) float64
+
+	// Age returns the age
+	// at which the intensity
+	// from an age
+	// reaches the value w.
+	age(from, w float64) float64
+}
+
+// CoalescentAges returns the ages
+// of the coalescence events
+// of a number of terminals,
+// in a population with the indicated size,
+// from the youngest to the oldest event.
+// Each waiting time is measured
+// from the age of the previous event,
+// and it is drawn from an exponential distribution
+// truncated at the age max,
+// so no event is older than max,
+// unless max is too young
+// to keep the events at least one year apart.
+func coalescentAges(rnd *rand.Rand, pop popSize, max int64, terms int) []int64 {
+	ages := make([]int64, 0, terms-1)
+	var age float64
+	var prev int64
+	for k := terms; k > 1; k-- {
+		c := float64(k*(k-1)) / 4
+
+		// waiting time in units of the integrated rate,
+		// truncated at the maximum age,
+		// leaving a year for each remaining event
+		lim := c * pop.intensity(age, float64(max-int64(k-2)))
+		w := -math.Log1p(rnd.Float64() * math.Expm1(-lim))
+		if next := pop.age(age, w/c); next > age {
+			age = next
 		}
-		a := int64(exp.Rand())
-		for a > max {
-			a = int64(exp.Rand())
+
+		a := int64(age)
+		if a <= prev {
+			a = prev + 1
 		}
-		ages[i] = a
+		if float64(a) > age {
+			age = float64(a)
+		}
+		ages = append(ages, a)
+		prev = a
 	}
+	return ages
+}
+
+// A growth is a population size
+// that grows exponentially.
+type growth struct {
+	// size at the present
+	n float64
+
+	// growth rate per year
+	g float64
+}
+
+func (gr growth) intensity(from, to float64) float64 {
+	if to <= from {
+		return 0
+	}
+	if gr.g == 0 {
+		return (to - from) / gr.n
+	}
+	return math.Exp(gr.g*from) * math.Expm1(gr.g*(to-from)) / (gr.n * gr.g)
+}
+
+func (gr growth) age(from, w float64) float64 {
+	if gr.g == 0 {
+		return from + w*gr.n
+	}
+	return from + math.Log1p(w*gr.n*gr.g*math.Exp(-gr.g*from))/gr.g
+}
+
+// A skyline is a piecewise constant
+// population size.
+type skyline struct {
+	// ages of the start of each interval
+	// (from the youngest to the oldest)
+	ages []int64
+
+	sizes []float64
+}
+
+func newSkyline(n float64, epochs []Epoch) skyline {
+	epochs = slices.Clone(epochs)
+	slices.SortStableFunc(epochs, func(a, b Epoch) int {
+		return cmp.Compare(a.Age, b.Age)
+	})
+
+	s := skyline{
+		ages:  []int64{0},
+		sizes: []float64{n},
+	}
+	for _, e := range epochs {
+		if e.Age <= s.ages[len(s.ages)-1] {
+			s.sizes[len(s.sizes)-1] = e.Size
+			continue
+		}
+		s.ages = append(s.ages, e.Age)
+		s.sizes = append(s.sizes, e.Size)
+	}
+	for _, sz := range s.sizes {
+		if sz <= 0 {
+			panic("expecting a positive population size")
+		}
+	}
+	return s
+}
+
+func (s skyline) intensity(from, to float64) float64 {
+	if to <= from {
+		return 0
+	}
+	var v float64
+	for i, start := range s.ages {
+		end := math.Inf(1)
+		if i+1 < len(s.ages) {
+			end = float64(s.ages[i+1])
+		}
+		lo := math.Max(from, float64(start))
+		hi := math.Min(to, end)
+		if hi > lo {
+			v += (hi - lo) / s.sizes[i]
+		}
+	}
+	return v
+}
+
+func (s skyline) age(from, w float64) float64 {
+	for i := range s.ages {
+		end := math.Inf(1)
+		if i+1 < len(s.ages) {
+			end = float64(s.ages[i+1])
+		}
+		if end <= from {
+			continue
+		}
+		if l := (end - from) / s.sizes[i]; l < w {
+			w -= l
+			from = end
+			continue
+		}
+		return from + w*s.sizes[i]
+	}
+	panic("unreachable")
+}
+
+// CoalescentTree builds a random coalescent tree
+// with the given coalescence ages.
+func coalescentTree(rnd *rand.Rand, name string, ages []int64) *timetree.Tree {
+	terms := len(ages) + 1
 	slices.SortFunc(ages, func(a, b int64) int {
 		return cmp.Compare(b, a)
 	})
@@ -130,7 +413,7 @@ func Coalescent(name string, n float64, max int64, terms int) *timetree.Tree {
 
 	for i := 2; i < terms; i++ {
 		// pick sister
-		s := added[rand.IntN(i)]
+		s := added[rnd.IntN(i)]
 		sis, _ := t.TaxNode(s)
 
 		// pick age
@@ -162,13 +445,15 @@ func Coalescent(name string, n float64, max int64, terms int) *timetree.Tree {
 // or when all proposed speciation events are in the future.
 // It returns false if less than two terminals are included.
 // Yule panics if terms < 2.
-func Yule(name string, spRate float64, rootAge int64, terms int) (*timetree.Tree, bool) {
+func Yule(rnd *rand.Rand, name string, spRate float64, rootAge int64, terms int) (*timetree.Tree, bool) {
 	if terms < 2 {
 		panic("expecting more than two terminals")
 	}
+	rnd = randGen(rnd)
 
 	exp := distuv.Exponential{
 		Rate: spRate,
+		Src:  source{rnd},
 	}
 
 	t := timetree.New(name, rootAge)
@@ -231,25 +516,28 @@ func yuleNode(t *timetree.Tree, n, max int, added *int, exp distuv.Exponential)
 // of when all proposed events are in the future.
 // It returns false if less than two terminals are included.
 // BirthDeath panics if terms < 2.
-func BirthDeath(name string, spRate, extRate float64, rootAge int64, terms int) (*timetree.Tree, bool) {
+func BirthDeath(rnd *rand.Rand, name string, spRate, extRate float64, rootAge int64, terms int) (*timetree.Tree, bool) {
 	if terms < 2 {
 		panic("expecting more than two terminals")
 	}
+	rnd = randGen(rnd)
 
 	if extRate == 0 {
-		return Yule(name, spRate, rootAge, terms)
+		return Yule(rnd, name, spRate, rootAge, terms)
 	}
 
 	sp := distuv.Exponential{
 		Rate: spRate,
+		Src:  source{rnd},
 	}
 	e := distuv.Exponential{
 		Rate: extRate,
+		Src:  source{rnd},
 	}
 
 	t := timetree.New(name, rootAge)
 	added := 0
-	bdNode(t, 0, terms-2, &added, sp, e)
+	bdNode(t, 0, terms-2, &added, expEvent(sp), expEvent(e))
 
 	if len(t.Terms()) < 2 {
 		return t, false
@@ -258,12 +546,30 @@ func BirthDeath(name string, spRate, extRate float64, rootAge int64, terms int)
 	return t, true
 }
 
-func bdNode(t *timetree.Tree, n, max int, added *int, sp, ext distuv.Exponential) {
+// ExpEvent returns a function that returns
+// the age of the next event
+// of a lineage alive at a given age,
+// with a waiting time drawn
+// from an exponential distribution.
+func expEvent(exp distuv.Exponential) func(age int64) int64 {
+	return func(age int64) int64 {
+		return age - int64(exp.Rand()*1_000_000)
+	}
+}
+
+// BdNode adds the descendants of a node
+// in a birth-death process.
+// The functions sp and ext return the age
+// of the next speciation and extinction event
+// of a lineage;
+// a negative age indicates
+// that the event is in the future.
+func bdNode(t *timetree.Tree, n, max int, added *int, sp, ext func(age int64) int64) {
 	age := t.Age(n)
 	if t.NumInternal() >= max {
 		// left descendant
 		brLen := age
-		if e := age - int64(ext.Rand()*1_000_000); e > 0 {
+		if e := ext(age); e > 0 {
 			brLen = age - e
 		}
 		term := fmt.Sprintf("term%d", *added)
@@ -272,7 +578,7 @@ func bdNode(t *timetree.Tree, n, max int, added *int, sp, ext distuv.Exponential
 
 		// right descendant
 		brLen = age
-		if e := age - int64(ext.Rand()*1_000_000); e > 0 {
+		if e := ext(age); e > 0 {
 			brLen = age - e
 		}
 		term = fmt.Sprintf("term%d", *added)
@@ -282,8 +588,8 @@ func bdNode(t *timetree.Tree, n, max int, added *int, sp, ext distuv.Exponential
 	}
 
 	// left descendant
-	spNext := age - int64(sp.Rand()*1_000_000)
-	eNext := age - int64(ext.Rand()*1_000_000)
+	spNext := sp(age)
+	eNext := ext(age)
 	if spNext < 0 && eNext < 0 {
 		term := fmt.Sprintf("term%d", *added)
 		t.Add(n, age, term)
@@ -298,7 +604,7 @@ func bdNode(t *timetree.Tree, n, max int, added *int, sp, ext distuv.Exponential
 	}
 
 	// right descendant
-	eNext = age - int64(ext.Rand()*1_000_000)
+	eNext = ext(age)
 	if t.NumInternal() >= max {
 		brLen := age
 		if eNext > 0 {
@@ -310,7 +616,7 @@ func bdNode(t *timetree.Tree, n, max int, added *int, sp, ext distuv.Exponential
 		return
 	}
 
-	spNext = age - int64(sp.Rand()*1_000_000)
+	spNext = sp(age)
 	if spNext < 0 && eNext < 0 {
 		term := fmt.Sprintf("term%d", *added)
 		t.Add(n, age, term)
@@ -326,3 +632,251 @@ func bdNode(t *timetree.Tree, n, max int, added *int, sp, ext distuv.Exponential
 	right, _ := t.Add(n, age-spNext, "")
 	bdNode(t, right, max, added, sp, ext)
 }
+
+// A Shift is a change
+// in the diversification rates
+// at a given age.
+type Shift struct {
+	// Age of the shift,
+	// in years.
+	Age int64
+
+	// Speciation and extinction rates,
+	// in million years,
+	// from the age of the shift
+	// to the next (younger) shift,
+	// or the present.
+	Speciation float64
+	Extinction float64
+}
+
+// RateShifts creates a birth-death tree
+// with a piecewise constant schedule
+// of speciation and extinction rates,
+// in million years,
+// stopping when the number of terminals is reached
+// or when all proposed events are in the future.
+// The rates spRate and extRate are used
+// from the root to the oldest shift.
+// A Yule process is simulated
+// if all extinction rates are zero.
+// It returns false if less than two terminals are included.
+// RateShifts panics if terms < 2.
+func RateShifts(rnd *rand.Rand, name string, spRate, extRate float64, shifts []Shift, rootAge int64, terms int) (*timetree.Tree, bool) {
+	if terms < 2 {
+		panic("expecting more than two terminals")
+	}
+
+	s := newSchedule(randGen(rnd), spRate, extRate, shifts, rootAge)
+	sp := func(age int64) int64 {
+		return s.next(age, s.sp)
+	}
+	ext := func(age int64) int64 {
+		return s.next(age, s.ext)
+	}
+
+	t := timetree.New(name, rootAge)
+	added := 0
+	bdNode(t, 0, terms-2, &added, sp, ext)
+
+	if len(t.Terms()) < 2 {
+		return t, false
+	}
+
+	return t, true
+}
+
+// A schedule is a piecewise constant schedule
+// of speciation and extinction rates.
+type schedule struct {
+	rnd *rand.Rand
+
+	// ages of the start of each interval
+	// (from the oldest to the youngest)
+	ages []int64
+
+	sp  []float64
+	ext []float64
+}
+
+func newSchedule(rnd *rand.Rand, spRate, extRate float64, shifts []Shift, rootAge int64) schedule {
+	shifts = slices.Clone(shifts)
+	slices.SortStableFunc(shifts, func(a, b Shift) int {
+		return cmp.Compare(b.Age, a.Age)
+	})
+
+	s := schedule{
+		rnd:  rnd,
+		ages: []int64{rootAge},
+		sp:   []float64{spRate},
+		ext:  []float64{extRate},
+	}
+	for _, sh := range shifts {
+		if sh.Age <= 0 {
+			continue
+		}
+		if sh.Age >= rootAge {
+			// the shift is older than the root
+			s.sp[0] = sh.Speciation
+			s.ext[0] = sh.Extinction
+			continue
+		}
+		if sh.Age == s.ages[len(s.ages)-1] {
+			s.sp[len(s.sp)-1] = sh.Speciation
+			s.ext[len(s.ext)-1] = sh.Extinction
+			continue
+		}
+		s.ages = append(s.ages, sh.Age)
+		s.sp = append(s.sp, sh.Speciation)
+		s.ext = append(s.ext, sh.Extinction)
+	}
+	return s
+}
+
+// Next returns the age of the next event
+// of a lineage alive at a given age,
+// using the indicated rates.
+// It returns -1 if the event is in the future.
+func (s schedule) next(age int64, rates []float64) int64 {
+	// waiting time in units of the integrated rate
+	w := s.rnd.ExpFloat64()
+	for i := range s.ages {
+		if i+1 < len(s.ages) && s.ages[i+1] >= age {
+			continue
+		}
+		end := int64(0)
+		if i+1 < len(s.ages) {
+			end = s.ages[i+1]
+		}
+		r := rates[i]
+		l := float64(age-end) / 1_000_000
+		if r*l >= w {
+			return age - int64(w/r*1_000_000)
+		}
+		w -= r * l
+		age = end
+	}
+	return -1
+}
+
+// Conditioned creates a birth-death tree
+// with the given speciation and extinction rates,
+// in million years,
+// conditioned on the age of the crown
+// (the root)
+// and the number of extant terminals,
+// so the tree always has exactly terms terminals,
+// all of them at the present,
+// and the indicated root age.
+// The tree is the reconstructed tree
+// (i.e., extinct lineages are not included).
+//
+// The ages of the internal nodes,
+// other than the root,
+// are the order statistics
+// of a sample of the distribution of speciation times
+// described by Gernhard (2008)
+// "The conditioned reconstructed process"
+// J. Theor. Biol. 253: 769-778.
+// doi:10.1016/j.jtbi.2008.04.005,
+// sampled directly in order,
+// and the topology is built
+// by splitting a random lineage
+// at each speciation time,
+// so no sample is discarded.
+// As ages are in years,
+// ages are adjusted
+// so each internal node has a different age,
+// older than the present,
+// and it returns an error
+// if the root age has not enough years
+// for the internal nodes.
+// Conditioned panics if terms < 2,
+// or spRate <= 0.
+func Conditioned(rnd *rand.Rand, name string, spRate, extRate float64, rootAge int64, terms int) (*timetree.Tree, error) {
+	if terms < 2 {
+		panic("expecting more than two terminals")
+	}
+	if spRate <= 0 {
+		panic("expecting a positive speciation rate")
+	}
+	if k := int64(terms - 2); rootAge-1 < k {
+		return nil, fmt.Errorf("root age of %d years too young for %d terminals", rootAge, terms)
+	}
+	rnd = randGen(rnd)
+
+	crown := float64(rootAge) / 1_000_000
+	ages := make([]int64, terms-1)
+	ages[0] = rootAge
+
+	// sorted uniform values,
+	// from the largest to the smallest,
+	// using the normalized spacings
+	// of exponential values
+	k := len(ages) - 1
+	sp := make([]float64, k+1)
+	var sum float64
+	for i := range sp {
+		sp[i] = rnd.ExpFloat64()
+		sum += sp[i]
+	}
+	u := 1.0
+	for i := 1; i < len(ages); i++ {
+		u -= sp[i-1] / sum
+		a := int64(speciationTime(spRate, extRate, crown, u) * 1_000_000)
+
+		// keep the ages different
+		// and older than the present
+		if a > ages[i-1]-1 {
+			a = ages[i-1] - 1
+		}
+		if rem := int64(len(ages) - i); a < rem {
+			a = rem
+		}
+		ages[i] = a
+	}
+
+	added := make([]string, 0, terms)
+	t := timetree.New(name, rootAge)
+	for i := range 2 {
+		term := fmt.Sprintf("term%d", i)
+		t.Add(0, rootAge, term)
+		added = append(added, term)
+	}
+
+	for i := 2; i < terms; i++ {
+		// pick the lineage to split
+		s := added[rnd.IntN(i)]
+		sis, _ := t.TaxNode(s)
+		age := ages[i-1]
+
+		term := fmt.Sprintf("term%d", i)
+		if _, err := t.AddSister(sis, 0, age, term); err != nil {
+			panic(fmt.Sprintf("unexpected error: %v", err))
+		}
+		added = append(added, term)
+	}
+
+	return t, nil
+}
+
+// SpeciationTime returns the speciation time
+// (in million years)
+// for a cumulative probability u
+// of the distribution of the speciation times
+// of a birth-death process
+// conditioned on the crown age.
+func speciationTime(spRate, extRate, crown, u float64) float64 {
+	r := spRate - extRate
+	if math.Abs(r) < 1e-12 {
+		// critical process
+		g := crown / (1 + spRate*crown)
+		y := u * g
+		return y / (1 - spRate*y)
+	}
+
+	g := (1 - math.Exp(-r*crown)) / (spRate - extRate*math.Exp(-r*crown))
+	y := u * g
+	x := (1 - y*spRate) / (1 - y*extRate)
+	return -math.Log(x) / r
+}
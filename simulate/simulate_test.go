@@ -0,0 +1,345 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package simulate_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/js-arias/timetree"
+	"github.com/js-arias/timetree/simulate"
+)
+
+// TestSimTree checks that a simulated tree
+// has the indicated number of terminals,
+// and that each node is younger than its parent.
+func testSimTree(t testing.TB, name string, tr *timetree.Tree, terms int) {
+	t.Helper()
+
+	if got := tr.NumTerms(); got != terms {
+		t.Errorf("%s: terminals: got %d, want %d", name, got, terms)
+	}
+	for _, id := range tr.Nodes() {
+		p := tr.Parent(id)
+		if p < 0 {
+			continue
+		}
+		if tr.Age(id) >= tr.Age(p) {
+			t.Errorf("%s: node %d: age %d, not younger than parent age %d", name, id, tr.Age(id), tr.Age(p))
+		}
+	}
+}
+
+func TestConditioned(t *testing.T) {
+	tests := map[string]struct {
+		sp, ext float64
+		root    int64
+		terms   int
+	}{
+		"yule":          {sp: 0.5, root: 50_000_000, terms: 30},
+		"birth-death":   {sp: 0.5, ext: 0.3, root: 50_000_000, terms: 30},
+		"critical":      {sp: 0.4, ext: 0.4, root: 50_000_000, terms: 30},
+		"two terminals": {sp: 0.5, root: 10_000_000, terms: 2},
+
+		// the root age has just enough years
+		// for the internal nodes
+		"young root": {sp: 1, root: 29, terms: 30},
+	}
+
+	for name, test := range tests {
+		tr, err := simulate.Conditioned(rand.New(rand.NewPCG(1, 2)), "test", test.sp, test.ext, test.root, test.terms)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if got := tr.Age(tr.Root()); got != test.root {
+			t.Errorf("%s: root age: got %d, want %d", name, got, test.root)
+		}
+		for _, tax := range tr.Terms() {
+			id, _ := tr.TaxNode(tax)
+			if a := tr.Age(id); a != 0 {
+				t.Errorf("%s: terminal %q: got age %d, want %d", name, tax, a, 0)
+			}
+		}
+		testSimTree(t, name, tr, test.terms)
+
+		// the same seed produces the same tree
+		other, _ := simulate.Conditioned(rand.New(rand.NewPCG(1, 2)), "test", test.sp, test.ext, test.root, test.terms)
+		if !tr.Equal(other) {
+			t.Errorf("%s: trees with the same seed are different", name)
+		}
+	}
+
+	// not enough years for the internal nodes
+	if _, err := simulate.Conditioned(rand.New(rand.NewPCG(1, 2)), "test", 1, 0, 20, 30); err == nil {
+		t.Errorf("conditioned: expecting error for a root age of %d years with %d terminals", 20, 30)
+	}
+}
+
+func TestSkyline(t *testing.T) {
+	const size = 100_000
+	const terms = 10
+
+	// with k lineages the expected waiting time
+	// is 4N/(k(k-1)),
+	// so the expected root age is 4N(1-1/k)
+	want := 4 * size * (1 - 1/float64(terms))
+
+	tests := map[string][]simulate.Epoch{
+		"constant":   nil,
+		"from start": {{Age: 0, Size: size}},
+		"same size":  {{Age: size, Size: size}, {Age: 2 * size, Size: size}},
+	}
+
+	for name, epochs := range tests {
+		n := float64(size)
+		if len(epochs) > 0 && epochs[0].Age == 0 {
+			n = 1
+		}
+		tr := simulate.Skyline(rand.New(rand.NewPCG(1, 2)), "test", n, epochs, 1_000_000_000, terms)
+		testSimTree(t, name, tr, terms)
+
+		// the same seed produces the same tree
+		other := simulate.Skyline(rand.New(rand.NewPCG(1, 2)), "test", n, epochs, 1_000_000_000, terms)
+		if !tr.Equal(other) {
+			t.Errorf("%s: trees with the same seed are different", name)
+		}
+
+		// a single epoch is the Kingman coalescent
+		if len(epochs) < 2 {
+			coal := simulate.Coalescent(rand.New(rand.NewPCG(1, 2)), "test", size, 1_000_000_000, terms)
+			if !tr.Equal(coal) {
+				t.Errorf("%s: skyline and coalescent trees with the same seed are different", name)
+			}
+		}
+
+		const reps = 2000
+		rnd := rand.New(rand.NewPCG(3, 4))
+		var sum float64
+		for range reps {
+			tr := simulate.Skyline(rnd, "test", n, epochs, 1_000_000_000, terms)
+			sum += float64(tr.Age(tr.Root()))
+		}
+		if mean := sum / reps; math.Abs(mean-want) > 0.05*want {
+			t.Errorf("%s: mean root age: got %.0f, want %.0f", name, mean, want)
+		}
+	}
+
+	// a smaller population in the past
+	// reduces the root age
+	epochs := []simulate.Epoch{{Age: size / 2, Size: size / 100}}
+	rnd := rand.New(rand.NewPCG(3, 4))
+	for range 100 {
+		tr := simulate.Skyline(rnd, "test", size, epochs, 1_000_000_000, terms)
+		testSimTree(t, "bottleneck", tr, terms)
+		if a := tr.Age(tr.Root()); a > 2*size {
+			t.Errorf("bottleneck: root age %d, want less than %d", a, 2*size)
+		}
+	}
+
+	// all events are younger than the maximum age
+	for range 100 {
+		tr := simulate.Skyline(rnd, "test", size, nil, size/10, terms)
+		testSimTree(t, "max age", tr, terms)
+		if a := tr.Age(tr.Root()); a > size/10 {
+			t.Errorf("max age: root age %d, want at most %d", a, size/10)
+		}
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	const size = 100_000
+	const terms = 10
+
+	tests := map[string]float64{
+		"constant": 0,
+		"slow":     1,
+		"fast":     10_000,
+	}
+
+	for name, rate := range tests {
+		tr := simulate.Growth(rand.New(rand.NewPCG(1, 2)), "test", size, rate, 1_000_000_000, terms)
+		testSimTree(t, name, tr, terms)
+
+		// the same seed produces the same tree
+		other := simulate.Growth(rand.New(rand.NewPCG(1, 2)), "test", size, rate, 1_000_000_000, terms)
+		if !tr.Equal(other) {
+			t.Errorf("%s: trees with the same seed are different", name)
+		}
+	}
+
+	// without growth,
+	// the expected root age is 4N(1-1/k)
+	want := 4 * size * (1 - 1/float64(terms))
+	const reps = 2000
+	rnd := rand.New(rand.NewPCG(3, 4))
+	var sum float64
+	for range reps {
+		tr := simulate.Growth(rnd, "test", size, 0, 1_000_000_000, terms)
+		sum += float64(tr.Age(tr.Root()))
+	}
+	if mean := sum / reps; math.Abs(mean-want) > 0.05*want {
+		t.Errorf("constant: mean root age: got %.0f, want %.0f", mean, want)
+	}
+
+	// with a fast growth,
+	// the events are close to each other
+	// (star-like trees),
+	// so the youngest event is old
+	// relative to the root age
+	// (in a constant population
+	// the expected ratio is about 0.012)
+	sum = 0
+	for range reps {
+		tr := simulate.Growth(rnd, "test", size, 10_000, 1_000_000_000, terms)
+		var young int64 = math.MaxInt64
+		for _, id := range tr.Nodes() {
+			if tr.IsTerm(id) {
+				continue
+			}
+			young = min(young, tr.Age(id))
+		}
+		sum += float64(young) / float64(tr.Age(tr.Root()))
+	}
+	if mean := sum / reps; mean < 0.3 {
+		t.Errorf("fast: mean ratio of youngest to root age: got %.3f, want at least %.3f", mean, 0.3)
+	}
+
+	// all events are younger than the maximum age
+	for range 100 {
+		tr := simulate.Growth(rnd, "test", size, 1, size/10, terms)
+		testSimTree(t, "max age", tr, terms)
+		if a := tr.Age(tr.Root()); a > size/10 {
+			t.Errorf("max age: root age %d, want at most %d", a, size/10)
+		}
+	}
+}
+
+func TestRateShifts(t *testing.T) {
+	const terms = 30
+
+	tests := map[string]struct {
+		sp, ext float64
+		shifts  []simulate.Shift
+	}{
+		"no shifts": {sp: 0.5},
+		"yule": {
+			sp: 0.1,
+			shifts: []simulate.Shift{
+				{Age: 30_000_000, Speciation: 0.5},
+				{Age: 10_000_000, Speciation: 1},
+			},
+		},
+		"birth-death": {
+			sp:  0.5,
+			ext: 0.1,
+			shifts: []simulate.Shift{
+				{Age: 20_000_000, Speciation: 1, Extinction: 0.2},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		tr, ok := simulate.RateShifts(rand.New(rand.NewPCG(1, 2)), "test", test.sp, test.ext, test.shifts, 50_000_000, terms)
+		if !ok {
+			t.Errorf("%s: expecting a tree with at least two terminals", name)
+			continue
+		}
+
+		// with extinction,
+		// the simulation might stop
+		// before reaching the number of terminals
+		want := terms
+		if test.ext > 0 && tr.NumTerms() < terms {
+			want = tr.NumTerms()
+		}
+		testSimTree(t, name, tr, want)
+
+		// the same seed produces the same tree
+		other, _ := simulate.RateShifts(rand.New(rand.NewPCG(1, 2)), "test", test.sp, test.ext, test.shifts, 50_000_000, terms)
+		if !tr.Equal(other) {
+			t.Errorf("%s: trees with the same seed are different", name)
+		}
+	}
+}
+
+func TestTaxonomy(t *testing.T) {
+	mammals := &simulate.Taxon{
+		Name: "Mammalia",
+		Children: []*simulate.Taxon{
+			{Name: "Bos taurus"},
+			{Name: "Homo sapiens"},
+			{Name: "Mus musculus"},
+		},
+		MinAge: 20_000_000,
+		MaxAge: 60_000_000,
+	}
+	birds := &simulate.Taxon{
+		Name: "Aves",
+		Children: []*simulate.Taxon{
+			{Name: "Gallus gallus"},
+			{Name: "Passer domesticus"},
+		},
+	}
+	root := &simulate.Taxon{
+		Name: "Amniota",
+		Children: []*simulate.Taxon{
+			mammals,
+			// a taxon with a single child
+			// is ignored
+			{Name: "Sauropsida", Children: []*simulate.Taxon{birds}},
+			{Name: "Anolis carolinensis"},
+		},
+	}
+
+	tr, err := simulate.Taxonomy(rand.New(rand.NewPCG(1, 2)), "test", root, 100_000_000, 300_000_000)
+	if err != nil {
+		t.Fatalf("taxonomy: unexpected error: %v", err)
+	}
+	testSimTree(t, "taxonomy", tr, 6)
+
+	if a := tr.Age(tr.Root()); a < 100_000_000 || a > 300_000_000 {
+		t.Errorf("taxonomy: root age %d, want between %d and %d", a, 100_000_000, 300_000_000)
+	}
+
+	for _, tx := range []*simulate.Taxon{mammals, birds} {
+		id, ok := tr.TaxNode(tx.Name)
+		if !ok {
+			t.Errorf("taxonomy: taxon %q not found", tx.Name)
+			continue
+		}
+		var want []string
+		for _, c := range tx.Children {
+			want = append(want, c.Name)
+		}
+		got := tr.CladeTerms(id)
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("taxonomy: taxon %q: got terminals %v, want %v", tx.Name, got, want)
+		}
+		if tx.MaxAge == 0 {
+			continue
+		}
+		if a := tr.Age(id); a < tx.MinAge || a > tx.MaxAge {
+			t.Errorf("taxonomy: taxon %q: age %d, want between %d and %d", tx.Name, a, tx.MinAge, tx.MaxAge)
+		}
+	}
+	if _, ok := tr.TaxNode("Sauropsida"); ok {
+		t.Errorf("taxonomy: taxon %q with a single child found in the tree", "Sauropsida")
+	}
+
+	// the same seed produces the same tree
+	other, _ := simulate.Taxonomy(rand.New(rand.NewPCG(1, 2)), "test", root, 100_000_000, 300_000_000)
+	if !tr.Equal(other) {
+		t.Errorf("taxonomy: trees with the same seed are different")
+	}
+
+	// the root is younger than the age bounds of a taxon
+	if _, err := simulate.Taxonomy(rand.New(rand.NewPCG(1, 2)), "test", root, 1_000_000, 10_000_000); err == nil {
+		t.Errorf("taxonomy: expecting error for a root younger than the minimum age of %q", mammals.Name)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package simulate
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/js-arias/timetree"
+)
+
+// A Taxon is a taxon of a taxonomy
+// used to constrain a simulation.
+// A taxon without children
+// is a terminal.
+type Taxon struct {
+	Name     string
+	Children []*Taxon
+
+	// MinAge and MaxAge are the bounds
+	// of the age of the crown of the taxon,
+	// in years.
+	// If MaxAge is 0,
+	// the age of the taxon is unconstrained.
+	MinAge int64
+	MaxAge int64
+}
+
+// Taxonomy creates a random tree
+// in which each taxon with two or more children
+// is a monophyletic group,
+// named with the name of the taxon,
+// and the terminals are the taxa without children.
+// Taxa with a single child are ignored.
+// The relationships inside a taxon are random,
+// and the age of each node is sampled uniformly
+// between the age of its parent
+// and the youngest age
+// that is compatible with the ages of its descendants.
+// The root age is sampled between min and max.
+// It returns an error if the age bounds of the taxa
+// can not be satisfied.
+func Taxonomy(rnd *rand.Rand, name string, root *Taxon, min, max int64) (*timetree.Tree, error) {
+	rnd = randGen(rnd)
+	root = collapse(root)
+	if len(root.Children) == 0 {
+		return nil, fmt.Errorf("taxon %q: expecting at least two terminals", root.Name)
+	}
+
+	lo := taxonBound(root)
+	if min > lo {
+		lo = min
+	}
+	hi := max
+	if root.MaxAge > 0 && root.MaxAge < hi {
+		hi = root.MaxAge
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("taxon %q: invalid age bounds", root.Name)
+	}
+
+	age := lo + rnd.Int64N(hi-lo+1)
+	t := timetree.New(name, age)
+	if root.Name != "" {
+		if err := t.SetName(t.Root(), root.Name); err != nil {
+			return nil, fmt.Errorf("taxon %q: %v", root.Name, err)
+		}
+	}
+	if err := addMembers(rnd, t, t.Root(), age, root.Children); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AddMembers adds a set of taxa
+// as descendants of a node,
+// with random relationships.
+func addMembers(rnd *rand.Rand, t *timetree.Tree, id int, age int64, members []*Taxon) error {
+	members = append([]*Taxon(nil), members...)
+	rnd.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	k := 1 + rnd.IntN(len(members)-1)
+
+	for _, part := range [][]*Taxon{members[:k], members[k:]} {
+		if len(part) == 1 {
+			if err := addTaxon(rnd, t, id, age, part[0]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		lo := membersBound(part)
+		hi := age - 1
+		if lo > hi {
+			return fmt.Errorf("node %d: invalid age bounds", id)
+		}
+		a := lo + rnd.Int64N(hi-lo+1)
+		child, err := t.Add(id, age-a, "")
+		if err != nil {
+			return err
+		}
+		if err := addMembers(rnd, t, child, a, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTaxon adds a taxon
+// as a descendant of a node.
+func addTaxon(rnd *rand.Rand, t *timetree.Tree, id int, age int64, tx *Taxon) error {
+	tx = collapse(tx)
+	if len(tx.Children) == 0 {
+		if _, err := t.Add(id, age, tx.Name); err != nil {
+			return fmt.Errorf("taxon %q: %v", tx.Name, err)
+		}
+		return nil
+	}
+
+	lo := taxonBound(tx)
+	hi := age - 1
+	if tx.MaxAge > 0 && tx.MaxAge < hi {
+		hi = tx.MaxAge
+	}
+	if lo > hi {
+		return fmt.Errorf("taxon %q: invalid age bounds", tx.Name)
+	}
+	a := lo + rnd.Int64N(hi-lo+1)
+	child, err := t.Add(id, age-a, tx.Name)
+	if err != nil {
+		return fmt.Errorf("taxon %q: %v", tx.Name, err)
+	}
+	return addMembers(rnd, t, child, a, tx.Children)
+}
+
+// Collapse returns the first descendant of a taxon
+// that is a terminal,
+// or that has two or more children.
+func collapse(tx *Taxon) *Taxon {
+	for len(tx.Children) == 1 {
+		tx = tx.Children[0]
+	}
+	return tx
+}
+
+// TaxonBound returns the youngest age
+// of the crown of a taxon.
+func taxonBound(tx *Taxon) int64 {
+	tx = collapse(tx)
+	if len(tx.Children) == 0 {
+		return 0
+	}
+	lo := membersBound(tx.Children)
+	if tx.MinAge > lo {
+		lo = tx.MinAge
+	}
+	return lo
+}
+
+// MembersBound returns the youngest age
+// of the most recent common ancestor
+// of a set of taxa.
+func membersBound(members []*Taxon) int64 {
+	var lo int64
+	for _, m := range members {
+		if b := taxonBound(m); b > lo {
+			lo = b
+		}
+	}
+	return lo + 1
+}
@@ -4,13 +4,24 @@
 
 // Package timetree provides a representation
 // of a time calibrated phylogenetic tree.
+//
+// All the functions that read trees
+// (for example ReadTSV or Newick)
+// detect and decompress gzip streams
+// transparently.
 package timetree
 
 import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 )
@@ -29,19 +40,70 @@ var (
 
 	// Age assignments
 	ErrInvalidRootAge = errors.New("invalid root age")
+	ErrInvalidOffset  = errors.New("invalid tree offset")
 	ErrOlderAge       = errors.New("age to old for node")
 	ErrYoungerAge     = errors.New("age to young for node")
+	ErrInvalidScale   = errors.New("invalid scale factor")
+
+	// Metadata errors
+	ErrMetaKey = errors.New("invalid metadata field")
+
+	// Errors when setting the order of children
+	ErrOrderChildren = errors.New("invalid children order")
+
+	// Namespace errors
+	ErrPrefix = errors.New("invalid namespace prefix")
+
+	// Pruning errors
+	ErrPruneTerms = errors.New("not enough terminals after pruning")
+
+	// Node search errors
+	ErrNodeNotFound = errors.New("node not found")
+
+	// Merging errors
+	ErrMergeShared = errors.New("not enough shared terminals")
+	ErrMergeUnits  = errors.New("trees with different age units")
+
+	// Swapping errors
+	ErrSwapNoClade = errors.New("clade ID not in tree")
+	ErrSwapTerms   = errors.New("clades with different terminals")
+)
+
+// NamespaceSep is the separator between a namespace prefix
+// and a taxon name.
+const NamespaceSep = "/"
+
+// Units of the ages of a tree.
+const (
+	Years           = "years"
+	Generations     = "generations"
+	CoalescentUnits = "coalescent-units"
 )
 
+// unitField is the metadata field
+// of the root node
+// used to store the unit of the ages of a tree.
+const unitField = "unit"
+
 // A Tree is a time calibrated phylogenetic tree,
 // a set of phylogenetic nodes
 // with a single common ancestor.
 type Tree struct {
 	name string
 
+	// offset is the age of the present for the tree
+	// (in years),
+	// i.e., no node can be younger than the offset.
+	offset int64
+
 	nodes map[int]*node
 	taxa  map[string]*node
 	root  *node
+
+	// stored derived values
+	// of the tree
+	mu    sync.Mutex
+	cache *stats
 }
 
 // New returns a new phylogenetic tree with a name
@@ -82,8 +144,8 @@ func (t *Tree) Add(id int, brLen int64, name string) (int, error) {
 	}
 
 	age := p.age - brLen
-	if age < 0 {
-		return -1, fmt.Errorf("%w: branch length %d greater than parent age %d", ErrAddInvalidBrLen, brLen, p.age)
+	if age < t.offset {
+		return -1, fmt.Errorf("%w: branch length %d greater than parent age %d", ErrAddInvalidBrLen, brLen, p.age-t.offset)
 	}
 
 	n := &node{
@@ -98,6 +160,7 @@ func (t *Tree) Add(id int, brLen int64, name string) (int, error) {
 	if name != "" {
 		t.taxa[name] = n
 	}
+	t.invalidate()
 
 	return n.id, nil
 }
@@ -126,6 +189,9 @@ func (t *Tree) AddSister(id int, age, brLen int64, name string) (int, error) {
 		}
 	}
 
+	if age < t.offset {
+		return -1, fmt.Errorf("%w: age %d, tree offset %d", ErrYoungerAge, age, t.offset)
+	}
 	pAge := age + brLen
 	if pAge < sister.age {
 		return -1, fmt.Errorf("%w: sister age %d, want %d", ErrYoungerAge, pAge, sister.age)
@@ -140,7 +206,7 @@ func (t *Tree) AddSister(id int, age, brLen int64, name string) (int, error) {
 		id:     len(t.nodes),
 		parent: pp,
 		age:    pAge,
-		brLen:  pp.age - age,
+		brLen:  pp.age - pAge,
 	}
 	t.nodes[p.id] = p
 	// replace old sister with the new parent
@@ -153,6 +219,7 @@ func (t *Tree) AddSister(id int, age, brLen int64, name string) (int, error) {
 	// add the sister as the first children of the new parent
 	p.children = append(p.children, sister)
 	sister.parent = p
+	sister.brLen = pAge - sister.age
 
 	// now add the taxon
 	n := &node{
@@ -167,6 +234,7 @@ func (t *Tree) AddSister(id int, age, brLen int64, name string) (int, error) {
 	if name != "" {
 		t.taxa[name] = n
 	}
+	t.invalidate()
 
 	return n.id, nil
 }
@@ -181,6 +249,106 @@ func (t *Tree) Age(id int) int64 {
 	return n.age
 }
 
+// AgeUnit returns the unit of the ages of the tree.
+// If the unit is undefined,
+// it returns Years.
+// Use AgeUnit to compare or report the unit of a tree,
+// and Unit only when an undefined unit
+// must be distinguished from an explicit one.
+func (t *Tree) AgeUnit() string {
+	if u := t.Unit(); u != "" {
+		return u
+	}
+	return Years
+}
+
+// A Branch is a branch of a tree,
+// i.e.,
+// the edge that connects a node with its parent.
+type Branch struct {
+	Node   int   // ID of the node at the end of the branch
+	Parent int   // ID of the parent node
+	Start  int64 // age of the parent (in years)
+	End    int64 // age of the node (in years)
+}
+
+// BranchesAt returns the branches of the tree
+// that cross the indicated age
+// (in years),
+// i.e.,
+// the branches that start before the age,
+// and end at the age,
+// or after it.
+// At the age of an internal node,
+// only the branch that ends in the node is returned,
+// so each lineage is counted once.
+// The branches are sorted by node ID.
+func (t *Tree) BranchesAt(age int64) []Branch {
+	if t.root == nil || age >= t.root.age {
+		return nil
+	}
+
+	var branches []Branch
+	stack := append([]*node{}, t.root.children...)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.age > age {
+			stack = append(stack, n.children...)
+			continue
+		}
+		branches = append(branches, Branch{
+			Node:   n.id,
+			Parent: n.parent.id,
+			Start:  n.parent.age,
+			End:    n.age,
+		})
+	}
+	slices.SortFunc(branches, func(a, b Branch) int {
+		return a.Node - b.Node
+	})
+	return branches
+}
+
+// BranchLen returns the length
+// (in years)
+// of the branch that ends in the indicated node,
+// i.e.,
+// the difference between the age of its parent
+// and the age of the node.
+// It returns 0 for the root,
+// or if the node is not in the tree.
+func (t *Tree) BranchLen(id int) int64 {
+	n, ok := t.nodes[id]
+	if !ok || n.parent == nil {
+		return 0
+	}
+	return n.brLen
+}
+
+// Canonical returns a normalized representation of the tree,
+// as a parenthetical string,
+// that does not depend on the node IDs,
+// or the order of the children of the nodes.
+// The children of each node are sorted by its set of terminals,
+// the names of the terminals and the named internal nodes
+// are quoted,
+// and the ages are in years.
+// The representation starts with the unit of the ages,
+// and other metadata,
+// as well as the name of the tree,
+// are ignored.
+func (t *Tree) Canonical() string {
+	var b strings.Builder
+	b.WriteString(t.AgeUnit())
+	b.WriteString(":")
+	if t.root != nil {
+		t.root.canonical(&b, t.stats().keys)
+	}
+	b.WriteString(";")
+	return b.String()
+}
+
 // Children returns an slice with the IDs
 // of the children of a node.
 func (t *Tree) Children(id int) []int {
@@ -200,6 +368,68 @@ func (t *Tree) Children(id int) []int {
 	return children
 }
 
+// CladeSize returns the number of terminals
+// descendant from the indicated node
+// (a terminal has a size of 1).
+// It returns -1 if the node is not in the tree.
+func (t *Tree) CladeSize(id int) int {
+	n, ok := t.nodes[id]
+	if !ok {
+		return -1
+	}
+	return t.stats().keys.size[n]
+}
+
+// CladeTerms returns the names of the terminals
+// descendant from the indicated node,
+// sorted in alphabetical order.
+// If the node is a terminal,
+// it returns its own name.
+func (t *Tree) CladeTerms(id int) []string {
+	n, ok := t.nodes[id]
+	if !ok {
+		return nil
+	}
+
+	terms := make([]string, 0, t.stats().keys.size[n])
+	for _, d := range n.preOrder(nil) {
+		if !d.isTerm() {
+			continue
+		}
+		terms = append(terms, d.taxon)
+	}
+	slices.Sort(terms)
+	return terms
+}
+
+// Clone returns a copy of the tree,
+// including the tree name,
+// node IDs,
+// taxon names,
+// ages,
+// and metadata.
+// Changes in the copy will not modify the original tree.
+func (t *Tree) Clone() *Tree {
+	c := &Tree{
+		name:   t.name,
+		offset: t.offset,
+		nodes:  make(map[int]*node, len(t.nodes)),
+		taxa:   make(map[string]*node, len(t.taxa)),
+	}
+
+	cp := make(map[*node]*node, len(t.nodes))
+	for _, n := range t.root.preOrder(nil) {
+		var p *node
+		if n.parent != nil {
+			p = cp[n.parent]
+		}
+		cp[n] = c.copyNode(n.id, p, n)
+	}
+	c.root = cp[t.root]
+
+	return c
+}
+
 // Delete removes a node
 // and all of its descendants
 // from a tree.
@@ -210,6 +440,7 @@ func (t *Tree) Delete(id int) error {
 	}
 
 	p := n.parent
+	t.invalidate()
 
 	// polytomous node
 	if len(p.children) > 2 {
@@ -255,6 +486,7 @@ func (t *Tree) Delete(id int) error {
 			anc.children[i] = s
 			p.children[j] = nil
 			s.parent = anc
+			s.brLen = anc.age - s.age
 		}
 	}
 
@@ -271,18 +503,88 @@ func (t *Tree) Depth(id int) int {
 		return -1
 	}
 
-	var d int
-	for n != t.root {
-		d++
-		n = n.parent
+	return t.stats().depth[n]
+}
+
+// Drop removes the indicated terminals from a tree.
+// Internal nodes that end with a single descendant
+// are also removed,
+// so the tree is always fully bifurcating
+// (or polytomous).
+// The ages of the remaining nodes are not changed.
+// Names that are not terminals of the tree
+// are ignored.
+// At least two terminals must remain in the tree.
+func (t *Tree) Drop(names ...string) error {
+	drop := make(map[*node]bool, len(names))
+	for _, nm := range names {
+		n, ok := t.taxa[canon(nm)]
+		if !ok || !n.isTerm() {
+			continue
+		}
+		drop[n] = true
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+
+	return t.prune(func(n *node) bool {
+		return !drop[n]
+	})
+}
+
+// Equal returns true if two trees have the same topology,
+// taxon names,
+// ages,
+// and age units,
+// i.e.,
+// if both trees have the same canonical representation.
+// The node IDs and the tree names are ignored.
+func (t *Tree) Equal(o *Tree) bool {
+	return t.Canonical() == o.Canonical()
+}
+
+// FindNode returns the ID of a node
+// defined by a node ID,
+// a taxon name,
+// or a comma separated list of taxon names
+// (the most recent common ancestor of the taxa).
+// It returns -1 and an error
+// if the node is not in the tree.
+func (t *Tree) FindNode(v string) (int, error) {
+	v = strings.TrimSpace(v)
+	if id, err := strconv.Atoi(v); err == nil {
+		if _, ok := t.nodes[id]; !ok {
+			return -1, fmt.Errorf("%w: ID %d in tree %q", ErrNodeNotFound, id, t.name)
+		}
+		return id, nil
+	}
+
+	var names []string
+	for _, nm := range strings.Split(v, ",") {
+		if strings.TrimSpace(nm) == "" {
+			continue
+		}
+		id, ok := t.TaxNode(nm)
+		if !ok {
+			return -1, fmt.Errorf("%w: taxon %q in tree %q", ErrNodeNotFound, nm, t.name)
+		}
+		names = append(names, t.Taxon(id))
+	}
+	if len(names) == 0 {
+		return -1, fmt.Errorf("%w: undefined node", ErrNodeNotFound)
 	}
-	return d
+	return t.MRCA(names...), nil
 }
 
 // Format sort the nodes of a tree,
 // changing node IDs if necessary.
+// Rotated nodes will have their children
+// in reverse order,
+// and nodes with an order set by SetOrder
+// will keep the order of their children.
 func (t *Tree) Format() {
-	t.root.sortAllChildren()
+	t.root.sortAllChildren(t.stats().keys)
 	ns := make([]*node, 0, len(t.nodes))
 	ns = t.preOrder(ns, t.root)
 
@@ -294,6 +596,106 @@ func (t *Tree) Format() {
 	t.nodes = nodes
 }
 
+// Graft attaches a source tree
+// as a sister clade of the indicated node ID,
+// using the indicated age
+// (in years)
+// for the new node that joins the grafted clade
+// and the sister node.
+// The age must be older than the sister node,
+// and older than the root of the source tree.
+// If the sister node is not the root,
+// the age must be younger than the age of its parent;
+// if the sister node is the root,
+// the new node will be the root of the tree.
+// The terminal names of the source tree
+// must not be in the tree,
+// and the ages of both trees
+// must be in the same unit.
+// The source tree is not modified.
+// It returns the ID of the new node
+// or -1 and an error.
+func (t *Tree) Graft(id int, src *Tree, age int64) (int, error) {
+	sister, ok := t.nodes[id]
+	if !ok {
+		return -1, fmt.Errorf("%w: ID %d", ErrAddNoSister, id)
+	}
+	if tu, su := t.AgeUnit(), src.AgeUnit(); tu != su {
+		return -1, fmt.Errorf("%w: %s and %s", ErrMergeUnits, tu, su)
+	}
+	if age <= sister.age {
+		return -1, fmt.Errorf("%w: sister age %d, want %d", ErrYoungerAge, age, sister.age)
+	}
+	if age <= src.root.age {
+		return -1, fmt.Errorf("%w: source root age %d, want %d", ErrYoungerAge, age, src.root.age)
+	}
+	pp := sister.parent
+	if pp != nil && pp.age <= age {
+		return -1, fmt.Errorf("%w: parent age %d, want %d", ErrOlderAge, age, pp.age)
+	}
+	if y := src.root.youngest(); y < t.offset {
+		return -1, fmt.Errorf("%w: source age %d, tree offset %d", ErrYoungerAge, y, t.offset)
+	}
+	for name := range src.taxa {
+		if _, dup := t.taxa[name]; dup {
+			return -1, fmt.Errorf("%w: %s", ErrAddRepeated, name)
+		}
+	}
+
+	t.invalidate()
+	next := 0
+	for nID := range t.nodes {
+		if nID >= next {
+			next = nID + 1
+		}
+	}
+
+	// add the new parent
+	p := &node{
+		id:     next,
+		parent: pp,
+		age:    age,
+	}
+	next++
+	t.nodes[p.id] = p
+	if pp == nil {
+		t.root = p
+	} else {
+		p.brLen = pp.age - age
+		for i, d := range pp.children {
+			if d == sister {
+				pp.children[i] = p
+				break
+			}
+		}
+	}
+	p.children = append(p.children, sister)
+	sister.parent = p
+	sister.brLen = age - sister.age
+
+	// copy the source tree
+	cp := make(map[*node]*node, len(src.nodes))
+	for _, n := range src.root.preOrder(nil) {
+		parent := p
+		if n.parent != nil {
+			parent = cp[n.parent]
+		}
+		cp[n] = t.copyNode(next, parent, n)
+		next++
+	}
+
+	return p.id, nil
+}
+
+// Hash returns a SHA-256 hash,
+// as an hexadecimal string,
+// of the canonical representation of the tree.
+// Equal trees have the same hash.
+func (t *Tree) Hash() string {
+	h := sha256.Sum256([]byte(t.Canonical()))
+	return hex.EncodeToString(h[:])
+}
+
 // IsRoot returns true if the indicated node
 // is the root of the tree.
 func (t *Tree) IsRoot(id int) bool {
@@ -314,6 +716,46 @@ func (t *Tree) IsTerm(id int) bool {
 	return n.isTerm()
 }
 
+// IsUltrametric returns true if all the terminals
+// of the tree have the same distance to the root,
+// within the indicated tolerance
+// (in years).
+func (t *Tree) IsUltrametric(tolerance int64) bool {
+	y := t.root.youngest()
+	for _, n := range t.taxa {
+		if !n.isTerm() {
+			continue
+		}
+		if n.age-y > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// Keep removes all the terminals of a tree
+// except the indicated terminals.
+// Internal nodes that end with a single descendant
+// are also removed.
+// The ages of the remaining nodes are not changed.
+// Names that are not terminals of the tree
+// are ignored.
+// At least two terminals must remain in the tree.
+func (t *Tree) Keep(names ...string) error {
+	keep := make(map[*node]bool, len(names))
+	for _, nm := range names {
+		n, ok := t.taxa[canon(nm)]
+		if !ok || !n.isTerm() {
+			continue
+		}
+		keep[n] = true
+	}
+
+	return t.prune(func(n *node) bool {
+		return keep[n]
+	})
+}
+
 // Len returns the total length
 // (in years)
 // of a tree.
@@ -333,6 +775,148 @@ func (t *Tree) LenToRoot(id int) int64 {
 	return t.root.age - n.age
 }
 
+// MaxDepth returns the largest number of nodes
+// between a node and the root of the tree.
+func (t *Tree) MaxDepth() int {
+	return t.stats().maxDepth
+}
+
+// MaxTipDistance returns the time
+// (in years)
+// between a node and its youngest descendant terminal.
+// In an ultrametric tree
+// it is equal to the age of the node
+// measured from the offset of the tree.
+func (t *Tree) MaxTipDistance(id int) int64 {
+	n, ok := t.nodes[id]
+	if !ok {
+		return 0
+	}
+	return n.age - n.youngest()
+}
+
+// MeanTipDistance returns the mean time
+// (in years)
+// between a node and its descendant terminals.
+func (t *Tree) MeanTipDistance(id int) float64 {
+	n, ok := t.nodes[id]
+	if !ok {
+		return 0
+	}
+
+	var sum float64
+	var num int
+	for _, d := range n.preOrder(nil) {
+		if !d.isTerm() {
+			continue
+		}
+		sum += float64(n.age - d.age)
+		num++
+	}
+	return sum / float64(num)
+}
+
+// Merge adds to the tree the terminals of a source tree
+// that are not in the tree,
+// using the terminals shared by both trees
+// as a backbone.
+//
+// First,
+// the ages of the internal nodes
+// that define the same set of shared terminals
+// in both trees
+// are reconciled by taking the maximum age.
+// Then,
+// each clade of the source tree without shared terminals
+// is attached as sister of the most recent common ancestor
+// (in the tree)
+// of the shared terminals of its sister group,
+// using the age of its parent in the source tree.
+// If that age is not valid in the tree,
+// the age will be set halfway
+// between the sister node and its parent.
+//
+// The trees must share at least two terminals,
+// and the ages of both trees
+// must be in the same unit.
+// The source tree is not modified.
+func (t *Tree) Merge(src *Tree) error {
+	// the merge is done on a copy of the tree,
+	// so the tree is unchanged
+	// if the merge fails
+	mt := t.Clone()
+	if err := mt.merge(src); err != nil {
+		return err
+	}
+
+	t.nodes = mt.nodes
+	t.taxa = mt.taxa
+	t.root = mt.root
+	t.invalidate()
+	return nil
+}
+
+// Meta returns the value of a metadata field
+// of the indicated node.
+// It returns an empty string if the field is not defined.
+func (t *Tree) Meta(id int, key string) string {
+	n, ok := t.nodes[id]
+	if !ok {
+		return ""
+	}
+
+	return n.meta[metaKey(key)]
+}
+
+// MetaKeys returns the names of the metadata fields
+// defined for the indicated node.
+func (t *Tree) MetaKeys(id int) []string {
+	n, ok := t.nodes[id]
+	if !ok {
+		return nil
+	}
+
+	keys := make([]string, 0, len(n.meta))
+	for k := range n.meta {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// MinTipDistance returns the time
+// (in years)
+// between a node and its oldest descendant terminal.
+func (t *Tree) MinTipDistance(id int) int64 {
+	n, ok := t.nodes[id]
+	if !ok {
+		return 0
+	}
+
+	var oldest int64 = math.MinInt64
+	for _, d := range n.preOrder(nil) {
+		if d.isTerm() && d.age > oldest {
+			oldest = d.age
+		}
+	}
+	return n.age - oldest
+}
+
+// Move sets the age of the root node (in years),
+// and updates all node ages keeping the branch lengths.
+// The age of the root must be at least equal to the distance
+// to the most recent terminal
+// plus the offset of the tree.
+func (t *Tree) Move(age int64) error {
+	if max := t.root.maxLen() + t.offset; age < max {
+		return fmt.Errorf("%w: age %d is smaller than %d", ErrInvalidRootAge, age, max)
+	}
+
+	t.root.age = age
+	t.root.propagateAge()
+	return nil
+}
+
 // MRCA returns the most recent common ancestor
 // of two or more terminals.
 func (t *Tree) MRCA(names ...string) int {
@@ -379,6 +963,43 @@ func (t *Tree) MRCA(names ...string) int {
 	return mrca[len(mrca)-1]
 }
 
+// Name returns the name of the tree.
+func (t *Tree) Name() string {
+	return t.name
+}
+
+// Nodes return an slice with IDs
+// of the nodes of the tree.
+func (t *Tree) Nodes() []int {
+	ns := make([]int, 0, len(t.nodes))
+	for _, n := range t.nodes {
+		ns = append(ns, n.id)
+	}
+	slices.Sort(ns)
+	return ns
+}
+
+// NonUltrametric returns the names of the terminals
+// with a distance to the root
+// shorter than the maximum root-to-tip distance
+// by more than the indicated tolerance
+// (in years).
+// The names are sorted in alphabetical order.
+func (t *Tree) NonUltrametric(tolerance int64) []string {
+	y := t.root.youngest()
+	var terms []string
+	for _, n := range t.taxa {
+		if !n.isTerm() {
+			continue
+		}
+		if n.age-y > tolerance {
+			terms = append(terms, n.taxon)
+		}
+	}
+	slices.Sort(terms)
+	return terms
+}
+
 // NumInternal returns the number of internal nodes
 // (i.e., nodes with descendants).
 func (t *Tree) NumInternal() int {
@@ -392,34 +1013,20 @@ func (t *Tree) NumInternal() int {
 	return num
 }
 
-// Move sets the age of the root node (in years),
-// and updates all node ages keeping the branch lengths.
-// The age of the root must be at least equal to the distance
-// to the most recent terminal.
-func (t *Tree) Move(age int64) error {
-	if max := t.root.maxLen(); age < max {
-		return fmt.Errorf("%w: age %d is smaller than %d", ErrInvalidRootAge, age, max)
-	}
-
-	t.root.age = age
-	t.root.propagateAge()
-	return nil
-}
-
-// Name returns the name of the tree.
-func (t *Tree) Name() string {
-	return t.name
+// NumTerms returns the number of terminals
+// of the tree.
+func (t *Tree) NumTerms() int {
+	return t.stats().keys.size[t.root]
 }
 
-// Nodes return an slice with IDs
-// of the nodes of the tree.
-func (t *Tree) Nodes() []int {
-	ns := make([]int, 0, len(t.nodes))
-	for _, n := range t.nodes {
-		ns = append(ns, n.id)
-	}
-	slices.Sort(ns)
-	return ns
+// Offset returns the age of the present for the tree
+// (in years).
+// By default it is 0,
+// but it can be older for trees
+// that end before the present
+// (for example, an entirely extinct clade).
+func (t *Tree) Offset() int64 {
+	return t.offset
 }
 
 // Parent returns the ID of the parent
@@ -437,18 +1044,170 @@ func (t *Tree) Parent(id int) int {
 	return n.parent.id
 }
 
+// Prefix adds a namespace prefix
+// to all the taxon names of the tree,
+// using the form "<prefix>/<name>".
+// It returns a map from the old names
+// to the new names.
+func (t *Tree) Prefix(prefix string) (map[string]string, error) {
+	prefix = strings.Join(strings.Fields(prefix), " ")
+	if prefix == "" || strings.Contains(prefix, NamespaceSep) {
+		return nil, fmt.Errorf("%w: %q", ErrPrefix, prefix)
+	}
+
+	names := make(map[string]string, len(t.taxa))
+	taxa := make(map[string]*node, len(t.taxa))
+	for name, n := range t.taxa {
+		nn := canon(prefix + NamespaceSep + name)
+		names[name] = nn
+		n.taxon = nn
+		taxa[nn] = n
+	}
+	t.taxa = taxa
+	t.invalidate()
+	return names, nil
+}
+
 // Root returns the ID of the root node
 // which is 0.
 func (t *Tree) Root() int {
 	return t.root.id
 }
 
-// Set sets the age of a node
-// (in years).
-func (t *Tree) Set(id int, age int64) error {
+// Rotate reverses the order of the children
+// of the indicated node.
+// The rotation is kept when the tree is formatted,
+// so node IDs will be updated
+// on the next call to Format.
+func (t *Tree) Rotate(id int) {
 	n, ok := t.nodes[id]
 	if !ok {
-		return nil
+		return
+	}
+	if n.isTerm() {
+		return
+	}
+
+	n.rotated = !n.rotated
+	slices.Reverse(n.children)
+}
+
+// Scale multiplies the ages of all nodes
+// by a factor,
+// so all branch lengths are multiplied
+// by the same factor.
+// Ages are measured from the offset of the tree,
+// so the offset is not changed.
+// The factor must be greater than 0.
+func (t *Tree) Scale(factor float64) error {
+	if factor <= 0 || math.IsInf(factor, 0) || math.IsNaN(factor) {
+		return fmt.Errorf("%w: %v", ErrInvalidScale, factor)
+	}
+
+	for _, n := range t.root.preOrder(nil) {
+		n.age = t.offset + int64(math.Round(float64(n.age-t.offset)*factor))
+		if n.parent != nil {
+			n.brLen = n.parent.age - n.age
+		}
+	}
+	return nil
+}
+
+// ScaleBranches multiplies the length of each branch
+// by a factor.
+// By default,
+// the indicated factor is used,
+// but a different factor can be defined for a clade,
+// using a map of node IDs to factors.
+// The factor of a node is used
+// for the branches of all of its descendants,
+// unless a descendant node has its own factor.
+// The age of the root is scaled
+// (from the offset of the tree)
+// using the root factor,
+// and the ages of the other nodes
+// are calculated from the root,
+// so if the factors are different,
+// the terminals might not keep their ages.
+// All factors must be greater than 0,
+// and no node can be younger than the offset of the tree.
+func (t *Tree) ScaleBranches(factor float64, clades map[int]float64) error {
+	if factor <= 0 || math.IsInf(factor, 0) || math.IsNaN(factor) {
+		return fmt.Errorf("%w: %v", ErrInvalidScale, factor)
+	}
+	for id, f := range clades {
+		if _, ok := t.nodes[id]; !ok {
+			return fmt.Errorf("%w: node %d not in tree", ErrInvalidScale, id)
+		}
+		if f <= 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("%w: node %d: %v", ErrInvalidScale, id, f)
+		}
+	}
+
+	ns := t.root.preOrder(nil)
+	factors := make(map[*node]float64, len(ns))
+	ages := make(map[*node]int64, len(ns))
+	for _, n := range ns {
+		f := factor
+		if n.parent != nil {
+			f = factors[n.parent]
+		}
+		if v, ok := clades[n.id]; ok {
+			f = v
+		}
+		factors[n] = f
+
+		if n.parent == nil {
+			ages[n] = t.offset + int64(math.Round(float64(n.age-t.offset)*f))
+			continue
+		}
+		age := ages[n.parent] - int64(math.Round(float64(n.brLen)*f))
+		if age < t.offset {
+			return fmt.Errorf("%w: node %d: age %d, offset %d", ErrYoungerAge, n.id, age, t.offset)
+		}
+		ages[n] = age
+	}
+
+	for _, n := range ns {
+		n.age = ages[n]
+		if n.parent != nil {
+			n.brLen = n.parent.age - n.age
+		}
+	}
+	return nil
+}
+
+// ScaleTo sets the age of the root node
+// (in years),
+// and updates the ages of all nodes
+// keeping the relative length of the branches.
+// The age of the root must be older
+// than the offset of the tree.
+func (t *Tree) ScaleTo(age int64) error {
+	if age <= t.offset {
+		return fmt.Errorf("%w: age %d is not older than the offset %d", ErrInvalidRootAge, age, t.offset)
+	}
+	if t.root.age <= t.offset {
+		return fmt.Errorf("%w: root age %d is not older than the offset %d", ErrInvalidRootAge, t.root.age, t.offset)
+	}
+
+	factor := float64(age-t.offset) / float64(t.root.age-t.offset)
+	if err := t.Scale(factor); err != nil {
+		return err
+	}
+	t.root.age = age
+	for _, c := range t.root.children {
+		c.brLen = age - c.age
+	}
+	return nil
+}
+
+// Set sets the age of a node
+// (in years).
+func (t *Tree) Set(id int, age int64) error {
+	n, ok := t.nodes[id]
+	if !ok {
+		return nil
 	}
 
 	if p := n.parent; p != nil && p.age < age {
@@ -464,8 +1223,91 @@ func (t *Tree) Set(id int, age int64) error {
 	if max > age {
 		return ErrYoungerAge
 	}
+	if age < t.offset {
+		return ErrYoungerAge
+	}
 
 	n.age = age
+	if p := n.parent; p != nil {
+		n.brLen = p.age - age
+	}
+	for _, c := range n.children {
+		c.brLen = age - c.age
+	}
+	return nil
+}
+
+// SetBranchLens sets the length
+// (in years)
+// of the branches that end in the indicated nodes,
+// and updates the ages of the nodes,
+// keeping the age of the root.
+// Nodes not in the tree,
+// and the root,
+// are ignored.
+// If a length is negative,
+// or a node would be younger than the offset of the tree,
+// the tree is not modified,
+// and an error is returned.
+func (t *Tree) SetBranchLens(lens map[int]int64) error {
+	for id, l := range lens {
+		n, ok := t.nodes[id]
+		if !ok || n.parent == nil {
+			continue
+		}
+		if l < 0 {
+			return fmt.Errorf("%w: node %d: length %d", ErrAddInvalidBrLen, id, l)
+		}
+	}
+
+	prev := make(map[*node]int64, len(lens))
+	for id, l := range lens {
+		n, ok := t.nodes[id]
+		if !ok || n.parent == nil {
+			continue
+		}
+		prev[n] = n.brLen
+		n.brLen = l
+	}
+	t.root.propagateAge()
+
+	if y := t.root.youngest(); y < t.offset {
+		for n, l := range prev {
+			n.brLen = l
+		}
+		t.root.propagateAge()
+		return fmt.Errorf("%w: node age %d younger than offset %d", ErrYoungerAge, y, t.offset)
+	}
+	return nil
+}
+
+// SetMeta sets the value of a metadata field
+// of the indicated node.
+// If the value is empty,
+// the field will be removed.
+// Field names are case insensitive,
+// and must be different from the names
+// used by the fields of a TSV tree file.
+func (t *Tree) SetMeta(id int, key, value string) error {
+	n, ok := t.nodes[id]
+	if !ok {
+		return nil
+	}
+
+	key = metaKey(key)
+	if isReserved(key) {
+		return fmt.Errorf("%w: %q", ErrMetaKey, key)
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		delete(n.meta, key)
+		return nil
+	}
+	if n.meta == nil {
+		n.meta = make(map[string]string)
+	}
+	n.meta[key] = value
 	return nil
 }
 
@@ -500,9 +1342,74 @@ func (t *Tree) SetName(id int, name string) error {
 	}
 	n.taxon = name
 	t.taxa[name] = n
+	t.invalidate()
+	return nil
+}
+
+// SetOffset sets the age of the present for the tree
+// (in years).
+// The offset can not be younger than 0,
+// or older than the youngest node of the tree.
+func (t *Tree) SetOffset(age int64) error {
+	if age < 0 {
+		return fmt.Errorf("%w: offset %d", ErrInvalidOffset, age)
+	}
+	if y := t.root.youngest(); age > y {
+		return fmt.Errorf("%w: offset %d older than youngest node age %d", ErrInvalidOffset, age, y)
+	}
+	t.offset = age
+	return nil
+}
+
+// SetOrder sets the order of the children
+// of the indicated node.
+// The given IDs must be all the children of the node.
+// The order is kept when the tree is formatted,
+// so node IDs will be updated
+// on the next call to Format.
+// If children is empty,
+// the node will use the default order.
+func (t *Tree) SetOrder(id int, children []int) error {
+	n, ok := t.nodes[id]
+	if !ok {
+		return nil
+	}
+	if len(children) == 0 {
+		n.fixed = false
+		n.rotated = false
+		return nil
+	}
+	if len(children) != len(n.children) {
+		return fmt.Errorf("%w: node %d: got %d children, want %d", ErrOrderChildren, id, len(children), len(n.children))
+	}
+
+	ns := make([]*node, 0, len(children))
+	for _, cID := range children {
+		c, ok := t.nodes[cID]
+		if !ok || c.parent != n {
+			return fmt.Errorf("%w: node %d: node %d is not a child", ErrOrderChildren, id, cID)
+		}
+		if slices.Contains(ns, c) {
+			return fmt.Errorf("%w: node %d: repeated child %d", ErrOrderChildren, id, cID)
+		}
+		ns = append(ns, c)
+	}
+	n.children = ns
+	n.fixed = true
+	n.rotated = false
 	return nil
 }
 
+// SetUnit sets the unit of the ages of the tree
+// (for example, Years, Generations, or CoalescentUnits).
+// The unit is stored in the "unit" metadata field
+// of the root node.
+// If the unit is empty,
+// the field will be removed.
+func (t *Tree) SetUnit(unit string) {
+	t.SetMeta(t.Root(), unitField, strings.ToLower(unit))
+}
+
 // SubTree creates a new tree from a given node
 // using the indicated name.
 // If no name is given,
@@ -524,9 +1431,10 @@ func (t *Tree) SubTree(id int, name string) *Tree {
 	name = strings.ToLower(name)
 
 	sub := &Tree{
-		name:  name,
-		nodes: make(map[int]*node),
-		taxa:  make(map[string]*node),
+		name:   name,
+		offset: t.offset,
+		nodes:  make(map[int]*node),
+		taxa:   make(map[string]*node),
 	}
 	root := sub.copySource(nil, n)
 	sub.root = root
@@ -536,6 +1444,128 @@ func (t *Tree) SubTree(id int, name string) *Tree {
 	return sub
 }
 
+// Swap replaces the clade of the indicated node
+// with a copy of the clade of a node
+// of a source tree
+// (for example,
+// to replace a poorly resolved clade
+// with a better dated clade from a focused study).
+// Both clades must have the same terminals,
+// and the ages of both trees
+// must be in the same unit.
+// The crown age of the source clade
+// must be younger than the age of the parent of the node.
+// If fit is true,
+// and the source clade is too old,
+// the ages of the source clade are rescaled,
+// keeping the age of its youngest node,
+// so the crown age of the source clade
+// is the age of the replaced node.
+// The names of the source clade
+// must not be used by nodes outside the replaced clade.
+// The crown node of the copied clade
+// keeps the metadata of the replaced node
+// (for example, the unit of the ages,
+// if the node is the root),
+// and the other copied nodes
+// keep the metadata of the source tree.
+// The source tree is not modified.
+func (t *Tree) Swap(id int, src *Tree, srcID int, fit bool) error {
+	n, ok := t.nodes[id]
+	if !ok {
+		return fmt.Errorf("%w: ID %d", ErrSwapNoClade, id)
+	}
+	sn, ok := src.nodes[srcID]
+	if !ok {
+		return fmt.Errorf("%w: source ID %d", ErrSwapNoClade, srcID)
+	}
+	if tu, su := t.AgeUnit(), src.AgeUnit(); tu != su {
+		return fmt.Errorf("%w: %s and %s", ErrMergeUnits, tu, su)
+	}
+	if !slices.Equal(t.CladeTerms(id), src.CladeTerms(srcID)) {
+		return fmt.Errorf("%w: node %d, source node %d", ErrSwapTerms, id, srcID)
+	}
+
+	// reconcile ages
+	y := sn.youngest()
+	scale := func(a int64) int64 { return a }
+	if p := n.parent; p != nil && sn.age >= p.age {
+		if !fit {
+			return fmt.Errorf("%w: source age %d, parent age %d", ErrOlderAge, sn.age, p.age)
+		}
+		if sn.age == y || n.age <= y {
+			return fmt.Errorf("%w: source age %d, parent age %d", ErrOlderAge, sn.age, p.age)
+		}
+		f := float64(n.age-y) / float64(sn.age-y)
+		scale = func(a int64) int64 {
+			return y + int64(math.Round(float64(a-y)*f))
+		}
+	}
+	if y < t.offset {
+		return fmt.Errorf("%w: source age %d, tree offset %d", ErrYoungerAge, y, t.offset)
+	}
+
+	replaced := make(map[string]bool)
+	for _, d := range n.preOrder(nil) {
+		if d.taxon != "" {
+			replaced[d.taxon] = true
+		}
+	}
+	for _, d := range sn.preOrder(nil) {
+		if d.taxon == "" || replaced[d.taxon] {
+			continue
+		}
+		if _, dup := t.taxa[d.taxon]; dup {
+			return fmt.Errorf("%w: %s", ErrAddRepeated, d.taxon)
+		}
+	}
+
+	t.invalidate()
+	next := 0
+	for nID := range t.nodes {
+		if nID >= next {
+			next = nID + 1
+		}
+	}
+
+	p := n.parent
+	meta := n.meta
+	for _, d := range n.preOrder(nil) {
+		t.remove(d)
+	}
+
+	cp := make(map[*node]*node, len(src.nodes))
+	for _, d := range sn.preOrder(nil) {
+		var anc *node
+		if d != sn {
+			anc = cp[d.parent]
+		}
+		c := t.copyNode(next, anc, d)
+		next++
+		c.age = scale(d.age)
+		if anc != nil {
+			c.brLen = anc.age - c.age
+		}
+		cp[d] = c
+	}
+
+	nc := cp[sn]
+	nc.meta = meta
+	if p == nil {
+		t.root = nc
+		return nil
+	}
+	nc.parent = p
+	nc.brLen = p.age - nc.age
+	for i, d := range p.children {
+		if d == n {
+			p.children[i] = nc
+			break
+		}
+	}
+	return nil
+}
+
 // Taxa returns all defined taxon names of the tree.
 func (t *Tree) Taxa() []string {
 	taxa := make([]string, 0, len(t.taxa))
@@ -546,17 +1576,6 @@ func (t *Tree) Taxa() []string {
 	return taxa
 }
 
-// Taxon returns the taxon name
-// of the node with the indicated ID.
-func (t *Tree) Taxon(id int) string {
-	n, ok := t.nodes[id]
-	if !ok {
-		return ""
-	}
-
-	return n.taxon
-}
-
 // TaxNode returns the ID of a node
 // with a given taxon name.
 // It returns false if the taxon does not exists.
@@ -573,6 +1592,17 @@ func (t *Tree) TaxNode(name string) (int, bool) {
 	return n.id, true
 }
 
+// Taxon returns the taxon name
+// of the node with the indicated ID.
+func (t *Tree) Taxon(id int) string {
+	n, ok := t.nodes[id]
+	if !ok {
+		return ""
+	}
+
+	return n.taxon
+}
+
 // Terms returns the name of all terminals of the tree.
 func (t *Tree) Terms() []string {
 	terms := make([]string, 0, len(t.taxa))
@@ -586,6 +1616,20 @@ func (t *Tree) Terms() []string {
 	return terms
 }
 
+// Unit returns the unit of the ages of the tree,
+// as stored in the "unit" metadata field
+// of the root node.
+// If the field is undefined,
+// it returns an empty string,
+// and the ages are assumed to be in years.
+// Use Unit only when an undefined unit
+// must be distinguished from an explicit one
+// (for example, to keep an undefined unit undefined);
+// otherwise use AgeUnit.
+func (t *Tree) Unit() string {
+	return strings.ToLower(t.Meta(t.Root(), unitField))
+}
+
 // Validate will return an error if the tree is invalid.
 // A tree is invalid if it has nodes with a single child,
 // or terminal nodes are without a defined name.
@@ -601,30 +1645,93 @@ func (t *Tree) Validate() error {
 	return nil
 }
 
-func (t *Tree) preOrder(ns []*node, n *node) []*node {
-	ns = append(ns, n)
-	for _, c := range n.children {
-		ns = t.preOrder(ns, c)
+// GraftAge returns a valid age
+// to attach a clade as sister of a node,
+// starting from the age of the parent of the clade
+// in its source tree.
+func graftAge(sister, clade *node, age int64) (int64, error) {
+	low := max(sister.age, clade.age)
+	if sister.parent == nil {
+		if age <= low {
+			age = low + age - clade.age
+		}
+		return age, nil
 	}
-	return ns
+
+	high := sister.parent.age
+	if age > low && age < high {
+		return age, nil
+	}
+	age = low + (high-low)/2
+	if age <= low {
+		return -1, fmt.Errorf("%w: clade age %d, parent age %d", ErrOlderAge, clade.age, high)
+	}
+	return age, nil
+}
+
+// Stats returns the stored derived values of the tree,
+// calculating them if they are not defined.
+func (t *Tree) stats() *stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cache == nil {
+		t.cache = newStats(t.root)
+	}
+	return t.cache
+}
+
+// Invalidate removes the stored derived values of the tree.
+// It must be called by any function
+// that modifies the topology
+// or the terminal names
+// of the tree.
+func (t *Tree) invalidate() {
+	t.mu.Lock()
+	t.cache = nil
+	t.mu.Unlock()
+}
+
+func (t *Tree) preOrder(ns []*node, n *node) []*node {
+	return n.preOrder(ns)
 }
 
 // CopyNode copies a node
 // and all of its descendants.
 func (t *Tree) copySource(p *node, src *node) *node {
+	cp := make(map[*node]*node)
+	for _, s := range src.preOrder(nil) {
+		anc := p
+		if s != src {
+			anc = cp[s.parent]
+		}
+		cp[s] = t.copyNode(len(t.nodes), anc, s)
+	}
+	return cp[src]
+}
+
+// CopyNode adds to a tree a copy of a source node
+// with the indicated ID,
+// as a child of p.
+func (t *Tree) copyNode(id int, p *node, src *node) *node {
 	n := &node{
-		id:     len(t.nodes),
-		parent: p,
-		age:    src.age,
-		taxon:  src.taxon,
+		id:      id,
+		parent:  p,
+		age:     src.age,
+		taxon:   src.taxon,
+		rotated: src.rotated,
+		fixed:   src.fixed,
 	}
 	t.nodes[n.id] = n
-	for _, c := range src.children {
-		d := t.copySource(n, c)
-		n.children = append(n.children, d)
+	for k, v := range src.meta {
+		if n.meta == nil {
+			n.meta = make(map[string]string, len(src.meta))
+		}
+		n.meta[k] = v
 	}
 	if p != nil {
 		n.brLen = p.age - n.age
+		p.children = append(p.children, n)
 	}
 	if n.taxon != "" {
 		t.taxa[n.taxon] = n
@@ -633,6 +1740,247 @@ func (t *Tree) copySource(p *node, src *node) *node {
 	return n
 }
 
+// merge adds the terminals of a source tree
+// to the tree.
+// It modifies the tree in place,
+// so on error the tree might be partially merged.
+func (t *Tree) merge(src *Tree) error {
+	if tu, su := t.AgeUnit(), src.AgeUnit(); tu != su {
+		return fmt.Errorf("%w: %s and %s", ErrMergeUnits, tu, su)
+	}
+
+	shared := make(map[string]bool)
+	for _, n := range src.taxa {
+		if !n.isTerm() {
+			continue
+		}
+		if tn, ok := t.taxa[n.taxon]; ok && tn.isTerm() {
+			shared[n.taxon] = true
+		}
+	}
+	if len(shared) < 2 {
+		return fmt.Errorf("%w: %d shared terminals", ErrMergeShared, len(shared))
+	}
+
+	srcNodes := src.root.preOrder(nil)
+	srcShared := sharedTerms(srcNodes, shared)
+	for _, n := range srcNodes {
+		if len(srcShared[n]) > 0 || n.taxon == "" {
+			continue
+		}
+		if _, dup := t.taxa[n.taxon]; dup {
+			return fmt.Errorf("%w: %s", ErrAddRepeated, n.taxon)
+		}
+	}
+
+	// reconcile the ages
+	ns := t.root.preOrder(nil)
+	tShared := sharedTerms(ns, shared)
+	ages := make(map[*node]int64)
+	for _, n := range srcNodes {
+		terms := srcShared[n]
+		if len(terms) < 2 {
+			continue
+		}
+
+		// only the youngest node
+		// with a set of shared terminals
+		// is compared
+		youngest := true
+		for _, c := range n.children {
+			if len(srcShared[c]) == len(terms) {
+				youngest = false
+				break
+			}
+		}
+		if !youngest {
+			continue
+		}
+
+		m := t.nodes[t.MRCA(terms...)]
+		if len(tShared[m]) != len(terms) {
+			continue
+		}
+		ages[m] = max(ages[m], n.age)
+	}
+	for i := len(ns) - 1; i >= 0; i-- {
+		n := ns[i]
+		if n.isTerm() {
+			continue
+		}
+		age := max(n.age, ages[n])
+		for _, c := range n.children {
+			if c.age >= age {
+				age = c.age + 1
+			}
+		}
+		n.age = age
+	}
+	for _, n := range ns {
+		if n.parent != nil {
+			n.brLen = n.parent.age - n.age
+		}
+	}
+
+	// attach the clades without shared terminals
+	for _, n := range srcNodes {
+		if len(srcShared[n]) > 0 {
+			continue
+		}
+		p := n.parent
+		if len(srcShared[p]) == 0 {
+			continue
+		}
+
+		sister := t.nodes[t.MRCA(srcShared[p]...)]
+		age, err := graftAge(sister, n, p.age)
+		if err != nil {
+			return err
+		}
+		if _, err := t.Graft(sister.id, src.SubTree(n.id, ""), age); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune removes the terminals that are not kept,
+// as well as the internal nodes without descendants,
+// or with a single descendant.
+func (t *Tree) prune(keep func(*node) bool) error {
+	ns := t.root.preOrder(nil)
+
+	// in reverse pre-order
+	// children are visited before their parents
+	terms := make(map[*node]int, len(ns))
+	for i := len(ns) - 1; i >= 0; i-- {
+		n := ns[i]
+		if n.isTerm() {
+			if keep(n) {
+				terms[n] = 1
+			}
+			continue
+		}
+		for _, c := range n.children {
+			terms[n] += terms[c]
+		}
+	}
+	if terms[t.root] < 2 {
+		return fmt.Errorf("%w: %d terminals", ErrPruneTerms, terms[t.root])
+	}
+
+	t.invalidate()
+	for _, n := range ns {
+		if terms[n] == 0 {
+			t.remove(n)
+			continue
+		}
+		if n.isTerm() {
+			continue
+		}
+
+		var children []*node
+		for _, c := range n.children {
+			if terms[c] > 0 {
+				children = append(children, c)
+			}
+		}
+		n.children = children
+		if len(children) > 1 {
+			continue
+		}
+
+		// remove nodes with a single descendant
+		c := children[0]
+		c.parent = n.parent
+		if n.parent == nil {
+			t.root = c
+		} else {
+			for i, s := range n.parent.children {
+				if s == n {
+					n.parent.children[i] = c
+					break
+				}
+			}
+		}
+		t.remove(n)
+	}
+
+	t.root.brLen = 0
+	for _, n := range t.root.preOrder(nil) {
+		if n.parent != nil {
+			n.brLen = n.parent.age - n.age
+		}
+	}
+	return nil
+}
+
+// Remove removes a node from the node and taxon maps
+// of the tree.
+func (t *Tree) remove(n *node) {
+	delete(t.nodes, n.id)
+	if n.taxon != "" {
+		delete(t.taxa, n.taxon)
+	}
+	n.parent = nil
+	n.children = nil
+}
+
+// SharedTerms returns the shared terminals
+// descendant from each node
+// of a list of nodes in pre-order.
+func sharedTerms(ns []*node, shared map[string]bool) map[*node][]string {
+	terms := make(map[*node][]string, len(ns))
+	for i := len(ns) - 1; i >= 0; i-- {
+		n := ns[i]
+		if n.isTerm() {
+			if shared[n.taxon] {
+				terms[n] = []string{n.taxon}
+			}
+			continue
+		}
+		for _, c := range n.children {
+			terms[n] = append(terms[n], terms[c]...)
+		}
+	}
+	return terms
+}
+
+// Stats are derived values of a tree
+// that are stored
+// to prevent their recalculation.
+type stats struct {
+	// sort values of the nodes,
+	// including the number of terminals
+	keys sortKeys
+
+	// number of nodes between a node
+	// and the root
+	depth    map[*node]int
+	maxDepth int
+}
+
+// NewStats returns the derived values
+// of a tree with the indicated root.
+func newStats(root *node) *stats {
+	ns := root.preOrder(nil)
+	s := &stats{
+		keys:  newSortKeys(root),
+		depth: make(map[*node]int, len(ns)),
+	}
+	for _, n := range ns {
+		if n.parent == nil {
+			continue
+		}
+		d := s.depth[n.parent] + 1
+		s.depth[n] = d
+		if d > s.maxDepth {
+			s.maxDepth = d
+		}
+	}
+	return s
+}
+
 // A Node is a node in a phylogenetic tree.
 type node struct {
 	id     int
@@ -642,6 +1990,17 @@ type node struct {
 
 	brLen int64
 
+	// node metadata
+	meta map[string]string
+
+	// if true,
+	// the order of the children is reversed
+	rotated bool
+
+	// if true,
+	// the order of the children is set by the user
+	fixed bool
+
 	children []*node
 }
 
@@ -660,24 +2019,6 @@ func (n *node) del(t *Tree) {
 	}
 }
 
-// FirstTerm return the first terminal
-// by alphabetical order
-// found in a node.
-func (n *node) firstTerm() string {
-	if n.isTerm() {
-		return n.taxon
-	}
-
-	term := n.children[0].firstTerm()
-	for _, c := range n.children[1:] {
-		t := c.firstTerm()
-		if t < term {
-			term = t
-		}
-	}
-	return term
-}
-
 // IsTerm returns true if the node is a terminal
 // (i.e. has no children).
 func (n *node) isTerm() bool {
@@ -688,85 +2029,256 @@ func (n *node) isTerm() bool {
 // that descends from the given node
 // (including their ancestral branch).
 func (n *node) maxLen() int64 {
-	var cLen int64
-	for _, c := range n.children {
-		l := c.maxLen()
-		if l > cLen {
-			cLen = l
+	ns := n.preOrder(nil)
+	dist := make(map[*node]int64, len(ns))
+	var max int64
+	for _, d := range ns {
+		l := d.brLen
+		if d != n {
+			l += dist[d.parent]
+		}
+		dist[d] = l
+		if l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+// Youngest returns the age of the youngest node
+// descendant from a node.
+func (n *node) youngest() int64 {
+	y := n.age
+	for _, d := range n.preOrder(nil) {
+		if d.age < y {
+			y = d.age
+		}
+	}
+	return y
+}
+
+// PreOrder appends the node,
+// and all of its descendants,
+// in pre-order,
+// to a list of nodes.
+func (n *node) preOrder(ns []*node) []*node {
+	stack := []*node{n}
+	for len(stack) > 0 {
+		d := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ns = append(ns, d)
+		for i := len(d.children) - 1; i >= 0; i-- {
+			stack = append(stack, d.children[i])
 		}
 	}
-	return cLen + n.brLen
+	return ns
 }
 
 // PropagateAge updates the age of the descendant nodes.
 func (n *node) propagateAge() {
-	if n.parent != nil {
-		n.age = n.parent.age - n.brLen
-	}
-	for _, c := range n.children {
-		c.propagateAge()
+	for _, d := range n.preOrder(nil) {
+		if d.parent != nil {
+			d.age = d.parent.age - d.brLen
+		}
 	}
 }
 
-// Size return the number of terminals on a node.
-func (n *node) size() int {
-	if n.isTerm() {
-		return 1
+// SetMeta sets the value of a metadata field
+// ignoring empty or invalid fields.
+func (n *node) setMeta(key, value string) {
+	if isReserved(key) {
+		return
 	}
-	sz := 0
-	for _, c := range n.children {
-		sz += c.size()
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
 	}
-	return sz
+	if n.meta == nil {
+		n.meta = make(map[string]string)
+	}
+	n.meta[key] = value
 }
 
-// SortAllChildren sorts recursively
-// the list of children
-// of a node.
-func (n *node) sortAllChildren() {
-	for _, c := range n.children {
-		c.sortAllChildren()
-	}
-	slices.SortFunc(n.children, func(a, b *node) int {
-		szA := a.size()
-		szB := b.size()
-		if szA != szB {
-			if szA < szB {
-				return -1
+// Canonical writes the canonical representation
+// of a node
+// and all of its descendants.
+// It uses an explicit stack of open nodes,
+// so deep trees can be written.
+func (n *node) canonical(b *strings.Builder, k sortKeys) {
+	type frame struct {
+		n        *node
+		children []*node
+		next     int
+	}
+
+	stack := []frame{{n: n}}
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		if f.next == 0 && !f.n.isTerm() {
+			f.children = slices.Clone(f.n.children)
+			slices.SortFunc(f.children, func(x, y *node) int {
+				if c := cmp.Compare(k.first[x], k.first[y]); c != 0 {
+					return c
+				}
+				if c := cmp.Compare(k.size[x], k.size[y]); c != 0 {
+					return c
+				}
+				return cmp.Compare(y.age, x.age)
+			})
+			b.WriteString("(")
+		}
+		if f.next < len(f.children) {
+			if f.next > 0 {
+				b.WriteString(",")
 			}
-			return 1
+			c := f.children[f.next]
+			f.next++
+			stack = append(stack, frame{n: c})
+			continue
+		}
+
+		// close the node
+		if !f.n.isTerm() {
+			b.WriteString(")")
 		}
+		if f.n.taxon != "" {
+			b.WriteString(strconv.Quote(f.n.taxon))
+		}
+		b.WriteString(":")
+		b.WriteString(strconv.FormatInt(f.n.age, 10))
+		stack = stack[:len(stack)-1]
+	}
+}
 
-		if a.age != b.age {
-			// larger ages are earlier ages
-			if a.age > b.age {
-				return -1
+// SortAllChildren sorts
+// the list of children
+// of a node
+// and all of its descendants.
+// If a node is rotated,
+// the order of its children will be reversed,
+// and if the order is fixed,
+// the children will be kept in its current order.
+// The sort values must include the node
+// and all of its descendants.
+func (n *node) sortAllChildren(k sortKeys) {
+	for _, d := range n.preOrder(nil) {
+		if d.fixed {
+			continue
+		}
+		slices.SortFunc(d.children, k.compare)
+		if d.rotated {
+			slices.Reverse(d.children)
+		}
+	}
+}
+
+// SortKeys stores the values
+// used to sort the children of a node.
+type sortKeys struct {
+	// number of terminals of a node
+	size map[*node]int
+
+	// first terminal of a node
+	// by alphabetical order
+	first map[*node]string
+}
+
+// NewSortKeys returns the sort values
+// of a node
+// and all of its descendants.
+func newSortKeys(n *node) sortKeys {
+	ns := n.preOrder(nil)
+	k := sortKeys{
+		size:  make(map[*node]int, len(ns)),
+		first: make(map[*node]string, len(ns)),
+	}
+
+	// in reverse pre-order
+	// children are visited before their parents
+	for i := len(ns) - 1; i >= 0; i-- {
+		d := ns[i]
+		if d.isTerm() {
+			k.size[d] = 1
+			k.first[d] = d.taxon
+			continue
+		}
+		sz := 0
+		term := k.first[d.children[0]]
+		for _, c := range d.children {
+			sz += k.size[c]
+			if t := k.first[c]; t < term {
+				term = t
 			}
-			return 1
 		}
+		k.size[d] = sz
+		k.first[d] = term
+	}
+	return k
+}
+
+// Compare is used to sort the children of a node.
+func (k sortKeys) compare(a, b *node) int {
+	szA := k.size[a]
+	szB := k.size[b]
+	if szA != szB {
+		if szA < szB {
+			return -1
+		}
+		return 1
+	}
 
-		// search for terminals in alphabetical order
-		if a.firstTerm() < b.firstTerm() {
+	if a.age != b.age {
+		// larger ages are earlier ages
+		if a.age > b.age {
 			return -1
 		}
 		return 1
-	})
+	}
+
+	// search for terminals in alphabetical order
+	if k.first[a] < k.first[b] {
+		return -1
+	}
+	return 1
+}
+
+// SetRotation sets a node,
+// and all of its descendants,
+// as rotated
+// if the current order of its children
+// is the reverse of the sorted order.
+func (n *node) setRotation() {
+	k := newSortKeys(n)
+	for _, d := range n.preOrder(nil) {
+		if len(d.children) < 2 {
+			continue
+		}
+
+		sorted := slices.Clone(d.children)
+		slices.SortFunc(sorted, k.compare)
+		slices.Reverse(sorted)
+		d.rotated = slices.Equal(sorted, d.children)
+	}
 }
 
 // TotalLen returns the length of all the branches descendant
 // from a node.
 func (n *node) totalLen() int64 {
 	var l int64
-	for _, c := range n.children {
-		l += c.totalLen()
-	}
-
-	if n.parent != nil {
-		l += n.parent.age - n.age
+	for _, d := range n.preOrder(nil) {
+		if d.parent != nil {
+			l += d.parent.age - d.age
+		}
 	}
 	return l
 }
 
+// MetaKey returns a metadata field name
+// in its canonical form.
+func metaKey(key string) string {
+	return strings.ToLower(strings.Join(strings.Fields(key), " "))
+}
+
 // Canon returns a taxon name
 // in its canonical form.
 func canon(name string) string {
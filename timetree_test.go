@@ -5,7 +5,9 @@
 package timetree_test
 
 import (
+	"bytes"
 	"errors"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
@@ -249,6 +251,12 @@ func testTree(t testing.TB, tree *timetree.Tree, test treeTest) {
 		if !reflect.DeepEqual(terms, test.terms) {
 			t.Errorf("%s: got %v terminals, want %v", test.name, terms, test.terms)
 		}
+		if n := tree.NumTerms(); n != len(test.terms) {
+			t.Errorf("%s: number of terminals: got %d, want %d", test.name, n, len(test.terms))
+		}
+		if ct := tree.CladeTerms(tree.Root()); !reflect.DeepEqual(ct, test.terms) {
+			t.Errorf("%s: root terminals: got %v, want %v", test.name, ct, test.terms)
+		}
 	}
 
 	if tree.Len() != test.totLen {
@@ -323,6 +331,318 @@ func TestMRCA(t *testing.T) {
 	}
 }
 
+func TestFindNode(t *testing.T) {
+	tests := map[string]struct {
+		v   string
+		id  int
+		err error
+	}{
+		"id":            {v: " 2 ", id: 2},
+		"taxon":         {v: "passer domesticus", id: 10},
+		"list":          {v: "Passer domesticus, Ceratosaurus nasicornis", id: 2},
+		"missing id":    {v: "100", id: -1, err: timetree.ErrNodeNotFound},
+		"missing taxon": {v: "Passer domesticus,Homo sapiens", id: -1, err: timetree.ErrNodeNotFound},
+		"empty":         {v: " , ", id: -1, err: timetree.ErrNodeNotFound},
+	}
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("find node: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	for n, test := range tests {
+		id, err := d.FindNode(test.v)
+		if !errors.Is(err, test.err) {
+			t.Errorf("find node %q: got error %v, want %v", n, err, test.err)
+		}
+		if id != test.id {
+			t.Errorf("find node %q: got %d, want %d", n, id, test.id)
+		}
+	}
+}
+
+func TestCladeSize(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("clade size: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	sizes := map[int]int{0: 6, 1: 1, 2: 5, 3: 2, 6: 3, 8: 2, 10: 1, 11: -1}
+	for id, want := range sizes {
+		if got := d.CladeSize(id); got != want {
+			t.Errorf("clade size: node %d: got %d, want %d", id, got, want)
+		}
+	}
+	if got := d.MaxDepth(); got != 4 {
+		t.Errorf("clade size: max depth: got %d, want %d", got, 4)
+	}
+
+	terms := []string{"Archaeopteryx lithographica", "Passer domesticus", "Tyrannosaurus rex"}
+	if got := d.CladeTerms(6); !reflect.DeepEqual(got, terms) {
+		t.Errorf("clade size: clade terminals: got %v, want %v", got, terms)
+	}
+	if got := d.CladeTerms(11); got != nil {
+		t.Errorf("clade size: clade terminals: node 11: got %v, want nil", got)
+	}
+
+	// stored values must be updated
+	// after modifying the tree
+	id, err := d.Add(8, 10_000_000, "Struthio camelus")
+	if err != nil {
+		t.Fatalf("clade size: unexpected error: %v", err)
+	}
+	sizes = map[int]int{0: 7, 2: 6, 6: 4, 8: 3, id: 1}
+	for id, want := range sizes {
+		if got := d.CladeSize(id); got != want {
+			t.Errorf("clade size: after add: node %d: got %d, want %d", id, got, want)
+		}
+	}
+	if got := d.Depth(id); got != 4 {
+		t.Errorf("clade size: after add: depth: got %d, want %d", got, 4)
+	}
+
+	if err := d.Drop("Eoraptor lunensis"); err != nil {
+		t.Fatalf("clade size: unexpected error: %v", err)
+	}
+	if got := d.MaxDepth(); got != 3 {
+		t.Errorf("clade size: after drop: max depth: got %d, want %d", got, 3)
+	}
+	if got := d.CladeSize(d.Root()); got != 6 {
+		t.Errorf("clade size: after drop: root: got %d, want %d", got, 6)
+	}
+}
+
+func TestBranchesAt(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("BranchesAt: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	tests := map[string]struct {
+		age   int64
+		nodes []int
+	}{
+		"root":       {age: 235_000_000},
+		"older":      {age: 300_000_000},
+		"after root": {age: 232_000_000, nodes: []int{1, 2}},
+		"at node":    {age: 230_000_000, nodes: []int{1, 2}},
+		"jurassic":   {age: 150_000_000, nodes: []int{4, 5, 7, 9, 10}},
+		"present":    {age: 0, nodes: []int{10}},
+		"after tree": {age: -1},
+	}
+	for name, test := range tests {
+		var got []int
+		for _, b := range d.BranchesAt(test.age) {
+			got = append(got, b.Node)
+			if b.Parent != d.Parent(b.Node) {
+				t.Errorf("BranchesAt: %s: node %d: parent %d, want %d", name, b.Node, b.Parent, d.Parent(b.Node))
+			}
+			if b.Start != d.Age(b.Parent) || b.End != d.Age(b.Node) {
+				t.Errorf("BranchesAt: %s: node %d: got %d-%d, want %d-%d", name, b.Node, b.Start, b.End, d.Age(b.Parent), d.Age(b.Node))
+			}
+			if b.Start <= test.age || b.End > test.age {
+				t.Errorf("BranchesAt: %s: node %d: branch %d-%d does not cross %d", name, b.Node, b.Start, b.End, test.age)
+			}
+		}
+		if !reflect.DeepEqual(got, test.nodes) {
+			t.Errorf("BranchesAt: %s: got %v, want %v", name, got, test.nodes)
+		}
+	}
+}
+
+func TestBranchLen(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("BranchLen: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	check := func(step string) {
+		t.Helper()
+		for _, id := range d.Nodes() {
+			want := int64(0)
+			if p := d.Parent(id); p >= 0 {
+				want = d.Age(p) - d.Age(id)
+			}
+			if got := d.BranchLen(id); got != want {
+				t.Errorf("BranchLen: %s: node %d: got %d, want %d", step, id, got, want)
+			}
+		}
+	}
+	check("read")
+
+	if got := d.BranchLen(8); got != 10_000_000 {
+		t.Errorf("BranchLen: node 8: got %d, want %d", got, 10_000_000)
+	}
+	if got := d.BranchLen(100); got != 0 {
+		t.Errorf("BranchLen: undefined node: got %d, want %d", got, 0)
+	}
+
+	if err := d.Set(8, 165_000_000); err != nil {
+		t.Fatalf("BranchLen: unexpected error: %v", err)
+	}
+	check("set")
+
+	// moving the root keeps the branch lengths
+	if err := d.Move(240_000_000); err != nil {
+		t.Fatalf("BranchLen: unexpected error: %v", err)
+	}
+	check("move")
+	if got := d.Age(8); got != 170_000_000 {
+		t.Errorf("BranchLen: move: age of node 8: got %d, want %d", got, 170_000_000)
+	}
+
+	if _, err := d.AddSister(7, 73_000_000, 7_000_000, "Albertosaurus sarcophagus"); err != nil {
+		t.Fatalf("BranchLen: unexpected error: %v", err)
+	}
+	check("add sister")
+
+	cerato, _ := d.TaxNode("Ceratosaurus nasicornis")
+	if err := d.Delete(cerato); err != nil {
+		t.Fatalf("BranchLen: unexpected error: %v", err)
+	}
+	check("delete")
+}
+
+func TestCanonical(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("canonical: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	// the same tree,
+	// with different node IDs
+	// and order of children
+	other := `tree	node	parent	age	taxon
+theropods	0	-1	235000000	
+theropods	1	0	230000000	
+theropods	2	1	170000000	
+theropods	3	2	160000000	
+theropods	4	3	0	Passer domesticus
+theropods	5	3	150000000	Archaeopteryx lithographica
+theropods	6	2	68000000	Tyrannosaurus rex
+theropods	7	1	170000000	
+theropods	8	7	71000000	Carnotaurus sastrei
+theropods	9	7	145000000	Ceratosaurus nasicornis
+theropods	10	0	230000000	Eoraptor lunensis
+`
+	oc, err := timetree.ReadTSV(strings.NewReader(other))
+	if err != nil {
+		t.Fatalf("canonical: unexpected error: %v", err)
+	}
+	o := oc.Tree("theropods")
+
+	want := `years:(((("Archaeopteryx lithographica":150000000,"Passer domesticus":0):160000000,"Tyrannosaurus rex":68000000):170000000,("Carnotaurus sastrei":71000000,"Ceratosaurus nasicornis":145000000):170000000):230000000,"Eoraptor lunensis":230000000):235000000;`
+	if got := d.Canonical(); got != want {
+		t.Errorf("canonical: got %s, want %s", got, want)
+	}
+	if got := o.Canonical(); got != want {
+		t.Errorf("canonical: other tree: got %s, want %s", got, want)
+	}
+	if !d.Equal(o) {
+		t.Errorf("canonical: trees should be equal")
+	}
+	if d.Hash() != o.Hash() {
+		t.Errorf("canonical: hash: got %s and %s, want equal hashes", d.Hash(), o.Hash())
+	}
+
+	// a tree built by adding a taxon
+	// is equal to a tree read with the taxon
+	a := d.Clone()
+	b := o.Clone()
+	if _, err := a.Add(8, 10_000_000, "Struthio camelus"); err != nil {
+		t.Fatalf("canonical: unexpected error: %v", err)
+	}
+	if _, err := b.Add(3, 10_000_000, "Struthio camelus"); err != nil {
+		t.Fatalf("canonical: unexpected error: %v", err)
+	}
+	b.Format()
+	if !a.Equal(b) {
+		t.Errorf("canonical: after add: got %s and %s, want equal trees", a.Canonical(), b.Canonical())
+	}
+
+	if err := b.Set(b.Root(), 240_000_000); err != nil {
+		t.Fatalf("canonical: unexpected error: %v", err)
+	}
+	if a.Equal(b) {
+		t.Errorf("canonical: different ages: trees should be different")
+	}
+	if a.Hash() == b.Hash() {
+		t.Errorf("canonical: different ages: hash: got %s, want different hashes", a.Hash())
+	}
+
+	o.SetUnit(timetree.Generations)
+	if d.Equal(o) {
+		t.Errorf("canonical: different units: trees should be different")
+	}
+}
+
+func TestTipDistance(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("tip distance: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	tests := map[int]struct {
+		max  int64
+		min  int64
+		mean float64
+	}{
+		0:  {max: 235_000_000, min: 5_000_000, mean: 746_000_000.0 / 6},
+		3:  {max: 99_000_000, min: 25_000_000, mean: 62_000_000},
+		6:  {max: 170_000_000, min: 20_000_000, mean: 292_000_000.0 / 3},
+		7:  {},
+		11: {},
+	}
+	for id, test := range tests {
+		if got := d.MaxTipDistance(id); got != test.max {
+			t.Errorf("tip distance: node %d: max: got %d, want %d", id, got, test.max)
+		}
+		if got := d.MinTipDistance(id); got != test.min {
+			t.Errorf("tip distance: node %d: min: got %d, want %d", id, got, test.min)
+		}
+		if got := d.MeanTipDistance(id); math.Abs(got-test.mean) > 1 {
+			t.Errorf("tip distance: node %d: mean: got %.2f, want %.2f", id, got, test.mean)
+		}
+	}
+}
+
+func TestUltrametric(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("ultrametric: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	if d.IsUltrametric(0) {
+		t.Errorf("ultrametric: tree %q: got ultrametric", d.Name())
+	}
+	want := []string{"Archaeopteryx lithographica", "Ceratosaurus nasicornis", "Eoraptor lunensis"}
+	if got := d.NonUltrametric(100_000_000); !reflect.DeepEqual(got, want) {
+		t.Errorf("ultrametric: got %v, want %v", got, want)
+	}
+	if !d.IsUltrametric(230_000_000) {
+		t.Errorf("ultrametric: tolerance %d: got non ultrametric", 230_000_000)
+	}
+
+	mammals := "(Gallus_gallus:324,(Macropus_fuliginosus:176,(Macaca_mulatta:25,'homo  sapiens':25):151):148);"
+	c, err = timetree.Newick(strings.NewReader(mammals), "mammals", 0)
+	if err != nil {
+		t.Fatalf("ultrametric: unexpected error: %v", err)
+	}
+	m := c.Tree("mammals")
+	if !m.IsUltrametric(0) {
+		t.Errorf("ultrametric: tree %q: got non ultrametric", m.Name())
+	}
+	if got := m.NonUltrametric(0); len(got) != 0 {
+		t.Errorf("ultrametric: tree %q: got %v", m.Name(), got)
+	}
+}
+
 func TestSet(t *testing.T) {
 	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
 	if err != nil {
@@ -382,6 +702,54 @@ func TestSetError(t *testing.T) {
 	}
 }
 
+func TestSetBranchLens(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("SetBranchLens: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	// node 8 is moved 5 million years older,
+	// and its descendants follow it
+	lens := map[int]int64{
+		0:  1_000_000,
+		8:  5_000_000,
+		9:  20_000_000,
+		50: 1_000_000,
+	}
+	if err := d.SetBranchLens(lens); err != nil {
+		t.Fatalf("SetBranchLens: unexpected error: %v", err)
+	}
+	ages := map[int]int64{
+		0:  235_000_000,
+		6:  170_000_000,
+		8:  165_000_000,
+		9:  145_000_000,
+		10: 5_000_000,
+	}
+	for id, want := range ages {
+		if got := d.Age(id); got != want {
+			t.Errorf("SetBranchLens: node %d: got age %d, want %d", id, got, want)
+		}
+	}
+
+	// invalid lengths do not modify the tree
+	bad := map[string]map[int]int64{
+		"negative": {8: -1},
+		"too long": {10: 200_000_000},
+	}
+	for name, lens := range bad {
+		if err := d.SetBranchLens(lens); err == nil {
+			t.Errorf("SetBranchLens: %s: expecting error", name)
+		}
+		for id, want := range ages {
+			if got := d.Age(id); got != want {
+				t.Errorf("SetBranchLens: %s: node %d: got age %d, want %d", name, id, got, want)
+			}
+		}
+	}
+}
+
 func TestAddSister(t *testing.T) {
 	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
 	if err != nil {
@@ -529,6 +897,83 @@ dinos	19	10	0	Struthio camelus
 dinos	20	10	0	Turdus migratorius
 `
 
+func TestGraft(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("Graft: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	sc, err := timetree.Newick(strings.NewReader("(Velociraptor_mongoliensis:5,Deinonychus_antirrhopus:5);"), "dromaeosaurs", 75_000_000)
+	if err != nil {
+		t.Fatalf("Graft: unexpected error: %v", err)
+	}
+	src := sc.Tree("dromaeosaurs")
+
+	errs := map[string]struct {
+		id  int
+		age int64
+		err error
+	}{
+		"no sister":      {id: 500, age: 80_000_000, err: timetree.ErrAddNoSister},
+		"young sister":   {id: 7, age: 60_000_000, err: timetree.ErrYoungerAge},
+		"young source":   {id: 7, age: 70_000_000, err: timetree.ErrYoungerAge},
+		"old for parent": {id: 7, age: 175_000_000, err: timetree.ErrOlderAge},
+	}
+	for name, test := range errs {
+		if _, err := d.Graft(test.id, src, test.age); !errors.Is(err, test.err) {
+			t.Errorf("Graft: %s: got error %v, want %v", name, err, test.err)
+		}
+	}
+
+	cl := d.Clone()
+	if _, err := cl.Graft(1, src, 232_000_000); err != nil {
+		t.Fatalf("Graft: unexpected error: %v", err)
+	}
+	if _, err := cl.Graft(7, src, 80_000_000); !errors.Is(err, timetree.ErrAddRepeated) {
+		t.Errorf("Graft: repeated name: got error %v, want %v", err, timetree.ErrAddRepeated)
+	}
+
+	// graft at the root
+	cl = d.Clone()
+	rID, err := cl.Graft(cl.Root(), src, 240_000_000)
+	if err != nil {
+		t.Fatalf("Graft: root: unexpected error: %v", err)
+	}
+	if !cl.IsRoot(rID) {
+		t.Errorf("Graft: root: node %d is not the root", rID)
+	}
+
+	id, err := d.Graft(7, src, 80_000_000)
+	if err != nil {
+		t.Fatalf("Graft: unexpected error: %v", err)
+	}
+	if got := len(d.Terms()); got != 8 {
+		t.Errorf("Graft: terminals: got %d, want %d", got, 8)
+	}
+	if got := d.MRCA("Tyrannosaurus rex", "Velociraptor mongoliensis"); got != id {
+		t.Errorf("Graft: mrca: got %d, want %d", got, id)
+	}
+	if got := d.Age(id); got != 80_000_000 {
+		t.Errorf("Graft: age: got %d, want %d", got, 80_000_000)
+	}
+	if got := d.Parent(id); got != 6 {
+		t.Errorf("Graft: parent: got %d, want %d", got, 6)
+	}
+	v, _ := d.TaxNode("Velociraptor mongoliensis")
+	if got := d.Age(v); got != 70_000_000 {
+		t.Errorf("Graft: terminal age: got %d, want %d", got, 70_000_000)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Graft: unexpected error: %v", err)
+	}
+
+	// source tree is not modified
+	if got := len(src.Nodes()); got != 3 {
+		t.Errorf("Graft: source nodes: got %d, want %d", got, 3)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	c, err := timetree.ReadTSV(strings.NewReader(dinoTreeToDel))
 	if err != nil {
@@ -604,47 +1049,863 @@ func TestDelete(t *testing.T) {
 	testTree(t, d, w)
 }
 
-func TestSubTree(t *testing.T) {
-	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
-	if err != nil {
-		t.Fatalf("Delete: unexpected error: %v", err)
-	}
-
-	d := c.Tree("dinos")
-	if d == nil {
-		t.Fatalf("Delete: tree %q not found", "dinos")
-	}
-
-	mrca := d.MRCA("Tyrannosaurus rex", "Passer domesticus")
-	nt := d.SubTree(mrca, "TETANUROS")
-
+func TestPrune(t *testing.T) {
 	w := treeTest{
-		name: "tetanuros",
+		name: "dinos",
 		age:  0,
 		nodes: []node{
-			{id: 0, parent: -1, age: 170_000_000, children: []int{1, 2}},
-			{id: 1, parent: 0, age: 68_000_000, taxon: "Tyrannosaurus rex", toRoot: 102_000_000, depth: 1},
-			{id: 2, parent: 0, age: 160_000_000, children: []int{3, 4}, toRoot: 10_000_000, depth: 1},
-			{id: 3, parent: 2, age: 150_000_000, taxon: "Archaeopteryx lithographica", toRoot: 20_000_000, depth: 2},
-			{id: 4, parent: 2, age: 0, taxon: "Passer domesticus", toRoot: 170_000_000, depth: 2},
+			{id: 0, parent: -1, age: 235_000_000, children: []int{1, 2}},
+			{id: 1, parent: 0, age: 230_000_000, taxon: "Eoraptor lunensis", toRoot: 5_000_000, depth: 1},
+			{id: 2, parent: 0, age: 230_000_000, children: []int{3, 6}, toRoot: 5_000_000, depth: 1},
+			{id: 3, parent: 2, age: 170_000_000, children: []int{4, 5}, toRoot: 65_000_000, depth: 2},
+			{id: 4, parent: 3, age: 145_000_000, taxon: "Ceratosaurus nasicornis", toRoot: 90_000_000, depth: 3},
+			{id: 5, parent: 3, age: 71_000_000, taxon: "Carnotaurus sastrei", toRoot: 164_000_000, depth: 3},
+			{id: 6, parent: 2, age: 170_000_000, children: []int{7, 8}, toRoot: 65_000_000, depth: 2},
+			{id: 7, parent: 6, age: 68_000_000, taxon: "Tyrannosaurus rex", toRoot: 167_000_000, depth: 3},
+			{id: 8, parent: 6, age: 160_000_000, children: []int{9, 10}, toRoot: 75_000_000, depth: 3},
+			{id: 9, parent: 8, age: 150_000_000, taxon: "Archaeopteryx lithographica", toRoot: 85_000_000, depth: 4},
+			{id: 10, parent: 8, age: 0, taxon: "Passer domesticus", toRoot: 235_000_000, depth: 4},
 		},
 		terms: []string{
 			"Archaeopteryx lithographica",
+			"Carnotaurus sastrei",
+			"Ceratosaurus nasicornis",
+			"Eoraptor lunensis",
 			"Passer domesticus",
 			"Tyrannosaurus rex",
 		},
 		taxa: []string{
 			"Archaeopteryx lithographica",
+			"Carnotaurus sastrei",
+			"Ceratosaurus nasicornis",
+			"Eoraptor lunensis",
 			"Passer domesticus",
 			"Tyrannosaurus rex",
 		},
-		totLen: 282_000_000,
+		totLen: 536_000_000,
 	}
 
-	testTree(t, nt, w)
+	tests := map[string]func(*timetree.Tree) error{
+		"drop": func(d *timetree.Tree) error {
+			return d.Drop(
+				"Majungasaurus crenatissimus",
+				"Turdus migratorius",
+				"Struthio camelus",
+				"Falco peregrinus",
+				"Pisanosaurus mertii",
+				"Albertosaurus sarcophagus",
+				"Gorgosaurus libratus",
+				"Velociraptor mongoliensis", // not in tree
+			)
+		},
+		"keep": func(d *timetree.Tree) error {
+			return d.Keep(w.terms...)
+		},
+	}
 
-	// Test default tree name
-	nt = d.SubTree(mrca, "")
-	w.name = "dinos:node-6"
-	testTree(t, nt, w)
+	for name, prune := range tests {
+		c, err := timetree.ReadTSV(strings.NewReader(dinoTreeToDel))
+		if err != nil {
+			t.Fatalf("Prune: %s: unexpected error: %v", name, err)
+		}
+		d := c.Tree("dinos")
+
+		if err := prune(d); err != nil {
+			t.Fatalf("Prune: %s: unexpected error: %v", name, err)
+		}
+		d.Format()
+		testTree(t, d, w)
+	}
+
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTreeToDel))
+	if err != nil {
+		t.Fatalf("Prune: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+	if err := d.Keep("Passer domesticus"); !errors.Is(err, timetree.ErrPruneTerms) {
+		t.Errorf("Prune: got error %v, want %v", err, timetree.ErrPruneTerms)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c, err := timetree.Newick(strings.NewReader("((A:10,B:10):20,(C:15,D:15):15);"), "dest", 0)
+	if err != nil {
+		t.Fatalf("Merge: unexpected error: %v", err)
+	}
+	d := c.Tree("dest")
+
+	c, err = timetree.Newick(strings.NewReader("(((A:12,E:12):2,B:14):26,(C:20,F:20):20);"), "src", 0)
+	if err != nil {
+		t.Fatalf("Merge: unexpected error: %v", err)
+	}
+	src := c.Tree("src")
+
+	if err := d.Merge(src); err != nil {
+		t.Fatalf("Merge: unexpected error: %v", err)
+	}
+	if err := d.Validate(); err != nil {
+		t.Fatalf("Merge: invalid tree: %v", err)
+	}
+
+	terms := []string{"A", "B", "C", "D", "E", "F"}
+	if got := d.Terms(); !reflect.DeepEqual(got, terms) {
+		t.Errorf("Merge: terms: got %v, want %v", got, terms)
+	}
+
+	ages := []struct {
+		taxa []string
+		age  int64
+	}{
+		{taxa: []string{"A", "E"}, age: 12_000_000},
+		{taxa: []string{"A", "B"}, age: 14_000_000},
+		{taxa: []string{"C", "F"}, age: 7_500_000},
+		{taxa: []string{"C", "D"}, age: 15_000_000},
+		{taxa: []string{"A", "D"}, age: 40_000_000},
+	}
+	for _, a := range ages {
+		if age := d.Age(d.MRCA(a.taxa...)); age != a.age {
+			t.Errorf("Merge: %v: age %d, want %d", a.taxa, age, a.age)
+		}
+	}
+	if got := src.Terms(); len(got) != 5 {
+		t.Errorf("Merge: source tree modified: %v", got)
+	}
+
+	c, err = timetree.Newick(strings.NewReader("(A:10,(G:5,H:5):5);"), "other", 0)
+	if err != nil {
+		t.Fatalf("Merge: unexpected error: %v", err)
+	}
+	if err := d.Merge(c.Tree("other")); !errors.Is(err, timetree.ErrMergeShared) {
+		t.Errorf("Merge: got error %v, want %v", err, timetree.ErrMergeShared)
+	}
+
+	src.SetUnit(timetree.Generations)
+	if err := d.Merge(src); !errors.Is(err, timetree.ErrMergeUnits) {
+		t.Errorf("Merge: got error %v, want %v", err, timetree.ErrMergeUnits)
+	}
+
+	// a failed merge does not modify the tree
+	d = timetree.New("dest", 40_000_000)
+	ab, _ := d.Add(0, 10_000_000, "")
+	d.Add(ab, 1, "A")
+	d.Add(ab, 30_000_000, "B")
+	d.Add(0, 40_000_000, "C")
+	want := d.Canonical()
+
+	src = timetree.New("src", 45_000_000)
+	abe, _ := src.Add(0, 15_000_000, "")
+	ae, _ := src.Add(abe, 5_000_000, "")
+	src.Add(ae, 25_000_000, "A")
+	ef, _ := src.Add(ae, 1_000_000, "")
+	src.Add(ef, 24_000_000, "E")
+	src.Add(ef, 24_000_000, "F")
+	src.Add(abe, 30_000_000, "B")
+	src.Add(0, 45_000_000, "C")
+
+	if err := d.Merge(src); !errors.Is(err, timetree.ErrOlderAge) {
+		t.Errorf("Merge: got error %v, want %v", err, timetree.ErrOlderAge)
+	}
+	if got := d.Canonical(); got != want {
+		t.Errorf("Merge: failed merge: got tree %q, want %q", got, want)
+	}
+}
+
+func TestSubTree(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("Delete: unexpected error: %v", err)
+	}
+
+	d := c.Tree("dinos")
+	if d == nil {
+		t.Fatalf("Delete: tree %q not found", "dinos")
+	}
+
+	mrca := d.MRCA("Tyrannosaurus rex", "Passer domesticus")
+	nt := d.SubTree(mrca, "TETANUROS")
+
+	w := treeTest{
+		name: "tetanuros",
+		age:  0,
+		nodes: []node{
+			{id: 0, parent: -1, age: 170_000_000, children: []int{1, 2}},
+			{id: 1, parent: 0, age: 68_000_000, taxon: "Tyrannosaurus rex", toRoot: 102_000_000, depth: 1},
+			{id: 2, parent: 0, age: 160_000_000, children: []int{3, 4}, toRoot: 10_000_000, depth: 1},
+			{id: 3, parent: 2, age: 150_000_000, taxon: "Archaeopteryx lithographica", toRoot: 20_000_000, depth: 2},
+			{id: 4, parent: 2, age: 0, taxon: "Passer domesticus", toRoot: 170_000_000, depth: 2},
+		},
+		terms: []string{
+			"Archaeopteryx lithographica",
+			"Passer domesticus",
+			"Tyrannosaurus rex",
+		},
+		taxa: []string{
+			"Archaeopteryx lithographica",
+			"Passer domesticus",
+			"Tyrannosaurus rex",
+		},
+		totLen: 282_000_000,
+	}
+
+	testTree(t, nt, w)
+
+	// Test default tree name
+	nt = d.SubTree(mrca, "")
+	w.name = "dinos:node-6"
+	testTree(t, nt, w)
+}
+
+func TestSwap(t *testing.T) {
+	tests := map[string]struct {
+		crown int64
+		fit   bool
+		err   error
+		age   int64
+		cerat int64
+	}{
+		"young clade": {
+			crown: 200_000_000,
+			age:   200_000_000,
+			cerat: 145_000_000,
+		},
+		"old clade": {
+			crown: 240_000_000,
+			err:   timetree.ErrOlderAge,
+		},
+		"fit clade": {
+			crown: 240_000_000,
+			fit:   true,
+			age:   170_000_000,
+			cerat: 114_349_112,
+		},
+	}
+
+	for name, test := range tests {
+		c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		d := c.Tree("dinos")
+
+		src := timetree.New("ceratosauria", test.crown)
+		src.Add(0, test.crown-145_000_000, "Ceratosaurus nasicornis")
+		src.Add(0, test.crown-71_000_000, "Carnotaurus sastrei")
+
+		id := d.MRCA("Ceratosaurus nasicornis", "Carnotaurus sastrei")
+		err = d.Swap(id, src, src.Root(), test.fit)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: got error %v, want %v", name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		id = d.MRCA("Ceratosaurus nasicornis", "Carnotaurus sastrei")
+		if a := d.Age(id); a != test.age {
+			t.Errorf("%s: crown age: got %d, want %d", name, a, test.age)
+		}
+		if p := d.Parent(id); p != d.MRCA("Ceratosaurus nasicornis", "Tyrannosaurus rex") {
+			t.Errorf("%s: parent: got %d", name, p)
+		}
+		cer, _ := d.TaxNode("Ceratosaurus nasicornis")
+		if a := d.Age(cer); a != test.cerat {
+			t.Errorf("%s: terminal age: got %d, want %d", name, a, test.cerat)
+		}
+		if l := d.BranchLen(id); l != 230_000_000-test.age {
+			t.Errorf("%s: branch length: got %d, want %d", name, l, 230_000_000-test.age)
+		}
+		if err := d.Validate(); err != nil {
+			t.Errorf("%s: invalid tree: %v", name, err)
+		}
+		if len(d.Terms()) != 6 {
+			t.Errorf("%s: terms: got %d, want %d", name, len(d.Terms()), 6)
+		}
+	}
+
+	// the crown node keeps the metadata
+	// of the replaced node
+	c, _ := timetree.ReadTSV(strings.NewReader(dinoTree))
+	d := c.Tree("dinos")
+	id := d.MRCA("Ceratosaurus nasicornis", "Carnotaurus sastrei")
+	d.SetMeta(id, "posterior", "0.95")
+	src := timetree.New("ceratosauria", 200_000_000)
+	src.Add(0, 55_000_000, "Ceratosaurus nasicornis")
+	src.Add(0, 129_000_000, "Carnotaurus sastrei")
+	src.SetMeta(src.Root(), "posterior", "0.50")
+	if err := d.Swap(id, src, src.Root(), false); err != nil {
+		t.Fatalf("metadata: unexpected error: %v", err)
+	}
+	id = d.MRCA("Ceratosaurus nasicornis", "Carnotaurus sastrei")
+	if got := d.Meta(id, "posterior"); got != "0.95" {
+		t.Errorf("metadata: got %q, want %q", got, "0.95")
+	}
+
+	// a source name used outside the replaced clade
+	c, _ = timetree.ReadTSV(strings.NewReader(dinoTree))
+	d = c.Tree("dinos")
+	id = d.MRCA("Ceratosaurus nasicornis", "Carnotaurus sastrei")
+	src = timetree.New("ceratosauria", 200_000_000)
+	src.Add(0, 55_000_000, "Ceratosaurus nasicornis")
+	src.Add(0, 129_000_000, "Carnotaurus sastrei")
+	src.SetName(src.Root(), "Tyrannosaurus rex")
+	want := d.Canonical()
+	if err := d.Swap(id, src, src.Root(), false); !errors.Is(err, timetree.ErrAddRepeated) {
+		t.Errorf("repeated name: got error %v, want %v", err, timetree.ErrAddRepeated)
+	}
+	if got := d.Canonical(); got != want {
+		t.Errorf("repeated name: tree changed")
+	}
+
+	// different terminals
+	c, _ = timetree.ReadTSV(strings.NewReader(dinoTree))
+	d = c.Tree("dinos")
+	src = timetree.New("other", 200_000_000)
+	src.Add(0, 55_000_000, "Ceratosaurus nasicornis")
+	src.Add(0, 129_000_000, "Majungasaurus crenatissimus")
+	id = d.MRCA("Ceratosaurus nasicornis", "Carnotaurus sastrei")
+	if err := d.Swap(id, src, src.Root(), false); !errors.Is(err, timetree.ErrSwapTerms) {
+		t.Errorf("different terminals: got error %v, want %v", err, timetree.ErrSwapTerms)
+	}
+}
+
+func TestClone(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("Clone: unexpected error: %v", err)
+	}
+
+	d := c.Tree("dinos")
+	if d == nil {
+		t.Fatalf("Clone: tree %q not found", "dinos")
+	}
+	if err := d.SetMeta(8, "posterior", "0.95"); err != nil {
+		t.Fatalf("Clone: unexpected error: %v", err)
+	}
+
+	cp := d.Clone()
+	if cp.Name() != d.Name() {
+		t.Errorf("Clone: name: got %q, want %q", cp.Name(), d.Name())
+	}
+	if got, want := cp.Nodes(), d.Nodes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Clone: nodes: got %v, want %v", got, want)
+	}
+	for _, id := range d.Nodes() {
+		if got, want := getNode(cp, id), getNode(d, id); !reflect.DeepEqual(got, want) {
+			t.Errorf("Clone: node %d: got %v, want %v", id, got, want)
+		}
+	}
+	if got := cp.Meta(8, "posterior"); got != "0.95" {
+		t.Errorf("Clone: meta: got %q, want %q", got, "0.95")
+	}
+
+	// changes in the copy
+	// should not modify the original tree
+	want := make(map[int]node)
+	for _, id := range d.Nodes() {
+		want[id] = getNode(d, id)
+	}
+	term, _ := cp.TaxNode("Carnotaurus sastrei")
+	if err := cp.Delete(term); err != nil {
+		t.Fatalf("Clone: unexpected error: %v", err)
+	}
+	if err := cp.Set(6, 200_000_000); err != nil {
+		t.Fatalf("Clone: unexpected error: %v", err)
+	}
+	if err := cp.SetMeta(8, "posterior", "0.50"); err != nil {
+		t.Fatalf("Clone: unexpected error: %v", err)
+	}
+	for _, id := range d.Nodes() {
+		if got := getNode(d, id); !reflect.DeepEqual(got, want[id]) {
+			t.Errorf("Clone: original node %d: got %v, want %v", id, got, want[id])
+		}
+	}
+	if got := d.Meta(8, "posterior"); got != "0.95" {
+		t.Errorf("Clone: original meta: got %q, want %q", got, "0.95")
+	}
+	if _, ok := d.TaxNode("Carnotaurus sastrei"); !ok {
+		t.Errorf("Clone: original taxon %q not found", "Carnotaurus sastrei")
+	}
+}
+
+func TestScale(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("Scale: unexpected error: %v", err)
+	}
+
+	d := c.Tree("dinos")
+	if d == nil {
+		t.Fatalf("Scale: tree %q not found", "dinos")
+	}
+
+	if err := d.Scale(0); !errors.Is(err, timetree.ErrInvalidScale) {
+		t.Errorf("Scale: got error %v, want %v", err, timetree.ErrInvalidScale)
+	}
+	if err := d.Scale(2); err != nil {
+		t.Fatalf("Scale: unexpected error: %v", err)
+	}
+	want := map[int]int64{
+		0:  470_000_000,
+		3:  340_000_000,
+		7:  136_000_000,
+		10: 0,
+	}
+	for id, a := range want {
+		if got := d.Age(id); got != a {
+			t.Errorf("Scale: node %d: got %d, want %d", id, got, a)
+		}
+	}
+	if got := d.Len(); got != 1_072_000_000 {
+		t.Errorf("Scale: length: got %d, want %d", got, 1_072_000_000)
+	}
+
+	if err := d.ScaleTo(0); !errors.Is(err, timetree.ErrInvalidRootAge) {
+		t.Errorf("ScaleTo: got error %v, want %v", err, timetree.ErrInvalidRootAge)
+	}
+	if err := d.ScaleTo(117_500_000); err != nil {
+		t.Fatalf("ScaleTo: unexpected error: %v", err)
+	}
+	want = map[int]int64{
+		0:  117_500_000,
+		1:  115_000_000,
+		7:  34_000_000,
+		10: 0,
+	}
+	for id, a := range want {
+		if got := d.Age(id); got != a {
+			t.Errorf("ScaleTo: node %d: got %d, want %d", id, got, a)
+		}
+	}
+}
+
+func TestScaleBranches(t *testing.T) {
+	mammals := "(Gallus_gallus:324,(Macropus_fuliginosus:176,(Macaca_mulatta:25,'homo  sapiens':25):151):148);"
+	c, err := timetree.Newick(strings.NewReader(mammals), "mammals", 0)
+	if err != nil {
+		t.Fatalf("ScaleBranches: unexpected error: %v", err)
+	}
+	m := c.Tree("mammals")
+
+	if err := m.ScaleBranches(0, nil); !errors.Is(err, timetree.ErrInvalidScale) {
+		t.Errorf("ScaleBranches: got error %v, want %v", err, timetree.ErrInvalidScale)
+	}
+	if err := m.ScaleBranches(2, map[int]float64{2: 4}); !errors.Is(err, timetree.ErrYoungerAge) {
+		t.Errorf("ScaleBranches: got error %v, want %v", err, timetree.ErrYoungerAge)
+	}
+	if got := m.Age(0); got != 324_000_000 {
+		t.Errorf("ScaleBranches: tree modified after error: root age %d", got)
+	}
+
+	if err := m.ScaleBranches(2, map[int]float64{4: 1}); err != nil {
+		t.Fatalf("ScaleBranches: unexpected error: %v", err)
+	}
+	want := map[int]int64{
+		0: 648_000_000,
+		1: 0,
+		2: 352_000_000,
+		3: 0,
+		4: 201_000_000,
+		5: 176_000_000,
+		6: 176_000_000,
+	}
+	for id, a := range want {
+		if got := m.Age(id); got != a {
+			t.Errorf("ScaleBranches: node %d: got %d, want %d", id, got, a)
+		}
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("ScaleBranches: unexpected error: %v", err)
+	}
+}
+
+func TestSetMeta(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("SetMeta: unexpected error: %v", err)
+	}
+
+	d := c.Tree("dinos")
+	if d == nil {
+		t.Fatalf("SetMeta: tree %q not found", "dinos")
+	}
+
+	if err := d.SetMeta(8, "Posterior", " 0.95 "); err != nil {
+		t.Fatalf("SetMeta: unexpected error: %v", err)
+	}
+	if got := d.Meta(8, "posterior"); got != "0.95" {
+		t.Errorf("SetMeta: got %q, want %q", got, "0.95")
+	}
+
+	if err := d.SetMeta(8, "posterior", ""); err != nil {
+		t.Fatalf("SetMeta: unexpected error: %v", err)
+	}
+	if keys := d.MetaKeys(8); len(keys) != 0 {
+		t.Errorf("SetMeta: got keys %v, want none", keys)
+	}
+
+	if err := d.SetMeta(8, "age", "10"); !errors.Is(err, timetree.ErrMetaKey) {
+		t.Errorf("SetMeta: got error %v, want %v", err, timetree.ErrMetaKey)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("Rotate: unexpected error: %v", err)
+	}
+
+	d := c.Tree("dinos")
+	if d == nil {
+		t.Fatalf("Rotate: tree %q not found", "dinos")
+	}
+
+	d.Rotate(8)
+	d.Rotate(0)
+	d.Format()
+
+	want := []struct {
+		id       int
+		taxon    string
+		children []int
+	}{
+		{id: 0, children: []int{1, 10}},
+		{id: 1, children: []int{2, 5}},
+		{id: 2, children: []int{3, 4}},
+		{id: 3, taxon: "Ceratosaurus nasicornis"},
+		{id: 5, children: []int{6, 7}},
+		{id: 6, taxon: "Tyrannosaurus rex"},
+		{id: 7, children: []int{8, 9}},
+		{id: 8, taxon: "Passer domesticus"},
+		{id: 9, taxon: "Archaeopteryx lithographica"},
+		{id: 10, taxon: "Eoraptor lunensis"},
+	}
+	check := func(name string, tr *timetree.Tree) {
+		for _, w := range want {
+			if got := tr.Taxon(w.id); got != w.taxon {
+				t.Errorf("Rotate %s: node %d: got taxon %q, want %q", name, w.id, got, w.taxon)
+			}
+			if got := tr.Children(w.id); !reflect.DeepEqual(got, w.children) {
+				t.Errorf("Rotate %s: node %d: got children %v, want %v", name, w.id, got, w.children)
+			}
+		}
+	}
+	check("format", d)
+
+	// rotations are kept after reading a tree
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("Rotate: while writing data: %v", err)
+	}
+	nc, err := timetree.ReadTSV(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("Rotate: while reading data: %v", err)
+	}
+	check("tsv", nc.Tree("dinos"))
+
+	// rotate back
+	d.Rotate(0)
+	d.Format()
+	if got := d.Taxon(1); got != "Eoraptor lunensis" {
+		t.Errorf("Rotate back: node 1: got taxon %q, want %q", got, "Eoraptor lunensis")
+	}
+}
+
+func TestSetOrder(t *testing.T) {
+	tr := timetree.New("polytomy", 10_000_000)
+	for _, tx := range []string{"Alpha", "Beta", "Gamma"} {
+		if _, err := tr.Add(0, 10_000_000, tx); err != nil {
+			t.Fatalf("SetOrder: unexpected error: %v", err)
+		}
+	}
+	tr.Format()
+
+	a, _ := tr.TaxNode("Alpha")
+	b, _ := tr.TaxNode("Beta")
+	g, _ := tr.TaxNode("Gamma")
+	if err := tr.SetOrder(0, []int{a, b}); !errors.Is(err, timetree.ErrOrderChildren) {
+		t.Errorf("SetOrder: got error %v, want %v", err, timetree.ErrOrderChildren)
+	}
+	if err := tr.SetOrder(0, []int{a, b, b}); !errors.Is(err, timetree.ErrOrderChildren) {
+		t.Errorf("SetOrder: got error %v, want %v", err, timetree.ErrOrderChildren)
+	}
+	if err := tr.SetOrder(0, []int{g, a, b}); err != nil {
+		t.Fatalf("SetOrder: unexpected error: %v", err)
+	}
+	tr.Format()
+
+	want := []string{"Gamma", "Alpha", "Beta"}
+	check := func(name string, tr *timetree.Tree) {
+		for i, c := range tr.Children(0) {
+			if got := tr.Taxon(c); got != want[i] {
+				t.Errorf("SetOrder %s: child %d: got %q, want %q", name, i, got, want[i])
+			}
+		}
+	}
+	check("format", tr)
+
+	// order is kept after reading a tree
+	c := timetree.NewCollection()
+	c.Add(tr)
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("SetOrder: while writing data: %v", err)
+	}
+	if !strings.Contains(buf.String(), "taxon\torder") {
+		t.Errorf("SetOrder: field %q not found in TSV output", "order")
+	}
+	nc, err := timetree.ReadTSV(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("SetOrder: while reading data: %v", err)
+	}
+	check("tsv", nc.Tree("polytomy"))
+
+	// default order
+	tr.SetOrder(0, nil)
+	tr.Format()
+	want = []string{"Alpha", "Beta", "Gamma"}
+	check("default", tr)
+}
+
+func TestOffset(t *testing.T) {
+	tr := timetree.New("extinct", 100_000_000)
+	if _, err := tr.Add(0, 30_000_000, "Alpha"); err != nil {
+		t.Fatalf("Offset: unexpected error: %v", err)
+	}
+	if _, err := tr.Add(0, 25_000_000, "Beta"); err != nil {
+		t.Fatalf("Offset: unexpected error: %v", err)
+	}
+
+	if err := tr.SetOffset(-1); !errors.Is(err, timetree.ErrInvalidOffset) {
+		t.Errorf("Offset: got error %v, want %v", err, timetree.ErrInvalidOffset)
+	}
+	if err := tr.SetOffset(71_000_000); !errors.Is(err, timetree.ErrInvalidOffset) {
+		t.Errorf("Offset: got error %v, want %v", err, timetree.ErrInvalidOffset)
+	}
+	if err := tr.SetOffset(66_000_000); err != nil {
+		t.Fatalf("Offset: unexpected error: %v", err)
+	}
+	if got := tr.Offset(); got != 66_000_000 {
+		t.Errorf("Offset: got %d, want %d", got, 66_000_000)
+	}
+
+	// nodes can not be younger than the offset
+	if _, err := tr.Add(0, 40_000_000, "Gamma"); !errors.Is(err, timetree.ErrAddInvalidBrLen) {
+		t.Errorf("Offset: add: got error %v, want %v", err, timetree.ErrAddInvalidBrLen)
+	}
+	a, _ := tr.TaxNode("Alpha")
+	nodes := len(tr.Nodes())
+	if _, err := tr.AddSister(a, 10_000_000, 70_000_000, "Gamma"); !errors.Is(err, timetree.ErrYoungerAge) {
+		t.Errorf("Offset: add sister: got error %v, want %v", err, timetree.ErrYoungerAge)
+	}
+	if got := len(tr.Nodes()); got != nodes {
+		t.Errorf("Offset: add sister: got %d nodes, want %d", got, nodes)
+	}
+	if err := tr.Set(a, 60_000_000); !errors.Is(err, timetree.ErrYoungerAge) {
+		t.Errorf("Offset: set: got error %v, want %v", err, timetree.ErrYoungerAge)
+	}
+	if err := tr.Move(95_000_000); !errors.Is(err, timetree.ErrInvalidRootAge) {
+		t.Errorf("Offset: move: got error %v, want %v", err, timetree.ErrInvalidRootAge)
+	}
+	if err := tr.Move(96_000_000); err != nil {
+		t.Errorf("Offset: move: unexpected error: %v", err)
+	}
+	if sub := tr.SubTree(0, "sub"); sub.Offset() != tr.Offset() {
+		t.Errorf("Offset: subtree: got %d, want %d", sub.Offset(), tr.Offset())
+	}
+
+	// offset is kept after reading a tree
+	c := timetree.NewCollection()
+	c.Add(tr)
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("Offset: while writing data: %v", err)
+	}
+	nc, err := timetree.ReadTSV(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("Offset: while reading data: %v", err)
+	}
+	if got := nc.Tree("extinct").Offset(); got != tr.Offset() {
+		t.Errorf("Offset: tsv: got %d, want %d", got, tr.Offset())
+	}
+
+	buf.Reset()
+	if err := c.JSON(&buf); err != nil {
+		t.Fatalf("Offset: while writing data: %v", err)
+	}
+	nc, err = timetree.ReadJSON(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("Offset: while reading data: %v", err)
+	}
+	if got := nc.Tree("extinct").Offset(); got != tr.Offset() {
+		t.Errorf("Offset: json: got %d, want %d", got, tr.Offset())
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("Prefix: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+	terms := d.Terms()
+
+	if _, err := d.Prefix(""); !errors.Is(err, timetree.ErrPrefix) {
+		t.Errorf("Prefix: got error %v, want %v", err, timetree.ErrPrefix)
+	}
+	if _, err := d.Prefix("a/b"); !errors.Is(err, timetree.ErrPrefix) {
+		t.Errorf("Prefix: got error %v, want %v", err, timetree.ErrPrefix)
+	}
+
+	names, err := d.Prefix("Source")
+	if err != nil {
+		t.Fatalf("Prefix: unexpected error: %v", err)
+	}
+	if len(names) != len(d.Taxa()) {
+		t.Errorf("Prefix: got %d names, want %d", len(names), len(d.Taxa()))
+	}
+	for _, tx := range terms {
+		want := "Source/" + strings.ToLower(tx)
+		if got := names[tx]; got != want {
+			t.Errorf("Prefix: taxon %q: got %q, want %q", tx, got, want)
+		}
+		id, ok := d.TaxNode(want)
+		if !ok {
+			t.Errorf("Prefix: taxon %q not found", want)
+			continue
+		}
+		if got := d.Taxon(id); got != want {
+			t.Errorf("Prefix: node %d: got %q, want %q", id, got, want)
+		}
+		if _, ok := d.TaxNode(tx); ok {
+			t.Errorf("Prefix: old name %q found", tx)
+		}
+	}
+}
+
+func TestUnit(t *testing.T) {
+	c, err := timetree.ReadTSV(strings.NewReader(dinoTree))
+	if err != nil {
+		t.Fatalf("Unit: unexpected error: %v", err)
+	}
+	d := c.Tree("dinos")
+
+	if u := d.Unit(); u != "" {
+		t.Errorf("Unit: got %q, want %q", u, "")
+	}
+
+	if u := d.AgeUnit(); u != timetree.Years {
+		t.Errorf("AgeUnit: got %q, want %q", u, timetree.Years)
+	}
+
+	d.SetUnit(timetree.CoalescentUnits)
+	if u := d.Unit(); u != timetree.CoalescentUnits {
+		t.Errorf("Unit: got %q, want %q", u, timetree.CoalescentUnits)
+	}
+	if u := d.AgeUnit(); u != timetree.CoalescentUnits {
+		t.Errorf("AgeUnit: got %q, want %q", u, timetree.CoalescentUnits)
+	}
+
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("Unit: unexpected error: %v", err)
+	}
+	nc, err := timetree.ReadTSV(&buf)
+	if err != nil {
+		t.Fatalf("Unit: unexpected error: %v", err)
+	}
+	if u := nc.Tree("dinos").Unit(); u != timetree.CoalescentUnits {
+		t.Errorf("Unit: after reading: got %q, want %q", u, timetree.CoalescentUnits)
+	}
+
+	d.SetUnit("")
+	if u := d.Unit(); u != "" {
+		t.Errorf("Unit: got %q, want %q", u, "")
+	}
+}
+
+func TestCollectionUnits(t *testing.T) {
+	c := timetree.NewCollection()
+	for _, tn := range []string{"a", "b", "c"} {
+		tr := timetree.New(tn, 10_000_000)
+		if tn == "c" {
+			tr.SetUnit(timetree.Generations)
+		}
+		if err := c.Add(tr); err != nil {
+			t.Fatalf("Units: unexpected error: %v", err)
+		}
+	}
+
+	want := []string{timetree.Generations, timetree.Years}
+	if got := c.Units(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Units: got %v, want %v", got, want)
+	}
+
+	warns := []string{"tree c: ages in generations, but tree a has ages in years"}
+	if got := c.Warnings(); !reflect.DeepEqual(got, warns) {
+		t.Errorf("Units: warnings: got %q, want %q", got, warns)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c := timetree.NewCollection()
+	tr := timetree.New("Tree", 10_000_000)
+	a, _ := tr.Add(0, 4_000_000, "A")
+	tr.Add(0, 10_000_000, "B")
+	if err := c.Add(tr); err != nil {
+		t.Fatalf("Snapshot: unexpected error: %v", err)
+	}
+
+	if err := c.Snapshot("tree", "Raw Import"); err != nil {
+		t.Fatalf("Snapshot: unexpected error: %v", err)
+	}
+	if err := c.Snapshot("tree", "raw import"); !errors.Is(err, timetree.ErrTreeRepeated) {
+		t.Errorf("Snapshot: repeated label: got error %v, want %v", err, timetree.ErrTreeRepeated)
+	}
+	if err := c.Snapshot("tree"+timetree.SnapshotSep+"raw import", "other"); !errors.Is(err, timetree.ErrSnapshot) {
+		t.Errorf("Snapshot: snapshot of snapshot: got error %v, want %v", err, timetree.ErrSnapshot)
+	}
+	if err := c.Snapshot("other", "raw import"); !errors.Is(err, timetree.ErrTreeNotFound) {
+		t.Errorf("Snapshot: missing tree: got error %v, want %v", err, timetree.ErrTreeNotFound)
+	}
+
+	names := []string{"Tree", "Tree@raw import"}
+	if got := c.Names(); !reflect.DeepEqual(got, names) {
+		t.Errorf("Snapshot: names: got %v, want %v", got, names)
+	}
+	labels := []string{"raw import"}
+	if got := c.Snapshots("tree"); !reflect.DeepEqual(got, labels) {
+		t.Errorf("Snapshot: labels: got %v, want %v", got, labels)
+	}
+
+	// changes in the tree should not modify the snapshot
+	if err := tr.Set(a, 2_000_000); err != nil {
+		t.Fatalf("Snapshot: unexpected error: %v", err)
+	}
+	s := c.Tree("tree@raw import")
+	if age := s.Age(a); age != 6_000_000 {
+		t.Errorf("Snapshot: age: got %d, want %d", age, 6_000_000)
+	}
+
+	if err := c.Revert("tree", "missing"); !errors.Is(err, timetree.ErrSnapshot) {
+		t.Errorf("Revert: missing label: got error %v, want %v", err, timetree.ErrSnapshot)
+	}
+	if err := c.Revert("tree", "raw import"); err != nil {
+		t.Fatalf("Revert: unexpected error: %v", err)
+	}
+	nt := c.Tree("tree")
+	if nt.Name() != "Tree" {
+		t.Errorf("Revert: name: got %q, want %q", nt.Name(), "Tree")
+	}
+	if age := nt.Age(a); age != 6_000_000 {
+		t.Errorf("Revert: age: got %d, want %d", age, 6_000_000)
+	}
+	if keys := nt.MetaKeys(nt.Root()); len(keys) != 0 {
+		t.Errorf("Revert: root metadata: got %v, want none", keys)
+	}
+	if got := c.Snapshots("tree"); !reflect.DeepEqual(got, labels) {
+		t.Errorf("Revert: labels: got %v, want %v", got, labels)
+	}
 }
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +24,26 @@ var headerFields = []string{
 	"taxon",
 }
 
+// Optional fields of a TSV file.
+const (
+	// orderField is used to store the order
+	// of the children of a node.
+	orderField = "order"
+
+	// offsetField is used to store the offset of the tree
+	// (in the row of the root node).
+	offsetField = "offset"
+)
+
+// IsReserved returns true if a field name
+// can not be used as a metadata field.
+func isReserved(key string) bool {
+	if key == "" || key == orderField || key == offsetField {
+		return true
+	}
+	return slices.Contains(headerFields, key)
+}
+
 // ReadTSV reads a phylogenetic tree
 // from a TSV file.
 //
@@ -35,8 +56,24 @@ var headerFields = []string{
 //	-age, the age of the node (in years)
 //	-taxon, the taxonomic name of the node
 //
+// Optionally,
+// the field "order" can be used to indicate
+// the position of a node among its siblings.
+// If defined,
+// the children of the node will be kept in that order
+// (as set by Tree.SetOrder).
+// The optional field "offset",
+// in the row of the root node,
+// indicates the age of the present for the tree
+// (in years, as set by Tree.SetOffset).
+// Any other field will be read as a metadata field
+// of the node.
+//
 // Parent nodes should be defined,
 // before any children node.
+// If the children of a node are defined
+// in the reverse of the order used by Format,
+// the node will be set as rotated.
 // Terminal nodes should have a unique taxonomic name.
 //
 // Here is an example file:
@@ -48,14 +85,30 @@ var headerFields = []string{
 //	dinosaurs	2	0	170000000
 //	dinosaurs	3	2	145000000	Ceratosaurus nasicornis
 //	dinosaurs	4	2	71000000	Carnotaurus sastrei
+//
+// Any returned error wraps either ErrSyntax,
+// ErrInvalidTree,
+// or ErrIO.
 func ReadTSV(r io.Reader) (*Collection, error) {
+	c, err := readTSV(r)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return c, nil
+}
+
+func readTSV(r io.Reader) (*Collection, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
 	tab := csv.NewReader(r)
 	tab.Comma = '\t'
 	tab.Comment = '#'
 
 	head, err := tab.Read()
 	if err != nil {
-		return nil, fmt.Errorf("while reading header: %v", err)
+		return nil, fmt.Errorf("while reading header: %w", err)
 	}
 	fields := make(map[string]int, len(head))
 	for i, h := range head {
@@ -64,9 +117,21 @@ func ReadTSV(r io.Reader) (*Collection, error) {
 	}
 	for _, h := range headerFields {
 		if _, ok := fields[h]; !ok {
-			return nil, fmt.Errorf("expecting field %q", h)
+			return nil, fmt.Errorf("%w: expecting field %q", ErrSyntax, h)
 		}
 	}
+	meta := make(map[string]int)
+	for i, h := range head {
+		h = metaKey(h)
+		if isReserved(h) {
+			continue
+		}
+		meta[h] = i
+	}
+	orderCol, hasOrder := fields[orderField]
+	order := make(map[*node]int)
+	offsetCol, hasOffset := fields[offsetField]
+	offset := make(map[*Tree]int64)
 
 	c := NewCollection()
 	for {
@@ -76,12 +141,13 @@ func ReadTSV(r io.Reader) (*Collection, error) {
 		}
 		ln, _ := tab.FieldPos(0)
 		if err != nil {
-			return nil, fmt.Errorf("on row %d: %v", ln, err)
+			return nil, fmt.Errorf("on row %d: %w", ln, err)
 		}
 
 		f := "tree"
 		name := strings.ToLower(strings.Join(strings.Fields(row[fields[f]]), " "))
 		if name == "" {
+			c.warns.add("on row %d: row without tree name ignored", ln)
 			continue
 		}
 
@@ -98,16 +164,16 @@ func ReadTSV(r io.Reader) (*Collection, error) {
 		f = "node"
 		id, err := strconv.Atoi(row[fields[f]])
 		if err != nil {
-			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+			return nil, fmt.Errorf("on row %d: field %q: %w", ln, f, err)
 		}
 		if _, dup := t.nodes[id]; dup {
-			return nil, fmt.Errorf("on row %d: field %q: node ID %d already used", ln, f, id)
+			return nil, fmt.Errorf("%w: on row %d: field %q: node ID %d already used", ErrInvalidTree, ln, f, id)
 		}
 
 		f = "parent"
 		pID, err := strconv.Atoi(row[fields[f]])
 		if err != nil {
-			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+			return nil, fmt.Errorf("on row %d: field %q: %w", ln, f, err)
 		}
 		var p *node
 		if pID >= 0 {
@@ -117,16 +183,16 @@ func ReadTSV(r io.Reader) (*Collection, error) {
 				return nil, fmt.Errorf("on row %d: field %q: %w: %d", ln, f, ErrAddNoParent, pID)
 			}
 		} else if t.root != nil {
-			return nil, fmt.Errorf("on row %d: field %q: root already defined", ln, f)
+			return nil, fmt.Errorf("%w: on row %d: field %q: root already defined", ErrInvalidTree, ln, f)
 		}
 
 		f = "age"
 		age, err := strconv.ParseInt(row[fields[f]], 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+			return nil, fmt.Errorf("on row %d: field %q: %w", ln, f, err)
 		}
 		if p != nil && p.age < age {
-			return nil, fmt.Errorf("on row %d: field %q: age should be less than %d", ln, f, p.age)
+			return nil, fmt.Errorf("on row %d: field %q: %w: age should be less than %d", ln, f, ErrOlderAge, p.age)
 		}
 
 		f = "taxon"
@@ -153,13 +219,50 @@ func ReadTSV(r io.Reader) (*Collection, error) {
 		if n.taxon != "" {
 			t.taxa[n.taxon] = n
 		}
+
+		if hasOrder && p != nil {
+			if v := strings.TrimSpace(row[orderCol]); v != "" {
+				o, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("on row %d: field %q: %w", ln, orderField, err)
+				}
+				order[n] = o
+				p.fixed = true
+			}
+		}
+
+		if hasOffset && p == nil {
+			if v := strings.TrimSpace(row[offsetCol]); v != "" {
+				o, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("on row %d: field %q: %w", ln, offsetField, err)
+				}
+				offset[t] = o
+			}
+		}
+
+		for k, i := range meta {
+			v := strings.TrimSpace(row[i])
+			if v == "" {
+				continue
+			}
+			if n.meta == nil {
+				n.meta = make(map[string]string)
+			}
+			n.meta[k] = v
+		}
 	}
 
 	for _, t := range c.trees {
+		t.root.setRotation()
+		t.fixOrder(order)
 		t.Format()
 		if err := t.Validate(); err != nil {
 			return nil, fmt.Errorf("tree %s: %w", t.name, err)
 		}
+		if err := t.SetOffset(offset[t]); err != nil {
+			return nil, fmt.Errorf("tree %s: %w", t.name, err)
+		}
 	}
 
 	return c, nil
@@ -167,6 +270,11 @@ func ReadTSV(r io.Reader) (*Collection, error) {
 
 // TSV encodes a collection of phylogenetic trees
 // into a TSV file.
+// If the order of the children of any node
+// was set with Tree.SetOrder,
+// the field "order" will be added to the file,
+// and if any tree has an offset,
+// the field "offset" will be added to the file.
 func (c *Collection) TSV(w io.Writer) error {
 	bw := bufio.NewWriter(w)
 	fmt.Fprintf(bw, "# time calibrated phylogenetic trees\n")
@@ -175,12 +283,23 @@ func (c *Collection) TSV(w io.Writer) error {
 	tab.Comma = '\t'
 	tab.UseCRLF = true
 
-	if err := tab.Write(headerFields); err != nil {
+	keys := c.metaKeys()
+	header := slices.Clip(headerFields)
+	withOrder := c.hasOrder()
+	if withOrder {
+		header = append(header, orderField)
+	}
+	withOffset := c.hasOffset()
+	if withOffset {
+		header = append(header, offsetField)
+	}
+	header = append(header, keys...)
+	if err := tab.Write(header); err != nil {
 		return fmt.Errorf("while writing header: %v", err)
 	}
 
 	for _, nm := range c.Names() {
-		if err := c.trees[nm].tsv(tab); err != nil {
+		if err := c.trees[nm].tsv(tab, withOrder, withOffset, keys); err != nil {
 			return fmt.Errorf("while writing data: %v", err)
 		}
 	}
@@ -195,35 +314,119 @@ func (c *Collection) TSV(w io.Writer) error {
 	return nil
 }
 
+// HasOffset returns true if any tree
+// in the collection
+// has an offset.
+func (c *Collection) hasOffset() bool {
+	for _, t := range c.trees {
+		if t.offset != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasOrder returns true if any node
+// in the collection
+// has a fixed order of its children.
+func (c *Collection) hasOrder() bool {
+	for _, t := range c.trees {
+		for _, n := range t.nodes {
+			if n.fixed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MetaKeys returns the names of all metadata fields
+// used in the trees of the collection.
+func (c *Collection) metaKeys() []string {
+	used := make(map[string]bool)
+	for _, t := range c.trees {
+		for _, n := range t.nodes {
+			for k := range n.meta {
+				used[k] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(used))
+	for k := range used {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// FixOrder sorts the children of the nodes
+// with a fixed order
+// using the given order values.
+// Nodes without an order value
+// are placed at the end.
+func (t *Tree) fixOrder(order map[*node]int) {
+	for _, n := range t.nodes {
+		if !n.fixed {
+			continue
+		}
+		n.rotated = false
+		slices.SortStableFunc(n.children, func(a, b *node) int {
+			oa, okA := order[a]
+			ob, okB := order[b]
+			if okA != okB {
+				if okA {
+					return -1
+				}
+				return 1
+			}
+			return oa - ob
+		})
+	}
+}
+
 // TSV encodes a phylogenetic tree
 // into a TSV file.
-func (t *Tree) tsv(w *csv.Writer) error {
-	if err := t.root.tsv(w, t.name); err != nil {
-		return err
+func (t *Tree) tsv(w *csv.Writer, withOrder, withOffset bool, keys []string) error {
+	for _, n := range t.preOrder(nil, t.root) {
+		if err := n.tsv(w, t, withOrder, withOffset, keys); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (n *node) tsv(w *csv.Writer, name string) error {
+func (n *node) tsv(w *csv.Writer, t *Tree, withOrder, withOffset bool, keys []string) error {
 	p := "-1"
 	if n.parent != nil {
 		p = strconv.Itoa(n.parent.id)
 	}
 	row := []string{
-		name,
+		t.name,
 		strconv.Itoa(n.id),
 		p,
 		strconv.FormatInt(n.age, 10),
 		n.taxon,
 	}
-	if err := w.Write(row); err != nil {
-		return err
+	if withOrder {
+		o := ""
+		if n.parent != nil && n.parent.fixed {
+			o = strconv.Itoa(slices.Index(n.parent.children, n))
+		}
+		row = append(row, o)
 	}
-
-	for _, c := range n.children {
-		if err := c.tsv(w, name); err != nil {
-			return err
+	if withOffset {
+		o := ""
+		if n.parent == nil {
+			o = strconv.FormatInt(t.offset, 10)
 		}
+		row = append(row, o)
+	}
+	for _, k := range keys {
+		row = append(row, n.meta[k])
+	}
+	if err := w.Write(row); err != nil {
+		return err
 	}
 	return nil
 }
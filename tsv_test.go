@@ -6,6 +6,8 @@ package timetree_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
@@ -67,3 +69,62 @@ func TestTSV(t *testing.T) {
 		}
 	}
 }
+
+func TestTSVMeta(t *testing.T) {
+	in := "((A[&posterior=1.0]:1.0,B:1.0):2.0[&height_95%_HPD={2.5,3.5},posterior=0.99],C:3.0);"
+	c, err := timetree.Newick(strings.NewReader(in), "annotated", 0)
+	if err != nil {
+		t.Fatalf("while processing newick tree: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+
+	nc, err := timetree.ReadTSV(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+
+	tr := c.Tree("annotated")
+	nt := nc.Tree("annotated")
+	for _, id := range tr.Nodes() {
+		keys := tr.MetaKeys(id)
+		if got := nt.MetaKeys(id); !reflect.DeepEqual(got, keys) {
+			t.Errorf("node %d: got keys %v, want %v", id, got, keys)
+		}
+		for _, k := range keys {
+			if got := nt.Meta(id, k); got != tr.Meta(id, k) {
+				t.Errorf("node %d: field %q: got %q, want %q", id, k, got, tr.Meta(id, k))
+			}
+		}
+	}
+}
+
+func TestTSVGzip(t *testing.T) {
+	var buf bytes.Buffer
+	z := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(z, dinoTree); err != nil {
+		t.Fatalf("gzip: unexpected error: %v", err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatalf("gzip: unexpected error: %v", err)
+	}
+
+	c, err := timetree.ReadTSV(&buf)
+	if err != nil {
+		t.Fatalf("gzip: unexpected error: %v", err)
+	}
+	want, _ := timetree.ReadTSV(strings.NewReader(dinoTree))
+	d := c.Tree("dinos")
+	if d == nil {
+		t.Fatalf("gzip: tree %q not found", "dinos")
+	}
+	w := want.Tree("dinos")
+	for _, id := range w.Nodes() {
+		if got, want := getNode(d, id), getNode(w, id); !reflect.DeepEqual(got, want) {
+			t.Errorf("gzip: node %d: got %v, want %v", id, got, want)
+		}
+	}
+}